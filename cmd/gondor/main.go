@@ -0,0 +1,66 @@
+// Command gondor provides tools for the operators of Gondor Transform servers.
+//
+//	gondor [-db path] history [--transform X] [--tenant N] [--type T] [--input V] [--since 24h] [--limit N] [--json]
+//
+// The history command queries the runs recorded in the default SQLite history
+// database (see the maltego/history package), or the one given with -db.
+package main
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/maxlandon/gondor/maltego"
+	"github.com/maxlandon/gondor/maltego/history"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: gondor [-db path] history [flags]\n\n")
+		flag.PrintDefaults()
+	}
+	db := flag.String("db", "", "path of the history database (default "+history.DefaultPath()+")")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch flag.Arg(0) {
+	case "history":
+		store, err := history.Open(*db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = maltego.RunHistoryCommand(store, flag.Args()[1:])
+		if err != nil && err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+}
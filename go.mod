@@ -1,3 +1,18 @@
 module github.com/maxlandon/gondor
 
 go 1.17
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.17
+	golang.org/x/crypto v0.14.0
+	google.golang.org/grpc v1.50.1
+	google.golang.org/protobuf v1.28.1
+)
+
+require (
+	github.com/golang/protobuf v1.5.2 // indirect
+	golang.org/x/net v0.11.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
+)
@@ -0,0 +1,126 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//
+// Entity Aliases ------------------------------------------------------------------------------
+//
+// The alias of an Entity is the name of its main property (holding its value), under which
+// users search for it in the Maltego client. Unless set explicitly with the Alias field, it is
+// derived from the last element of the Entity namespace and its type, like "examples.target".
+// Property aliases default to the namespaced property names (eg. "network.ip"), which are
+// unique within an Entity. Aliases are checked for collisions when registering Entities.
+
+// aliasInvalid - Characters that are not allowed in derived aliases.
+var aliasInvalid = regexp.MustCompile(`[^a-z0-9_.]+`)
+
+// alias - Returns the alias of the Entity, set by the user or derived from its type.
+func (e *Entity) alias() string {
+	if e.Alias != "" {
+		return e.Alias
+	}
+	return deriveAlias(lastNamespaceElement(e.Namespace), e.Type)
+}
+
+// deriveAlias - A deterministic alias from name elements: lowercased,
+// joined with dots, and stripped of any non alphanumeric character.
+func deriveAlias(elements ...string) string {
+	var parts []string
+	for _, element := range elements {
+		element = aliasInvalid.ReplaceAllString(strings.ToLower(element), "")
+		if element = strings.Trim(element, "."); element != "" {
+			parts = append(parts, element)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// lastNamespaceElement - The last element of a namespace, either a Go package path
+// (github.com/user/pkg gives pkg) or a Maltego namespace (maltego gives maltego).
+func lastNamespaceElement(namespace string) string {
+	if i := strings.LastIndex(namespace, "/"); i != -1 {
+		namespace = namespace[i+1:]
+	}
+	return namespace
+}
+
+// checkAliases - Verify that the alias of the Entity does not collide with any of
+// its property names, and that no two properties share the same alias.
+func (e *Entity) checkAliases() error {
+	alias := e.alias()
+	var problems []string
+
+	names := make([]string, 0, len(e.Properties))
+	for name := range e.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	owners := map[string]string{}
+	for _, name := range names {
+		property := e.Properties[name]
+		if strings.Contains(name, "#") || property.Value == goTypeSeparator {
+			continue
+		}
+		if name == alias {
+			problems = append(problems, fmt.Sprintf("property %q has the same name as the Entity alias: "+
+				"set the Entity Alias field (eg. %q)", name, deriveAlias(e.Namespace, e.Type)))
+		}
+		propertyAlias := property.Alias
+		if propertyAlias == "" {
+			propertyAlias = name
+		}
+		if owner, found := owners[propertyAlias]; found {
+			problems = append(problems, fmt.Sprintf("properties %q and %q share the alias %q: "+
+				"change the alias tag of one of them (eg. alias:%q)", owner, name, propertyAlias, name))
+			continue
+		}
+		owners[propertyAlias] = name
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Alias collisions in Entity %s: %s", e.Type, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// aliasRegistry - The aliases of all Entities of a Distribution, for detecting collisions.
+type aliasRegistry map[string]string
+
+// add - Register the alias of an Entity, unless another Entity already uses it.
+// The error suggests an alias derived from the full namespace of the Entity.
+func (r aliasRegistry) add(e *Entity) error {
+	id := strings.Join([]string{e.Namespace, e.Type}, ".")
+	alias := e.alias()
+
+	if owner, found := r[alias]; found && owner != id {
+		return fmt.Errorf("Entity %s alias %q is already used by Entity %s: set a distinct Alias on one of them (eg. %q)",
+			id, alias, owner, deriveAlias(strings.ReplaceAll(e.Namespace, "/", "."), e.Type))
+	}
+	r[alias] = id
+
+	return nil
+}
@@ -0,0 +1,334 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//
+// HTTP API Transforms - Specification & Instantiation ------------------------------------------
+//
+// Many Transforms do nothing more than calling a REST API with the input Entity value, and
+// mapping some fields of the JSON response into output Entities. The APITransform type lets
+// you declare such Transforms with configuration only, without writing any TransformFunc.
+
+// APITransform - The declaration of a Transform calling an HTTP API and
+// mapping its JSON response into output Entities. Example:
+//
+//	api := maltego.APITransform{
+//		URL:         "https://api.example.com/v1/domains/{{.Value | urlquery}}/subdomains",
+//		AuthSetting: "example.apikey",
+//		AuthHeader:  "Authorization",
+//		AuthPrefix:  "Bearer ",
+//		Results:     "data.subdomains",
+//		Outputs: []maltego.APIOutput{{
+//			Type:       "maltego.Domain",
+//			Value:      "name",
+//			Properties: map[string]string{"first.seen": "first_seen"},
+//		}},
+//	}
+//	transform := maltego.NewAPITransform("Subdomains", api)
+type APITransform struct {
+	Method  string            // The HTTP method to use, defaults to GET.
+	URL     string            // The URL, as a text/template (see APIRequest for the available data).
+	Body    string            // An optional body template, same as the URL.
+	Headers map[string]string // Additional headers to set on the request.
+
+	// Authentication
+	AuthSetting string // The name of the Transform setting holding the API key/token.
+	AuthHeader  string // The header in which to pass it, defaults to "Authorization".
+	AuthPrefix  string // An optional prefix to the token value (eg. "Bearer ").
+
+	// Response mapping
+	Results string      // The path to the list of results in the JSON response (eg. "data.items[*]")
+	Outputs []APIOutput // How to map each of the results into output Entities.
+
+	Client *http.Client // Defaults to a client with a 30 seconds timeout.
+}
+
+// APIOutput - Maps each result object of a JSON API response into an output Entity.
+// All paths are relative to the result object, with a notation close to JSONPath:
+// keys are separated with dots, array elements are accessed with [index] or [*].
+type APIOutput struct {
+	Type       string            // The fully qualified Maltego type of the Entity (eg. "maltego.Domain")
+	Value      string            // The path to the Entity value. Results without value are skipped.
+	Properties map[string]string // Property names, mapped to their path in the result.
+	Weight     int               // An optional weight for all the output Entities.
+}
+
+// APIRequest - The data available to the URL and Body templates of an APITransform.
+type APIRequest struct {
+	Value    string            // The input Entity value
+	Type     string            // The input Entity type
+	Entity   *Entity           // The input Entity, for accessing its properties.
+	Settings map[string]string // All settings sent along the request, or their default values.
+}
+
+// NewAPITransform - Create a new Transform calling an HTTP API, as declared by the
+// APITransform. If the API requires authentication and that you don't pass a setting
+// matching the AuthSetting name, a required (non-optional) one is added automatically.
+func NewAPITransform(name string, api APITransform, settings ...TransformSetting) Transform {
+	if api.AuthSetting != "" {
+		var found bool
+		for _, setting := range settings {
+			if setting.Name == api.AuthSetting {
+				found = true
+			}
+		}
+		if !found {
+			settings = append(settings, TransformSetting{
+				Name:        api.AuthSetting,
+				Description: "API key/token for " + name,
+				Default:     "",
+			})
+		}
+	}
+
+	return NewTransform(name, api.run, settings...)
+}
+
+//
+// HTTP API Transforms - Internal Implementation -----------------------------------------------
+//
+
+// run - The TransformFunc implementation of all APITransforms.
+func (api APITransform) run(t *Transform) (err error) {
+	req, err := api.newRequest(t)
+	if err != nil {
+		return t.Errorf("Failed to build API request: %s", err)
+	}
+
+	// Don't let the API call outlive the request itself: the request is
+	// canceled with the Transform context, and at its deadline, if any.
+	if deadline, ok := t.Deadline(); ok {
+		ctx, cancel := context.WithDeadline(req.Context(), deadline)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	client := api.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return t.Errorf("API request failed: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return t.Errorf("API returned status %s", resp.Status)
+	}
+
+	var document interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return t.Errorf("Failed to decode API response: %s", err)
+	}
+
+	// Map each result to zero or more entities.
+	results := jsonPath(document, api.Results)
+	t.Debugf("API returned %d results", len(results))
+
+	for _, result := range results {
+		for _, output := range api.Outputs {
+			entity, ok := output.toEntity(result)
+			if !ok {
+				continue
+			}
+			t.AddEntity(entity)
+		}
+	}
+
+	return
+}
+
+// newRequest - Render the URL/Body templates and build the HTTP request, with authentication.
+func (api APITransform) newRequest(t *Transform) (req *http.Request, err error) {
+	data := APIRequest{
+		Value:    t.request.Entity.Value,
+		Type:     t.request.Entity.Type,
+		Entity:   &t.request.Entity,
+		Settings: map[string]string{},
+	}
+	for _, setting := range t.Settings.settings {
+		data.Settings[setting.Name] = t.settingValue(setting.Name)
+	}
+	for _, setting := range t.request.Settings {
+		data.Settings[setting.Name] = t.settingValue(setting.Name)
+	}
+
+	url, err := renderAPITemplate("url", api.URL, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if api.Body != "" {
+		content, err := renderAPITemplate("body", api.Body, data)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(content)
+	}
+
+	method := api.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	if req, err = http.NewRequestWithContext(t.Context(), method, url, body); err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	for key, value := range api.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// Authentication
+	if api.AuthSetting != "" {
+		token := t.settingValue(api.AuthSetting)
+		if token == "" {
+			return nil, fmt.Errorf("no value for setting %s", api.AuthSetting)
+		}
+		header := api.AuthHeader
+		if header == "" {
+			header = "Authorization"
+		}
+		req.Header.Set(header, api.AuthPrefix+token)
+	}
+
+	return req, nil
+}
+
+// renderAPITemplate - Execute a text/template with the API request data.
+func renderAPITemplate(name, text string, data APIRequest) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// toEntity - Create an output Entity out of a single API result.
+func (o APIOutput) toEntity(result interface{}) (e Entity, ok bool) {
+	values := jsonPath(result, o.Value)
+	if len(values) == 0 || jsonString(values[0]) == "" {
+		return e, false
+	}
+
+	e = NewForeignEntity(o.Type, jsonString(values[0]))
+	e.Weight = o.Weight
+
+	for name, path := range o.Properties {
+		values := jsonPath(result, path)
+		if len(values) == 0 {
+			continue
+		}
+		e.AddProperty(Field{
+			Name:         name,
+			Display:      name,
+			MatchingRule: MatchLoose,
+			Value:        jsonString(values[0]),
+		})
+	}
+
+	return e, true
+}
+
+// jsonPath - Returns all the values found at path in a decoded JSON document.
+// Keys are separated with dots, and array elements are accessed either with
+// their [index] (or .index) or all at once with [*] (or .*). An empty path (or "$")
+// returns the document itself, or all of its elements if it's an array.
+func jsonPath(document interface{}, path string) (values []interface{}) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+
+	current := []interface{}{document}
+
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+		var next []interface{}
+		for _, node := range current {
+			switch value := node.(type) {
+			case map[string]interface{}:
+				if key == "*" {
+					for _, child := range value {
+						next = append(next, child)
+					}
+				} else if child, found := value[key]; found {
+					next = append(next, child)
+				}
+			case []interface{}:
+				if key == "*" {
+					next = append(next, value...)
+				} else if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < len(value) {
+					next = append(next, value[index])
+				}
+			}
+		}
+		current = next
+	}
+
+	// Results lists are always flattened
+	for _, node := range current {
+		if list, isList := node.([]interface{}); isList {
+			values = append(values, list...)
+		} else if node != nil {
+			values = append(values, node)
+		}
+	}
+
+	return
+}
+
+// jsonString - Returns the string representation of a decoded JSON value.
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,294 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobsPath - The URL path under which a TransformServer serves the status
+// and results of the jobs of asynchronous Transforms, as JSON documents.
+const JobsPath = "/jobs/"
+
+// JobResultsTransform - The name of the Transform fetching the results of a Job: it is
+// registered along with the first asynchronous Transform, and runs on Job Entities.
+const JobResultsTransform = "FetchJobResults"
+
+// The status of a Job.
+const (
+	JobRunning = "running" // The Transform is still running.
+	JobDone    = "done"    // The Transform has run successfully, its results can be fetched.
+	JobFailed  = "failed"  // The Transform has failed, its exceptions can be fetched.
+)
+
+// JobTTL - How long a TransformServer keeps the results of a finished Job.
+var JobTTL = 1 * time.Hour
+
+// Job - The placeholder Entity returned by asynchronous Transforms (see SetAsync()), while
+// they run in the background. Running the JobResultsTransform on it returns their results,
+// once they are done, or the Job itself with its status, if they are still running.
+type Job struct {
+	ID        string `display:"Job ID" strict:"yes"`
+	Transform string `display:"Transform"`
+	Status    string `display:"Status"`
+}
+
+// AsEntity - A Job is a valid Maltego Entity, of type gondor.Job.
+func (j *Job) AsEntity() Entity {
+	e := NewEntity(j)
+	e.Namespace = "gondor"
+	e.Value = j.ID
+	e.DisplayName = "Job"
+	e.Description = "A Transform running in the background on a Transform server."
+	return e
+}
+
+// SetAsync - Run the Transform in the background, for those taking minutes (port scans,
+// crawls, etc): requests are answered immediately with a Job Entity, on which analysts run
+// the JobResultsTransform to get the results once the run is over. Background runs are only
+// limited by the given timeout (if not zero) and the server Timeout, not by the client one.
+// Call this before registering the Transform, so that the JobResultsTransform is registered.
+func (t *Transform) SetAsync(timeout time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.async = true
+	t.asyncTimeout = timeout
+}
+
+// startJob - Run the instance of an asynchronous Transform in the background, on a copy
+// of the request, and answer the latter with the Job Entity tracking the run.
+func (ts *TransformServer) startJob(transform, instance *Transform, request Message) error {
+	run := transform.newInstanceFromRequest(request, ts)
+	run.tenant = instance.tenant
+	run.principal = instance.principal
+	run.requestID = instance.requestID
+	run.deadline = time.Time{}
+	if ts.Timeout > 0 {
+		run.deadline = time.Now().Add(ts.Timeout)
+	}
+	if run.asyncTimeout > 0 && (ts.Timeout == 0 || run.asyncTimeout < ts.Timeout) {
+		run.deadline = time.Now().Add(run.asyncTimeout)
+	}
+
+	// The server waits for the job when shutting down, like for other runs.
+	job := ts.jobs.start(transform.Name, instance.tenant)
+	ctx, done := ts.drain.join(context.Background())
+	go func() {
+		defer done()
+		runErr := ts.runInstance(ctx, transform, run)
+		ts.jobs.finish(job.ID, run, runErr)
+	}()
+
+	// The response is a placeholder, which must not be cached.
+	instance.mutex.Lock()
+	instance.cacheKey = ""
+	instance.mutex.Unlock()
+	instance.Infof("Transform %s is running in the background: run %s on the Job to get its results",
+		transform.Name, JobResultsTransform)
+	return instance.AddEntity(&job)
+}
+
+// registerJobResults - Register the JobResultsTransform, if not already.
+// The server must be locked by the caller.
+func (ts *TransformServer) registerJobResults() {
+	path := "/" + JobResultsTransform
+	if _, found := ts.Transforms[path]; found {
+		return
+	}
+	results := NewTransform(JobResultsTransform, func(t *Transform) error {
+		return ts.fetchJobResults(t)
+	})
+	results.Description = "Fetch the results of a Transform running in the background on the server."
+	results.input = &Job{}
+	results.path = path
+	ts.Transforms[path] = &results
+	ts.route(path)
+	ts.Distribution.RegisterTransform(results)
+	ts.Distribution.RegisterEntity(&Job{})
+}
+
+// fetchJobResults - The implementation of the JobResultsTransform: returns the results of
+// the Job given as input if it is over, or the Job with its status if it is still running.
+func (ts *TransformServer) fetchJobResults(t *Transform) error {
+	job, found := ts.jobs.get(t.InputValue(), t.tenant)
+	if !found {
+		return t.Errorf("Job %s not found: it has expired, or the server has restarted", t.InputValue())
+	}
+	if job.status == JobRunning {
+		t.Infof("Transform %s is still running (for %s), retry later",
+			job.transform, time.Since(job.started).Round(time.Second))
+		return t.AddEntity(&Job{ID: job.id, Transform: job.transform, Status: job.status})
+	}
+
+	t.mutex.Lock()
+	t.entities = append(t.entities, job.entities...)
+	t.messages = append(t.messages, job.messages...)
+	t.exceptions = append(t.exceptions, job.exceptions...)
+	t.mutex.Unlock()
+	return job.err
+}
+
+// jobHandler - Serve the status of a Job, and its results when it is over, as JSON. Clients
+// are authenticated like for running Transforms, and only see the Jobs of their tenant (by
+// API key, or under the tenant path prefix), of Transforms that their ClientRules allow.
+func (ts *TransformServer) jobHandler(w http.ResponseWriter, r *http.Request) {
+	r, ok := ts.authenticate(w, r)
+	if !ok {
+		return
+	}
+	tenant, path, err := ts.findTenant(r.URL.Path, r.Header.Get(TenantKeyHeader), Message{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	job, found := ts.jobs.get(strings.TrimPrefix(path, JobsPath), tenant)
+	if !found || !ts.clientAllowed(tenantPrincipal(requestPrincipal(r), tenant), job.transform) {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := jobStatus{
+		ID:         job.id,
+		Transform:  job.transform,
+		Status:     job.status,
+		Started:    job.started,
+		Entities:   job.entities,
+		Messages:   job.messages,
+		Exceptions: job.exceptions,
+	}
+	if !job.finished.IsZero() {
+		status.Finished = &job.finished
+	}
+	if job.err != nil {
+		status.Error = job.err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// jobStatus - The JSON document describing a Job.
+type jobStatus struct {
+	ID         string      `json:"id"`
+	Transform  string      `json:"transform"`
+	Status     string      `json:"status"`
+	Started    time.Time   `json:"started"`
+	Finished   *time.Time  `json:"finished,omitempty"`
+	Entities   []Entity    `json:"entities,omitempty"`
+	Messages   []MessageUI `json:"messages,omitempty"`
+	Exceptions []Exception `json:"exceptions,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// jobStore - The Jobs of a TransformServer, keyed by their identifier.
+type jobStore struct {
+	jobs  map[string]*job
+	mutex *sync.RWMutex
+}
+
+// job - A background run of an asynchronous Transform, and its results once it is over.
+type job struct {
+	id         string
+	transform  string
+	tenant     *Tenant
+	status     string
+	started    time.Time
+	finished   time.Time
+	entities   []Entity
+	messages   []MessageUI
+	exceptions []Exception
+	err        error
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{
+		jobs:  map[string]*job{},
+		mutex: &sync.RWMutex{},
+	}
+}
+
+// start - Track a new running Job. Jobs finished for longer than JobTTL are removed.
+func (s *jobStore) start(transform string, tenant *Tenant) Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for id, job := range s.jobs {
+		if job.status != JobRunning && now.Sub(job.finished) > JobTTL {
+			delete(s.jobs, id)
+		}
+	}
+
+	j := &job{
+		id:        newJobID(),
+		transform: transform,
+		tenant:    tenant,
+		status:    JobRunning,
+		started:   now,
+	}
+	s.jobs[j.id] = j
+	return Job{ID: j.id, Transform: transform, Status: JobRunning}
+}
+
+// newJobID - Generate a random Job identifier, long enough not to be guessed.
+func newJobID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// finish - Store the results of a Job, from the instance that ran in the background.
+func (s *jobStore) finish(id string, run *Transform, runErr error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	j, found := s.jobs[id]
+	if !found {
+		return
+	}
+	j.finished = time.Now()
+	j.entities = run.Entities()
+	j.messages = run.Messages()
+	j.exceptions = run.Exceptions()
+	j.err = runErr
+	j.status = JobDone
+	if runErr != nil {
+		j.status = JobFailed
+	}
+}
+
+// get - Returns a copy of a Job, if it exists and belongs to the tenant (if any).
+func (s *jobStore) get(id string, tenant *Tenant) (j job, found bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	stored, found := s.jobs[id]
+	if !found || (tenant != nil && stored.tenant != tenant) {
+		return job{}, false
+	}
+	if stored.status != JobRunning && time.Since(stored.finished) > JobTTL {
+		return job{}, false
+	}
+	return *stored, true
+}
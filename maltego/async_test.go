@@ -0,0 +1,85 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJobHandlerAccess(t *testing.T) {
+	ts := NewTransformServer(nil)
+	ts.SetBasicAuth(map[string]string{"alice": "secret"})
+	ts.AddTenant(&Tenant{Name: "acme", APIKeys: []string{"acme-key"}})
+	ts.AddTenant(&Tenant{Name: "globex", PathPrefix: "/globex", APIKeys: []string{"globex-key"}})
+	scan := NewTransform("Scan", func(t *Transform) error {
+		return t.AddEntity(NewForeignEntity("maltego.Port", "443"))
+	})
+	scan.SetAsync(0)
+	ts.RegisterTransform(&scan)
+
+	headers := basicAuth("alice", "secret")
+	headers[TenantKeyHeader] = "acme-key"
+	_, response := serveAuthenticated(ts, "/Scan", "", headers)
+	if len(response.Entities) != 1 || response.Entities[0].Type != "gondor.Job" {
+		t.Fatalf("Expected a Job Entity, got %+v", response)
+	}
+	id := response.Entities[0].Value
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if job, _ := ts.jobs.get(id, nil); job.status != JobRunning {
+			break
+		}
+	}
+
+	tests := []struct {
+		name, path string
+		headers    map[string]string
+		code       int
+	}{
+		{"no credentials", JobsPath + id, map[string]string{TenantKeyHeader: "acme-key"}, http.StatusUnauthorized},
+		{"no tenant", JobsPath + id, basicAuth("alice", "secret"), http.StatusUnauthorized},
+		{"other tenant key", JobsPath + id, map[string]string{"Authorization": headers["Authorization"], TenantKeyHeader: "globex-key"}, http.StatusNotFound},
+		{"other tenant prefix", "/globex" + JobsPath + id, basicAuth("alice", "secret"), http.StatusNotFound},
+		{"owner", JobsPath + id, headers, http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		ts.mux.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Job requested with %s: got status %d, want %d", test.name, w.Code, test.code)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var status struct {
+			Status   string            `json:"status"`
+			Entities []json.RawMessage `json:"entities"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || status.Status != JobDone || len(status.Entities) != 1 {
+			t.Errorf("Unexpected Job status %s (%v)", w.Body.String(), err)
+		}
+	}
+}
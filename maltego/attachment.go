@@ -0,0 +1,185 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attachment size limits
+const (
+	// MaxEmbeddedAttachmentSize - The maximum size of a file embedded (base64-encoded)
+	// in an Entity label: larger ones would slow down the Maltego client considerably.
+	MaxEmbeddedAttachmentSize = 256 << 10
+
+	// MaxServedAttachmentSize - The maximum size of a file served by the Transform server.
+	MaxServedAttachmentSize = 10 << 20
+)
+
+// AttachmentsPath - The URL path under which a TransformServer serves attachments.
+const AttachmentsPath = "/attachments/"
+
+// AttachmentTTL - How long a TransformServer keeps serving an attachment.
+var AttachmentTTL = 1 * time.Hour
+
+// AttachImage - Display an image (screenshot, favicon, etc) in a label of the Entity,
+// embedded as a base64 data URI. The image type is detected from its content, and
+// the image must not be larger than MaxEmbeddedAttachmentSize.
+func (e *Entity) AttachImage(name string, data []byte) error {
+	uri, contentType, err := embedAttachment(data)
+	if err != nil {
+		return fmt.Errorf("Cannot attach image %s: %s", name, err)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return fmt.Errorf("Cannot attach image %s: content type is %s", name, contentType)
+	}
+	e.AddLabel(name, fmt.Sprintf(`<img src="%s" alt="%s"/>`, uri, html.EscapeString(name)))
+	return nil
+}
+
+// AttachFile - Add a file to a label of the Entity, as a link embedding the file content
+// as a base64 data URI. The file must not be larger than MaxEmbeddedAttachmentSize: use
+// Transform.Attach() for larger files, which can be served by the Transform server.
+func (e *Entity) AttachFile(name string, data []byte) error {
+	uri, _, err := embedAttachment(data)
+	if err != nil {
+		return fmt.Errorf("Cannot attach file %s: %s", name, err)
+	}
+	e.AddLabel(name, attachmentLink(name, uri, len(data)))
+	return nil
+}
+
+// Attach - Attach a file or an image to an output Entity: small files are embedded
+// in a label (see AttachImage() and AttachFile()), while larger ones are served by
+// the Transform server (up to MaxServedAttachmentSize) for AttachmentTTL, and linked
+// from the label. The latter requires the public URL of the server to be known.
+func (t *Transform) Attach(e *Entity, name string, data []byte) error {
+	if len(data) <= MaxEmbeddedAttachmentSize {
+		if strings.HasPrefix(http.DetectContentType(data), "image/") {
+			return e.AttachImage(name, data)
+		}
+		return e.AttachFile(name, data)
+	}
+	base := t.publicURL()
+	if t.server == nil || base == "" {
+		return fmt.Errorf("Cannot attach %s: %d bytes is too large to embed (max %d), and the server URL is unknown",
+			name, len(data), MaxEmbeddedAttachmentSize)
+	}
+
+	url, err := t.server.attachments.add(base, name, data)
+	if err != nil {
+		return fmt.Errorf("Cannot attach %s: %s", name, err)
+	}
+	e.AddLabel(name, attachmentLink(name, url, len(data)))
+	return nil
+}
+
+// embedAttachment - Check the size of a file, and return it as a data URI.
+func embedAttachment(data []byte) (uri, contentType string, err error) {
+	if len(data) == 0 {
+		return "", "", fmt.Errorf("empty content")
+	}
+	if len(data) > MaxEmbeddedAttachmentSize {
+		return "", "", fmt.Errorf("%d bytes is too large (max %d)", len(data), MaxEmbeddedAttachmentSize)
+	}
+	contentType = http.DetectContentType(data)
+	uri = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	return uri, contentType, nil
+}
+
+// attachmentLink - The HTML link to an attachment, for a label.
+func attachmentLink(name, url string, size int) string {
+	return fmt.Sprintf(`<a href="%s" download="%s">%s</a> (%d bytes)`,
+		url, html.EscapeString(name), html.EscapeString(name), size)
+}
+
+// attachmentStore - The attachments served by a TransformServer, keyed by the hash of their content.
+type attachmentStore struct {
+	files map[string]attachment
+	mutex *sync.RWMutex
+}
+
+// attachment - A file served by the TransformServer until it expires.
+type attachment struct {
+	name        string
+	contentType string
+	data        []byte
+	expires     time.Time
+}
+
+func newAttachmentStore() *attachmentStore {
+	return &attachmentStore{
+		files: map[string]attachment{},
+		mutex: &sync.RWMutex{},
+	}
+}
+
+// add - Store a file and return its URL on the server. Expired files are removed.
+func (s *attachmentStore) add(serverURL, name string, data []byte) (url string, err error) {
+	if len(data) > MaxServedAttachmentSize {
+		return "", fmt.Errorf("%d bytes is too large (max %d)", len(data), MaxServedAttachmentSize)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for id, file := range s.files {
+		if now.After(file.expires) {
+			delete(s.files, id)
+		}
+	}
+
+	hash := sha256.Sum256(data)
+	id := hex.EncodeToString(hash[:])
+	s.files[id] = attachment{
+		name:        name,
+		contentType: http.DetectContentType(data),
+		data:        data,
+		expires:     now.Add(AttachmentTTL),
+	}
+
+	return strings.TrimSuffix(serverURL, "/") + AttachmentsPath + id, nil
+}
+
+// attachmentHandler - Serve the attachments of the TransformServer.
+func (ts *TransformServer) attachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, AttachmentsPath)
+
+	ts.attachments.mutex.RLock()
+	file, found := ts.attachments.files[id]
+	ts.attachments.mutex.RUnlock()
+
+	if !found || time.Now().After(file.expires) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", file.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", file.name))
+	w.Write(file.data)
+}
@@ -18,6 +18,13 @@ package maltego
    along with this program.  If not, see <https://www.gnu.org/licenses/>.
 */
 
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+)
+
 // AuthenticationType - The Authentication required to access and run a Server's transforms.
 type AuthenticationType string
 
@@ -26,3 +33,98 @@ const (
 	AuthenticationMAC     AuthenticationType = "mac"
 	AuthenticationLicense AuthenticationType = "license"
 )
+
+// Principal - The identity on behalf of which a Transform request runs, as established
+// by whatever authenticated it: an API key, a TLS client certificate, OAuth claims, etc.
+// Transforms access it with Transform.Principal(), for per-user decisions like filtering
+// their results or attributing their actions in audit logs.
+type Principal struct {
+	ID     string            // A unique identifier: user name, key ID, certificate subject, etc.
+	Method string            // How the principal was authenticated (eg. "apikey", "mtls", "oauth")
+	Tenant string            // The name of the tenant the principal belongs to, if any.
+	Claims map[string]string // Any other attributes: email, roles, groups, scopes, etc.
+
+	// The CN and SANs of the verified TLS client certificate of the request, if any, kept
+	// whatever the authentication method, for the ClientRules of the server to apply.
+	certificate []string
+}
+
+// Principal authentication methods set by the server itself.
+const (
+	PrincipalAPIKey = "apikey"
+	PrincipalMTLS   = "mtls"
+)
+
+// Claim - Returns the value of a claim of the principal, or an empty
+// string if it has no such claim or if the principal is nil.
+func (p *Principal) Claim(name string) string {
+	if p == nil {
+		return ""
+	}
+	return p.Claims[name]
+}
+
+// principalKey - The key of a Principal stored in a request context.
+type principalKey struct{}
+
+// WithPrincipal - Returns a copy of an HTTP request carrying the principal that
+// authenticated it. Use it in your authentication middleware, wrapping the server
+// handler, for the principal to be passed to the Transform run by the request.
+func WithPrincipal(r *http.Request, principal *Principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// PrincipalFromContext - Returns the principal stored in a context with WithPrincipal(), if any.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// requestPrincipal - Returns the principal set on the HTTP request by an authentication
+// middleware or, failing that, the identity of the verified TLS client certificate.
+// In both cases, the principal carries the identities of the certificate, if any.
+func requestPrincipal(r *http.Request) *Principal {
+	var cert *x509.Certificate
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cert = r.TLS.VerifiedChains[0][0]
+	}
+
+	principal := PrincipalFromContext(r.Context())
+	switch {
+	case principal != nil && cert != nil:
+		withCertificate := *principal
+		withCertificate.certificate = certificateIdentities(cert)
+		return &withCertificate
+	case principal != nil:
+		return principal
+	case cert == nil:
+		return nil
+	}
+
+	return &Principal{
+		ID:     cert.Subject.CommonName,
+		Method: PrincipalMTLS,
+		Claims: map[string]string{
+			"subject": cert.Subject.String(),
+			"issuer":  cert.Issuer.String(),
+			"serial":  cert.SerialNumber.String(),
+			ClaimSAN:  strings.Join(certificateNames(cert), ","),
+		},
+		certificate: certificateIdentities(cert),
+	}
+}
+
+// tenantPrincipal - Returns the principal of a request run by a tenant: the principal
+// established by the authentication (with its tenant set), or the tenant API key itself.
+func tenantPrincipal(principal *Principal, tenant *Tenant) *Principal {
+	switch {
+	case tenant == nil:
+		return principal
+	case principal == nil:
+		return &Principal{ID: tenant.Name, Method: PrincipalAPIKey, Tenant: tenant.Name}
+	default:
+		withTenant := *principal
+		withTenant.Tenant = tenant.Name
+		return &withTenant
+	}
+}
@@ -0,0 +1,162 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newAuthServer - Returns a server with a Lookup and an Export Transform,
+// both returning the input Entity, and some authentication to test.
+func newAuthServer(setup func(ts *TransformServer)) *TransformServer {
+	ts := NewTransformServer(nil)
+	for _, name := range []string{"Lookup", "Export"} {
+		transform := NewTransform(name, func(t *Transform) error {
+			return t.AddEntity(NewForeignEntity("maltego.Domain", "example.com"))
+		})
+		ts.RegisterTransform(&transform)
+	}
+	setup(ts)
+	return ts
+}
+
+// serveAuthenticated - Send a request to the Transform at path, with a verified client
+// certificate if cn is not empty, and with the given headers. Returns the status code,
+// and the response if the request was answered with a Transform response.
+func serveAuthenticated(ts *TransformServer, path, cn string, headers map[string]string) (int, testResponse) {
+	r := newTransformRequest(path, 12)
+	if cn != "" {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	ts.mux.ServeHTTP(w, r)
+
+	var response testResponse
+	xml.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+// basicAuth - The Authorization header of HTTP Basic credentials.
+func basicAuth(user, password string) map[string]string {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.SetBasicAuth(user, password)
+	return map[string]string{"Authorization": r.Header.Get("Authorization")}
+}
+
+func TestClientRulesWithBasicAuth(t *testing.T) {
+	ts := newAuthServer(func(ts *TransformServer) {
+		ts.SetBasicAuth(map[string]string{"alice": "secret"})
+		ts.ClientRules = []ClientRule{{Identity: "analyst.example.com", Transforms: []string{"Lookup"}}}
+	})
+
+	if code, _ := serveAuthenticated(ts, "/Lookup", "analyst.example.com", nil); code != http.StatusUnauthorized {
+		t.Errorf("Request without credentials: got status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := serveAuthenticated(ts, "/Lookup", "analyst.example.com", basicAuth("alice", "wrong")); code != http.StatusUnauthorized {
+		t.Errorf("Request with invalid credentials: got status %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		path, cn string
+		allowed  bool
+	}{
+		{"/Lookup", "analyst.example.com", true},
+		{"/Export", "analyst.example.com", false},
+		{"/Lookup", "intern.example.com", false},
+	}
+	for _, test := range tests {
+		code, response := serveAuthenticated(ts, test.path, test.cn, basicAuth("alice", "secret"))
+		if code != http.StatusOK {
+			t.Errorf("%s as %s: got status %d", test.path, test.cn, code)
+			continue
+		}
+		if allowed := len(response.Exceptions) == 0 && len(response.Entities) == 1; allowed != test.allowed {
+			t.Errorf("%s as %s: allowed %t, want %t (%q)", test.path, test.cn, allowed, test.allowed, response.Exceptions)
+		}
+		if !test.allowed && (len(response.Exceptions) != 1 || !strings.Contains(response.Exceptions[0], "not available to client alice")) {
+			t.Errorf("%s as %s: unexpected exceptions %q", test.path, test.cn, response.Exceptions)
+		}
+	}
+}
+
+func TestClientRulesWithCertificates(t *testing.T) {
+	ts := newAuthServer(func(ts *TransformServer) {
+		ts.ClientRules = []ClientRule{{Identity: "analyst.example.com"}}
+	})
+
+	if _, response := serveAuthenticated(ts, "/Export", "analyst.example.com", nil); len(response.Exceptions) != 0 {
+		t.Errorf("Certificate matching a rule without Transforms should run all of them: %q", response.Exceptions)
+	}
+	if _, response := serveAuthenticated(ts, "/Export", "intern.example.com", nil); len(response.Exceptions) != 1 {
+		t.Errorf("Certificate matching no rule should not run any Transform")
+	}
+}
+
+func TestTenants(t *testing.T) {
+	acme := &Tenant{Name: "acme", APIKeys: []string{"acme-key"}, Transforms: []string{"Lookup"}}
+	globex := &Tenant{Name: "globex", PathPrefix: "/globex"}
+	ts := newAuthServer(func(ts *TransformServer) {
+		ts.AddTenant(acme)
+		ts.AddTenant(globex)
+	})
+
+	tests := []struct {
+		path, key string
+		code      int
+		allowed   bool
+	}{
+		{"/Lookup", "", http.StatusUnauthorized, false},
+		{"/Lookup", "other-key", http.StatusUnauthorized, false},
+		{"/Lookup", "acme-key", http.StatusOK, true},
+		{"/Export", "acme-key", http.StatusOK, false},
+		{"/globex/Export", "", http.StatusOK, true},
+	}
+	for _, test := range tests {
+		code, response := serveAuthenticated(ts, test.path, "", map[string]string{TenantKeyHeader: test.key})
+		if code != test.code {
+			t.Errorf("%s with key %q: got status %d, want %d", test.path, test.key, code, test.code)
+			continue
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		if allowed := len(response.Exceptions) == 0; allowed != test.allowed {
+			t.Errorf("%s with key %q: allowed %t, want %t (%q)", test.path, test.key, allowed, test.allowed, response.Exceptions)
+		}
+	}
+
+	if usage := acme.Usage(); usage["Lookup"].Requests != 1 || usage["Export"].Rejected != 1 {
+		t.Errorf("Unexpected usage of tenant acme: %+v", usage)
+	}
+	if usage := globex.Usage(); usage["Export"].Requests != 1 || usage["Export"].Entities != 1 {
+		t.Errorf("Unexpected usage of tenant globex: %+v", usage)
+	}
+}
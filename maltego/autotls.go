@@ -0,0 +1,111 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// AutoTLS - Obtain and renew the TLS certificates of the server automatically, from an ACME
+// certificate authority (Let's Encrypt by default), so that hosting a public Transform server
+// does not require any certificate plumbing. Set it as the server AutoTLS, and start it with
+// ListenAndServeTLS() without any TLS configuration.
+//
+// The authority must be able to reach the server for validating its host names: either on
+// port 443 (set the server Port accordingly), or on port 80 with an HTTPAddress (":80").
+// By using AutoTLS, you accept the terms of service of the certificate authority.
+type AutoTLS struct {
+	Hosts        []string                                     // The host names for which certificates are obtained.
+	HostPolicy   func(ctx context.Context, host string) error // Which host names are allowed, if not only the Hosts.
+	CacheDir     string                                       // Where certificates are kept across restarts (see DefaultAutoTLSCache()).
+	Email        string                                       // The contact address of the certificate authority account, if any.
+	DirectoryURL string                                       // The ACME directory of the certificate authority, if not Let's Encrypt.
+	HTTPAddress  string                                       // If set, the address on which HTTP challenges are answered (eg. ":80").
+}
+
+// DefaultAutoTLSCache - Returns the directory in which certificates are kept when the AutoTLS
+// has no CacheDir: "gondor/autocert" in the cache directory of the user (see os.UserCacheDir()).
+func DefaultAutoTLSCache() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gondor", "autocert"), nil
+}
+
+// manager - Returns the certificate manager of the configuration. Certificates are only
+// obtained for allowed host names: without Hosts nor HostPolicy, no host name would be.
+func (a *AutoTLS) manager() (*autocert.Manager, error) {
+	policy := a.HostPolicy
+	if policy == nil {
+		if len(a.Hosts) == 0 {
+			return nil, errors.New("No host names configured for automatic TLS certificates")
+		}
+		policy = autocert.HostWhitelist(a.Hosts...)
+	}
+	dir := a.CacheDir
+	if dir == "" {
+		var err error
+		if dir, err = DefaultAutoTLSCache(); err != nil {
+			return nil, fmt.Errorf("No cache directory for automatic TLS certificates: %s", err)
+		}
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(dir),
+		HostPolicy: policy,
+		Email:      a.Email,
+	}
+	if a.DirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: a.DirectoryURL}
+	}
+	return manager, nil
+}
+
+// autoTLSConfig - Returns the TLS configuration obtaining the certificates of the server
+// from its AutoTLS, and starts answering HTTP challenges, if it has an HTTPAddress.
+func (ts *TransformServer) autoTLSConfig() (*tls.Config, error) {
+	manager, err := ts.AutoTLS.manager()
+	if err != nil {
+		return nil, err
+	}
+	if ts.AutoTLS.HTTPAddress != "" {
+		listener, err := net.Listen("tcp", ts.AutoTLS.HTTPAddress)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to listen for HTTP challenges on %s: %s", ts.AutoTLS.HTTPAddress, err)
+		}
+		challenges := &http.Server{Handler: manager.HTTPHandler(nil)}
+		ts.mutex.Lock()
+		ts.challenges = challenges
+		ts.mutex.Unlock()
+		go challenges.Serve(listener)
+	}
+	return manager.TLSConfig(), nil
+}
@@ -0,0 +1,204 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// Badge - A small status badge (a text on a colored background), rendered as a PNG image
+// embedded in a data URI, for use as an image overlay: transforms can visually flag their
+// output Entities (eg. "MALICIOUS") without hosting any icon file. Example:
+//
+//	entity.AddBadge(maltego.OverlayNorthWest, maltego.Badge{Text: "malicious"})
+//
+// Texts are drawn uppercase, with a builtin pixel font covering letters,
+// digits and a few punctuation characters: others are drawn as '?'.
+type Badge struct {
+	Text       string // The text of the badge, keep it short.
+	Background string // An RGB code (eg. #d32f2f), defaults to red.
+	Foreground string // An RGB code (eg. #ffffff), defaults to white.
+	Scale      int    // The size of a font pixel, in image pixels (defaults to 2).
+}
+
+// Default badge colors
+const (
+	BadgeRed    = "#d32f2f"
+	BadgeOrange = "#f57c00"
+	BadgeGreen  = "#388e3c"
+	BadgeBlue   = "#1976d2"
+	BadgeGrey   = "#616161"
+	BadgeWhite  = "#ffffff"
+)
+
+// DataURI - Render the badge and return it as a base64 PNG data URI,
+// which can be passed as the value of an image overlay.
+func (b Badge) DataURI() (uri string, err error) {
+	img, err := b.render()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("Failed to encode badge: %s", err)
+	}
+
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// AddBadge - Render a badge and set it as an image overlay of the Entity, at the given position.
+func (e *Entity) AddBadge(pos OverlayPosition, badge Badge) error {
+	uri, err := badge.DataURI()
+	if err != nil {
+		return err
+	}
+	return e.AddOverlay(uri, pos, OverlayImage)
+}
+
+// badge rendering dimensions, in font pixels.
+const (
+	glyphWidth   = 5
+	glyphHeight  = 7
+	glyphSpacing = 1
+	badgePadding = 2
+)
+
+// render - Draw the badge text on its background.
+func (b Badge) render() (*image.NRGBA, error) {
+	background, err := parseRGB(b.Background, BadgeRed)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid badge background: %s", err)
+	}
+	foreground, err := parseRGB(b.Foreground, BadgeWhite)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid badge foreground: %s", err)
+	}
+	scale := b.Scale
+	if scale <= 0 {
+		scale = 2
+	}
+
+	text := []rune(strings.ToUpper(strings.TrimSpace(b.Text)))
+	if len(text) == 0 {
+		return nil, fmt.Errorf("Badge has no text")
+	}
+
+	width := 2*badgePadding + len(text)*(glyphWidth+glyphSpacing) - glyphSpacing
+	height := 2*badgePadding + glyphHeight
+	img := image.NewNRGBA(image.Rect(0, 0, width*scale, height*scale))
+
+	// Background, then each glyph pixel as a scale*scale square.
+	fill := func(x, y int, c color.NRGBA) {
+		for dy := 0; dy < scale; dy++ {
+			for dx := 0; dx < scale; dx++ {
+				img.SetNRGBA(x*scale+dx, y*scale+dy, c)
+			}
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fill(x, y, background)
+		}
+	}
+	for i, char := range text {
+		glyph, found := badgeFont[char]
+		if !found {
+			glyph = badgeFont['?']
+		}
+		left := badgePadding + i*(glyphWidth+glyphSpacing)
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<(glyphWidth-1-col)) != 0 {
+					fill(left+col, badgePadding+row, foreground)
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// parseRGB - Parse an RGB code (eg. #45e06f) into a color, with a default value if empty.
+func parseRGB(code, defaultCode string) (c color.NRGBA, err error) {
+	if code == "" {
+		code = defaultCode
+	}
+	if !isRGBColor(code) {
+		return c, fmt.Errorf("%q is not a valid RGB color (eg. #45e06f)", code)
+	}
+	value, _ := strconv.ParseUint(code[1:], 16, 32)
+	return color.NRGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xff}, nil
+}
+
+// badgeFont - A 5x7 pixel font: each glyph is a list of rows, one bit per pixel.
+var badgeFont = map[rune][glyphHeight]uint8{
+	'A': {0b01110, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'B': {0b11110, 0b10001, 0b10001, 0b11110, 0b10001, 0b10001, 0b11110},
+	'C': {0b01110, 0b10001, 0b10000, 0b10000, 0b10000, 0b10001, 0b01110},
+	'D': {0b11100, 0b10010, 0b10001, 0b10001, 0b10001, 0b10010, 0b11100},
+	'E': {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b11111},
+	'F': {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b10000},
+	'G': {0b01110, 0b10001, 0b10000, 0b10111, 0b10001, 0b10001, 0b01111},
+	'H': {0b10001, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'I': {0b01110, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'J': {0b00111, 0b00010, 0b00010, 0b00010, 0b00010, 0b10010, 0b01100},
+	'K': {0b10001, 0b10010, 0b10100, 0b11000, 0b10100, 0b10010, 0b10001},
+	'L': {0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b11111},
+	'M': {0b10001, 0b11011, 0b10101, 0b10101, 0b10001, 0b10001, 0b10001},
+	'N': {0b10001, 0b10001, 0b11001, 0b10101, 0b10011, 0b10001, 0b10001},
+	'O': {0b01110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'P': {0b11110, 0b10001, 0b10001, 0b11110, 0b10000, 0b10000, 0b10000},
+	'Q': {0b01110, 0b10001, 0b10001, 0b10001, 0b10101, 0b10010, 0b01101},
+	'R': {0b11110, 0b10001, 0b10001, 0b11110, 0b10100, 0b10010, 0b10001},
+	'S': {0b01111, 0b10000, 0b10000, 0b01110, 0b00001, 0b00001, 0b11110},
+	'T': {0b11111, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100},
+	'U': {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'V': {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01010, 0b00100},
+	'W': {0b10001, 0b10001, 0b10001, 0b10101, 0b10101, 0b10101, 0b01010},
+	'X': {0b10001, 0b10001, 0b01010, 0b00100, 0b01010, 0b10001, 0b10001},
+	'Y': {0b10001, 0b10001, 0b10001, 0b01010, 0b00100, 0b00100, 0b00100},
+	'Z': {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b11111},
+	'0': {0b01110, 0b10001, 0b10011, 0b10101, 0b11001, 0b10001, 0b01110},
+	'1': {0b00100, 0b01100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'2': {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b01000, 0b11111},
+	'3': {0b11111, 0b00010, 0b00100, 0b00010, 0b00001, 0b10001, 0b01110},
+	'4': {0b00010, 0b00110, 0b01010, 0b10010, 0b11111, 0b00010, 0b00010},
+	'5': {0b11111, 0b10000, 0b11110, 0b00001, 0b00001, 0b10001, 0b01110},
+	'6': {0b00110, 0b01000, 0b10000, 0b11110, 0b10001, 0b10001, 0b01110},
+	'7': {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b01000, 0b01000},
+	'8': {0b01110, 0b10001, 0b10001, 0b01110, 0b10001, 0b10001, 0b01110},
+	'9': {0b01110, 0b10001, 0b10001, 0b01111, 0b00001, 0b00010, 0b01100},
+	' ': {0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b00000},
+	'-': {0b00000, 0b00000, 0b00000, 0b11111, 0b00000, 0b00000, 0b00000},
+	'+': {0b00000, 0b00100, 0b00100, 0b11111, 0b00100, 0b00100, 0b00000},
+	'.': {0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b01100, 0b01100},
+	':': {0b00000, 0b01100, 0b01100, 0b00000, 0b01100, 0b01100, 0b00000},
+	'/': {0b00000, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b00000},
+	'%': {0b11000, 0b11001, 0b00010, 0b00100, 0b01000, 0b10011, 0b00011},
+	'!': {0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00000, 0b00100},
+	'?': {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b00000, 0b00100},
+}
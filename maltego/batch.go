@@ -0,0 +1,288 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+//
+// Batch Execution - Running Transforms outside of Maltego -----------------------------------
+//
+// The same Go Transforms can be used as batch enrichment jobs: RunBatch() runs a Transform
+// over a file of input values, entirely offline, and writes the results as JSON lines.
+
+// BatchFormat - The format of a batch input file.
+type BatchFormat string
+
+const (
+	// BatchCSV - Comma-separated values. The first row is a header naming the columns:
+	// "value" (required) and "type" (optional) columns are the Entity value and type,
+	// while all other columns are passed as Entity properties.
+	BatchCSV BatchFormat = "csv"
+	// BatchJSON - JSON lines, each of them an object with "value", "type" (optional)
+	// and "properties" (optional, an object) keys, like the JSON output of Entities.
+	BatchJSON BatchFormat = "jsonl"
+)
+
+// BatchOptions - The options of a batch run.
+type BatchOptions struct {
+	Format   BatchFormat // The format of the input, defaults to JSON lines.
+	Type     string      // The default type of input Entities (eg. "maltego.Domain").
+	Limit    int         // Maximum number of output Entities per input, defaults to 10000.
+	Settings map[string]string
+}
+
+// BatchResult - The output of a Transform for one input Entity, written as a JSON line.
+type BatchResult struct {
+	Input      Entity      `json:"input"`
+	Entities   []Entity    `json:"entities"`
+	Messages   []MessageUI `json:"messages,omitempty"`
+	Exceptions []Exception `json:"exceptions,omitempty"`
+}
+
+// BatchSummary - Aggregated statistics of a batch run.
+type BatchSummary struct {
+	Inputs   int // Number of input Entities processed
+	Failures int // Number of inputs for which the Transform failed
+	Entities int // Total number of output Entities
+}
+
+// RunBatch - Run the Transform registered at path on all the input Entities read from input,
+// and write one BatchResult per input as a JSON line to output. Failing runs do not stop the
+// batch: their exceptions are part of their results. An error is returned only if the input
+// cannot be read, the output cannot be written, or the Transform is not found.
+func (ts *TransformServer) RunBatch(path string, input io.Reader, output io.Writer, opts BatchOptions) (summary BatchSummary, err error) {
+	if ts.GetTransform(path) == nil {
+		return summary, fmt.Errorf("%w: %s", ErrTransformNotFound, path)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 10000
+	}
+
+	encoder := json.NewEncoder(output)
+	err = readBatch(input, opts, func(entity Entity) error {
+		request := Message{
+			Value:  entity.Value,
+			Type:   entityTypeName(entity),
+			Slider: opts.Limit,
+			Entity: entity,
+		}
+		for name, value := range opts.Settings {
+			request.Settings = append(request.Settings, TransformSetting{Name: name, Default: value})
+		}
+
+		instance, runErr, err := ts.runRequest(context.Background(), path, "", nil, request)
+		if err != nil {
+			return err
+		}
+
+		result := BatchResult{
+			Input:      instance.request.Entity,
+			Entities:   instance.Entities(),
+			Messages:   instance.Messages(),
+			Exceptions: instance.Exceptions(),
+		}
+		summary.Inputs++
+		summary.Entities += len(result.Entities)
+		if runErr != nil {
+			summary.Failures++
+		}
+
+		return encoder.Encode(result)
+	})
+
+	return summary, err
+}
+
+// RunBatchCommand - A ready-to-use command line for batch runs, to be called from the main
+// function of your Transform server program, with the command line arguments (os.Args[1:]):
+//
+//	transforms batch -transform /dns-to-ip -type maltego.Domain -format csv -input domains.csv
+//
+// The results are written as JSON lines to the output file (stdout by default),
+// and a summary is printed to stderr.
+func (ts *TransformServer) RunBatchCommand(args []string) error {
+	flags := flag.NewFlagSet("batch", flag.ContinueOnError)
+	path := flags.String("transform", "", "path of the Transform to run (required)")
+	inputPath := flags.String("input", "-", "input file (- for stdin)")
+	outputPath := flags.String("output", "-", "output file, as JSON lines (- for stdout)")
+	format := flags.String("format", string(BatchJSON), "input format: csv or jsonl")
+	entityType := flags.String("type", "", "default type of input Entities (eg. maltego.Domain)")
+	limit := flags.Int("limit", 10000, "maximum number of output Entities per input")
+	var settings []string
+	flags.Func("setting", "transform setting, as name=value (repeatable)", func(s string) error {
+		settings = append(settings, s)
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("No Transform path given (-transform)")
+	}
+
+	opts := BatchOptions{
+		Format:   BatchFormat(*format),
+		Type:     *entityType,
+		Limit:    *limit,
+		Settings: map[string]string{},
+	}
+	for _, setting := range settings {
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid setting %q: notation is name=value", setting)
+		}
+		opts.Settings[parts[0]] = parts[1]
+	}
+
+	input := io.Reader(os.Stdin)
+	if *inputPath != "-" {
+		file, err := os.Open(*inputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	output := io.Writer(os.Stdout)
+	if *outputPath != "-" {
+		file, err := os.Create(*outputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+
+	summary, err := ts.RunBatch(*path, input, output, opts)
+	fmt.Fprintf(os.Stderr, "%d inputs, %d failures, %d output entities\n",
+		summary.Inputs, summary.Failures, summary.Entities)
+
+	return err
+}
+
+// readBatch - Read all input Entities, and pass them one by one to process.
+func readBatch(input io.Reader, opts BatchOptions, process func(Entity) error) error {
+	switch opts.Format {
+	case BatchCSV:
+		return readBatchCSV(input, opts.Type, process)
+	case BatchJSON, "":
+		return readBatchJSON(input, opts.Type, process)
+	default:
+		return fmt.Errorf("Unknown batch format %q (valid: csv, jsonl)", opts.Format)
+	}
+}
+
+// readBatchCSV - Read input Entities from CSV rows.
+func readBatchCSV(input io.Reader, defaultType string, process func(Entity) error) error {
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("Error reading CSV header: %s", err)
+	}
+	valueColumn, typeColumn := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "value":
+			valueColumn = i
+		case "type":
+			typeColumn = i
+		}
+	}
+	if valueColumn == -1 {
+		return errors.New("CSV header has no \"value\" column")
+	}
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading CSV line %d: %s", line, err)
+		}
+		if valueColumn >= len(row) {
+			continue
+		}
+
+		entityType := defaultType
+		if typeColumn != -1 && typeColumn < len(row) && row[typeColumn] != "" {
+			entityType = row[typeColumn]
+		}
+		entity := NewForeignEntity(entityType, row[valueColumn])
+		for i, value := range row {
+			if i == valueColumn || i == typeColumn || i >= len(header) {
+				continue
+			}
+			entity.AddProperty(Field{Name: header[i], Display: header[i], MatchingRule: MatchLoose, Value: value})
+		}
+
+		if err = process(entity); err != nil {
+			return err
+		}
+	}
+}
+
+// readBatchJSON - Read input Entities from JSON lines.
+func readBatchJSON(input io.Reader, defaultType string, process func(Entity) error) error {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var item struct {
+			Type       string                 `json:"type"`
+			Value      string                 `json:"value"`
+			Properties map[string]interface{} `json:"properties"`
+		}
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			return fmt.Errorf("Error reading JSON line %d: %s", line, err)
+		}
+		if item.Type == "" {
+			item.Type = defaultType
+		}
+
+		entity := NewForeignEntity(item.Type, item.Value)
+		for name, value := range item.Properties {
+			entity.AddProperty(Field{Name: name, Display: name, MatchingRule: MatchLoose, Value: value})
+		}
+
+		if err := process(entity); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,123 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import "errors"
+
+// EntityBuilder - Builds an Entity that is not backed by any native Go type with chained
+// calls, instead of populating it over many statements. All methods return the builder
+// itself, and Done() returns the Entity:
+//
+//	domain := maltego.Build("maltego.Domain").
+//		Value("example.com").
+//		Prop("whois.registrar", registrar).
+//		Overlay("whois.registrar", maltego.OverlaySouth, maltego.OverlayText).
+//		Done()
+//	t.AddEntity(domain)
+//
+// Steps that fail (eg. an invalid overlay) are skipped, and their errors returned by Err().
+type EntityBuilder struct {
+	entity Entity
+	errs   []error
+}
+
+// Build - Start building an Entity of a fully qualified Maltego type (eg. "maltego.Domain").
+func Build(fqType string) *EntityBuilder {
+	return &EntityBuilder{entity: NewForeignEntity(fqType, "")}
+}
+
+// Value - Set the value of the Entity.
+func (b *EntityBuilder) Value(value string) *EntityBuilder {
+	b.entity.Value = value
+	return b
+}
+
+// Weight - Set the weight of the Entity on the graph.
+func (b *EntityBuilder) Weight(weight int) *EntityBuilder {
+	b.entity.Weight = weight
+	return b
+}
+
+// Prop - Add a property to the Entity, with its name as display name.
+func (b *EntityBuilder) Prop(name string, value interface{}) *EntityBuilder {
+	return b.Field(Field{Name: name, Display: name, MatchingRule: MatchLoose, Value: value})
+}
+
+// Field - Add a property to the Entity, with all its details (see Entity.AddField()).
+func (b *EntityBuilder) Field(f Field) *EntityBuilder {
+	b.entity.AddField(f)
+	return b
+}
+
+// Overlay - Set an overlay of the Entity (see Entity.AddOverlay()).
+func (b *EntityBuilder) Overlay(value string, pos OverlayPosition, oType OverlayType) *EntityBuilder {
+	if err := b.entity.AddOverlay(value, pos, oType); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// Badge - Set a badge as an image overlay of the Entity (see Entity.AddBadge()).
+func (b *EntityBuilder) Badge(pos OverlayPosition, badge Badge) *EntityBuilder {
+	if err := b.entity.AddBadge(pos, badge); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// Label - Add a display label to the Entity (see Entity.AddLabel()).
+func (b *EntityBuilder) Label(title, content string) *EntityBuilder {
+	b.entity.AddLabel(title, content)
+	return b
+}
+
+// Note - Set the note of the Entity.
+func (b *EntityBuilder) Note(note string) *EntityBuilder {
+	b.entity.SetNote(note)
+	return b
+}
+
+// Bookmark - Set the bookmark color of the Entity.
+func (b *EntityBuilder) Bookmark(color BookmarkColor) *EntityBuilder {
+	b.entity.Bookmark = color
+	return b
+}
+
+// Link - Modify the link between the input Entity and this one (label, style, etc).
+func (b *EntityBuilder) Link(set func(link *Link)) *EntityBuilder {
+	set(&b.entity.Link)
+	return b
+}
+
+// Done - Returns the Entity built so far. The builder should not be used afterwards.
+func (b *EntityBuilder) Done() Entity {
+	return b.entity
+}
+
+// Err - Returns the errors of all the steps that failed, if any.
+func (b *EntityBuilder) Err() error {
+	if len(b.errs) == 0 {
+		return nil
+	}
+	msg := b.errs[0].Error()
+	for _, err := range b.errs[1:] {
+		msg += "; " + err.Error()
+	}
+	return errors.New(msg)
+}
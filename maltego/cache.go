@@ -0,0 +1,235 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResultCache - A backend storing the marshalled responses of Transforms, so that expensive
+// Transforms (eg. querying paid third-party APIs) are not run again when an analyst re-runs
+// them on the same node. Implementations must be safe for concurrent use, and must not
+// return entries older than their TTL. The package provides an in-memory cache.
+type ResultCache interface {
+	Get(key string) (response []byte, found bool, err error)
+	Set(key string, response []byte, ttl time.Duration) error
+}
+
+// SetCache - Opt the Transform into the server result cache (see TransformServer.Cache):
+// its successful responses are kept for ttl, keyed by the Transform, its input Entity
+// (type, value and properties), the request slider, the authenticated principal (if any)
+// and the values of the given settings, which are those changing its output (eg.
+// "search.depth", but generally not API keys). Only the requests received over HTTP with
+// a single input Entity are cached, and never those of Transforms declaring an OAuth
+// authenticator (see SetOAuth()), whose output depends on the analyst token. A ttl of 0
+// disables it.
+func (t *Transform) SetCache(ttl time.Duration, settings ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.cacheTTL = ttl
+	t.cacheSettings = append([]string{}, settings...)
+}
+
+// cachingKey - The context key of HTTP requests whose response can be cached.
+type cachingKey struct{}
+
+// withResponseCaching - Returns a context allowing the response of its run to come from
+// the server result cache, or to be stored in it.
+func withResponseCaching(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cachingKey{}, true)
+}
+
+// cachedResponse - Look for the response of an instance in the server cache, if the
+// Transform and the request are cached. When not found, the key under which to store
+// the response is kept on the instance (see cacheResponse()).
+func (ts *TransformServer) cachedResponse(ctx context.Context, t *Transform) (response []byte, found bool) {
+	if ts.Cache == nil || ctx == nil || ctx.Value(cachingKey{}) == nil {
+		return nil, false
+	}
+	key := t.resultCacheKey()
+	if key == "" {
+		return nil, false
+	}
+	response, found, err := ts.Cache.Get(key)
+	if err != nil || !found {
+		t.mutex.Lock()
+		t.cacheKey = key
+		t.mutex.Unlock()
+		return nil, false
+	}
+	return response, true
+}
+
+// setCached - Keep the cached response of the instance, if found, and return whether it was.
+func (t *Transform) setCached(response []byte, found bool) bool {
+	if found {
+		t.mutex.Lock()
+		t.cached = response
+		t.mutex.Unlock()
+	}
+	return found
+}
+
+// cachedOutput - Returns the response of the instance found in the server cache, if any.
+func (t *Transform) cachedOutput() []byte {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.cached
+}
+
+// cacheResponse - Store the marshalled response of a successful run in the server cache,
+// if it was looked for in the latter beforehand. Errors of the cache are ignored.
+func (ts *TransformServer) cacheResponse(t *Transform, response []byte) {
+	t.mutex.RLock()
+	key, ttl := t.cacheKey, t.cacheTTL
+	t.mutex.RUnlock()
+	if key == "" || ts.Cache == nil {
+		return
+	}
+	ts.Cache.Set(key, response, ttl)
+}
+
+// resultCacheKey - The key of the response of the instance in a ResultCache,
+// or an empty string if the Transform is not cached or the request cannot be.
+func (t *Transform) resultCacheKey() string {
+	t.mutex.RLock()
+	ttl, request := t.cacheTTL, t.request
+	settings := append([]string{}, t.cacheSettings...)
+	tenant, principal := "", ""
+	if t.tenant != nil {
+		tenant = t.tenant.Name
+	}
+	if t.principal != nil {
+		principal = t.principal.Method + ":" + t.principal.ID
+	}
+	authenticated := t.authenticator != ""
+	t.mutex.RUnlock()
+	if ttl <= 0 || len(request.Entities) > 1 || authenticated {
+		return ""
+	}
+
+	parts := []string{
+		t.Name,
+		t.Version,
+		tenant,
+		principal,
+		entityTypeName(request.Entity),
+		request.Entity.Value,
+		propertiesDigest(&request.Entity),
+		strconv.Itoa(request.Slider),
+	}
+	sort.Strings(settings)
+	for _, name := range settings {
+		parts = append(parts, name+"="+t.settingValue(name))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// propertiesDigest - Returns a hash of the names and values of all properties
+// of an Entity, which does not depend on the order in which they were added.
+func propertiesDigest(e *Entity) string {
+	e.ensureInitialized()
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	names := make([]string, 0, len(e.Properties))
+	for name := range e.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s=%v\x00", name, e.Properties[name].Value)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+//
+// Result Caches - Builtin Backends ----------------------------------------------------------
+//
+
+// MemoryResultCache - A ResultCache keeping all responses in memory,
+// until they expire. All responses are lost when the server stops.
+type MemoryResultCache struct {
+	entries map[string]cachedResult
+	swept   time.Time // The last time expired entries were removed
+	mutex   *sync.Mutex
+}
+
+// cachedResult - A response stored in a MemoryResultCache.
+type cachedResult struct {
+	response []byte
+	expires  time.Time
+}
+
+// NewMemoryResultCache - Create a new, empty in-memory ResultCache.
+func NewMemoryResultCache() *MemoryResultCache {
+	return &MemoryResultCache{
+		entries: map[string]cachedResult{},
+		swept:   time.Now(),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// Get - Returns the response stored under key, unless it has expired.
+func (c *MemoryResultCache) Get(key string) (response []byte, found bool, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, found := c.entries[key]
+	if !found {
+		return nil, false, nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return entry.response, true, nil
+}
+
+// Set - Store a response under key for ttl, replacing any previous one.
+// Expired responses are removed at most once per minute.
+func (c *MemoryResultCache) Set(key string, response []byte, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(c.swept) > time.Minute {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	c.entries[key] = cachedResult{
+		response: append([]byte{}, response...),
+		expires:  now.Add(ttl),
+	}
+	return nil
+}
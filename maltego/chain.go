@@ -0,0 +1,122 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RunTransform - Run another Transform registered on the same server, in-process, on the
+// given Entity, and merge its outputs into those of this Transform: they are added just like
+// with AddEntity(), and its messages are appended to the ones of this Transform. This allows
+// to write composite Transforms (eg. "Domain to full footprint") without HTTP round-trips.
+//
+// The Transform is found by name, or by URL path (eg. /ToDNSName/v2). It runs with the same
+// settings, slider, tenant and context as this Transform, and the Entities it produced are
+// returned, so as to chain several Transforms. It fails if the Transform is not available to
+// the tenant, is disabled, does not accept the Entity as input, or is already running in the
+// current chain (which would loop).
+// Errors are not raised as exceptions: return them to fail this Transform, or ignore them
+// to go on with the outputs of the other Transforms.
+func (t *Transform) RunTransform(name string, entity ValidEntity) (entities []Entity, err error) {
+	if t.server == nil {
+		return nil, fmt.Errorf("Cannot run Transform %s: %s is not served", name, t.Name)
+	}
+	ts := t.server
+	transform := ts.findTransform(name)
+	if transform == nil {
+		return nil, fmt.Errorf("Cannot run Transform %s: no such Transform on this server", name)
+	}
+	callers := append(append([]string{}, t.callers...), t.Name)
+	for _, caller := range callers {
+		if caller == transform.Name {
+			return nil, fmt.Errorf("Cannot run Transform %s: it is already running (%s)",
+				transform.Name, strings.Join(callers, " > "))
+		}
+	}
+
+	input := entity.AsEntity()
+	t.mutex.RLock()
+	request := t.request
+	t.mutex.RUnlock()
+	request.Entity = input
+	request.Entities = nil
+	request.Type = entityTypeName(input)
+	request.Weight = input.Weight
+	request.Geneaology = nil
+
+	run := transform.newInstanceFromRequest(request, ts)
+	run.tenant = t.tenant
+	run.principal = t.principal
+	run.requestID = t.requestID
+	run.callers = callers
+	inputErr := run.checkInputs()
+
+	switch {
+	case t.tenant != nil && !t.tenant.CanRun(transform.Name):
+		err = run.reject(ErrNotAllowed, "Transform %s is not available to tenant %s", transform.Name, t.tenant.Name)
+	case !ts.clientAllowed(t.principal, transform.Name):
+		err = run.reject(ErrNotAllowed, "Transform %s is not available to client %s", transform.Name, t.principal.ID)
+	case ts.IsTransformDisabled(transform.Name):
+		err = run.disabled()
+	case inputErr != nil:
+		err = inputErr
+	default:
+		ctx, cancel := run.newContext(t.Context())
+		defer cancel()
+		run.ctx = ctx
+		if err = run.execute(); err == nil {
+			run.process(run.processors)
+		}
+	}
+
+	t.mutex.Lock()
+	t.messages = append(t.messages, run.Messages()...)
+	t.mutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("Transform %s failed: %s", transform.Name, err)
+	}
+
+	entities = run.Entities()
+	for i := range entities {
+		t.AddEntity(&entities[i])
+	}
+	return entities, nil
+}
+
+// findTransform - Returns the Transform registered with the given name or at the given
+// path (with its aliases and versions, see resolveTransform()), if any.
+func (ts *TransformServer) findTransform(name string) *Transform {
+	if transform, _ := ts.resolveTransform("/" + strings.TrimPrefix(name, "/")); transform != nil {
+		return transform
+	}
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	var found *Transform
+	for _, transform := range ts.Transforms {
+		if transform.Name != name {
+			continue
+		}
+		if found == nil || compareVersions(transform.Version, found.Version) > 0 {
+			found = transform
+		}
+	}
+	return found
+}
@@ -0,0 +1,90 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Named palette - Valid RGB codes for colour overlays, link colors, badges, etc.
+// Colour overlays also accept their names (eg. "red"), see ParseColor().
+const (
+	ColorBlack  = "#000000"
+	ColorWhite  = "#ffffff"
+	ColorGrey   = "#9e9e9e"
+	ColorRed    = "#e53935"
+	ColorOrange = "#fb8c00"
+	ColorYellow = "#fdd835"
+	ColorGreen  = "#43a047"
+	ColorTeal   = "#00897b"
+	ColorCyan   = "#00acc1"
+	ColorBlue   = "#1e88e5"
+	ColorPurple = "#8e24aa"
+	ColorPink   = "#d81b60"
+	ColorBrown  = "#6d4c41"
+)
+
+// colorNames - The palette colors, by name.
+var colorNames = map[string]string{
+	"black":  ColorBlack,
+	"white":  ColorWhite,
+	"grey":   ColorGrey,
+	"gray":   ColorGrey,
+	"red":    ColorRed,
+	"orange": ColorOrange,
+	"yellow": ColorYellow,
+	"green":  ColorGreen,
+	"teal":   ColorTeal,
+	"cyan":   ColorCyan,
+	"blue":   ColorBlue,
+	"purple": ColorPurple,
+	"pink":   ColorPink,
+	"brown":  ColorBrown,
+}
+
+// ParseColor - Returns the valid RGB code of a color, given either as an RGB code
+// (#45e06f, or its short form #4e6), or as the name of a palette color ("red",
+// "Blue", etc). The error describes the valid notations if the color is invalid.
+func ParseColor(color string) (code string, err error) {
+	color = strings.TrimSpace(color)
+
+	if isRGBColor(color) {
+		return strings.ToLower(color), nil
+	}
+	if len(color) == 4 && color[0] == '#' {
+		expanded := "#" + string([]byte{color[1], color[1], color[2], color[2], color[3], color[3]})
+		if isRGBColor(expanded) {
+			return strings.ToLower(expanded), nil
+		}
+	}
+	if code, found := colorNames[strings.ToLower(color)]; found {
+		return code, nil
+	}
+
+	names := make([]string, 0, len(colorNames))
+	for name := range colorNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return "", fmt.Errorf("Invalid color %q: must be an RGB code (eg. #45e06f) or one of %s",
+		color, strings.Join(names, ", "))
+}
@@ -29,15 +29,62 @@ package configuration
 //
 // We have added some utility code to generate the corresponding configurations.
 
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+)
+
 // PropertyType - String representation of a Property type
 type PropertyType string
 
 const (
-	PropertyTypeString  PropertyType = "string"
-	PropertyTypeBoolean PropertyType = "boolean"
-	PropertyTypeInteger PropertyType = "int"
+	PropertyTypeString      PropertyType = "string"
+	PropertyTypeBoolean     PropertyType = "boolean"
+	PropertyTypeInteger     PropertyType = "int"
+	PropertyTypeLong        PropertyType = "long"
+	PropertyTypeFloat       PropertyType = "float"
+	PropertyTypeDate        PropertyType = "date"
+	PropertyTypeDateTime    PropertyType = "datetime"
+	PropertyTypeStringArray PropertyType = "string[]"
+	PropertyTypeIntArray    PropertyType = "int[]"
+)
+
+// XMLFormat - The layout of generated XML documents.
+type XMLFormat int
+
+const (
+	XMLPretty  XMLFormat = iota // Indented, one element per line: readable and diffable.
+	XMLCompact                  // Without any whitespace between elements: smallest size.
 )
 
+// Format - The layout of all configuration files written by WriteConfig() methods,
+// and thus of the contents of .mtz distributions. Files are pretty-printed by default,
+// so that diffs between generated distributions remain readable.
+var Format = XMLPretty
+
+// Marshal - Returns the XML encoding of v, laid out according to format.
+// Pretty-printed documents end with a newline, like any other text file.
+func Marshal(v interface{}, format XMLFormat) (data []byte, err error) {
+	if format == XMLCompact {
+		return xml.Marshal(v)
+	}
+	if data, err = xml.MarshalIndent(v, "", "  "); err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// getDirectory - Returns the path to a subdirectory of a configuration
+// tree (eg. path/Entities), creating it if it does not exist yet.
+func getDirectory(path, subdir string) (dir string, err error) {
+	dir = filepath.Join(path, subdir)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
 type globalConfig struct {
 }
 
@@ -18,14 +18,128 @@ package configuration
    along with this program.  If not, see <https://www.gnu.org/licenses/>.
 */
 
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Entity - A type holding all the information of an Entity specification, able
+// to marshal itself as a MaltegoEntity XML object for inclusion in a configuration.
+type Entity struct {
+	XMLName         xml.Name         `xml:"MaltegoEntity"`
+	ID              string           `xml:"id,attr"`
+	DisplayName     string           `xml:"displayName,attr"`
+	Plural          string           `xml:"displayNamePlural,attr"`
+	Description     string           `xml:"description,attr"`
+	Category        string           `xml:"category,attr"`
+	SmallIcon       string           `xml:"smallIconResource,attr,omitempty"`
+	LargeIcon       string           `xml:"largeIconResource,attr,omitempty"`
+	AllowedRoot     bool             `xml:"allowedRoot,attr"`
+	ConversionOrder int              `xml:"conversionOrder,attr"`
+	Visible         bool             `xml:"visible,attr"`
+	BaseEntities    BaseEntities     `xml:"BaseEntities"`
+	Properties      EntityProperties `xml:"Properties"`
+}
+
+// BaseEntities - The list of Entity types from which an Entity inherits.
+type BaseEntities []string
+
+// MarshalXML - BaseEntities implement the xml.Marshaller interface,
+// so as not to produce any element when the Entity has no base.
+func (b BaseEntities) MarshalXML(e *xml.Encoder, start xml.StartElement) (err error) {
+	if len(b) == 0 {
+		return
+	}
+	if err = e.EncodeToken(start); err != nil {
+		return
+	}
+	for _, base := range b {
+		e.EncodeElement(base, xml.StartElement{Name: xml.Name{Local: "BaseEntity"}})
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// EntityProperties - The Properties of an Entity specification: the name
+// of the field holding the Entity value, and the list of all fields.
+type EntityProperties struct {
+	Value        string        `xml:"value,attr"`
+	DisplayValue string        `xml:"displayValue,attr"`
+	Groups       []EntityGroup `xml:"Groups>Group"`
+	Fields       []EntityField `xml:"Fields>Field"`
+}
+
+// EntityGroup - A named section of the Properties window, grouping Entity fields.
+type EntityGroup struct {
+	Name string `xml:"name,attr"`
+}
+
+// EntityField - The specification of an Entity property field.
+type EntityField struct {
+	Name         string                 `xml:"name,attr"`
+	Type         PropertyType           `xml:"type,attr"`
+	Nullable     bool                   `xml:"nullable,attr"`
+	Hidden       bool                   `xml:"hidden,attr"`
+	ReadOnly     bool                   `xml:"readonly,attr"`
+	Description  string                 `xml:"description,attr"`
+	DisplayName  string                 `xml:"displayName,attr"`
+	DefaultValue string                 `xml:"DefaultValue,omitempty"`
+	SampleValue  string                 `xml:"SampleValue,omitempty"`
+	Group        string                 `xml:"group,attr,omitempty"`
+	Constraint   *EntityFieldConstraint `xml:"Constraint,omitempty"`
+}
+
+// EntityFieldConstraint - A constraint on the values of an Entity field,
+// marshalled as <Constraint regex="^\d+$"/> in the field specification.
+type EntityFieldConstraint struct {
+	Regex string `xml:"regex,attr"`
+}
+
+// WriteConfig - The Entity creates a file in path/Entities/EntityID.entity,
+// and writes itself as an XML message into it.
+func (e Entity) WriteConfig(path string) (err error) {
+	dir, err := getDirectory(path, "Entities")
+	if err != nil {
+		return fmt.Errorf("Error getting output dir: %s", err)
+	}
+
+	data, err := Marshal(e, Format)
+	if err != nil {
+		return fmt.Errorf("Error marshalling Entity %s: %s", e.ID, err)
+	}
+
+	// IDs derived from Go package paths might contain slashes.
+	name := strings.ReplaceAll(e.ID, "/", ".") + ".entity"
+
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
+}
+
 // EntityCategory - A type holding information on a category
 // of Entities, and able to write itself as XML for a configuration.
+// Entities declare their category by name, in their category attribute.
 type EntityCategory struct {
+	XMLName xml.Name `xml:"EntityCategory"`
+	Name    string   `xml:"name,attr"`
 }
 
 // WriteConfig - The EntityCategory creates a file in
 // path/EntityCategories/EntityCategoryName, and writes
 // itself as an XML message into it.
 func (ec EntityCategory) WriteConfig(path string) (err error) {
-	return
+	dir, err := getDirectory(path, "EntityCategories")
+	if err != nil {
+		return fmt.Errorf("Error getting output dir: %s", err)
+	}
+
+	data, err := Marshal(ec, Format)
+	if err != nil {
+		return fmt.Errorf("Error marshalling Entity category %s: %s", ec.Name, err)
+	}
+
+	name := strings.NewReplacer("/", ".", " ", "").Replace(strings.ToLower(ec.Name)) + ".category"
+
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
 }
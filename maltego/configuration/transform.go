@@ -18,7 +18,14 @@ package configuration
    along with this program.  If not, see <https://www.gnu.org/licenses/>.
 */
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
 
 // This file is a reproduction of the Canari Framework configuration.py file:
 //
@@ -52,11 +59,20 @@ const (
 // IOConstraint - A set of Input/Output constraint parameters
 // to be applied to a Entity used by a Transform.
 type IOConstraint struct {
-	Min  int    `xml:"min"`
-	Max  int    `xml:"max"`
-	Type string `xml:"type"`
+	Min  int    `xml:"min,attr"`
+	Max  int    `xml:"max,attr"`
+	Type string `xml:"type,attr"`
 }
 
+// Local Transform properties, holding the command run by the
+// client for Transforms using the local Transform adapter.
+const (
+	LocalCommand    = "transform.local.command"           // The command to execute
+	LocalParameters = "transform.local.parameters"        // Its parameters, before the Entity value and fields
+	LocalWorkDir    = "transform.local.working-directory" // The directory from which it is run
+	LocalDebug      = "transform.local.debug"             // Whether the client shows a debug window
+)
+
 // type OutputEntity string
 // type InputEntity string
 
@@ -97,7 +113,7 @@ type TransformInfo struct {
 	Help         string `xml:",cdata"`
 	Disclaimer   string `xml:",cdata"`
 	StealthLevel int
-	Debug        string // Whether the transform should open a debugging window in Maltego when executed.
+	Debug        bool // Show verbose execution logs, and open a debugging window in Maltego for local Transforms.
 }
 
 // Transform - A type holding all the information for a Transform,
@@ -108,7 +124,7 @@ type Transform struct {
 	Template          bool
 	Visibility        VisibilityType
 	TransformAdapter  TransformAdapter
-	Authenticator     string
+	Authenticator     string            // The name of the OAuth authenticator of the transform, if any.
 	LocationRelevance string            `xml:"locationRelevance,attr"`
 	Sets              []string          `xml:"defaultSets"`             // Optional name of a transform set to which we belong
 	Settings          TransformSettings `xml:"Properties"`              // All transform settings, and their local configuration.
@@ -116,9 +132,9 @@ type Transform struct {
 	Output            []IOConstraint    `xml:"OutputEntities>Entity"`   // Output Entity types/max/min
 }
 
-// WriteConfig - The transform creates a file in
-// path/TransformRegistries/TransformLocal/TransformName, and
-// writes itself as an XML message into it.
+// WriteConfig - The transform creates two files in path/TransformRepositories/Local/:
+// TransformName.transform, holding its definition, and TransformName.transformsettings,
+// holding the value of its settings, and writes itself as XML messages into them.
 func (t *Transform) WriteConfig(path string) (err error) {
 	// Check defaults
 	if t.LocationRelevance == "" {
@@ -127,20 +143,115 @@ func (t *Transform) WriteConfig(path string) (err error) {
 	if t.Version == "" {
 		t.Version = "1.0"
 	}
-	return
+	if t.Visibility == "" {
+		t.Visibility = VisibilityTypePublic
+	}
+
+	dir, err := getDirectory(path, filepath.Join("TransformRepositories", "Local"))
+	if err != nil {
+		return fmt.Errorf("Error getting output dir: %s", err)
+	}
+
+	data, err := Marshal(t, Format)
+	if err != nil {
+		return fmt.Errorf("Error marshalling Transform %s: %s", t.Name, err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, t.Name+".transform"), data, 0o644); err != nil {
+		return err
+	}
+
+	if data, err = Marshal(t.Settings.values(), Format); err != nil {
+		return fmt.Errorf("Error marshalling Transform %s settings: %s", t.Name, err)
+	}
+
+	return os.WriteFile(filepath.Join(dir, t.Name+".transformsettings"), data, 0o644)
 }
 
-// TransformSet - A set of Maltego transforms
+// MarshalXML - The Transform marshals itself as a Maltego Transform definition: its
+// information as attributes, followed by its adapter, the definitions of its settings,
+// its input and output constraints and its sets. Setting values are written separately.
+func (t Transform) MarshalXML(e *xml.Encoder, start xml.StartElement) (err error) {
+	definition := struct {
+		XMLName      xml.Name            `xml:"MaltegoTransform"`
+		Name         string              `xml:"name,attr"`
+		DisplayName  string              `xml:"displayName,attr"`
+		Abstract     bool                `xml:"abstract,attr"`
+		Template     bool                `xml:"template,attr"`
+		Visibility   VisibilityType      `xml:"visibility,attr"`
+		HelpURL      string              `xml:"helpURL,attr,omitempty"`
+		Auth         string              `xml:"authenticator,attr,omitempty"`
+		Description  string              `xml:"description,attr"`
+		Author       string              `xml:"author,attr"`
+		Owner        string              `xml:"owner,attr"`
+		Version      string              `xml:"version,attr"`
+		Location     string              `xml:"locationRelevance,attr"`
+		RequireInfo  bool                `xml:"requireDisplayInfo,attr"`
+		Adapter      TransformAdapter    `xml:"TransformAdapter"`
+		Properties   []TransformProperty `xml:"Properties>Fields>Property"`
+		Input        []IOConstraint      `xml:"InputConstraints>Entity"`
+		Output       []IOConstraint      `xml:"OutputEntities>Entity"`
+		Help         string              `xml:"Help,omitempty"`
+		Disclaimer   string              `xml:"Disclaimer,omitempty"`
+		Sets         []string            `xml:"defaultSets>Set"`
+		StealthLevel int                 `xml:"StealthLevel"`
+	}{
+		Name:         t.Name,
+		DisplayName:  t.DisplayName,
+		Abstract:     t.Abstract,
+		Template:     t.Template,
+		Visibility:   t.Visibility,
+		HelpURL:      t.HelpURL,
+		Auth:         t.Authenticator,
+		Description:  t.Description,
+		Author:       t.Author,
+		Owner:        t.Owner,
+		Version:      t.Version,
+		Location:     t.LocationRelevance,
+		RequireInfo:  t.RequireInfo,
+		Adapter:      t.TransformAdapter,
+		Properties:   t.Settings.Settings,
+		Input:        t.Input,
+		Output:       t.Output,
+		Help:         t.Help,
+		Disclaimer:   t.Disclaimer,
+		Sets:         t.Sets,
+		StealthLevel: t.StealthLevel,
+	}
+
+	return e.Encode(definition)
+}
+
+// TransformSet - A set of Maltego transforms, grouping them in the client
+// menus. Transforms are listed by name, and a Transform can be in several sets.
 type TransformSet struct {
-	Description string
-	Transforms  []Transform
+	XMLName     xml.Name             `xml:"TransformSet"`
+	Name        string               `xml:"name,attr"`
+	Description string               `xml:"description,attr"`
+	Transforms  []TransformSetMember `xml:"Transforms>Transform"`
+}
+
+// TransformSetMember - A Transform listed in a TransformSet.
+type TransformSetMember struct {
+	Name string `xml:"name,attr"`
 }
 
 // WriteConfig - The transform set creates a file in
-// path/TransformSets/TransformSetName, and
+// path/TransformSets/TransformSetName.set, and
 // writes itself as an XML message into it.
 func (t TransformSet) WriteConfig(path string) (err error) {
-	return
+	dir, err := getDirectory(path, "TransformSets")
+	if err != nil {
+		return fmt.Errorf("Error getting output dir: %s", err)
+	}
+
+	data, err := Marshal(t, Format)
+	if err != nil {
+		return fmt.Errorf("Error marshalling Transform set %s: %s", t.Name, err)
+	}
+
+	name := strings.NewReplacer("/", ".", " ", "").Replace(t.Name) + ".set"
+
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
 }
 
 // TransformSettings - Holds all settings for
@@ -155,23 +266,79 @@ type TransformSettings struct {
 }
 
 // MarshalXML - The Transform Settings implement the xml.Marshaller interface in order to
-// marshal a few of its elements that are not accessible to Transform writers, like Properties.
+// write their flags as attributes, as Maltego expects, followed by all their properties.
 func (ts *TransformSettings) MarshalXML(e *xml.Encoder, start xml.StartElement) (err error) {
-	return
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "enabled"}, Value: strconv.FormatBool(ts.Enabled)},
+		xml.Attr{Name: xml.Name{Local: "disclaimerAccepted"}, Value: strconv.FormatBool(ts.Accepted)},
+		xml.Attr{Name: xml.Name{Local: "showHelp"}, Value: strconv.FormatBool(ts.ShowHelp)},
+		xml.Attr{Name: xml.Name{Local: "runWithAll"}, Value: strconv.FormatBool(ts.RunWithAll)},
+		xml.Attr{Name: xml.Name{Local: "favorite"}, Value: strconv.FormatBool(ts.Favorite)},
+	)
+
+	properties := struct {
+		Properties []TransformProperty `xml:"Properties>Property"`
+	}{
+		Properties: ts.Settings,
+	}
+
+	return e.EncodeElement(properties, start)
+}
+
+// transformSettingValues - The flags of a Transform and the values of its settings,
+// as written in a .transformsettings file of a configuration.
+type transformSettingValues struct {
+	XMLName    xml.Name                `xml:"TransformSettings"`
+	Enabled    bool                    `xml:"enabled,attr"`
+	Accepted   bool                    `xml:"disclaimerAccepted,attr"`
+	ShowHelp   bool                    `xml:"showHelp,attr"`
+	RunWithAll bool                    `xml:"runWithAll,attr"`
+	Favorite   bool                    `xml:"favorite,attr"`
+	Properties []transformSettingValue `xml:"Properties>Property"`
+}
+
+// transformSettingValue - The value of a Transform setting, in a .transformsettings file.
+type transformSettingValue struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr"`
+	Popup bool   `xml:"popup,attr"`
+	Value string `xml:",chardata"`
+}
+
+// values - The settings flags, and the default values of all settings.
+func (ts *TransformSettings) values() transformSettingValues {
+	values := transformSettingValues{
+		Enabled:    ts.Enabled,
+		Accepted:   ts.Accepted,
+		ShowHelp:   ts.ShowHelp,
+		RunWithAll: ts.RunWithAll,
+		Favorite:   ts.Favorite,
+	}
+	for _, setting := range ts.Settings {
+		values.Properties = append(values.Properties, transformSettingValue{
+			Name:  setting.Name,
+			Type:  setting.Type,
+			Popup: setting.Popup,
+			Value: setting.DefaultValue,
+		})
+	}
+	return values
 }
 
 // TransformProperty - A type very similar to an Entity property, targeting a transform.
 type TransformProperty struct {
-	Name         string
-	DisplayName  string
-	DefaultValue string
-	SampleValue  string
-	Abstract     bool
-	Description  string
-	Hidden       bool
-	Nullable     bool
-	ReadOnly     bool
-	Popup        bool
-	Type         string // Enum
-	Visibility   string // Enum
+	XMLName      xml.Name `xml:"Property"`
+	Name         string   `xml:"name,attr"`
+	DisplayName  string   `xml:"displayName,attr"`
+	DefaultValue string   `xml:"DefaultValue"`
+	SampleValue  string   `xml:"SampleValue"`
+	Abstract     bool     `xml:"abstract,attr"`
+	Description  string   `xml:"description,attr"`
+	Hidden       bool     `xml:"hidden,attr"`
+	Nullable     bool     `xml:"nullable,attr"`
+	ReadOnly     bool     `xml:"readonly,attr"`
+	Popup        bool     `xml:"popup,attr"`
+	Auth         bool     `xml:"auth,attr"`
+	Type         string   `xml:"type,attr"`       // Enum
+	Visibility   string   `xml:"visibility,attr"` // Enum
 }
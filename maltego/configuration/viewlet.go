@@ -0,0 +1,69 @@
+package configuration
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Viewlet - A type holding all the information of a Viewlet specification, able to marshal
+// itself as an XML object for inclusion in a configuration. A viewlet is a small canvas
+// widget scoring the Entities of a graph on one of their properties, and coloring/sizing
+// them according to a list of rules (the first matching one wins).
+type Viewlet struct {
+	XMLName     xml.Name      `xml:"Viewlet"`
+	Name        string        `xml:"name,attr"`
+	DisplayName string        `xml:"displayName,attr"`
+	Description string        `xml:"description,attr,omitempty"`
+	Property    string        `xml:"property,attr"`
+	EntityTypes []string      `xml:"EntityTypes>EntityType,omitempty"`
+	Rules       []ViewletRule `xml:"Rules>Rule"`
+}
+
+// ViewletRule - A rule of a Viewlet, matching the property value either as a number
+// within [Min, Max], or as a string matching a regular expression.
+type ViewletRule struct {
+	Min   *float64 `xml:"min,attr,omitempty"`
+	Max   *float64 `xml:"max,attr,omitempty"`
+	Match string   `xml:"match,attr,omitempty"`
+	Color string   `xml:"color,attr,omitempty"`
+	Size  int      `xml:"size,attr,omitempty"`
+}
+
+// WriteConfig - The Viewlet creates a file in path/Viewlets/ViewletName.viewlet,
+// and writes itself as an XML message into it.
+func (v Viewlet) WriteConfig(path string) (err error) {
+	dir, err := getDirectory(path, "Viewlets")
+	if err != nil {
+		return fmt.Errorf("Error getting output dir: %s", err)
+	}
+
+	data, err := Marshal(v, Format)
+	if err != nil {
+		return fmt.Errorf("Error marshalling Viewlet %s: %s", v.Name, err)
+	}
+
+	name := strings.ReplaceAll(v.Name, "/", ".") + ".viewlet"
+
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
+}
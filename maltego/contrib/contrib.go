@@ -0,0 +1,108 @@
+// Package contrib provides ready-to-use Transforms built on the maltego package:
+// DNS resolution, reverse DNS, WHOIS and TLS certificate parsing. Each of them can
+// be registered as is to a maltego.TransformServer, and their code is meant to be
+// read as a reference implementation of a Transform querying external services.
+//
+//	for _, transform := range contrib.Transforms() {
+//		transform := transform
+//		server.RegisterTransform(&transform)
+//	}
+package contrib
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// Maltego core Entity types, used as inputs and outputs of the contrib Transforms.
+const (
+	TypeDomain          = "maltego.Domain"
+	TypeDNSName         = "maltego.DNSName"
+	TypeIPv4Address     = "maltego.IPv4Address"
+	TypeIPv6Address     = "maltego.IPv6Address"
+	TypeNSRecord        = "maltego.NSRecord"
+	TypeEmailAddress    = "maltego.EmailAddress"
+	TypeOrganization    = "maltego.Organization"
+	TypeX509Certificate = "maltego.X509Certificate"
+)
+
+// DefaultTimeout - The maximum duration of the network calls performed by a
+// contrib Transform, when the request itself has no deadline (see Transform.Deadline()).
+var DefaultTimeout = 30 * time.Second
+
+// Transforms - Returns all contrib Transforms, ready to be registered to a server.
+func Transforms() []maltego.Transform {
+	return []maltego.Transform{
+		NewDNSToIP(),
+		NewIPToDNS(),
+		NewDomainToWhois(),
+		NewDomainToCertificate(),
+	}
+}
+
+// newContext - Returns a context derived from the one of the Transform (canceled when the
+// client goes away), expiring at the Transform deadline if it has one, or after the
+// DefaultTimeout. All network calls must use it.
+func newContext(t *maltego.Transform) (context.Context, context.CancelFunc) {
+	if deadline, ok := t.Deadline(); ok {
+		return context.WithDeadline(t.Context(), deadline)
+	}
+	return context.WithTimeout(t.Context(), DefaultTimeout)
+}
+
+// newIPEntity - Returns an IPv4/IPv6 Address Entity, depending on the IP version.
+func newIPEntity(ip net.IP) maltego.Entity {
+	if ip.To4() != nil {
+		return maltego.NewForeignEntity(TypeIPv4Address, ip.String())
+	}
+	return maltego.NewForeignEntity(TypeIPv6Address, ip.String())
+}
+
+// addProperty - Add a string property to an output Entity, if its value is not empty.
+func addProperty(e *maltego.Entity, name, display string, value interface{}) {
+	if value == nil || value == "" {
+		return
+	}
+	e.AddProperty(maltego.Field{
+		Name:         name,
+		Display:      display,
+		MatchingRule: maltego.MatchLoose,
+		Value:        value,
+	})
+}
+
+// hostname - Returns the input Entity value as a hostname: spaces
+// and the trailing dot of fully qualified names are removed.
+func hostname(t *maltego.Transform) string {
+	return strings.TrimSuffix(strings.TrimSpace(t.Input().Value), ".")
+}
+
+// isTemporary - Whether a network error is worth retrying.
+func isTemporary(err error) bool {
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		return !dnsErr.IsNotFound
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package contrib
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"net"
+	"strings"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// NewDNSToIP - Returns a Transform resolving a Domain/DNS Name to its IP addresses.
+func NewDNSToIP() maltego.Transform {
+	transform := maltego.NewTransform("To IP Address [DNS]", DNSToIP)
+	transform.AddToSet("Gondor DNS")
+	return transform
+}
+
+// DNSToIP - Resolve the input domain name into its IPv4 and IPv6 addresses,
+// as well as the name servers of the domain, when it has some.
+func DNSToIP(t *maltego.Transform) (err error) {
+	name := hostname(t)
+	if name == "" {
+		return t.Errorf("No domain name to resolve")
+	}
+
+	ctx, cancel := newContext(t)
+	defer cancel()
+
+	// Non-existing domains are not worth retrying,
+	// but they are not a Transform failure either.
+	var addrs []net.IPAddr
+	err = t.Retry(maltego.DefaultRetryPolicy, func() (err error) {
+		addrs, err = net.DefaultResolver.LookupIPAddr(ctx, name)
+		if err != nil && !isTemporary(err) {
+			t.Infof("No IP address found for %s", name)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return t.Errorf("Failed to resolve %s: %s", name, err)
+	}
+
+	for _, addr := range addrs {
+		t.AddEntity(newIPEntity(addr.IP))
+	}
+
+	// The name servers are only looked up for a best effort.
+	servers, err := net.DefaultResolver.LookupNS(ctx, name)
+	if err != nil {
+		t.Debugf("No name servers found for %s: %s", name, err)
+		return nil
+	}
+	for _, ns := range servers {
+		t.AddEntity(maltego.NewForeignEntity(TypeNSRecord, strings.TrimSuffix(ns.Host, ".")))
+	}
+
+	return nil
+}
+
+// NewIPToDNS - Returns a Transform resolving an IP address to its DNS names.
+func NewIPToDNS() maltego.Transform {
+	transform := maltego.NewTransform("To DNS Name [Reverse DNS]", IPToDNS)
+	transform.AddToSet("Gondor DNS")
+	return transform
+}
+
+// IPToDNS - Perform a reverse DNS lookup (PTR records) of the input IP address.
+func IPToDNS(t *maltego.Transform) (err error) {
+	ip := net.ParseIP(strings.TrimSpace(t.Input().Value))
+	if ip == nil {
+		return t.Errorf("Invalid IP address: %q", t.Input().Value)
+	}
+
+	ctx, cancel := newContext(t)
+	defer cancel()
+
+	var names []string
+	err = t.Retry(maltego.DefaultRetryPolicy, func() (err error) {
+		names, err = net.DefaultResolver.LookupAddr(ctx, ip.String())
+		if err != nil && !isTemporary(err) {
+			t.Infof("No PTR record found for %s", ip)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return t.Errorf("Failed to reverse resolve %s: %s", ip, err)
+	}
+
+	for _, name := range names {
+		t.AddEntity(maltego.NewForeignEntity(TypeDNSName, strings.TrimSuffix(name, ".")))
+	}
+
+	return nil
+}
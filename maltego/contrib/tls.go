@@ -0,0 +1,122 @@
+package contrib
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// NewDomainToCertificate - Returns a Transform fetching the TLS certificate of a host.
+func NewDomainToCertificate() maltego.Transform {
+	transform := maltego.NewTransform("To TLS Certificate", DomainToCertificate)
+	transform.AddToSet("Gondor TLS")
+	return transform
+}
+
+// DomainToCertificate - Connect to the input host (port 443, unless the value
+// is a host:port pair), and return its TLS certificate, the organization that
+// issued it, and all the other domain names covered by the certificate.
+//
+// The certificate is not verified, since we want to inspect it even if it is
+// self-signed or expired: its validity is returned as a property instead.
+func DomainToCertificate(t *maltego.Transform) (err error) {
+	host, port := hostname(t), "443"
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
+	if host == "" {
+		return t.Errorf("No host to connect to")
+	}
+
+	ctx, cancel := newContext(t)
+	defer cancel()
+
+	var state tls.ConnectionState
+	err = t.Retry(maltego.DefaultRetryPolicy, func() (err error) {
+		dialer := tls.Dialer{Config: &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true, // We verify the certificate ourselves below.
+		}}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		state = conn.(*tls.Conn).ConnectionState()
+		return nil
+	})
+	if err != nil {
+		return t.Errorf("TLS connection to %s:%s failed: %s", host, port, err)
+	}
+	if len(state.PeerCertificates) == 0 {
+		return t.Errorf("No certificate presented by %s:%s", host, port)
+	}
+
+	cert := state.PeerCertificates[0]
+	t.AddEntity(newCertificateEntity(cert, host, state.PeerCertificates[1:]))
+
+	for _, org := range cert.Issuer.Organization {
+		t.AddEntity(maltego.NewForeignEntity(TypeOrganization, org))
+	}
+	for _, name := range cert.DNSNames {
+		name = strings.TrimPrefix(strings.ToLower(name), "*.")
+		if name == strings.ToLower(host) {
+			continue
+		}
+		t.AddEntity(maltego.NewForeignEntity(TypeDomain, name))
+	}
+
+	return nil
+}
+
+// newCertificateEntity - Returns an X509 Certificate Entity, valued with the
+// certificate SHA-256 fingerprint and holding its main details as properties.
+func newCertificateEntity(cert *x509.Certificate, host string, chain []*x509.Certificate) maltego.Entity {
+	fingerprint := sha256.Sum256(cert.Raw)
+	entity := maltego.NewForeignEntity(TypeX509Certificate, hex.EncodeToString(fingerprint[:]))
+
+	addProperty(&entity, "subject", "Subject", cert.Subject.String())
+	addProperty(&entity, "issuer", "Issuer", cert.Issuer.String())
+	addProperty(&entity, "serial", "Serial Number", cert.SerialNumber.String())
+	addProperty(&entity, "validfrom", "Valid From", cert.NotBefore.UTC().Format(maltego.MaltegoDateTimeFormat))
+	addProperty(&entity, "validto", "Valid To", cert.NotAfter.UTC().Format(maltego.MaltegoDateTimeFormat))
+	addProperty(&entity, "altnames", "Alternative Names", strings.Join(cert.DNSNames, ", "))
+	addProperty(&entity, "signature.algorithm", "Signature Algorithm", cert.SignatureAlgorithm.String())
+
+	// Verify the certificate against the system roots,
+	// with the intermediates presented by the server.
+	intermediates := x509.NewCertPool()
+	for _, c := range chain {
+		intermediates.AddCert(c)
+	}
+	valid := "yes"
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates}); err != nil {
+		valid = err.Error()
+	}
+	addProperty(&entity, "valid", "Valid", valid)
+
+	return entity
+}
@@ -0,0 +1,231 @@
+package contrib
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// WhoisRootServer - The WHOIS server first queried for a domain,
+// which refers us to the authoritative server of its TLD.
+var WhoisRootServer = "whois.iana.org"
+
+// NewDomainToWhois - Returns a Transform querying the WHOIS record of a Domain.
+func NewDomainToWhois() maltego.Transform {
+	transform := maltego.NewTransform("To WHOIS Details", DomainToWhois)
+	transform.AddToSet("Gondor WHOIS")
+	return transform
+}
+
+// DomainToWhois - Query the WHOIS record of the input domain, following the referrals
+// from the IANA server down to the registrar one, and return the registrar, registrant
+// organization, name servers and contact email addresses found in the record.
+func DomainToWhois(t *maltego.Transform) (err error) {
+	domain := strings.ToLower(hostname(t))
+	if domain == "" {
+		return t.Errorf("No domain to query")
+	}
+
+	ctx, cancel := newContext(t)
+	defer cancel()
+
+	record, err := whoisLookup(ctx, t, domain)
+	if err != nil {
+		return t.Errorf("WHOIS query for %s failed: %s", domain, err)
+	}
+	if len(record.fields) == 0 {
+		t.Infof("No WHOIS record found for %s", domain)
+		return nil
+	}
+
+	// The registrar holds the registration details.
+	if registrar := record.get("registrar"); registrar != "" {
+		entity := maltego.NewForeignEntity(TypeOrganization, registrar)
+		addProperty(&entity, "whois.domain", "Domain", domain)
+		addProperty(&entity, "whois.created", "Creation Date", record.get("creation date", "created", "registered"))
+		addProperty(&entity, "whois.updated", "Updated Date", record.get("updated date", "last-update", "changed"))
+		addProperty(&entity, "whois.expires", "Expiry Date", record.get("registry expiry date", "registrar registration expiration date", "expiry date", "paid-till"))
+		addProperty(&entity, "whois.server", "WHOIS Server", record.server)
+		entity.AddLabel("WHOIS", "<pre>"+html.EscapeString(record.raw)+"</pre>")
+		t.AddEntity(entity)
+	}
+
+	if org := record.get("registrant organization", "org", "organisation"); org != "" {
+		t.AddEntity(maltego.NewForeignEntity(TypeOrganization, org))
+	}
+	for _, ns := range record.all("name server", "nserver") {
+		t.AddEntity(maltego.NewForeignEntity(TypeNSRecord, strings.ToLower(strings.Fields(ns)[0])))
+	}
+	for _, email := range record.emails() {
+		t.AddEntity(maltego.NewForeignEntity(TypeEmailAddress, email))
+	}
+
+	return nil
+}
+
+// whoisRecord - The parsed fields of a WHOIS response.
+type whoisRecord struct {
+	server string
+	raw    string
+	fields map[string][]string
+}
+
+// whoisLookup - Query the root WHOIS server, then follow its referrals until
+// we get the most specific record for the domain (generally the registrar one).
+func whoisLookup(ctx context.Context, t *maltego.Transform, domain string) (record whoisRecord, err error) {
+	server := WhoisRootServer
+	visited := map[string]bool{}
+
+	for server != "" && !visited[server] {
+		visited[server] = true
+
+		var raw string
+		err = t.Retry(maltego.DefaultRetryPolicy, func() (err error) {
+			raw, err = whoisQuery(ctx, server, domain)
+			return err
+		})
+		if err != nil {
+			// A failing registrar server should not hide the registry record.
+			if record.raw != "" {
+				t.Warnf("WHOIS server %s failed: %s", server, err)
+				return record, nil
+			}
+			return
+		}
+
+		next := parseWhois(server, raw)
+		if len(next.fields) > 0 {
+			record = next
+		}
+		server = next.get("refer", "whois", "registrar whois server")
+		server = strings.TrimPrefix(strings.TrimPrefix(server, "whois://"), "http://")
+	}
+
+	return
+}
+
+// whoisQuery - Send a single WHOIS query (RFC 3912) and return the raw response.
+func whoisQuery(ctx context.Context, server, domain string) (string, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(server, "43"))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(DefaultTimeout))
+	}
+
+	if _, err = fmt.Fprintf(conn, "%s\r\n", domain); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// parseWhois - Parse the "key: value" lines of a WHOIS response. Keys are
+// lowercased, and comments (lines starting with % or #) are ignored.
+func parseWhois(server, raw string) (record whoisRecord) {
+	record = whoisRecord{server: server, raw: raw, fields: map[string][]string{}}
+
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "%") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.Index(line, ":")
+		if sep <= 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:sep]))
+		value := strings.TrimSpace(line[sep+1:])
+		if value == "" {
+			continue
+		}
+		record.fields[key] = append(record.fields[key], value)
+	}
+
+	return
+}
+
+// get - Returns the first value found for any of the keys, in order.
+func (r whoisRecord) get(keys ...string) string {
+	for _, key := range keys {
+		if values := r.fields[key]; len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// all - Returns all the distinct values found for any of the keys.
+func (r whoisRecord) all(keys ...string) (values []string) {
+	seen := map[string]bool{}
+	for _, key := range keys {
+		for _, value := range r.fields[key] {
+			if !seen[strings.ToLower(value)] {
+				seen[strings.ToLower(value)] = true
+				values = append(values, value)
+			}
+		}
+	}
+	return
+}
+
+// emails - Returns all the distinct contact email addresses of the record.
+func (r whoisRecord) emails() (emails []string) {
+	var keys []string
+	for key := range r.fields {
+		if strings.Contains(key, "email") || strings.Contains(key, "e-mail") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	seen := map[string]bool{}
+	for _, key := range keys {
+		for _, value := range r.fields[key] {
+			email := strings.ToLower(value)
+			if !strings.Contains(email, "@") || seen[email] {
+				continue
+			}
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+	return
+}
@@ -0,0 +1,107 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+)
+
+// Deprecate - Mark the Transform as deprecated, with a message telling analysts what to use
+// instead (eg. "use ToIPAddress instead"). The Transform keeps running as usual, but each of
+// its runs adds this message to the output, shown by the Maltego client, and so do its docs.
+func (t *Transform) Deprecate(message string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if message == "" {
+		message = "it will be removed in a future release"
+	}
+	t.deprecation = message
+}
+
+// Deprecated - Returns the deprecation message of the Transform, if it is deprecated.
+func (t *Transform) Deprecated() (message string, deprecated bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.deprecation, t.deprecation != ""
+}
+
+// Alias - Add former URL paths at which the Transform keeps being served once registered,
+// so that renaming it does not break the graphs and configurations of analysts. Runs going
+// through an alias warn the analyst that the path should be updated. Aliases must be added
+// before the Transform is registered to a server.
+func (t *Transform) Alias(paths ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.aliases = append(t.aliases, paths...)
+}
+
+// Aliases - Returns the former URL paths at which the Transform is still served.
+func (t *Transform) Aliases() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return append([]string{}, t.aliases...)
+}
+
+// registerAliases - Serve a Transform registered at path at all its aliases as well.
+// An alias never shadows a Transform registered at the same path.
+func (ts *TransformServer) registerAliases(path string, t *Transform) {
+	for _, alias := range t.Aliases() {
+		if _, taken := ts.Transforms[alias]; taken || alias == path {
+			continue
+		}
+		ts.route(alias)
+		ts.aliases[alias] = path
+	}
+}
+
+// resolveTransform - Find the Transform registered at path, or at the path aliased by it,
+// in which case aliased is true.
+func (ts *TransformServer) resolveTransform(path string) (t *Transform, aliased bool) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	if t = ts.Transforms[path]; t != nil {
+		return t, false
+	}
+	if target, found := ts.aliases[path]; found {
+		return ts.Transforms[target], true
+	}
+	if latest, found := ts.versions[path]; found {
+		return ts.Transforms[latest], false
+	}
+	return nil, false
+}
+
+// warnDeprecated - Tell the analyst that the Transform is deprecated,
+// or that it was called through an alias path, which should be updated.
+func (t *Transform) warnDeprecated(path string, aliased bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.deprecation != "" {
+		t.messages = append(t.messages, MessageUI{
+			Text: fmt.Sprintf("Transform %s is deprecated: %s", t.Name, t.deprecation),
+			Type: "Partial",
+		})
+	}
+	if aliased {
+		t.messages = append(t.messages, MessageUI{
+			Text: fmt.Sprintf("Transform %s was called at its former path %s: update your Transform configuration", t.Name, path),
+			Type: "Partial",
+		})
+	}
+}
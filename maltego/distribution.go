@@ -19,6 +19,11 @@ package maltego
 */
 
 import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/maxlandon/gondor/maltego/configuration"
@@ -39,6 +44,10 @@ type Distribution struct {
 	transforms map[string]configuration.Transform       // Transforms write themselves to files
 	machines   map[string]Machine                       // Machines write themselves to files
 	servers    map[string]configuration.TransformServer // Servers write themselves to files
+	viewlets   map[string]Viewlet                       // Viewlets write themselves to files
+	aliases    aliasRegistry                            // The aliases of all Entities, must be unique
+	locales    map[string]Localizations                 // The localizations of Transforms, by name
+	sets       map[string]configuration.TransformSet    // The sets of Transforms, by name
 	// Assets
 
 	// Other
@@ -49,7 +58,13 @@ type Distribution struct {
 // with default operating parameters and empty contents.
 func NewDistribution() Distribution {
 	return Distribution{
-		mutex: &sync.RWMutex{},
+		entities:   map[string]Entity{},
+		transforms: map[string]configuration.Transform{},
+		viewlets:   map[string]Viewlet{},
+		aliases:    aliasRegistry{},
+		locales:    map[string]Localizations{},
+		sets:       map[string]configuration.TransformSet{},
+		mutex:      &sync.RWMutex{},
 	}
 }
 
@@ -57,18 +72,96 @@ func NewDistribution() Distribution {
 // Maltego Distribution - Contents Management -----------------------------------------
 //
 
-// RegisterEntity - Add an Entity to this distribution.
-func (d *Distribution) RegisterEntity(e ValidEntity) {
+// RegisterEntity - Add an Entity to this distribution. An error is returned, with a suggested
+// fix, if the alias of the Entity collides with the alias of another registered Entity, or
+// if its own properties have colliding aliases: in this case, the Entity is not registered.
+func (d *Distribution) RegisterEntity(e ValidEntity) error {
+	entity := e.AsEntity()
+	if err := entity.GetGoProperties(); err != nil {
+		return fmt.Errorf("Error marshalling Entity properties: %s", err)
+	}
+	if err := entity.checkAliases(); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.entities == nil {
+		d.entities = map[string]Entity{}
+		d.aliases = aliasRegistry{}
+	}
+	if err := d.aliases.add(&entity); err != nil {
+		return err
+	}
+	d.entities[strings.Join([]string{entity.Namespace, entity.Type}, ".")] = entity
+
+	return nil
 }
 
-// RegisterTransform - Register a Transform to this distribution.
+// inherits - Returns true if the registered Entity of the given fully qualified type
+// inherits from the base type, directly or through its own base Entities.
+func (d *Distribution) inherits(fqType, base string) bool {
+	if d.mutex == nil {
+		return false
+	}
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	seen := map[string]bool{}
+	types := []string{fqType}
+	for len(types) > 0 {
+		current := types[0]
+		types = types[1:]
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		entity, found := d.entities[current]
+		if !found {
+			continue
+		}
+		for _, name := range entity.baseEntities() {
+			if name == base {
+				return true
+			}
+			types = append(types, name)
+		}
+	}
+	return false
+}
+
+// RegisterTransform - Register a Transform to this distribution. For now, only its
+// localizations and sets are written in the distribution, and its definition and
+// settings if it is a local Transform (see Transform.SetLocal()).
 func (d *Distribution) RegisterTransform(t Transform) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.locales == nil {
+		d.locales = map[string]Localizations{}
+	}
+	if len(t.locales) > 0 {
+		d.locales[t.Name] = t.locales.clone()
+	}
+	d.addToSets(&t)
+	if t.isLocal() {
+		if d.transforms == nil {
+			d.transforms = map[string]configuration.Transform{}
+		}
+		d.transforms[t.Name] = t.toConfig(configuration.TransformAdapterLocalv2)
+	}
 }
 
 // RegisterMachine - Register a Machine to this distribution.
 func (d *Distribution) RegisterMachine(t Transform) {
 }
 
+// RegisterViewlet - Register a Viewlet to this distribution.
+// A viewlet with the same name as an existing one replaces it.
+func (d *Distribution) RegisterViewlet(v Viewlet) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.viewlets[v.Name] = v
+}
+
 // RegisterServer - Register a new Server to the distribution.
 // This function has the following effects:
 // - It merges the server Distribution contents with its own.
@@ -93,5 +186,102 @@ func (d *Distribution) Merge(ed *Distribution) {
 // a tree containing its contents, zip it into a Maltego Distribution file (.mtz) and
 // writes it to the specified path. The path must obviously be writable.
 func (d *Distribution) WriteToFile(path string) (err error) {
-	return
+	dir, err := os.MkdirTemp("", "gondor-mtz-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err = d.writeContents(dir); err != nil {
+		return err
+	}
+
+	return zipDirectory(dir, path)
+}
+
+//
+// Maltego Distribution - Internal Implementation -----------------------------------------
+//
+
+// writeContents - Write the configuration files of all contents in the dir tree.
+func (d *Distribution) writeContents(dir string) (err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	categories := map[string]bool{}
+	for id, entity := range d.entities {
+		if err = entity.writeConfig(dir); err != nil {
+			return fmt.Errorf("Error writing Entity %s: %s", id, err)
+		}
+		if entity.Category != "" {
+			categories[entity.Category] = true
+		}
+	}
+
+	// Declare the categories of all Entities, for the client to group them in its palette.
+	for name := range categories {
+		if err = (configuration.EntityCategory{Name: name}).WriteConfig(dir); err != nil {
+			return fmt.Errorf("Error writing Entity category %s: %s", name, err)
+		}
+	}
+
+	if err = d.writeLocalizations(dir); err != nil {
+		return err
+	}
+
+	for name, transform := range d.transforms {
+		if err = transform.WriteConfig(dir); err != nil {
+			return fmt.Errorf("Error writing Transform %s: %s", name, err)
+		}
+	}
+
+	for name, set := range d.nestedSets() {
+		if err = set.WriteConfig(dir); err != nil {
+			return fmt.Errorf("Error writing Transform set %s: %s", name, err)
+		}
+	}
+
+	for name, viewlet := range d.viewlets {
+		if err = viewlet.writeConfig(dir); err != nil {
+			return fmt.Errorf("Error writing Viewlet %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// zipDirectory - Zip the contents of a directory tree into a file.
+func zipDirectory(dir, path string) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	err = filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		w, err := archive.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		archive.Close()
+		return err
+	}
+
+	return archive.Close()
 }
@@ -0,0 +1,271 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
+)
+
+//
+// Transform Pack Documentation ------------------------------------------------------------------
+//
+// The documentation of a Transform pack is generated from the same metadata that
+// builds its Maltego Distribution (.mtz): the Entities with their fields, the Transforms
+// with their input/output Entities and settings. Analysts can thus read what a pack
+// offers without having to install it, nor to read any Go code.
+
+// DocFormat - The format of a generated documentation.
+type DocFormat string
+
+const (
+	// DocMarkdown - A single Markdown document (eg. for a README, or a wiki).
+	DocMarkdown DocFormat = "markdown"
+	// DocHTML - A single, standalone HTML page.
+	DocHTML DocFormat = "html"
+)
+
+// docs - The contents of a documentation, whatever its format.
+type docs struct {
+	Title      string
+	Entities   []entityDoc
+	Transforms []helpPage
+}
+
+// entityDoc - The documentation of an Entity type.
+type entityDoc struct {
+	Type        string
+	DisplayName string
+	Description string
+	Category    string
+	Bases       []string
+	Fields      []configuration.EntityField
+}
+
+// newEntityDoc - Gather the information of an Entity, and of its properties.
+func newEntityDoc(e Entity) entityDoc {
+	doc := entityDoc{
+		Type:        entityTypeName(e),
+		DisplayName: e.DisplayName,
+		Description: e.Description,
+		Category:    e.Category,
+		Bases:       e.baseEntities(),
+		Fields:      e.configFields(),
+	}
+	if doc.DisplayName == "" {
+		doc.DisplayName = getDisplayName(e.Type)
+	}
+	return doc
+}
+
+// WriteDocs - Write the documentation of all Entities
+// registered to the distribution, in the given format.
+func (d *Distribution) WriteDocs(w io.Writer, format DocFormat) error {
+	doc := docs{Title: "Maltego Distribution"}
+	d.collectDocs(&doc, map[string]bool{})
+	return doc.write(w, format)
+}
+
+// WriteDocs - Write the documentation of the server Transforms, of all Entities
+// they use or that are registered to the server.
+func (ts *TransformServer) WriteDocs(w io.Writer, format DocFormat) error {
+	doc := docs{Title: ts.Name + " Transforms"}
+	seen := map[string]bool{}
+	ts.Distribution.collectDocs(&doc, seen)
+
+	ts.mutex.RLock()
+	var entities []ValidEntity
+	for _, transform := range ts.Transforms {
+		doc.Transforms = append(doc.Transforms, newHelpPage(transform))
+		if transform.input != nil {
+			entities = append(entities, transform.input)
+		}
+		entities = append(entities, transform.output...)
+	}
+	ts.mutex.RUnlock()
+
+	// Entities used by Transforms but not registered are documented as well.
+	for _, e := range entities {
+		entity := e.AsEntity()
+		if seen[entityTypeName(entity)] {
+			continue
+		}
+		if err := entity.GetGoProperties(); err != nil {
+			return fmt.Errorf("Error marshalling Entity properties: %s", err)
+		}
+		seen[entityTypeName(entity)] = true
+		doc.Entities = append(doc.Entities, newEntityDoc(entity))
+	}
+
+	return doc.write(w, format)
+}
+
+// RunDocsCommand - Write the documentation of the server from command line arguments:
+//
+//	transforms docs -format html -output transforms.html
+//
+// The documentation is written as Markdown on the standard output by default.
+func (ts *TransformServer) RunDocsCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("docs", flag.ContinueOnError)
+	format := flags.String("format", string(DocMarkdown), "format of the documentation (markdown or html)")
+	output := flags.String("output", "", "file to write the documentation to (default: standard output)")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return ts.WriteDocs(w, DocFormat(*format))
+}
+
+// collectDocs - Add the registered Entities to a documentation.
+func (d *Distribution) collectDocs(doc *docs, seen map[string]bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	for id, entity := range d.entities {
+		seen[id] = true
+		doc.Entities = append(doc.Entities, newEntityDoc(entity))
+	}
+}
+
+// write - Sort the documentation contents, and render them in the given format.
+func (doc docs) write(w io.Writer, format DocFormat) error {
+	sort.Slice(doc.Entities, func(i, j int) bool { return doc.Entities[i].Type < doc.Entities[j].Type })
+	sort.Slice(doc.Transforms, func(i, j int) bool { return doc.Transforms[i].Name < doc.Transforms[j].Name })
+
+	// Render into a buffer, so that nothing is written on error.
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case DocMarkdown, "md", "":
+		err = markdownDocsTemplate.Execute(&buf, doc)
+	case DocHTML:
+		err = htmlDocsTemplate.Execute(&buf, doc)
+	default:
+		return fmt.Errorf("Invalid documentation format %q (must be markdown or html)", format)
+	}
+	if err != nil {
+		return fmt.Errorf("Error rendering documentation: %s", err)
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// anchor - The identifier of a documentation section, for links to it.
+func anchor(name string) string {
+	return strings.NewReplacer(".", "-", "/", "-", " ", "-").Replace(strings.ToLower(name))
+}
+
+// markdownCell - Escape a value for a Markdown table cell.
+func markdownCell(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(fmt.Sprintf("%v", value))
+}
+
+// markdownDocsTemplate - The documentation of a Transform pack, as Markdown.
+var markdownDocsTemplate = template.Must(template.New("markdown").Funcs(template.FuncMap{
+	"anchor": anchor,
+	"cell":   markdownCell,
+}).Parse(`# {{.Title}}
+{{if .Transforms}}
+## Transforms
+{{range .Transforms}}
+### {{.DisplayName}}
+
+` + "`{{.Name}}`" + `{{with .Version}} · version {{.}}{{end}}{{with .Author}} · by {{.}}{{end}}{{with .Owner}} · {{.}}{{end}}
+{{with .Deprecated}}
+> **Deprecated:** {{.}}
+{{end}}{{with .Description}}
+{{.}}
+{{end}}{{with .Help}}
+{{.}}
+{{end}}
+- Input: {{if .Input}}[` + "`{{.Input}}`" + `](#{{anchor .Input}}){{else}}any Entity type{{end}}
+- Output: {{range $i, $o := .Output}}{{if $i}}, {{end}}[` + "`{{$o}}`" + `](#{{anchor $o}}){{else}}any Entity type{{end}}
+{{if .Settings}}
+| Setting | Description | Default | Optional |
+| --- | --- | --- | --- |
+{{range .Settings}}| ` + "`{{.Name}}`" + ` | {{cell .Description}} | {{cell .Default}} | {{if .Optional}}yes{{else}}no{{end}} |
+{{end}}{{end}}{{with .Disclaimer}}
+> **Disclaimer:** {{.}}
+{{end}}{{end}}{{end}}{{if .Entities}}
+## Entities
+{{range .Entities}}
+<a id="{{anchor .Type}}"></a>
+### {{.Type}}
+
+**{{.DisplayName}}**{{with .Category}} ({{.}}){{end}}{{with .Description}} – {{.}}{{end}}
+{{with .Bases}}
+Inherits from: {{range $i, $b := .}}{{if $i}}, {{end}}` + "`{{$b}}`" + `{{end}}
+{{end}}{{if .Fields}}
+| Property | Display name | Type | Group | Description | Default |
+| --- | --- | --- | --- | --- | --- |
+{{range .Fields}}| ` + "`{{.Name}}`" + ` | {{cell .DisplayName}} | {{.Type}} | {{cell .Group}} | {{cell .Description}} | {{cell .DefaultValue}} |
+{{end}}{{end}}{{end}}{{end}}`))
+
+// htmlDocsTemplate - The documentation of a Transform pack, as a standalone HTML page.
+var htmlDocsTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+	"anchor": anchor,
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title>` + helpStyle + `</head><body>
+<h1>{{.Title}}</h1>
+{{if .Transforms}}<h2>Transforms</h2>
+{{range .Transforms}}<h3 id="{{anchor .Name}}">{{.DisplayName}}</h3>
+<p class="meta">{{.Name}}{{with .Version}} &middot; version {{.}}{{end}}{{with .Author}} &middot; by {{.}}{{end}}{{with .Owner}} &middot; {{.}}{{end}}</p>
+{{with .Deprecated}}<p class="disclaimer"><strong>Deprecated:</strong> {{.}}</p>{{end}}
+{{with .Description}}<p>{{.}}</p>{{end}}
+{{with .Help}}<p>{{.}}</p>{{end}}
+<p>Input: {{if .Input}}<a href="#{{anchor .Input}}"><code>{{.Input}}</code></a>{{else}}any Entity type{{end}}</p>
+<p>Output: {{range $i, $o := .Output}}{{if $i}}, {{end}}<a href="#{{anchor $o}}"><code>{{$o}}</code></a>{{else}}any Entity type{{end}}</p>
+{{if .Settings}}<table><tr><th>Setting</th><th>Description</th><th>Default</th><th>Optional</th></tr>
+{{range .Settings}}<tr><td><code>{{.Name}}</code></td><td>{{.Description}}</td><td>{{with .Default}}{{.}}{{end}}</td><td>{{if .Optional}}yes{{else}}no{{end}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Disclaimer}}<p class="disclaimer">{{.}}</p>{{end}}
+{{end}}{{end}}
+{{if .Entities}}<h2>Entities</h2>
+{{range .Entities}}<h3 id="{{anchor .Type}}">{{.Type}}</h3>
+<p><strong>{{.DisplayName}}</strong>{{with .Category}} ({{.}}){{end}}{{with .Description}} &ndash; {{.}}{{end}}</p>
+{{with .Bases}}<p>Inherits from: {{range $i, $b := .}}{{if $i}}, {{end}}<code>{{$b}}</code>{{end}}</p>{{end}}
+{{if .Fields}}<table><tr><th>Property</th><th>Display name</th><th>Type</th><th>Group</th><th>Description</th><th>Default</th></tr>
+{{range .Fields}}<tr><td><code>{{.Name}}</code></td><td>{{.DisplayName}}</td><td>{{.Type}}</td><td>{{.Group}}</td><td>{{.Description}}</td><td>{{.DefaultValue}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}{{end}}
+</body></html>
+`))
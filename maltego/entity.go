@@ -21,8 +21,7 @@ package maltego
 import (
 	"fmt"
 	"reflect"
-	"runtime/debug"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 
@@ -42,6 +41,29 @@ type ValidEntity interface {
 	AsEntity() Entity // The type is able to wrap itself into a maltego.Entity
 }
 
+// EntityDisplayNamer - An optional interface for native Go Entity types,
+// overriding the display name derived from the type name by NewEntity().
+type EntityDisplayNamer interface {
+	EntityDisplayName() string
+}
+
+// EntityNamespacer - An optional interface for native Go Entity types,
+// overriding the namespace derived from their Go package by NewEntity().
+type EntityNamespacer interface {
+	EntityNamespace() string
+}
+
+// EntityOption - An option applied to an Entity created by NewEntity().
+type EntityOption func(e *Entity)
+
+// WithNamespace - Set the Maltego namespace of the Entity (eg. "acme.recon"),
+// overriding the one declared by its type, or derived from its Go package.
+func WithNamespace(namespace string) EntityOption {
+	return func(e *Entity) {
+		e.Namespace = namespace
+	}
+}
+
 // Entity - A Go representation of a Maltego Entity type.
 // Because the Maltego client might pass Entities inputs that are not Go native types,
 // (or Go types not known to this program), this Entity type contains all properties and
@@ -51,10 +73,10 @@ type Entity struct {
 	// Base properties
 	Namespace   string `xml:"-"` // The Maltego namespace of this entity (Maltego entities always fit within a tree)
 	DisplayName string // Defaults to the camelCase-split Entity type if Go native.
-	Alias       string `xml:"-"`         // The alias under which the Entity can be searched for/ grabbed.
+	Alias       string `xml:"-"`         // The alias under which the Entity can be searched for/ grabbed (derived if empty).
 	Type        string `xml:"Type,attr"` // The string representation of the Entity type (determined through reflection)
 	Description string `xml:"-"`
-	Category    string `xml:"-"`      // The category of entities to which this category belongs (eg: a DNS server => services)
+	Category    string `xml:"-"`      // The palette category of the Entity type (eg: a DNS server => "Infrastructure")
 	Value       string `xml:",cdata"` // The value of the Entity, used by the Maltego client
 	Weight      int    `xml:"Weight"` // The weight attributed to this entity on the graph
 
@@ -83,8 +105,13 @@ type Entity struct {
 	Properties Properties `xml:"AdditionalFields"`
 
 	// Operating
-	mutex *sync.RWMutex `xml:"-"` // Concurrency management
-	data  interface{}   `xml:"-"` // Underlying native Go struct, holds base fields with struct tags, might be nil
+	mutex         *sync.RWMutex                    `xml:"-"` // Concurrency management
+	data          interface{}                      `xml:"-"` // Underlying native Go struct, holds base fields with struct tags, might be nil
+	colors        map[OverlayPosition]overlayColor `xml:"-"` // Colour overlays computed from property values
+	weightSet     bool                             `xml:"-"` // The weight has been set explicitly, with SetWeight()
+	confidence    float64                          `xml:"-"` // How sure the Transform is about the Entity, from 0 to 1
+	confidenceSet bool                             `xml:"-"` // The confidence has been set with SetConfidence()
+	locales       Localizations                    `xml:"-"` // Localized display names and descriptions, by locale
 }
 
 // NewEntity - Instantiate a new Entity type. The interface data passed as parameter
@@ -95,6 +122,15 @@ type Entity struct {
 // for the Entity, but not its struct fields: this is because you should not ever need
 // them after this function. Transforms only care about Go native types.
 //
+// Besides all basic Go types, fields of type time.Time, net.IP, net.IPNet and url.URL
+// (or pointers to them) are natively converted to and from property values: dates
+// are passed in the Maltego format (see MaltegoDateTimeFormat). Any other type implementing
+// encoding.TextMarshaler and encoding.TextUnmarshaler (ULIDs, enums, etc) is converted to
+// and from property values with its own implementations.
+// Slices and maps of structs (eg. []Host, map[string]Port) are marshalled element by
+// element, as properties namespaced with their index or key (eg. hosts.0.ip, hosts.1.ip),
+// and rebuilt when unmarshalling. Map keys should therefore not contain any dot.
+//
 // Struct Tags & Type Compliance:
 //
 // The following is an exhaustive list of all valid and/or required struct
@@ -109,43 +145,123 @@ type Entity struct {
 // overlay:"W,image"      - Use the field as an overlay: notation is <Position>,<type>.
 //                          Valid positions: W, N, S, C, NW, SW
 //                          Valid types: text, image, colour/color
-//                          If color is used, must be a valid RGB format (eg. #45e06f)
-// hidden:"yes"           - If not nil, the field is hidden in the Properties Window.
+//                          If color is used, the field value must be a valid RGB code
+//                          (eg. #45e06f) or a palette color name (eg. red).
+// hidden:"yes"           - If not empty, the field is hidden in the Properties Window.
+// readonly:"yes"         - If not empty, the user cannot edit the field from the Maltego GUI.
+//                          On a struct field, hidden and readonly apply to all its fields.
 // sample:"127.0.0.1"     - A value used when the Entity is created manually in Maltego.
 // default:"0.0.0.0"      - A value that is always populated by default.
+// base:"maltego.Domain"  - The Entity inherits from this Maltego type (see SetBase()).
+//                          On an embedded Entity type, any value (eg. "yes") is enough.
+// validate:"^\\d+$"      - A regular expression that non-empty values must match:
+//                          checked before the Entity is added to a Transform output,
+//                          and written as a field constraint in Entity configurations.
+// group:"Network"        - The section of the Properties window holding the field. On a
+//                          struct field, applies to all fields of the struct by default.
+// maltego:"-"            - The field is never marshalled into, nor unmarshalled from,
+//                          properties, whatever its other tags: use it for sensitive
+//                          data like private keys or internal IDs.
+//
+// Display Name:
+//
+// The Entity display name defaults to the type name split on its words ("DNSToIP" gives
+// "DNS To IP"). You can override it either by implementing the EntityDisplayNamer interface,
+// or with a display tag on a blank field of the type, as you would for an XMLName:
 //
-func NewEntity(data interface{}) Entity {
+//	type DNSToIP struct {
+//		_ struct{} `display:"Resolved Domain"`
+//	}
+//
+// Namespace:
+//
+// The Entity namespace defaults to the Go package path of the type, which changes whenever
+// the module is renamed. To use a short and stable namespace (eg. "acme.recon") instead, in
+// order of precedence: pass the WithNamespace() option, implement the EntityNamespacer
+// interface, use a namespace tag on a blank field, or register a namespace for all types
+// of the package with RegisterNamespace().
+//
+//	type DNSToIP struct {
+//		_ struct{} `namespace:"acme.recon"`
+//	}
+//
+func NewEntity(data interface{}, opts ...EntityOption) Entity {
 	e := Entity{
 		Overlays:   Overlays{},
 		Properties: Properties{},
 		mutex:      &sync.RWMutex{},
 		data:       data,
+		colors:     map[OverlayPosition]overlayColor{},
 	}
 
-	// Get the namespace + Name from the Go runtime package + type
-	e.Namespace = reflect.TypeOf(data).Elem().PkgPath()
+	// Get the namespace + Name from the Go runtime package + type,
+	// unless the type or its package declares its own namespace.
+	e.Namespace = typeNamespace(data)
 	e.Type = reflect.TypeOf(data).Elem().Name()
 
-	bi, ok := debug.ReadBuildInfo()
-	if ok {
-		e.Namespace = strings.Join([]string{bi.Main.Path, e.Namespace}, "/")
+	// Set the Display name to the type name with spaces and caps,
+	// unless the type declares its own display name.
+	e.DisplayName = getDisplayName(e.Type)
+	if name := typeDisplayName(data); name != "" {
+		e.DisplayName = name
 	}
+	e.Category = typeTag(data, "category")
 
-	// Set the Display name to the type name with spaces and caps
-	e.DisplayName = e.Type
+	for _, opt := range opts {
+		opt(&e)
+	}
 
-	// name := "DNSToIp"
-	// re := regexp.MustCompile(`([0-9]+)`)
-	// name = re.ReplaceAllString(name, "$1")
-	// fmt.Println(name)
-	// re2 := regexp.MustCompile(`([a-z])([A-Z]+)`)
-	// name = re2.ReplaceAllString(name, "$1$1")
-	// fmt.Println(name)
-	// re3 := regexp.MustCompile(`([A-Z]+)([A-Z][a-z])`)
-	// name = re3.ReplaceAllString(name, "$1$1")
-	// fmt.Println(name)
-	// re := regexp.MustCompile(`[A-Z][a-z]+|[A-Z]+(![a-z])`)
-	// e.DisplayName = strings.Join(re.FindAllString(e.Type, -1), " ")
+	return e
+}
+
+// NewEntityDefault - Works exactly like NewEntity(), but first applies the default:"value"
+// struct tags of the type: any tagged field still holding the zero value of its type is
+// populated with the default value (converted into its type), including in nested structs.
+// This is generally the constructor you want to call from your type's AsEntity() method.
+func NewEntityDefault(data interface{}, opts ...EntityOption) Entity {
+	setDefaultValues(reflect.ValueOf(data))
+	return NewEntity(data, opts...)
+}
+
+// packageNamespaces - The Maltego namespaces of all types of Go packages, by package path.
+var packageNamespaces = struct {
+	names map[string]string
+	mutex *sync.RWMutex
+}{
+	names: map[string]string{},
+	mutex: &sync.RWMutex{},
+}
+
+// RegisterNamespace - Set the Maltego namespace (eg. "acme.recon") of all Entity types
+// declared in a Go package, given its import path (eg. "github.com/acme/recon/entities"),
+// unless they declare their own. Call it before creating any Entity of these types.
+func RegisterNamespace(goPackage, namespace string) {
+	packageNamespaces.mutex.Lock()
+	defer packageNamespaces.mutex.Unlock()
+	packageNamespaces.names[goPackage] = namespace
+}
+
+// NewForeignEntity - Instantiate a base Entity for a Maltego type that is not backed by
+// any native Go type (eg. "maltego.Domain"), given its fully qualified type and value.
+// This is useful when building Entities out of any Maltego context (RPC, local runs),
+// or when you want to return Entities of a type that you don't have in your Go code.
+func NewForeignEntity(fqType, value string) Entity {
+	e := Entity{
+		Value:      value,
+		Overlays:   Overlays{},
+		Properties: Properties{},
+		mutex:      &sync.RWMutex{},
+		colors:     map[OverlayPosition]overlayColor{},
+	}
+
+	// The namespace is everything before the last dot, if any.
+	if dot := strings.LastIndex(fqType, "."); dot != -1 {
+		e.Namespace = fqType[:dot]
+		e.Type = fqType[dot+1:]
+	} else {
+		e.Type = fqType
+	}
+	e.DisplayName = e.Type
 
 	return e
 }
@@ -168,12 +284,45 @@ func (e Entity) AsEntity() Entity {
 	return e
 }
 
+// Clone - Returns a deep copy of the Entity: its properties, overlays, labels and link
+// are not shared with the original, so that a transform can emit several variants of
+// the same (eg. input) Entity. Note that AsEntity() or a plain assignment only copies
+// the Entity shallowly, and that modifying the copy would then modify the original.
+// The underlying native Go type (if any) and the Base Entity are still shared.
+func (e *Entity) Clone() Entity {
+	e.ensureInitialized()
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	clone := *e
+	clone.mutex = &sync.RWMutex{}
+	clone.Link = e.Link.clone()
+	clone.Labels = append([]Label(nil), e.Labels...)
+
+	clone.Properties = make(Properties, len(e.Properties))
+	for name, property := range e.Properties {
+		clone.Properties[name] = property.clone()
+	}
+	clone.Overlays = make(Overlays, len(e.Overlays))
+	for pos, overlay := range e.Overlays {
+		clone.Overlays[pos] = overlay
+	}
+	clone.colors = make(map[OverlayPosition]overlayColor, len(e.colors))
+	for pos, color := range e.colors {
+		clone.colors[pos] = color
+	}
+	clone.locales = e.locales.clone()
+
+	return clone
+}
+
 // SetBase - An entity inherits all the properties of its base Entity, if it has one.
 // Because some of these properties might happen to be settings of various kinds
 // (display labels, icons, etc), this Entity will by default inherit them as well.
 //
 // You can also set the base for your Entity with struct tags, with base:"yes"
-// (any non-nil "" value is enough).
+// (any non-nil "" value is enough) on an embedded Entity type, or by naming
+// any Maltego type in the tag of any field, like base:"maltego.Domain".
 //
 // This function is therefore useful when for some reason, you don't want or cannot
 // embed a type in yours for acting as a Base (ex: when your Entity is a type alias).
@@ -185,6 +334,15 @@ func (e *Entity) SetBase(base ValidEntity) {
 	e.base = base
 }
 
+// SetCategory - Set the category of the Entity type, under which it is grouped in the
+// Entity palette of the Maltego client. Distributions declare all categories of their
+// Entities. You can also set it with a category:"" tag on a blank field of your type.
+func (e *Entity) SetCategory(category string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.Category = category
+}
+
 // Property - Returns the string value of a Property field (regardless of its true,
 // underlying type), given the name (key) of the field as argument. If not found,
 // the function returns an empty string.
@@ -221,9 +379,39 @@ func (e *Entity) Field(name string) *Field {
 // Note that you can't directly set a field as an overlay when declaring it
 // through this function. You need to reference it again in Entity.AddOverlay().
 func (e *Entity) AddProperty(p Field) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.Properties[p.Name] = p
+}
+
+// AddField - Add a property field to the Entity, exactly like AddProperty().
+// If the field has no value but has a DefaultValue, the latter is used. Its
+// sample and default values are kept for when producing Entity configurations.
+func (e *Entity) AddField(f Field) {
+	if f.Value == nil && f.DefaultValue != nil {
+		f.Value = f.DefaultValue
+	}
+	e.AddProperty(f)
+}
+
+// Validate - Check the value of all Entity properties against their validation
+// pattern (Field.Validate), and return an error on the first invalid one.
+func (e *Entity) Validate() error {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
-	e.Properties[p.Name] = p
+
+	names := make([]string, 0, len(e.Properties))
+	for name := range e.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := e.Properties[name].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // AddOverlay - Set one of the Entity's overlay items, specifying three things:
@@ -231,41 +419,113 @@ func (e *Entity) AddProperty(p Field) {
 // - Its position, which is a Go enum so that you can't pass an invalid one.
 // - Its type, also as a Go enum to avoid invalid ones.
 //
+// Text and colour overlays must reference an existing property of the Entity, so you
+// should add it first. The value of a colour overlay property must be a valid RGB code
+// (eg. #45e06f). If the overlay is invalid, it is not added and an error is returned.
+//
 // Note that you can also specify entity fields as overlays when tagging a native
 // Go type fields with the appropriate tags (overlay:"W,text", overlay:"N,image", etc).
 // Please refer to the NewEntity() function documentation for info on these tags.
-func (e *Entity) AddOverlay(value string, pos OverlayPosition, oType OverlayType) {
-	e.mutex.RLock()
-	defer e.mutex.RUnlock()
+func (e *Entity) AddOverlay(value string, pos OverlayPosition, oType OverlayType) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	overlay := Overlay{
 		PropertyName: value,
 		Position:     pos,
 		Type:         oType,
 	}
+
+	// Colour overlay properties may hold color names: store their RGB code.
+	if property, found := e.Properties[value]; found && oType == OverlayColour && property.Value != nil {
+		property.Value = colorCode(fmt.Sprintf("%v", property.Value))
+		e.Properties[value] = property
+	}
+
+	if err := e.validateOverlay(overlay); err != nil {
+		return err
+	}
 	e.Overlays[pos] = overlay
+	delete(e.colors, pos)
+
+	return nil
+}
+
+// AddColorOverlay - Set a colour overlay whose color is computed by a callback, given
+// the value of one of the Entity's properties (eg. red if a score is above a threshold).
+// The callback is called each time the Entity is marshalled, and must return a valid RGB
+// code (eg. #45e06f) or palette color name (eg. "red", see ParseColor()): the property
+// does not need to exist when calling this function.
+func (e *Entity) AddColorOverlay(property string, pos OverlayPosition, color OverlayColorFunc) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !isOverlayPosition(string(pos)) {
+		return fmt.Errorf("Invalid overlay position %q (valid: N, S, W, NW, SW, C)", pos)
+	}
+	if color == nil {
+		return fmt.Errorf("No color function for %s overlay on property %q", pos, property)
+	}
+	if e.colors == nil {
+		e.colors = map[OverlayPosition]overlayColor{}
+	}
+	e.colors[pos] = overlayColor{property: property, color: color}
+	e.Overlays[pos] = Overlay{
+		PropertyName: overlayColorProperty(pos),
+		Position:     pos,
+		Type:         OverlayColour,
+	}
+
+	return nil
 }
 
 // AddLabel - Add a specific Display information to this Entity.
 // If the title argument is nil (""), it will default to "Info".
 func (e *Entity) AddLabel(title, content string) {
-	e.mutex.RLock()
-	defer e.mutex.RUnlock()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	if title == "" {
 		title = "Info"
 	}
 	e.Labels = append(e.Labels, Label{
 		Name:    title,
 		Content: content,
-		Type:    "text/html", // Fixed for all labels
+		Type:    LabelTypeHTML, // Fixed for all labels
 	})
 }
 
-// SetNote - Set the note for this Entity.
-func (e *Entity) SetNote(note string) {
+// Notes - Returns the notes of this Entity, generally set by a previous
+// Transform or by the analyst, when this Entity is a Transform input.
+func (e *Entity) Notes() string {
+	return e.Property(notesProperty)
+}
+
+// BookmarkColor - Returns the bookmark color of this Entity, generally set by the analyst
+// when this Entity is a Transform input, or BOOKMARK_COLOR_NONE if it is not bookmarked.
+func (e *Entity) BookmarkColor() BookmarkColor {
+	bookmark := e.Property(bookmarkProperty)
+	if bookmark == "" {
+		bookmark = e.Property(legacyBookmarkProperty)
+	}
+	if bookmark == "" {
+		bookmark = string(e.Bookmark)
+	}
+	if bookmark == "" {
+		return BOOKMARK_COLOR_NONE
+	}
+	return BookmarkColor(bookmark)
+}
+
+// GetLabels - Returns a copy of the labels (display information) of this Entity,
+// including those sent along the Entity when it is a Transform input.
+func (e *Entity) GetLabels() []Label {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
+	return append([]Label{}, e.Labels...)
+}
+
+// SetNote - Set the note for this Entity.
+func (e *Entity) SetNote(note string) {
 	e.AddProperty(Field{
-		Name:    "notes#",
+		Name:    notesProperty,
 		Display: "Notes",
 		Value:   note,
 	})
@@ -292,6 +552,11 @@ func (e *Entity) Unmarshal(eType ValidEntity) (err error) {
 	realval := reflect.Indirect(ptrval)
 	e.unmarshalStruct("", realval, nil)
 
+	// Canonicalize the values of the Go type, if it knows how to.
+	if normalizer, ok := eType.(Normalizer); ok {
+		normalizer.Normalize()
+	}
+
 	return
 }
 
@@ -300,46 +565,23 @@ func (e *Entity) Unmarshal(eType ValidEntity) (err error) {
 //
 
 // getDisplayProperties - Creates Entity properties from some builtin
-// types of the Go Entity, like Links, Bookmarks, etc.
+// types of the Go Entity, like Links, Bookmarks, etc. Called on all
+// output Entities, after their Go properties (see GetGoProperties()).
 func (e *Entity) getDisplayProperties() (err error) {
 
-	// The link should add all its content to the list of properties
-	e.AddProperty(Field{
-		Name:    "link#maltego.link.color",
-		Display: "LinkColor",
-		Value:   e.Link.Color,
-	})
-	e.AddProperty(Field{
-		Name:    "link#maltego.link.style",
-		Display: "LinkStyle",
-		Value:   e.Link.Style,
-	})
-	e.AddProperty(Field{
-		Name:    "link#maltego.link.thickness",
-		Display: "Thickness",
-		Value:   e.Link.Thickness,
-	})
-	e.AddProperty(Field{
-		Name:    "link#maltego.link.label",
-		Display: "Label",
-		Value:   e.Link.Label,
-	})
-	e.AddProperty(Field{
-		Name:         "link#maltego.link.direction",
-		Display:      "link#maltego.link.direction", // ??
-		MatchingRule: MatchLoose,
-		Value:        e.Link.Direction,
-	})
-	for _, property := range e.Link.properties {
+	// The link adds all its content (builtin and custom fields) to the list of properties
+	for _, property := range e.Link.toProperties() {
 		e.AddProperty(property)
 	}
 
-	// The bookmark as a property
-	e.AddProperty(Field{
-		Name:    "bookmark#",
-		Display: "Bookmark",
-		Value:   e.Bookmark,
-	})
+	// The bookmark as a property, if the Entity has one
+	if e.Bookmark != "" {
+		e.AddProperty(Field{
+			Name:    bookmarkProperty,
+			Display: "Bookmark",
+			Value:   e.Bookmark,
+		})
+	}
 
 	return
 }
@@ -353,32 +595,49 @@ func (e *Entity) setDisplayProperties(base Entity) {
 		e.Properties[prop.Name] = prop
 	}
 
-	// Link
-	e.Link.Color = e.Property("link#maltego.link.color")
-	style, _ := strconv.Atoi(e.Property("link#maltego.link.style"))
-	e.Link.Style = LinkStyle(style)
-	thickness, _ := strconv.Atoi(e.Property("link#maltego.link.thickness"))
-	e.Link.Thickness = LineThickness(thickness)
-	e.Link.Label = e.Property("link#maltego.link.label")
-	e.Link.Direction = LinkDirection(e.Property("link#maltego.link.direction"))
-	// Link properties
+	// Link, with its builtin settings and custom properties
+	e.Link.fromProperties(e.Properties)
 
 	// Bookmark
-	e.Bookmark = BookmarkColor(e.Property("#bookmark"))
+	e.Bookmark = e.BookmarkColor()
 
 	// Labels
 	e.Labels = append(base.Labels, e.Labels...)
 }
 
-func (e *Entity) hasBaseEntity() (yes bool, name string) {
-	if e.data == nil {
-		return false, ""
+// ensureInitialized - Entities decoded from requests (or declared as literals) do not
+// go through a constructor: make sure their mutex and property maps are usable.
+func (e *Entity) ensureInitialized() {
+	if e.mutex == nil {
+		e.mutex = &sync.RWMutex{}
+	}
+	if e.Properties == nil {
+		e.Properties = Properties{}
+	}
+	if e.Overlays == nil {
+		e.Overlays = Overlays{}
+	}
+}
+
+// baseEntities - Returns the fully qualified types of all the Entities this Entity
+// inherits from, for the BaseEntities of its configuration: the one set with SetBase(),
+// and those declared with base:"" struct tags. A tag value containing a dot is used as
+// is (eg. base:"maltego.Domain"), otherwise the type is the one of the tagged field.
+func (e *Entity) baseEntities() (names []string) {
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name != "" && name != "." && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
 	}
 
 	if e.base != nil {
-		b := base.AsEntity()
-		name = strings.Join([]string{b.Namespace, b.Type}, ".")
-		return true, name
+		b := e.base.AsEntity()
+		add(strings.Join([]string{b.Namespace, b.Type}, "."))
+	}
+	if e.data == nil {
+		return
 	}
 
 	// Get the reflect value here. The type is only
@@ -396,8 +655,20 @@ func (e *Entity) hasBaseEntity() (yes bool, name string) {
 		fieldValue := entityValue.Field(fieldCount) // Can be nil
 		fieldType := entityValue.Type().Field(fieldCount)
 
-		// We can't read unexported fields, nor
-		if !fieldType.IsExported() {
+		// We can't read unexported fields, nor those excluded by their tag.
+		if !isMarshalled(fieldType) {
+			continue
+		}
+
+		// Only fields marked as a Base entity are of interest.
+		tag, isBaseEntity := fieldType.Tag.Lookup("base")
+		if !isBaseEntity {
+			continue
+		}
+
+		// The tag might directly name a (foreign) Maltego type.
+		if strings.Contains(tag, ".") {
+			add(tag)
 			continue
 		}
 
@@ -410,33 +681,34 @@ func (e *Entity) hasBaseEntity() (yes bool, name string) {
 			realValue = fieldValue
 		}
 
-		// If the type is marked as a Base entity, check and process it.
-		if _, isBaseEntity := fieldType.Tag.Lookup("base"); isBaseEntity {
-			// Check the underlying type is a maltego.ValidEntity type.
-			// If we have a Maltego Entity type, this is our base.
-			validEntity := reflect.TypeOf((*ValidEntity)(nil)).Elem()
-			if realValue.Type().Implements(validEntity) {
-				base, ok := realValue.Interface().(ValidEntity)
-				if !ok {
-					continue
-				}
-				// Else we're good, forge the complete name.
-				b := base.AsEntity()
-				name = strings.Join([]string{b.Namespace, b.Type}, ".")
-				return true, name
-			}
+		// Check the underlying type is a maltego.ValidEntity type.
+		// If we have a Maltego Entity type, this is our base.
+		// Types implementing it with pointer receivers are used through their address.
+		validEntity := reflect.TypeOf((*ValidEntity)(nil)).Elem()
+		if !realValue.Type().Implements(validEntity) && realValue.CanAddr() {
+			realValue = realValue.Addr()
 		}
+		if !realValue.Type().Implements(validEntity) {
+			continue
+		}
+		base, ok := realValue.Interface().(ValidEntity)
+		if !ok {
+			continue
+		}
+
+		// Else we're good, forge the complete name.
+		b := base.AsEntity()
+		add(strings.Join([]string{b.Namespace, b.Type}, "."))
 	}
 
-	return false, ""
+	return
 }
 
 // writeConfig - The Entity creates a file in path/Entities/EntityName,
 // and writes itself as an XML message into it.
 func (e Entity) writeConfig(path string) (err error) {
-	dir, err := getDirectory(path, "Entities")
-	if err != nil {
-		return fmt.Errorf("Error getting output dir: %s", err)
+	if err = e.GetGoProperties(); err != nil {
+		return fmt.Errorf("Error marshalling Entity properties: %s", err)
 	}
 
 	// Create a configuration Entity in which we put everything.
@@ -449,16 +721,91 @@ func (e Entity) writeConfig(path string) (err error) {
 		AllowedRoot:     true,
 		Visible:         true,
 		ConversionOrder: 2147483647,
-		// Icons
 		// Default converter ?
 	}
 
-	// Return and set any Base Entity
-	if hasBase, name := e.hasBaseEntity(); hasBase {
-		ce.BaseEntities = append(ce.BaseEntities, name)
+	// Built-in icons are referenced by name, for the client to render them.
+	if icon, found := e.builtinIcon(); found {
+		ce.LargeIcon = string(icon)
+		ce.SmallIcon = string(icon)
+	}
+
+	// Declare all Base Entities, so that Maltego lets the
+	// Transforms of these types run on this Entity as well.
+	ce.BaseEntities = e.baseEntities()
+
+	// The main property holds the Entity value.
+	ce.Properties.Value = e.alias()
+	ce.Properties.DisplayValue = ce.Properties.Value
+	ce.Properties.Fields = append(ce.Properties.Fields, configuration.EntityField{
+		Name:        ce.Properties.Value,
+		Type:        configuration.PropertyTypeString,
+		DisplayName: e.DisplayName,
+		Description: e.Description,
+	})
+
+	// Now set all properties, and the sections grouping them.
+	fields := e.configFields()
+	ce.Properties.Fields = append(ce.Properties.Fields, fields...)
+	ce.Properties.Groups = configGroups(fields)
+
+	return ce.WriteConfig(path)
+}
+
+// configFields - Returns the specification of all Entity properties, sorted by name.
+// Display properties (links, bookmarks, etc) and Go struct separators are not included.
+func (e *Entity) configFields() (fields []configuration.EntityField) {
+	for name, property := range e.Properties {
+		if strings.Contains(name, "#") || property.Value == goTypeSeparator {
+			continue
+		}
+
+		field := configuration.EntityField{
+			Name:        property.Name,
+			Type:        property.Type,
+			Nullable:    true,
+			Hidden:      property.Hidden,
+			ReadOnly:    property.ReadOnly,
+			Description: property.Description,
+			DisplayName: property.Display,
+		}
+		if field.Type == "" {
+			field.Type = propertyType(reflect.TypeOf(property.Value))
+		}
+		if property.DefaultValue != nil {
+			field.DefaultValue = fmt.Sprintf("%v", property.DefaultValue)
+		}
+		if property.SampleValue != nil {
+			field.SampleValue = fmt.Sprintf("%v", property.SampleValue)
+		}
+		if property.Validate != "" {
+			field.Constraint = &configuration.EntityFieldConstraint{Regex: property.Validate}
+		}
+		field.Group = property.Group
+		fields = append(fields, field)
 	}
 
-	// Now set all properties
+	// Fields of the same group are kept together, ungrouped ones first.
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Group != fields[j].Group {
+			return fields[i].Group < fields[j].Group
+		}
+		return fields[i].Name < fields[j].Name
+	})
+
+	return
+}
 
+// configGroups - Returns the groups (sections) of the Entity properties, in the order
+// of the fields returned by configFields(), for inclusion in Entity configurations.
+func configGroups(fields []configuration.EntityField) (groups []configuration.EntityGroup) {
+	seen := map[string]bool{}
+	for _, field := range fields {
+		if field.Group == "" || seen[field.Group] {
+			continue
+		}
+		seen[field.Group] = true
+		groups = append(groups, configuration.EntityGroup{Name: field.Group})
+	}
 	return
 }
@@ -0,0 +1,182 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"errors"
+	"fmt"
+)
+
+//
+// Error Classification -----------------------------------------------------------------------
+//
+// Transforms returning one of these errors tell analysts at a glance whether they should fix
+// their input, ask the server administrators, or retry later: the exception is prefixed with
+// the class of the error. Non-fatal errors do not fail the run: its outputs are returned, and
+// the error is shown as a message, whose level depends on the class of the error.
+
+// UserError - The input of the analyst is invalid: bad Entity value, missing property, etc.
+// Shown as "Invalid input: ...", or as an informational message if not fatal.
+type UserError struct {
+	Message  string // The explanation shown to the analyst.
+	Err      error  // The underlying error, if any.
+	NonFatal bool   // Return the outputs of the run anyway, along the error.
+}
+
+// Error - The message of the error, followed by its underlying error, if any.
+func (e *UserError) Error() string {
+	return errorMessage(e.Message, e.Err)
+}
+
+// Unwrap - Returns the underlying error, if any.
+func (e *UserError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError - The server is misconfigured: missing API key, invalid setting, etc.
+// Shown as "Server misconfigured: ...", or as a fatal error message if not fatal.
+type ConfigError struct {
+	Message  string // The explanation shown to the analyst.
+	Err      error  // The underlying error, if any.
+	NonFatal bool   // Return the outputs of the run anyway, along the error.
+}
+
+// Error - The message of the error, followed by its underlying error, if any.
+func (e *ConfigError) Error() string {
+	return errorMessage(e.Message, e.Err)
+}
+
+// Unwrap - Returns the underlying error, if any.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// UpstreamError - A service queried by the Transform has failed: API down, quota exceeded,
+// etc. Shown as "Upstream service failed: ...", or as a partial error message if not fatal.
+type UpstreamError struct {
+	Message  string // The explanation shown to the analyst.
+	Err      error  // The underlying error, if any.
+	NonFatal bool   // Return the outputs of the run anyway, along the error.
+}
+
+// Error - The message of the error, followed by its underlying error, if any.
+func (e *UpstreamError) Error() string {
+	return errorMessage(e.Message, e.Err)
+}
+
+// Unwrap - Returns the underlying error, if any.
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Errors of the runs rejected by a server before running the Transform, matched with errors.Is()
+// on the error of the run (see Transform.Err()). The exception sent to the client explains why.
+var (
+	ErrTransformNotFound = errors.New("No Transform registered at this path")
+	ErrTransformDisabled = errors.New("Transform disabled")
+	ErrNotAllowed        = errors.New("Transform not available to this client")
+)
+
+// rejectedRun - The error of a run rejected by the server: its message is the
+// exception sent to the client, and it matches its kind (eg. ErrNotAllowed).
+type rejectedRun struct {
+	kind    error
+	message string
+}
+
+// Error - The exception sent to the client.
+func (e *rejectedRun) Error() string {
+	return e.message
+}
+
+// Unwrap - Returns the kind of the rejection.
+func (e *rejectedRun) Unwrap() error {
+	return e.kind
+}
+
+// reject - Raise an exception with a formatted message, like Errorf(), and
+// return it as an error of the given kind (eg. ErrNotAllowed, ErrRateLimited).
+func (t *Transform) reject(kind error, format string, args ...interface{}) error {
+	return &rejectedRun{kind: kind, message: t.Errorf(format, args...).Error()}
+}
+
+// UserErrorf - Returns a fatal UserError with a formatted message.
+func UserErrorf(format string, args ...interface{}) error {
+	return &UserError{Message: fmt.Sprintf(format, args...)}
+}
+
+// ConfigErrorf - Returns a fatal ConfigError with a formatted message.
+func ConfigErrorf(format string, args ...interface{}) error {
+	return &ConfigError{Message: fmt.Sprintf(format, args...)}
+}
+
+// UpstreamErrorf - Returns a fatal UpstreamError with a formatted message.
+func UpstreamErrorf(format string, args ...interface{}) error {
+	return &UpstreamError{Message: fmt.Sprintf(format, args...)}
+}
+
+// errorMessage - The message of a classified error, followed by its underlying error.
+func errorMessage(message string, err error) string {
+	switch {
+	case err == nil:
+		return message
+	case message == "":
+		return err.Error()
+	default:
+		return message + ": " + err.Error()
+	}
+}
+
+// classifyError - Returns the prefix of the exception raised for a classified error, the
+// type of the message shown if it is not fatal, and whether it is. ok is false for others.
+func classifyError(err error) (prefix, messageType string, fatal, ok bool) {
+	var user *UserError
+	var config *ConfigError
+	var upstream *UpstreamError
+	switch {
+	case errors.As(err, &user):
+		return "Invalid input", "Inform", !user.NonFatal, true
+	case errors.As(err, &config):
+		return "Server misconfigured", "FatalError", !config.NonFatal, true
+	case errors.As(err, &upstream):
+		return "Upstream service failed", "PartialError", !upstream.NonFatal, true
+	default:
+		return "", "", true, false
+	}
+}
+
+// raiseError - Report an error returned by the Transform implementation: classified
+// errors are prefixed with their class, and those not fatal are shown as messages,
+// in which case nil is returned. Other errors are raised as exceptions, unless
+// the Transform already raised some (eg. with Errorf()).
+func (t *Transform) raiseError(err error) error {
+	prefix, messageType, fatal, classified := classifyError(err)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	switch {
+	case classified && !fatal:
+		t.messages = append(t.messages, MessageUI{Text: prefix + ": " + err.Error(), Type: messageType})
+		return nil
+	case classified:
+		t.exceptions = append(t.exceptions, Exception(prefix+": "+err.Error()))
+	case len(t.exceptions) == 0:
+		t.exceptions = append(t.exceptions, Exception(err.Error()))
+	}
+	return err
+}
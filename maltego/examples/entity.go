@@ -49,7 +49,7 @@ import (
 type Target struct {
 	OS       string `display:"Operating System" strict:"yes" alias:"alias"`
 	Hostname string `strict:"yes" alias:"host"`
-	IP       string `display:"IP Address" alias:"address" overlay:"W,image"`
+	IP       string `display:"IP Address" alias:"address" overlay:"W,image" default:"0.0.0.0"`
 }
 
 // AsEntity - This function makes the Target type a valid Maltego entity.
@@ -65,7 +65,10 @@ func (tgt *Target) AsEntity() (e maltego.Entity) {
 	// For instance, the Maltego namespace of the Credential entity is,
 	// by default, the complete Go-module path+name of the Credential type.
 	// Please see the Credential type below for an example where we modify it.
-	return maltego.NewEntity(tgt)
+	//
+	// NewEntityDefault() also populates the empty fields having a default:""
+	// tag with their default value: here, an empty IP will be "0.0.0.0".
+	return maltego.NewEntityDefault(tgt)
 }
 
 // Credential - A native Go type that has some struct fields declared as properties,
@@ -119,7 +122,7 @@ func (cred *Credential) AsEntity() (e maltego.Entity) {
 func (cred *Credential) Do(mt *maltego.Transform) (err error) {
 
 	// You can make this call, checked at compile-time
-	err = mt.Request.Entity.Unmarshal(cred)
+	err = mt.Input().Unmarshal(cred)
 
 	// Completely overwrite the input Entity settings
 	mt.AddEntity(cred)
@@ -110,12 +110,17 @@ func main() {
 	// - One server able to produce a Distribution only for its own content.
 
 	// A - Register to the server -
-	// All transforms are automatically bound to a URL
-	// path matching their complete namespace + Name.
+	// All transforms are automatically bound to a URL path matching
+	// their name and major version (see server.PathTemplate).
 	// Their Entities are also registered in the Server's distribution.
 	server.RegisterTransform(&transformOnly)
 	server.RegisterTransform(&transform)
 
+	// Types implementing maltego.ValidTransform can also be registered
+	// directly: the Transform name, description and input type are
+	// derived from the type itself (here, the Credential Entity).
+	server.RegisterNative(cred)
+
 	// B - Register to a distribution -
 	// This has a drawback, which is that the transform will be mapped
 	// to a default (local) Server contained in the distribution.
@@ -158,5 +163,9 @@ func main() {
 	// B - Starting Transform Servers
 	// Start serving the transforms, supposing -here- that we loaded
 	// a complete Transform & Registry configuration, ports, TLS, etc.
-	server.ListenAndServe()
+	// This blocks until the server fails, or is shut down.
+	server.Port = 8080
+	if err = server.ListenAndServe(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -48,7 +48,7 @@ type UpdaterTransform struct {
 func (t UpdaterTransform) Do(mt *maltego.Transform) (err error) {
 
 	// You still have access to the transform input Entity:
-	mt.Request.Entity.AddProperty(maltego.Field{Display: "New Field"})
+	mt.Input().AddProperty(maltego.Field{Display: "New Field"})
 
 	// Add and process any arbitrary Go types in this body.
 	// However, you will only be able to return as output Entities
@@ -57,7 +57,7 @@ func (t UpdaterTransform) Do(mt *maltego.Transform) (err error) {
 
 	// We have added a field to the input entity, it's obviously
 	// because our transform is (in part ?) an "updating" transform.
-	mt.AddEntity(mt.Request.Entity)
+	mt.AddEntity(mt.Input())
 
 	return
 }
@@ -66,8 +66,8 @@ func (t UpdaterTransform) Do(mt *maltego.Transform) (err error) {
 // a native Go type as an Entity input, with compile-time validity check.
 var ProducerTransform = func(t *maltego.Transform) (err error) {
 
-	var target = &Target{}                   // If your type is implements maltego.ValidEntity...
-	err = t.Request.Entity.Unmarshal(target) // ...You can make this call, checked at compile-time
+	var target = &Target{}            // If your type is implements maltego.ValidEntity...
+	err = t.Input().Unmarshal(target) // ...You can make this call, checked at compile-time
 
 	// You can create a new version of your Entity, with all its default settings
 	// that you have declared in your constructor, and modify them on the fly,
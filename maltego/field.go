@@ -18,7 +18,15 @@ package maltego
    along with this program.  If not, see <https://www.gnu.org/licenses/>.
 */
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
+)
 
 // Field - A property field for a Maltego entity. You can use this
 // type from within a transform, when you want to add a property to
@@ -29,14 +37,86 @@ import "encoding/xml"
 // Note that you can't directly set a field as an overlay when declaring it
 // through this function. You need to reference it again in Entity.AddOverlay().
 type Field struct {
-	Name         string       `xml:"Name,attr"`         // The programmatic name, required.
-	Display      string       `xml:"DisplayName,attr"`  // The display name of this field
-	MatchingRule MatchingRule `xml:"MatchingRule,attr"` // The individual match rule for this field
-	Alias        string       `xml:"-"`                 // An alias for the field, default to .Name
-	Hidden       bool         // Hide this field in the Entity Properties window.
-	ReadOnly     bool         // The user cannot edit this value from the Maltego GUI
-	SampleValue  interface{}
-	Value        interface{} `xml:",cdata"` // Its value, automatically passed as an XML string
+	Name         string                     `xml:"Name,attr"`         // The programmatic name, required.
+	Display      string                     `xml:"DisplayName,attr"`  // The display name of this field
+	MatchingRule MatchingRule               `xml:"MatchingRule,attr"` // The individual match rule for this field
+	Alias        string                     `xml:"-"`                 // An alias for the field, default to .Name
+	Hidden       bool                       `xml:"-"`                 // Hide this field in the Entity Properties window.
+	ReadOnly     bool                       `xml:"-"`                 // The user cannot edit this value from the Maltego GUI
+	SampleValue  interface{}                `xml:"-"`                 // The value used when the Entity is created manually in Maltego.
+	DefaultValue interface{}                `xml:"-"`                 // The value used when none is set, and in Entity configurations.
+	Description  string                     `xml:"-"`                 // A description of the field, in Entity configurations.
+	Type         configuration.PropertyType `xml:"-"`                 // The Maltego type of the field, inferred from its Go type if empty.
+	Validate     string                     `xml:"-"`                 // A regular expression that non-empty values must match.
+	Group        string                     `xml:"-"`                 // The section of the Properties window holding the field.
+	Value        interface{}                `xml:",cdata"`            // Its value, automatically passed as an XML string
+}
+
+// ValueString - Returns the value of the field as written in Transform responses:
+// lists as comma-separated values, times in the Maltego format, etc.
+func (f Field) ValueString() (string, error) {
+	if f.Value == nil {
+		return "", nil
+	}
+	value, err := marshalValue(reflect.ValueOf(f.Value))
+	if err != nil {
+		return "", fmt.Errorf("Property %s: %s", f.Name, err)
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// validate - Check the field value against its validation pattern, if any.
+// Empty values are always valid, since all Entity fields are nullable.
+func (f Field) validate() error {
+	if f.Validate == "" || f.Value == nil {
+		return nil
+	}
+	value := fmt.Sprintf("%v", f.Value)
+	if value == "" {
+		return nil
+	}
+	re, err := regexp.Compile(f.Validate)
+	if err != nil {
+		return fmt.Errorf("Field %s: invalid validation pattern %q: %s", f.Name, f.Validate, err)
+	}
+	if !re.MatchString(value) {
+		return fmt.Errorf("Field %s: value %q does not match %q", f.Name, value, f.Validate)
+	}
+	return nil
+}
+
+// clone - Returns a copy of the field, in which slice and map values
+// (eg. string arrays) are copied as well, so as not to be shared.
+func (f Field) clone() Field {
+	f.Value = cloneValue(f.Value)
+	f.DefaultValue = cloneValue(f.DefaultValue)
+	f.SampleValue = cloneValue(f.SampleValue)
+	return f
+}
+
+// cloneValue - Returns a shallow copy of slices and maps, other values as is.
+func cloneValue(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return value
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		return c.Interface()
+	case reflect.Map:
+		if v.IsNil() {
+			return value
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return c.Interface()
+	}
+	return value
 }
 
 // Properties - Holds all the Properties of an Entity, used to ensure
@@ -52,8 +132,25 @@ func (p Properties) MarshalXML(e *xml.Encoder, start xml.StartElement) (err erro
 	if err = e.EncodeToken(start); err != nil {
 		return
 	}
-	for _, property := range p {
-		e.Encode(property)
+	// Go struct separators only make sense in Entity configurations.
+	names := make([]string, 0, len(p))
+	for name, property := range p {
+		if property.Value != goTypeSeparator {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// Values set by users (eg. string arrays) are written like marshalled Go fields.
+		property := p[name]
+		if property.Value != nil {
+			if property.Value, err = marshalValue(reflect.ValueOf(property.Value)); err != nil {
+				return fmt.Errorf("Property %s: %s", name, err)
+			}
+		}
+		if err = e.Encode(property); err != nil {
+			return
+		}
 	}
 
 	return e.EncodeToken(start.End())
@@ -0,0 +1,138 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//
+// Transform Fixtures - Canned Responses for Demos & Training ------------------------------------
+//
+// Transforms flagged with SetFixture() return canned responses instead of running, when their
+// server has a Fixtures directory: demo and training environments can thus show realistic
+// results without ever hitting production data sources. Fixtures are JSON files holding a
+// list of responses, the first one matching the input Entity value being returned:
+//
+//	[
+//	    {
+//	        "input": "example.com",
+//	        "entities": [
+//	            {"type": "maltego.IPv4Address", "value": "93.184.216.34", "properties": {"asn": "15133"}}
+//	        ],
+//	        "messages": [{"type": "Inform", "text": "Resolved from the demo dataset"}]
+//	    },
+//	    {"input": "*", "messages": [{"type": "Inform", "text": "No demo data for this domain"}]}
+//	]
+//
+// Output Entities are processed and validated as any other output, and runs are recorded.
+
+// fixture - A canned response of a Transform, for a given input value.
+type fixture struct {
+	Input    string           `json:"input"`    // The input Entity value, or "*" (or empty) for any
+	Entities []fixtureEntity  `json:"entities"` // The output Entities
+	Messages []fixtureMessage `json:"messages"` // The UI messages
+	Error    string           `json:"error"`    // An exception, for demoing failures
+}
+
+// fixtureEntity - An output Entity of a canned response.
+type fixtureEntity struct {
+	Type       string                 `json:"type"`
+	Value      string                 `json:"value"`
+	Weight     int                    `json:"weight"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// fixtureMessage - A UI message of a canned response.
+type fixtureMessage struct {
+	Type string `json:"type"` // Debug, Inform (default) or Partial
+	Text string `json:"text"`
+}
+
+// SetFixture - Flag the Transform for returning canned responses, read from a file of the
+// server Fixtures directory, when set (see TransformServer.Fixtures). An empty file name
+// defaults to the Transform name, with a .json extension (eg. DNSToIP.json).
+func (t *Transform) SetFixture(file string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if file == "" {
+		file = t.Name + ".json"
+	}
+	t.fixture = file
+}
+
+// fixtureRun - Returns a Transform implementation answering with the canned responses
+// of a fixtures file. The file is read on each run, so that it can be edited live.
+func fixtureRun(dir, file string) TransformFunc {
+	return func(t *Transform) error {
+		path := filepath.Join(dir, file)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return t.Errorf("Error reading fixtures %s: %s", file, err)
+		}
+		var fixtures []fixture
+		if err = json.Unmarshal(data, &fixtures); err != nil {
+			return t.Errorf("Error decoding fixtures %s: %s", file, err)
+		}
+
+		value := t.Input().Value
+		for _, f := range fixtures {
+			if f.Input == "" || f.Input == "*" || strings.EqualFold(f.Input, value) {
+				return f.apply(t)
+			}
+		}
+
+		t.Infof("No fixture for input %q", value)
+		return nil
+	}
+}
+
+// apply - Add the messages and Entities of the canned response to the Transform output.
+func (f fixture) apply(t *Transform) error {
+	for _, m := range f.Messages {
+		switch m.Type {
+		case "Debug":
+			t.Debugf("%s", m.Text)
+		case "Partial", "PartialError":
+			t.Warnf("%s", m.Text)
+		default:
+			t.Infof("%s", m.Text)
+		}
+	}
+
+	for _, fe := range f.Entities {
+		entity := NewForeignEntity(fe.Type, fe.Value)
+		entity.Weight = fe.Weight
+		for name, value := range fe.Properties {
+			entity.AddProperty(Field{Name: name, Display: name, MatchingRule: MatchLoose, Value: value})
+		}
+		if err := t.AddEntity(&entity); err != nil {
+			return fmt.Errorf("Invalid fixture Entity %s: %s", fe.Value, err)
+		}
+	}
+
+	if f.Error != "" {
+		return t.Errorf("%s", f.Error)
+	}
+	return nil
+}
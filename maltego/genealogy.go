@@ -0,0 +1,115 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"strings"
+)
+
+// OriginProperty - The hidden property in which a server tracking the origins of Entities
+// (see TransformServer.TrackOrigins) records the chain of Transforms that produced them, as
+// Transform names separated by '>', oldest first. Maltego sends it back along the Entity
+// when it is the input of another Transform, which can then know how it was produced.
+const OriginProperty = "gondor.origin"
+
+// maxOriginChain - The number of Transforms kept in origin chains, the most recent ones.
+const maxOriginChain = 16
+
+// Genealogy - Returns the type genealogy of the input Entity, as sent by the client: its
+// own type first, followed by the types it inherits from (eg. maltego.DNSName, then
+// maltego.Domain), if the client sent them.
+func (t *Transform) Genealogy() []Geneaology {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return append([]Geneaology{}, t.request.Geneaology...)
+}
+
+// InputInherits - Returns true if the input Entity is of the given fully qualified type,
+// or inherits from it according to its genealogy (see Genealogy()).
+func (t *Transform) InputInherits(fqType string) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if t.request.Type == fqType || entityTypeName(t.request.Entity) == fqType {
+		return true
+	}
+	for _, node := range t.request.Geneaology {
+		if node.Name == fqType || node.OldName == fqType {
+			return true
+		}
+	}
+	return false
+}
+
+// Origins - Returns the chain of Transforms that produced the input Entity, oldest first,
+// or nothing if it was created by the analyst, or produced by a server not tracking them
+// (see TransformServer.TrackOrigins). The last Transform is the parent of the Entity.
+func (t *Transform) Origins() []string {
+	t.mutex.RLock()
+	chain := t.request.Entity.Property(OriginProperty)
+	t.mutex.RUnlock()
+	if chain == "" {
+		return nil
+	}
+	return strings.Split(chain, ">")
+}
+
+// Origin - Returns the Transform that produced the input Entity, if known (see Origins()).
+func (t *Transform) Origin() string {
+	origins := t.Origins()
+	if len(origins) == 0 {
+		return ""
+	}
+	return origins[len(origins)-1]
+}
+
+// Depth - Returns the number of Transforms known to have produced the input
+// Entity from one created by the analyst, 0 if it was created by the analyst.
+func (t *Transform) Depth() int {
+	return len(t.Origins())
+}
+
+// ProducedBy - Returns true if the input Entity was produced by the named Transform,
+// directly or not (eg. to skip re-resolving a domain that came from a DNS Transform).
+func (t *Transform) ProducedBy(name string) bool {
+	for _, origin := range t.Origins() {
+		if origin == name {
+			return true
+		}
+	}
+	return false
+}
+
+// trackOrigin - Record the Transform at the end of the origin chain of an output
+// Entity, when the server tracks the origins of Entities.
+func (t *Transform) trackOrigin(entity *Entity) {
+	if t.server == nil || !t.server.TrackOrigins {
+		return
+	}
+	chain := append(t.Origins(), t.Name)
+	if len(chain) > maxOriginChain {
+		chain = chain[len(chain)-maxOriginChain:]
+	}
+	entity.ensureInitialized()
+	entity.AddProperty(Field{
+		Name:         OriginProperty,
+		Display:      "Origin",
+		MatchingRule: MatchLoose,
+		Value:        strings.Join(chain, ">"),
+	})
+}
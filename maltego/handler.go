@@ -20,19 +20,21 @@ package maltego
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
 )
 
 // transformHandler - Handle a request to run a Transform from a Maltego Client: unmarshal the Request,
 // pass it to a Transform, run the latter and return its output, regardless of the outcome.
 func (ts *TransformServer) transformHandler(w http.ResponseWriter, r *http.Request) {
 
-	// Get the transform transform keyed with the request path
-	transform := ts.GetTransform(r.URL.Path)
-	if transform == nil {
-		http.Error(w, "Did not found Transform for required URL path", http.StatusNoContent)
+	// Authenticate the client, if the server requires credentials.
+	r, ok := ts.authenticate(w, r)
+	if !ok {
 		return
 	}
 
@@ -56,19 +58,51 @@ func (ts *TransformServer) transformHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Create a new Transform instance based on the model.
-	instance := transform.newInstanceFromRequest(request)
+	format := configuration.XMLCompact
+	if ts.PrettyXML {
+		format = configuration.XMLPretty
+	}
 
-	// Run the transform.
-	err = transform.run(instance)
+	// Find the tenant and the transform keyed with the request path, and run it.
+	// Streaming Transforms may have started writing their output in the meantime.
+	ctx := withRequestID(ts.withClient(r.Context(), r), w, r)
+	ctx = withResponseCaching(withResponseStream(ctx, w, format))
+	instance, runErr, err := ts.runRequest(ctx, r.URL.Path, r.Header.Get(TenantKeyHeader), requestPrincipal(r), request)
+	if errors.Is(err, ErrUnknownTenant) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, ErrServerClosing) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Did not found Transform for required URL path", http.StatusNoContent)
+		return
+	}
+
+	if instance.streaming() {
+		instance.closeStream(runErr)
+		return
+	}
+
+	// Responses found in the server cache are sent as is.
+	if cached := instance.cachedOutput(); cached != nil {
+		w.Write(cached)
+		return
+	}
 
 	// Marshal its output (success or failure)
-	response, err := instance.marshalOutput(err)
+	response, err := instance.marshalOutput(runErr, format)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if runErr == nil {
+		ts.cacheResponse(instance, response)
+	}
+
 	// Finally, write the output to the HTTP response
 	fmt.Fprintf(w, string(response))
 }
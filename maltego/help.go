@@ -0,0 +1,169 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// HelpPath - The URL path under which a TransformServer serves the help pages of its
+// Transforms, one per Transform name (eg. /help/DNSToIP). When the server starts, the
+// HelpURL of all Transforms not declaring their own points to their help page.
+const HelpPath = "/help/"
+
+// HelpURL - Returns the public URL of the help page served for a Transform (see
+// PublicURL()), or an empty string if the URL of the server is not known yet.
+func (ts *TransformServer) HelpURL(name string) string {
+	base := ts.PublicURL()
+	if base == "" {
+		return ""
+	}
+	return base + HelpPath + url.PathEscape(name)
+}
+
+// setHelpURLs - Point the HelpURL of all Transforms that have none to their help page.
+func (ts *TransformServer) setHelpURLs() {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	for _, transform := range ts.Transforms {
+		if transform.HelpURL == "" {
+			transform.HelpURL = ts.HelpURL(transform.Name)
+		}
+	}
+}
+
+// helpHandler - Serve the help page of a Transform, generated from its information,
+// settings and input/output Entity types, or the list of all Transforms on the root path.
+func (ts *TransformServer) helpHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, HelpPath)
+
+	ts.mutex.RLock()
+	var pages []helpPage
+	for _, transform := range ts.Transforms {
+		if name == "" || transform.Name == name {
+			pages = append(pages, newHelpPage(transform))
+		}
+	}
+	ts.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	switch {
+	case name == "":
+		sort.Slice(pages, func(i, j int) bool { return pages[i].Name < pages[j].Name })
+		helpIndexTemplate.Execute(w, struct {
+			Server string
+			Pages  []helpPage
+		}{ts.Name, pages})
+	case len(pages) == 0:
+		http.NotFound(w, r)
+	default:
+		// Several versions of a Transform share its name: show the latest one.
+		sort.Slice(pages, func(i, j int) bool { return compareVersions(pages[i].Version, pages[j].Version) > 0 })
+		helpTemplate.Execute(w, pages[0])
+	}
+}
+
+// helpPage - The information of a Transform displayed in its help page.
+type helpPage struct {
+	Name        string
+	DisplayName string
+	Description string
+	Help        string
+	Author      string
+	Owner       string
+	Version     string
+	Disclaimer  string
+	Deprecated  string
+	Input       string
+	Output      []string
+	Settings    []TransformSetting
+}
+
+// newHelpPage - Gather the information of a Transform for its help page.
+func newHelpPage(t *Transform) helpPage {
+	page := helpPage{
+		Name:        t.Name,
+		DisplayName: t.DisplayName,
+		Description: t.Description,
+		Help:        t.Help,
+		Author:      t.Author,
+		Owner:       t.Owner,
+		Version:     t.Version,
+		Disclaimer:  t.Disclaimer,
+		Deprecated:  t.deprecation,
+		Settings:    t.Settings.settings,
+	}
+	if page.DisplayName == "" {
+		page.DisplayName = getDisplayName(t.Name)
+	}
+	if t.input != nil {
+		page.Input = entityTypeName(t.input.AsEntity())
+	}
+	for _, output := range t.output {
+		page.Output = append(page.Output, entityTypeName(output.AsEntity()))
+	}
+	return page
+}
+
+// entityTypeName - The fully qualified Maltego type of an Entity.
+func entityTypeName(e Entity) string {
+	return strings.Trim(strings.Join([]string{e.Namespace, e.Type}, "."), ".")
+}
+
+// helpStyle - The stylesheet shared by all help pages.
+const helpStyle = `<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; color: #222; }
+h1 { border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; } td, th { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.meta { color: #666; } .disclaimer { background: #fff4e0; padding: 0.5em; }
+</style>`
+
+// helpTemplate - The help page of a single Transform.
+var helpTemplate = template.Must(template.New("help").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.DisplayName}}</title>` + helpStyle + `</head><body>
+<h1>{{.DisplayName}}</h1>
+<p class="meta">{{.Name}}{{with .Version}} &middot; version {{.}}{{end}}{{with .Author}} &middot; by {{.}}{{end}}{{with .Owner}} &middot; {{.}}{{end}}</p>
+{{with .Deprecated}}<p class="disclaimer"><strong>Deprecated:</strong> {{.}}</p>{{end}}
+{{with .Description}}<p>{{.}}</p>{{end}}
+{{with .Help}}<h2>Usage</h2><p>{{.}}</p>{{end}}
+<h2>Entities</h2>
+<p>Input: {{if .Input}}<code>{{.Input}}</code>{{else}}any Entity type{{end}}</p>
+<p>Output: {{range $i, $o := .Output}}{{if $i}}, {{end}}<code>{{$o}}</code>{{else}}any Entity type{{end}}</p>
+{{if .Settings}}<h2>Settings</h2>
+<table><tr><th>Name</th><th>Description</th><th>Default</th><th>Optional</th></tr>
+{{range .Settings}}<tr><td><code>{{.Name}}</code></td><td>{{.Description}}</td><td>{{with .Default}}{{.}}{{end}}</td><td>{{if .Optional}}yes{{else}}no{{end}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Disclaimer}}<h2>Disclaimer</h2><p class="disclaimer">{{.}}</p>{{end}}
+</body></html>
+`))
+
+// helpIndexTemplate - The list of all Transforms served, linking to their help page.
+var helpIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Server}} Transforms</title>` + helpStyle + `</head><body>
+<h1>{{.Server}} Transforms</h1>
+<ul>{{range .Pages}}
+<li><a href="{{.Name}}">{{.DisplayName}}</a>{{with .Description}} &ndash; {{.}}{{end}}</li>{{end}}
+</ul>
+</body></html>
+`))
@@ -0,0 +1,446 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+//
+// Transform Run History ---------------------------------------------------------------------
+//
+// A TransformServer with a HistoryStore records all the Transforms it runs: their input,
+// their outputs, and how long they took. The history can then be queried, either to
+// answer "what did we already look up?", or by Transforms themselves to avoid querying
+// the same input twice across sessions (see Transform.PreviousRuns()).
+
+// HistoryRecord - A Transform run, as recorded in the history.
+type HistoryRecord struct {
+	Transform  string          `json:"transform"`
+	Tenant     string          `json:"tenant,omitempty"`
+	Principal  string          `json:"principal,omitempty"`
+	InputType  string          `json:"input_type"`
+	InputValue string          `json:"input_value"`
+	Outputs    []HistoryOutput `json:"outputs,omitempty"`
+	Error      string          `json:"error,omitempty"`  // The error of a failed run
+	Errors     []string        `json:"errors,omitempty"` // All exceptions raised, fatal or not
+	Started    time.Time       `json:"started"`
+	Duration   time.Duration   `json:"duration"`
+}
+
+// HistoryOutput - An output Entity of a recorded Transform run.
+type HistoryOutput struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Failed - Whether the Transform run failed. Non-fatal exceptions,
+// like output validation warnings, do not make a run fail.
+func (r HistoryRecord) Failed() bool {
+	return r.Error != ""
+}
+
+// HistoryQuery - The criteria of the records to return from the history.
+// All criteria are optional, and records must match all of those given.
+type HistoryQuery struct {
+	Transform  string    // The name of the Transform
+	Tenant     string    // The name of the tenant that ran the Transform
+	InputType  string    // The fully qualified type of the input Entity
+	InputValue string    // The value of the input Entity
+	Since      time.Time // Only runs started after this time
+	Limit      int       // The maximum number of records, the most recent ones first.
+}
+
+// matches - Whether a record matches the query criteria.
+func (q HistoryQuery) matches(r HistoryRecord) bool {
+	return (q.Transform == "" || q.Transform == r.Transform) &&
+		(q.Tenant == "" || q.Tenant == r.Tenant) &&
+		(q.InputType == "" || q.InputType == r.InputType) &&
+		(q.InputValue == "" || q.InputValue == r.InputValue) &&
+		(q.Since.IsZero() || r.Started.After(q.Since))
+}
+
+// HistoryStore - A backend persisting the history of Transform runs. Implementations must
+// be safe for concurrent use, and return query results with the most recent runs first.
+// The package provides an in-memory store, a file store and an SQL (SQLite) store; the
+// default SQLite store is opened with github.com/maxlandon/gondor/maltego/history.
+type HistoryStore interface {
+	Record(record HistoryRecord) error
+	Query(query HistoryQuery) ([]HistoryRecord, error)
+}
+
+// QueryHistory - Returns the Transform runs recorded in the server history.
+func (ts *TransformServer) QueryHistory(query HistoryQuery) ([]HistoryRecord, error) {
+	if ts.History == nil {
+		return nil, errors.New("The Transform server has no HistoryStore")
+	}
+	return ts.History.Query(query)
+}
+
+// PreviousRuns - Returns the previous runs of the Transform on the same input Entity,
+// the most recent first, if the server records its history (no runs otherwise). When
+// the Transform is run by a tenant, only the runs of this tenant are returned.
+func (t *Transform) PreviousRuns() ([]HistoryRecord, error) {
+	if t.server == nil || t.server.History == nil {
+		return nil, nil
+	}
+	input := t.Input()
+	query := HistoryQuery{
+		Transform:  t.Name,
+		InputType:  entityTypeName(*input),
+		InputValue: input.Value,
+	}
+	if t.tenant != nil {
+		query.Tenant = t.tenant.Name
+	}
+	return t.server.History.Query(query)
+}
+
+// RunHistoryCommand - The history command line, querying the runs recorded in a store.
+// This is the implementation of the `gondor history` command (github.com/maxlandon/gondor/cmd/gondor),
+// which reads the default SQLite history, but it can also be called from the main function
+// of your Transform server program, with the arguments following the command name:
+//
+//	gondor history --transform DNSToIP --since 24h
+//
+// Records are printed as a table, or as JSON lines with --json.
+func RunHistoryCommand(store HistoryStore, args []string) error {
+	flags := flag.NewFlagSet("gondor history", flag.ContinueOnError)
+	transform := flags.String("transform", "", "name of the Transform")
+	tenant := flags.String("tenant", "", "name of the tenant that ran the Transform")
+	inputType := flags.String("type", "", "type of the input Entity (eg. maltego.Domain)")
+	inputValue := flags.String("input", "", "value of the input Entity")
+	since := flags.Duration("since", 0, "only runs more recent than this (eg. 24h)")
+	limit := flags.Int("limit", 100, "maximum number of runs")
+	asJSON := flags.Bool("json", false, "print the records as JSON lines")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	query := HistoryQuery{
+		Transform:  *transform,
+		Tenant:     *tenant,
+		InputType:  *inputType,
+		InputValue: *inputValue,
+		Limit:      *limit,
+	}
+	if *since > 0 {
+		query.Since = time.Now().Add(-*since)
+	}
+	if store == nil {
+		return errors.New("No HistoryStore to query")
+	}
+	records, err := store.Query(query)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, record := range records {
+			if err = encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return printHistory(os.Stdout, records)
+}
+
+// printHistory - Print history records as a table.
+func printHistory(w io.Writer, records []HistoryRecord) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "STARTED\tTRANSFORM\tINPUT\tOUTPUTS\tDURATION\tSTATUS")
+	for _, r := range records {
+		status := "ok"
+		if r.Failed() {
+			status = "failed: " + r.Error
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s (%s)\t%d\t%s\t%s\n", r.Started.Format(time.RFC3339),
+			r.Transform, r.InputValue, r.InputType, len(r.Outputs), r.Duration.Round(time.Millisecond), status)
+	}
+	return table.Flush()
+}
+
+// recordHistory - Record a Transform run in the server history, failed if runErr
+// is not nil. The outcome of the run is not affected by a failure to record it.
+func (ts *TransformServer) recordHistory(instance *Transform, started time.Time, runErr error) {
+	if ts.History == nil {
+		return
+	}
+
+	input := instance.Input()
+	record := HistoryRecord{
+		Transform:  instance.Name,
+		InputType:  entityTypeName(*input),
+		InputValue: input.Value,
+		Started:    started,
+		Duration:   time.Since(started),
+	}
+	if instance.tenant != nil {
+		record.Tenant = instance.tenant.Name
+	}
+	if instance.principal != nil {
+		record.Principal = instance.principal.ID
+	}
+	for _, entity := range instance.Entities() {
+		record.Outputs = append(record.Outputs, HistoryOutput{
+			Type:  entityTypeName(entity),
+			Value: entity.Value,
+		})
+	}
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	for _, exception := range instance.Exceptions() {
+		record.Errors = append(record.Errors, string(exception))
+	}
+
+	ts.History.Record(record)
+}
+
+//
+// History Stores ---------------------------------------------------------------------------
+//
+
+// MemoryHistoryStore - A HistoryStore keeping the history in memory, lost on restart.
+type MemoryHistoryStore struct {
+	records []HistoryRecord
+	mutex   *sync.RWMutex
+}
+
+// NewMemoryHistoryStore - Create a new, empty in-memory HistoryStore.
+func NewMemoryHistoryStore() *MemoryHistoryStore {
+	return &MemoryHistoryStore{mutex: &sync.RWMutex{}}
+}
+
+// Record - Implements HistoryStore.
+func (m *MemoryHistoryStore) Record(record HistoryRecord) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.records = append(m.records, record)
+	return nil
+}
+
+// Query - Implements HistoryStore.
+func (m *MemoryHistoryStore) Query(query HistoryQuery) ([]HistoryRecord, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return queryRecords(m.records, query), nil
+}
+
+// FileHistoryStore - A HistoryStore appending the history to a file, as JSON lines.
+// Queries read the whole file: use an SQLHistoryStore for large histories.
+type FileHistoryStore struct {
+	Path  string
+	mutex *sync.RWMutex
+}
+
+// NewFileHistoryStore - Create a HistoryStore appending records to the file at path.
+func NewFileHistoryStore(path string) *FileHistoryStore {
+	return &FileHistoryStore{Path: path, mutex: &sync.RWMutex{}}
+}
+
+// Record - Implements HistoryStore.
+func (f *FileHistoryStore) Record(record HistoryRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+
+	return err
+}
+
+// Query - Implements HistoryStore.
+func (f *FileHistoryStore) Query(query HistoryQuery) ([]HistoryRecord, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	file, err := os.Open(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []HistoryRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record HistoryRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // A partially written line
+		}
+		if query.matches(record) {
+			records = append(records, record)
+		}
+	}
+
+	return queryRecords(records, query), scanner.Err()
+}
+
+// queryRecords - Returns the records matching a query, most recent first.
+// Records are expected in chronological order.
+func queryRecords(records []HistoryRecord, query HistoryQuery) (matching []HistoryRecord) {
+	for i := len(records) - 1; i >= 0; i-- {
+		if query.Limit > 0 && len(matching) == query.Limit {
+			break
+		}
+		if query.matches(records[i]) {
+			matching = append(matching, records[i])
+		}
+	}
+	return
+}
+
+// SQLHistoryStore - A HistoryStore persisting the history in an SQL database, written in
+// the SQLite dialect. This is the default store, opened with the maltego/history package:
+//
+//	server.History, err = history.Open("") // ~/.gondor/history.db
+//
+// The database can also be opened by the user, with the SQLite driver of their choice,
+// which keeps this package free of any driver dependency:
+//
+//	db, err := sql.Open("sqlite", "history.db")
+//	store, err := maltego.NewSQLHistoryStore(db)
+type SQLHistoryStore struct {
+	db *sql.DB
+}
+
+// sqlHistorySchema - The table and indexes of an SQLHistoryStore.
+const sqlHistorySchema = `
+CREATE TABLE IF NOT EXISTS gondor_history (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	transform   TEXT NOT NULL,
+	tenant      TEXT NOT NULL DEFAULT '',
+	principal   TEXT NOT NULL DEFAULT '',
+	input_type  TEXT NOT NULL,
+	input_value TEXT NOT NULL,
+	outputs     TEXT NOT NULL DEFAULT '[]',
+	error       TEXT NOT NULL DEFAULT '',
+	errors      TEXT NOT NULL DEFAULT '[]',
+	started     INTEGER NOT NULL,
+	duration    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS gondor_history_transform ON gondor_history (transform, started);
+CREATE INDEX IF NOT EXISTS gondor_history_input ON gondor_history (input_type, input_value);
+`
+
+// NewSQLHistoryStore - Create a HistoryStore in an (SQLite) database, creating its table if needed.
+func NewSQLHistoryStore(db *sql.DB) (*SQLHistoryStore, error) {
+	if _, err := db.Exec(sqlHistorySchema); err != nil {
+		return nil, fmt.Errorf("Error creating history table: %s", err)
+	}
+	return &SQLHistoryStore{db: db}, nil
+}
+
+// Record - Implements HistoryStore.
+func (s *SQLHistoryStore) Record(record HistoryRecord) error {
+	outputs, err := json.Marshal(record.Outputs)
+	if err != nil {
+		return err
+	}
+	errs, err := json.Marshal(record.Errors)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO gondor_history
+		(transform, tenant, principal, input_type, input_value, outputs, error, errors, started, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.Transform, record.Tenant, record.Principal, record.InputType, record.InputValue,
+		string(outputs), record.Error, string(errs), record.Started.UnixNano(), int64(record.Duration))
+
+	return err
+}
+
+// Query - Implements HistoryStore.
+func (s *SQLHistoryStore) Query(query HistoryQuery) (records []HistoryRecord, err error) {
+	statement := `SELECT transform, tenant, principal, input_type, input_value, outputs, error, errors, started, duration
+		FROM gondor_history WHERE 1 = 1`
+	var args []interface{}
+	criteria := []struct {
+		column string
+		value  string
+	}{
+		{"transform", query.Transform},
+		{"tenant", query.Tenant},
+		{"input_type", query.InputType},
+		{"input_value", query.InputValue},
+	}
+	for _, criterion := range criteria {
+		if criterion.value != "" {
+			statement += " AND " + criterion.column + " = ?"
+			args = append(args, criterion.value)
+		}
+	}
+	if !query.Since.IsZero() {
+		statement += " AND started > ?"
+		args = append(args, query.Since.UnixNano())
+	}
+	statement += " ORDER BY started DESC, id DESC"
+	if query.Limit > 0 {
+		statement += fmt.Sprintf(" LIMIT %d", query.Limit)
+	}
+
+	rows, err := s.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record HistoryRecord
+		var outputs, errs string
+		var started, duration int64
+		err = rows.Scan(&record.Transform, &record.Tenant, &record.Principal, &record.InputType,
+			&record.InputValue, &outputs, &record.Error, &errs, &started, &duration)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(outputs), &record.Outputs)
+		json.Unmarshal([]byte(errs), &record.Errors)
+		record.Started = time.Unix(0, started)
+		record.Duration = time.Duration(duration)
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
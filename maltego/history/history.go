@@ -0,0 +1,79 @@
+// Package history opens the default store of the Transform run history: an SQLite
+// database, shared by the Transform servers of a host and the `gondor history` command.
+//
+//	server.History, err = history.Open("")
+//
+// The package registers the github.com/mattn/go-sqlite3 driver, which requires cgo.
+// Programs that cannot use it should pass their own database to maltego.NewSQLHistoryStore,
+// or use one of the other stores of the maltego package.
+package history
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3" // The SQLite driver
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// PathEnv - The environment variable overriding the default path of the history database.
+const PathEnv = "GONDOR_HISTORY"
+
+// DefaultPath - Returns the path of the history database, when none is given:
+// the value of the PathEnv environment variable, or ~/.gondor/history.db.
+func DefaultPath() string {
+	if path := os.Getenv(PathEnv); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "history.db"
+	}
+	return filepath.Join(home, ".gondor", "history.db")
+}
+
+// Open - Open the SQLite history database at path (DefaultPath() if empty),
+// creating the database, its directory and its table if needed.
+func Open(path string) (*maltego.SQLHistoryStore, error) {
+	if path == "" {
+		path = DefaultPath()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("Error creating history directory: %s", err)
+	}
+
+	// Several servers (and the history command) may use the database at once:
+	// wait for the locks of other connections instead of failing immediately.
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("Error opening history database: %s", err)
+	}
+	store, err := maltego.NewSQLHistoryStore(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
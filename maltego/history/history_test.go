@@ -0,0 +1,62 @@
+package history
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+func TestOpen(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "gondor", "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now().Add(-time.Hour)
+	for _, tenant := range []string{"acme", "globex", "acme"} {
+		err = store.Record(maltego.HistoryRecord{
+			Transform:  "Lookup",
+			Tenant:     tenant,
+			InputType:  "maltego.Domain",
+			InputValue: "example.com",
+			Outputs:    []maltego.HistoryOutput{{Type: "maltego.IPv4Address", Value: "192.0.2.1"}},
+			Error:      "Quota exceeded",
+			Started:    started,
+			Duration:   time.Second,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		started = started.Add(time.Minute)
+	}
+
+	records, err := store.Query(maltego.HistoryQuery{Tenant: "acme", InputType: "maltego.Domain"})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected 2 runs of tenant acme, got %d (%v)", len(records), err)
+	}
+	record := records[0]
+	if record.Tenant != "acme" || !record.Failed() || len(record.Outputs) != 1 ||
+		record.Duration != time.Second || !record.Started.After(records[1].Started) {
+		t.Errorf("Unexpected record %+v", record)
+	}
+}
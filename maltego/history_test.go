@@ -0,0 +1,103 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordHistory(t *testing.T) {
+	ts := NewTransformServer(nil)
+	ts.History = NewMemoryHistoryStore()
+
+	lookup := NewTransform("Lookup", func(t *Transform) error {
+		t.Errorf("Source %s is unavailable", "whois")
+		return t.AddEntity(NewForeignEntity("Phrase", "registrant"))
+	})
+	failing := NewTransform("Failing", func(t *Transform) error {
+		return errors.New("Quota exceeded")
+	})
+	ts.RegisterTransform(&lookup)
+	ts.RegisterTransform(&failing)
+
+	request := Message{Entity: NewForeignEntity("Phrase", "example")}
+	ts.Run("/Lookup", request)
+	ts.Run("/Failing", request)
+
+	records, err := ts.QueryHistory(HistoryQuery{Transform: "Lookup", InputType: "Phrase"})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Expected 1 run of Lookup on a Phrase, got %d (%v)", len(records), err)
+	}
+	record := records[0]
+	if record.Failed() || len(record.Errors) != 1 {
+		t.Errorf("A run with a non-fatal exception should not fail: %+v", record)
+	}
+	if len(record.Outputs) != 1 || record.Outputs[0].Type != "Phrase" {
+		t.Errorf("Unexpected outputs %+v", record.Outputs)
+	}
+
+	records, _ = ts.QueryHistory(HistoryQuery{Transform: "Failing"})
+	if len(records) != 1 || !records[0].Failed() || records[0].Error != "Quota exceeded" {
+		t.Errorf("Expected a failed run of Failing, got %+v", records)
+	}
+}
+
+func TestPreviousRunsByTenant(t *testing.T) {
+	ts := NewTransformServer(nil)
+	ts.History = NewMemoryHistoryStore()
+	ts.AddTenant(&Tenant{Name: "acme", PathPrefix: "/acme"})
+	ts.AddTenant(&Tenant{Name: "globex", PathPrefix: "/globex"})
+
+	var previous []HistoryRecord
+	lookup := NewTransform("Lookup", func(t *Transform) (err error) {
+		previous, err = t.PreviousRuns()
+		return t.AddEntity(NewForeignEntity("Phrase", "secret of "+t.tenant.Name))
+	})
+	ts.RegisterTransform(&lookup)
+
+	request := Message{Entity: NewForeignEntity("Phrase", "example")}
+	ts.Run("/acme/Lookup", request)
+	ts.Run("/globex/Lookup", request)
+	if len(previous) != 0 {
+		t.Errorf("Runs of tenant acme returned to tenant globex: %+v", previous)
+	}
+	ts.Run("/acme/Lookup", request)
+	if len(previous) != 1 || previous[0].Tenant != "acme" {
+		t.Errorf("Expected the previous run of tenant acme, got %+v", previous)
+	}
+}
+
+func TestHistoryStoresByTenant(t *testing.T) {
+	stores := map[string]HistoryStore{
+		"memory": NewMemoryHistoryStore(),
+		"file":   NewFileHistoryStore(filepath.Join(t.TempDir(), "history.jsonl")),
+	}
+	for name, store := range stores {
+		for _, tenant := range []string{"acme", "globex", "acme"} {
+			store.Record(HistoryRecord{Transform: "Lookup", Tenant: tenant, Started: time.Now()})
+		}
+		records, err := store.Query(HistoryQuery{Tenant: "acme"})
+		if err != nil || len(records) != 2 || records[0].Tenant != "acme" || records[1].Tenant != "acme" {
+			t.Errorf("%s store: expected 2 runs of tenant acme, got %+v (%v)", name, records, err)
+		}
+	}
+}
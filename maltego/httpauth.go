@@ -0,0 +1,204 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//
+// HTTP Authentication - Basic & Bearer Credentials ----------------------------------------------
+//
+// The Transform endpoints of a server can require HTTP Basic or bearer token credentials: the
+// server checks them against its users and tokens in constant time, or passes them to its
+// CredentialValidator, and the authenticated identity is the Principal of the requests.
+// The Authentication of the server is set accordingly, for its exported configuration.
+
+// Authentication types of servers requiring HTTP credentials.
+const (
+	AuthenticationBasic  AuthenticationType = "basic"
+	AuthenticationBearer AuthenticationType = "bearer"
+)
+
+// Principal authentication methods of HTTP credentials.
+const (
+	PrincipalBasic  = "basic"
+	PrincipalBearer = "bearer"
+)
+
+// ErrInvalidCredentials - Returned by a CredentialValidator rejecting the credentials of a request.
+var ErrInvalidCredentials = errors.New("Invalid credentials")
+
+// Credentials - The HTTP credentials sent by a client: a user name and password with the
+// Basic scheme, or a token with the Bearer scheme (in which case Username is empty).
+type Credentials struct {
+	Scheme   string // PrincipalBasic or PrincipalBearer
+	Username string
+	Secret   string // The password or the token
+}
+
+// CredentialValidator - A function validating the HTTP credentials of a request (eg. against
+// a database or an identity provider), and returning the principal they authenticate, or an
+// error (eg. ErrInvalidCredentials) if they are not valid. Implementations must compare the
+// secrets in constant time (see crypto/subtle), and be safe for concurrent use.
+type CredentialValidator func(ctx context.Context, credentials Credentials) (*Principal, error)
+
+// httpAuth - The HTTP credentials accepted by the Transform endpoints of a server.
+type httpAuth struct {
+	users     map[string]string   // Basic passwords, by user name
+	tokens    map[string]string   // Bearer tokens, by the name of their owner
+	validator CredentialValidator // Validates the credentials not found above, if set
+}
+
+// SetBasicAuth - Require HTTP Basic credentials for running the Transforms of the server,
+// with the given passwords by user name. The user name is the ID of the request Principal.
+func (ts *TransformServer) SetBasicAuth(users map[string]string) {
+	ts.setHTTPAuth(func(auth *httpAuth) {
+		auth.users = copyCredentials(users)
+	})
+}
+
+// SetBearerAuth - Require a bearer token for running the Transforms of the server, with the
+// given tokens by the name of their owner, which is the ID of the request Principal.
+func (ts *TransformServer) SetBearerAuth(tokens map[string]string) {
+	ts.setHTTPAuth(func(auth *httpAuth) {
+		auth.tokens = copyCredentials(tokens)
+	})
+}
+
+// SetCredentialValidator - Require HTTP credentials (Basic or Bearer) for running the
+// Transforms of the server, validated by the given function when they are not among
+// the users and tokens set with SetBasicAuth() and SetBearerAuth().
+func (ts *TransformServer) SetCredentialValidator(validator CredentialValidator) {
+	ts.setHTTPAuth(func(auth *httpAuth) {
+		auth.validator = validator
+	})
+}
+
+// setHTTPAuth - Update the HTTP credentials accepted by the server, and its Authentication.
+func (ts *TransformServer) setHTTPAuth(update func(auth *httpAuth)) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if ts.auth == nil {
+		ts.auth = &httpAuth{}
+	}
+	update(ts.auth)
+	if len(ts.auth.users) > 0 || ts.auth.validator != nil {
+		ts.Authentication = AuthenticationBasic
+	} else {
+		ts.Authentication = AuthenticationBearer
+	}
+}
+
+// authenticate - Check the HTTP credentials of a request to a Transform endpoint, if the server
+// requires some, and return the request carrying the Principal they authenticate. Otherwise,
+// the client is answered with an Unauthorized error, and ok is false.
+func (ts *TransformServer) authenticate(w http.ResponseWriter, r *http.Request) (_ *http.Request, ok bool) {
+	ts.mutex.RLock()
+	auth := ts.auth
+	ts.mutex.RUnlock()
+	if auth == nil {
+		return r, true
+	}
+
+	var credentials Credentials
+	header := r.Header.Get("Authorization")
+	if username, password, found := r.BasicAuth(); found {
+		credentials = Credentials{Scheme: PrincipalBasic, Username: username, Secret: password}
+	} else if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		credentials = Credentials{Scheme: PrincipalBearer, Secret: strings.TrimSpace(header[7:])}
+	}
+
+	principal, err := auth.validate(r.Context(), credentials)
+	if err != nil {
+		var challenges []string
+		if len(auth.users) > 0 || auth.validator != nil {
+			challenges = append(challenges, fmt.Sprintf("Basic realm=%q", ts.Name))
+		}
+		if len(auth.tokens) > 0 || auth.validator != nil {
+			challenges = append(challenges, fmt.Sprintf("Bearer realm=%q", ts.Name))
+		}
+		for _, challenge := range challenges {
+			w.Header().Add("WWW-Authenticate", challenge)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return r, false
+	}
+	return WithPrincipal(r, principal), true
+}
+
+// validate - Returns the Principal authenticated by the credentials, checked against the users
+// or tokens in constant time (all of them are compared), or passed to the validator otherwise.
+func (a *httpAuth) validate(ctx context.Context, credentials Credentials) (*Principal, error) {
+	if credentials.Secret == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	var found string
+	switch credentials.Scheme {
+	case PrincipalBasic:
+		for user, password := range a.users {
+			match := secretsEqual(user, credentials.Username) & secretsEqual(password, credentials.Secret)
+			if match == 1 {
+				found = user
+			}
+		}
+	case PrincipalBearer:
+		for owner, token := range a.tokens {
+			if secretsEqual(token, credentials.Secret) == 1 {
+				found = owner
+			}
+		}
+	}
+	if found != "" {
+		return &Principal{ID: found, Method: credentials.Scheme}, nil
+	}
+
+	if a.validator == nil {
+		return nil, ErrInvalidCredentials
+	}
+	principal, err := a.validator(ctx, credentials)
+	if err == nil && principal == nil {
+		principal = &Principal{ID: credentials.Username, Method: credentials.Scheme}
+	}
+	return principal, err
+}
+
+// secretsEqual - Compare two secrets in constant time, regardless of their length:
+// returns 1 if they are equal, and 0 otherwise.
+func secretsEqual(a, b string) int {
+	hashA, hashB := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(hashA[:], hashB[:])
+}
+
+// copyCredentials - Returns a copy of credentials, so that
+// they are not modified once the server is serving.
+func copyCredentials(credentials map[string]string) map[string]string {
+	copied := make(map[string]string, len(credentials))
+	for name, secret := range credentials {
+		copied[name] = secret
+	}
+	return copied
+}
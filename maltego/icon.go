@@ -0,0 +1,107 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import "strings"
+
+// Icon - The name of an icon built into the Maltego client (see its Icon Manager).
+// Entities using built-in icons need neither hosted images nor embedded files: the
+// client renders them by name. Icons added to the client by other packages can be
+// used the same way, with Icon("TheirName").
+type Icon string
+
+// Built-in Maltego icons, by category.
+const (
+	// Infrastructure
+	IconAS            Icon = "AS"
+	IconDNSName       Icon = "DNSName"
+	IconDomain        Icon = "Domain"
+	IconIPv4Address   Icon = "IPv4Address"
+	IconIPv6Address   Icon = "IPv6Address"
+	IconMXRecord      Icon = "MXRecord"
+	IconNSRecord      Icon = "NSRecord"
+	IconNetblock      Icon = "Netblock"
+	IconURL           Icon = "URL"
+	IconWebsite       Icon = "Website"
+	IconServer        Icon = "Server"
+	IconComputer      Icon = "Computer"
+	IconDevice        Icon = "Device"
+	IconFirewall      Icon = "Firewall"
+	IconRouter        Icon = "Router"
+	IconCertificate   Icon = "Certificate"
+	IconBanner        Icon = "Banner"
+	IconPort          Icon = "Port"
+	IconService       Icon = "Service"
+	IconTechnology    Icon = "Technology"
+	IconCloud         Icon = "Cloud"
+	IconDatabase      Icon = "Database"
+	IconNetwork       Icon = "Network"
+	IconWirelessNet   Icon = "WirelessNetwork"
+	IconVulnerability Icon = "Vulnerability"
+
+	// Personal
+	IconPerson        Icon = "Person"
+	IconAlias         Icon = "Alias"
+	IconEmailAddress  Icon = "EmailAddress"
+	IconPhoneNumber   Icon = "PhoneNumber"
+	IconImage         Icon = "Image"
+	IconPhrase        Icon = "Phrase"
+	IconDocument      Icon = "Document"
+	IconFile          Icon = "File"
+	IconHash          Icon = "Hash"
+	IconSocialProfile Icon = "SocialProfile"
+	IconAccount       Icon = "Account"
+	IconPassword      Icon = "Password"
+	IconKey           Icon = "Key"
+
+	// Groups & Locations
+	IconOrganization Icon = "Organization"
+	IconCompany      Icon = "Company"
+	IconTeam         Icon = "Team"
+	IconLocation     Icon = "Location"
+	IconCircularArea Icon = "CircularArea"
+	IconGPS          Icon = "GPS"
+
+	// Generic
+	IconUnknown  Icon = "Unknown"
+	IconWarning  Icon = "Warning"
+	IconError    Icon = "Error"
+	IconInfo     Icon = "Info"
+	IconFlag     Icon = "Flag"
+	IconBug      Icon = "Bug"
+	IconLock     Icon = "Lock"
+	IconUnlock   Icon = "Unlock"
+	IconBitcoin  Icon = "Bitcoin"
+	IconCurrency Icon = "Currency"
+)
+
+// SetBuiltinIcon - Use an icon built into the Maltego client as the Entity icon, instead
+// of an image URL. The icon is used both at runtime (as the Entity IconURL) and in the
+// Entity configuration, as its large and small icon resources.
+func (e *Entity) SetBuiltinIcon(icon Icon) {
+	e.IconURL = string(icon)
+}
+
+// builtinIcon - Returns the built-in icon used by the Entity, if its IconURL is an icon name.
+func (e *Entity) builtinIcon() (icon Icon, found bool) {
+	if e.IconURL == "" || strings.Contains(e.IconURL, ":") || strings.Contains(e.IconURL, "/") {
+		return "", false
+	}
+	return Icon(e.IconURL), true
+}
@@ -0,0 +1,408 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// IsolatedEnv - The environment variable set when running the subprocess of an isolated
+// Transform (see Isolation): programs serving such Transforms must check it at startup,
+// once their Transforms are registered, and hand over to TransformServer.RunIsolated().
+const IsolatedEnv = "GONDOR_ISOLATED"
+
+// Isolation - Runs a Transform in a separate subprocess, so that a crash, a leak or
+// an out of memory error in its implementation (eg. one provided by a plugin, or
+// calling into untrusted libraries) cannot take down the server. The subprocess is
+// the server program itself by default, which receives the request on its stdin
+// and writes the outputs of the Transform on its stdout.
+//
+//	server.RegisterTransform(&untrusted)
+//	if os.Getenv(maltego.IsolatedEnv) != "" {
+//		os.Exit(server.RunIsolated(os.Stdin, os.Stdout))
+//	}
+//	server.ListenAndServe()
+type Isolation struct {
+	Command   string        // The program serving the Transform, defaults to the current one (os.Executable()).
+	Args      []string      // Arguments to pass to the program, if any.
+	Timeout   time.Duration // Kill the subprocess if it runs longer than this (0 means until the request deadline, if any).
+	MaxCPU    time.Duration // Maximum CPU time of the subprocess, rounded to the second (0 means no limit).
+	MaxMemory uint64        // Maximum address space of the subprocess, in bytes (0 means no limit).
+}
+
+// SetIsolation - Run the Transform in a separate subprocess, with the given limits (see Isolation).
+// The middleware of the Transform run in the subprocess, while its processors run in the server.
+// CPU and memory limits are only enforced on Linux and macOS, and the memory limit applies to
+// the virtual address space of the subprocess, which is much larger than its resident memory.
+func (t *Transform) SetIsolation(isolation Isolation) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.isolation = &isolation
+}
+
+// RunIsolated - Run the Transform requested on stdin, as the subprocess of an isolated
+// Transform (see Isolation), writing its outputs to stdout. Returns the exit code of the
+// subprocess: the Transform failing is not an error, since its exceptions are written.
+func (ts *TransformServer) RunIsolated(stdin io.Reader, stdout io.Writer) (code int) {
+	var request isolatedRequest
+	if err := json.NewDecoder(stdin).Decode(&request); err != nil {
+		fmt.Fprintf(os.Stderr, "Error decoding isolated Transform request: %s\n", err)
+		return LocalExitUsage
+	}
+	if err := setIsolationLimits(request.MaxCPU, request.MaxMemory); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting isolated Transform limits: %s\n", err)
+		return LocalExitFailure
+	}
+	transform := ts.GetTransform(request.Path)
+	if transform == nil {
+		fmt.Fprintf(os.Stderr, "No Transform registered at path %s\n", request.Path)
+		return LocalExitUsage
+	}
+
+	instance := transform.newInstanceFromRequest(request.message(), ts)
+	instance.isolation = nil
+	instance.requestID = request.RequestID
+	ctx, cancel := instance.newContext(context.Background())
+	defer cancel()
+	instance.ctx = ctx
+
+	var response isolatedResponse
+	if err := instance.execute(); err != nil {
+		response.Error = err.Error()
+	}
+	instance.mutex.RLock()
+	for _, entity := range instance.entities {
+		output, err := newIsolatedEntity(entity)
+		if err != nil {
+			instance.mutex.RUnlock()
+			fmt.Fprintf(os.Stderr, "Error encoding isolated Transform response: %s\n", err)
+			return LocalExitFailure
+		}
+		response.Entities = append(response.Entities, output)
+	}
+	response.Messages = instance.messages
+	response.Exceptions = instance.exceptions
+	response.Dropped = instance.dropped
+	instance.mutex.RUnlock()
+
+	if err := json.NewEncoder(stdout).Encode(response); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding isolated Transform response: %s\n", err)
+		return LocalExitFailure
+	}
+	return LocalExitSuccess
+}
+
+// runIsolated - Run the Transform in its subprocess, and merge the outputs
+// of the latter: Entities, messages and exceptions.
+func (t *Transform) runIsolated() (err error) {
+	path := t.Path()
+	t.mutex.RLock()
+	isolation := *t.isolation
+	request, err := newIsolatedRequest(path, t.request, isolation)
+	request.RequestID = t.requestID
+	t.mutex.RUnlock()
+	if err != nil {
+		return t.Errorf("Cannot run Transform %s in a subprocess: %s", t.Name, err)
+	}
+
+	command := isolation.Command
+	if command == "" {
+		if command, err = os.Executable(); err != nil {
+			return t.Errorf("Cannot run Transform %s in a subprocess: %s", t.Name, err)
+		}
+	}
+	ctx := t.Context()
+	if isolation.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, isolation.Timeout)
+		defer cancel()
+	}
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return t.Errorf("Cannot run Transform %s in a subprocess: %s", t.Name, err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, isolation.Args...)
+	cmd.Env = append(os.Environ(), IsolatedEnv+"=1")
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return t.Errorf("Transform %s was killed after running for too long", t.Name)
+		}
+		if detail := crashReason(stderr.String()); detail != "" {
+			err = fmt.Errorf("%s: %s", err, detail)
+		}
+		return t.Errorf("Transform %s crashed in its subprocess (%s)", t.Name, err)
+	}
+	var response isolatedResponse
+	if err = json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return t.Errorf("Transform %s returned an invalid output from its subprocess: %s", t.Name, err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.messages = append(t.messages, response.Messages...)
+	t.exceptions = append(t.exceptions, response.Exceptions...)
+	t.dropped += response.Dropped
+	for _, entity := range response.Entities {
+		if t.request.Slider > 0 && len(t.entities) >= t.request.Slider {
+			t.dropped++
+			continue
+		}
+		t.entities = append(t.entities, entity.toEntity())
+	}
+	t.flushStream()
+
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// crashReason - Returns the line explaining why a subprocess crashed, from its
+// error output: the panic or fatal error message, or its last line otherwise.
+func crashReason(stderr string) string {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// isolatedRequest - A Transform request, as passed to the subprocess of an isolated Transform.
+type isolatedRequest struct {
+	Path       string            `json:"path"`
+	Input      isolatedEntity    `json:"input"`
+	Slider     int               `json:"slider"`
+	Settings   map[string]string `json:"settings,omitempty"`
+	Geneaology []Geneaology      `json:"genealogy,omitempty"`
+	RequestID  string            `json:"requestId,omitempty"`
+	MaxCPU     time.Duration     `json:"maxCpu,omitempty"`
+	MaxMemory  uint64            `json:"maxMemory,omitempty"`
+}
+
+// newIsolatedRequest - Prepare a Transform request to be passed to a subprocess.
+// Setting values are written like property values, and parsed back the same way.
+func newIsolatedRequest(path string, request Message, isolation Isolation) (r isolatedRequest, err error) {
+	input, err := newIsolatedEntity(request.Entity)
+	if err != nil {
+		return r, err
+	}
+	r = isolatedRequest{
+		Path:       path,
+		Input:      input,
+		Slider:     request.Slider,
+		Settings:   map[string]string{},
+		Geneaology: request.Geneaology,
+		MaxCPU:     isolation.MaxCPU,
+		MaxMemory:  isolation.MaxMemory,
+	}
+	for _, setting := range request.Settings {
+		if setting.Default == nil {
+			continue
+		}
+		value, err := marshalValue(reflect.ValueOf(setting.Default))
+		if err != nil {
+			return r, fmt.Errorf("Setting %s: %s", setting.Name, err)
+		}
+		r.Settings[setting.Name] = fmt.Sprintf("%v", value)
+	}
+	return r, nil
+}
+
+// message - Returns the Transform request passed to the subprocess.
+func (r isolatedRequest) message() Message {
+	input := r.Input.toEntity()
+	m := Message{
+		Value:      input.Value,
+		Type:       entityTypeName(input),
+		Weight:     input.Weight,
+		Slider:     r.Slider,
+		Geneaology: r.Geneaology,
+		Entity:     input,
+	}
+	for name, value := range r.Settings {
+		m.Settings = append(m.Settings, TransformSetting{Name: name, Default: value})
+	}
+	return m
+}
+
+// isolatedResponse - The outputs of an isolated Transform, as written by its subprocess.
+type isolatedResponse struct {
+	Entities   []isolatedEntity `json:"entities,omitempty"`
+	Messages   []MessageUI      `json:"messages,omitempty"`
+	Exceptions []Exception      `json:"exceptions,omitempty"`
+	Dropped    int              `json:"dropped,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// isolatedEntity - An Entity passed to or from the subprocess of an isolated
+// Transform. Unlike its JSON representation (see Entity.MarshalJSON()), it has
+// all the display settings of the Entity, and property values are strings.
+type isolatedEntity struct {
+	Namespace   string          `json:"namespace,omitempty"`
+	Type        string          `json:"type"`
+	Value       string          `json:"value"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Weight      int             `json:"weight"`
+	IconURL     string          `json:"iconUrl,omitempty"`
+	Bookmark    BookmarkColor   `json:"bookmark,omitempty"`
+	Link        isolatedLink    `json:"link"`
+	Properties  []isolatedField `json:"properties,omitempty"`
+	Overlays    []Overlay       `json:"overlays,omitempty"`
+	Labels      []Label         `json:"labels,omitempty"`
+}
+
+type isolatedLink struct {
+	Label     string          `json:"label,omitempty"`
+	Style     LinkStyle       `json:"style,omitempty"`
+	Thickness LineThickness   `json:"thickness,omitempty"`
+	ShowLabel LinkShowLabel   `json:"showLabel,omitempty"`
+	Color     string          `json:"color,omitempty"`
+	Direction LinkDirection   `json:"direction,omitempty"`
+	Fields    []isolatedField `json:"fields,omitempty"`
+}
+
+type isolatedField struct {
+	Name         string       `json:"name"`
+	Display      string       `json:"display,omitempty"`
+	MatchingRule MatchingRule `json:"matchingRule,omitempty"`
+	Hidden       bool         `json:"hidden,omitempty"`
+	Value        string       `json:"value"`
+}
+
+// newIsolatedEntity - Prepare an Entity to be passed to or from a subprocess.
+// An error is returned if the value of one of its properties cannot be marshalled.
+func newIsolatedEntity(e Entity) (ie isolatedEntity, err error) {
+	e.ensureInitialized()
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	ie = isolatedEntity{
+		Namespace:   e.Namespace,
+		Type:        e.Type,
+		Value:       e.Value,
+		DisplayName: e.DisplayName,
+		Weight:      e.Weight,
+		IconURL:     e.IconURL,
+		Bookmark:    e.Bookmark,
+		Labels:      e.Labels,
+		Link: isolatedLink{
+			Label:     e.Link.Label,
+			Style:     e.Link.Style,
+			Thickness: e.Link.Thickness,
+			ShowLabel: e.Link.ShowLabel,
+			Color:     e.Link.Color,
+			Direction: e.Link.Direction,
+		},
+	}
+	for _, field := range e.Link.Fields() {
+		isolated, err := newIsolatedField(field)
+		if err != nil {
+			return ie, err
+		}
+		ie.Link.Fields = append(ie.Link.Fields, isolated)
+	}
+	for _, property := range e.Properties {
+		isolated, err := newIsolatedField(property)
+		if err != nil {
+			return ie, err
+		}
+		ie.Properties = append(ie.Properties, isolated)
+	}
+	for _, overlay := range e.Overlays {
+		ie.Overlays = append(ie.Overlays, overlay)
+	}
+	return ie, nil
+}
+
+// toEntity - Returns the Entity passed to or from a subprocess.
+func (ie isolatedEntity) toEntity() Entity {
+	e := NewForeignEntity("", ie.Value)
+	e.Namespace = ie.Namespace
+	e.Type = ie.Type
+	e.DisplayName = ie.DisplayName
+	e.Weight = ie.Weight
+	e.IconURL = ie.IconURL
+	e.Bookmark = ie.Bookmark
+	e.Labels = ie.Labels
+	e.Link = Link{
+		Label:     ie.Link.Label,
+		Style:     ie.Link.Style,
+		Thickness: ie.Link.Thickness,
+		ShowLabel: ie.Link.ShowLabel,
+		Color:     ie.Link.Color,
+		Direction: ie.Link.Direction,
+	}
+	for _, field := range ie.Link.Fields {
+		e.Link.AddField(field.toField())
+	}
+	for _, property := range ie.Properties {
+		e.Properties[property.Name] = property.toField()
+	}
+	for _, overlay := range ie.Overlays {
+		e.Overlays[overlay.Position] = overlay
+	}
+	return e
+}
+
+// newIsolatedField - Prepare a property or link field to be passed to or from a subprocess.
+// Its value is written as in Transform responses, so that lists, times, durations, etc.
+// are parsed back like the properties of any input Entity.
+func newIsolatedField(f Field) (isolatedField, error) {
+	value, err := f.ValueString()
+	if err != nil {
+		return isolatedField{}, err
+	}
+	return isolatedField{
+		Name:         f.Name,
+		Display:      f.Display,
+		MatchingRule: f.MatchingRule,
+		Hidden:       f.Hidden,
+		Value:        value,
+	}, nil
+}
+
+// toField - Returns the property or link field passed to or from a subprocess,
+// with its value as a string: native Go types are populated by unmarshalling it.
+func (f isolatedField) toField() Field {
+	return Field{
+		Name:         f.Name,
+		Display:      f.Display,
+		MatchingRule: f.MatchingRule,
+		Hidden:       f.Hidden,
+		Value:        f.Value,
+	}
+}
@@ -0,0 +1,54 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsolatedRequestValues(t *testing.T) {
+	input := NewForeignEntity("maltego.Domain", "example.com")
+	input.AddProperty(Field{Name: "servers", Value: []string{"ns1", "ns2"}})
+	input.AddProperty(Field{Name: "ttl", Value: 90 * time.Second})
+	request := Message{
+		Entity:   input,
+		Settings: []TransformSetting{{Name: "timeout", Default: 5 * time.Minute}},
+	}
+
+	isolated, err := newIsolatedRequest("/domains", request, Isolation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := map[string]string{}
+	for _, property := range isolated.Input.Properties {
+		properties[property.Name] = property.Value
+	}
+	if properties["servers"] != "ns1,ns2" || properties["ttl"] != "1m30s" {
+		t.Errorf("Properties not passed in their wire format: %v", properties)
+	}
+	if isolated.Settings["timeout"] != "5m0s" {
+		t.Errorf("Setting not passed in its wire format: %q", isolated.Settings["timeout"])
+	}
+
+	input.AddProperty(Field{Name: "status", Value: testStatus(42)})
+	if _, err = newIsolatedRequest("/domains", request, Isolation{}); err == nil {
+		t.Errorf("Expected an error for the value of an invalid property")
+	}
+}
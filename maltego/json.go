@@ -0,0 +1,131 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// jsonEntity - The stable JSON representation of an Entity, for pipelines that don't
+// speak Maltego XML (SIEMs, REST APIs, etc). Properties and overlays are sorted, so
+// that the same Entity always produces the same document.
+type jsonEntity struct {
+	Type        string         `json:"type"`
+	Namespace   string         `json:"namespace,omitempty"`
+	Value       string         `json:"value"`
+	DisplayName string         `json:"displayName,omitempty"`
+	Weight      int            `json:"weight"`
+	Properties  []jsonProperty `json:"properties"`
+	Overlays    []jsonOverlay  `json:"overlays,omitempty"`
+	Labels      []jsonLabel    `json:"labels,omitempty"`
+}
+
+type jsonProperty struct {
+	Name         string      `json:"name"`
+	DisplayName  string      `json:"displayName,omitempty"`
+	MatchingRule string      `json:"matchingRule,omitempty"`
+	Value        interface{} `json:"value"`
+}
+
+type jsonOverlay struct {
+	Position string `json:"position"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+}
+
+type jsonLabel struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+// MarshalJSON - An Entity implements the json.Marshaler interface, producing a stable
+// representation of its fully qualified type, value, weight, properties, overlays and
+// labels. Display-only properties (link and bookmark settings, Go type separators) are
+// not included, as they only make sense in the Maltego client.
+func (e Entity) MarshalJSON() ([]byte, error) {
+	if e.mutex != nil {
+		e.mutex.RLock()
+		defer e.mutex.RUnlock()
+	}
+
+	je := jsonEntity{
+		Type:        strings.Trim(strings.Join([]string{e.Namespace, e.Type}, "."), "."),
+		Namespace:   e.Namespace,
+		Value:       e.Value,
+		DisplayName: e.DisplayName,
+		Weight:      e.Weight,
+		Properties:  []jsonProperty{},
+	}
+
+	for name, property := range e.Properties {
+		if strings.Contains(name, "#") || property.Value == goTypeSeparator {
+			continue
+		}
+		je.Properties = append(je.Properties, jsonProperty{
+			Name:         property.Name,
+			DisplayName:  property.Display,
+			MatchingRule: string(property.MatchingRule),
+			Value:        marshalJSONValue(property.Value),
+		})
+	}
+	sort.Slice(je.Properties, func(i, j int) bool {
+		return je.Properties[i].Name < je.Properties[j].Name
+	})
+
+	for _, overlay := range e.Overlays {
+		je.Overlays = append(je.Overlays, jsonOverlay{
+			Position: string(overlay.Position),
+			Type:     string(overlay.Type),
+			Value:    overlay.PropertyName,
+		})
+	}
+	sort.Slice(je.Overlays, func(i, j int) bool {
+		return je.Overlays[i].Position < je.Overlays[j].Position
+	})
+
+	for _, label := range e.Labels {
+		if label.Name == "" {
+			label.Name = "Info"
+		}
+		if label.Type == "" {
+			label.Type = LabelTypeHTML
+		}
+		je.Labels = append(je.Labels, jsonLabel{Name: label.Name, Type: label.Type, Content: label.Content})
+	}
+
+	return json.Marshal(je)
+}
+
+// ToJSON - Returns the JSON representation of the Entity (see MarshalJSON()).
+func (e Entity) ToJSON() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// marshalJSONValue - Property values that cannot be represented
+// in JSON (eg. native Go structs) are passed as their string value.
+func marshalJSONValue(value interface{}) interface{} {
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return value
+}
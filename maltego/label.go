@@ -0,0 +1,53 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import "encoding/xml"
+
+// LabelTypeHTML - The content type of all labels added with Entity.AddLabel().
+const LabelTypeHTML = "text/html"
+
+// Label - Used to convey extra information associated with an Entity in the Maltego
+// client GUI. The client sends the labels of an Entity along with it when it is the
+// input of a Transform, which reads them with Entity.GetLabels(): unlike properties,
+// they are not unmarshalled into native Go types, nor used to match Entities.
+//
+// Labels are marshalled in the DisplayInformation element of their Entity:
+//
+//	<DisplayInformation>
+//	    <Label Name="Info" Type="text/html"><![CDATA[content]]></Label>
+//	</DisplayInformation>
+type Label struct {
+	Name    string `xml:"Name,attr"` // The name (key) for the label
+	Type    string `xml:"Type,attr"` // The type of content (if empty, defaults to "text/html")
+	Content string `xml:",cdata"`    // The content, displayed in Maltego
+}
+
+// MarshalXML - A Label implements the xml.Marshaller interface, so that
+// its name and content type always have a valid value when sent to Maltego.
+func (l Label) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type label Label // Avoid recursive calls to this function
+	if l.Name == "" {
+		l.Name = "Info"
+	}
+	if l.Type == "" {
+		l.Type = LabelTypeHTML
+	}
+	return e.EncodeElement(label(l), start)
+}
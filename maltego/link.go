@@ -18,7 +18,16 @@ package maltego
    along with this program.  If not, see <https://www.gnu.org/licenses/>.
 */
 
-// Link - Access and set all settings for the link to/from this entity
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Link - Access and set all settings for the link to/from this entity.
+// All of them, including custom fields, are passed as Entity properties
+// prefixed with "link#", so that when an Entity is passed as an input to
+// a Transform, its Link reflects how the previous Transform linked it.
 type Link struct {
 	Label      string
 	Style      LinkStyle
@@ -31,6 +40,16 @@ type Link struct {
 
 // TODO: check link sync.Mutex not nil when instantiating
 
+// clone - Returns a copy of the link, not sharing its custom fields.
+func (l Link) clone() Link {
+	properties := make([]Field, 0, len(l.properties))
+	for _, field := range l.properties {
+		properties = append(properties, field.clone())
+	}
+	l.properties = properties
+	return l
+}
+
 // Reverse - Set the reverse direction for this Entity link:
 // insted of being Input => Output, set it to Input <= Output.
 func (l *Link) Reverse() {
@@ -39,10 +58,117 @@ func (l *Link) Reverse() {
 
 // AddField - Exactly as you can AddField() to an entity,
 // you can add custom property fields to an Entity link.
+// Adding a field with the name of an existing one replaces it.
 func (l *Link) AddField(f Field) {
+	for i, field := range l.properties {
+		if field.Name == f.Name {
+			l.properties[i] = f
+			return
+		}
+	}
 	l.properties = append(l.properties, f)
 }
 
+// Fields - Returns the custom property fields of this Entity link.
+func (l Link) Fields() []Field {
+	return l.properties
+}
+
+// Field - Returns the custom link field with the given name
+// (without its "link#" prefix), or nil if there is none.
+func (l Link) Field(name string) *Field {
+	for _, field := range l.properties {
+		if field.Name == name {
+			return &field
+		}
+	}
+	return nil
+}
+
+// Link properties - The names of the Entity properties
+// in which the builtin Link settings are passed.
+const (
+	linkPropertyPrefix    = "link#"
+	linkColorProperty     = "link#maltego.link.color"
+	linkStyleProperty     = "link#maltego.link.style"
+	linkThicknessProperty = "link#maltego.link.thickness"
+	linkLabelProperty     = "link#maltego.link.label"
+	linkShowLabelProperty = "link#maltego.link.show-label"
+	linkDirectionProperty = "link#maltego.link.direction"
+)
+
+// toProperties - The link wraps all its settings and custom fields into
+// Entity properties. Custom fields are prefixed with "link#", if needed.
+// Settings left to their zero value are not included, so that the client
+// applies its own defaults (eg. the Transform name as the link label).
+func (l Link) toProperties() (properties []Field) {
+	if l.Color != "" {
+		properties = append(properties, Field{Name: linkColorProperty, Display: "LinkColor", MatchingRule: MatchLoose, Value: l.Color})
+	}
+	if l.Style != LinkNormal {
+		properties = append(properties, Field{Name: linkStyleProperty, Display: "LinkStyle", MatchingRule: MatchLoose, Value: int(l.Style)})
+	}
+	if l.Thickness != LineVeryThin {
+		properties = append(properties, Field{Name: linkThicknessProperty, Display: "Thickness", MatchingRule: MatchLoose, Value: int(l.Thickness)})
+	}
+	if l.Label != "" {
+		properties = append(properties, Field{Name: linkLabelProperty, Display: "Label", MatchingRule: MatchLoose, Value: l.Label})
+	}
+	if l.ShowLabel != LinkLabelGlobal {
+		properties = append(properties, Field{Name: linkShowLabelProperty, Display: "Show Label", MatchingRule: MatchLoose, Value: int(l.ShowLabel)})
+	}
+	if l.Direction != "" {
+		properties = append(properties, Field{Name: linkDirectionProperty, Display: "Direction", MatchingRule: MatchLoose, Value: string(l.Direction)})
+	}
+
+	for _, field := range l.properties {
+		if !strings.HasPrefix(field.Name, linkPropertyPrefix) {
+			field.Name = linkPropertyPrefix + field.Name
+		}
+		properties = append(properties, field)
+	}
+
+	return
+}
+
+// fromProperties - The link populates its settings and custom fields from
+// Entity properties, generally when the Entity is an input to a Transform.
+// All properties prefixed with "link#" that are not builtin settings are
+// custom fields, and are stored without their prefix.
+func (l *Link) fromProperties(properties Properties) {
+	for name, property := range properties {
+		if !strings.HasPrefix(name, linkPropertyPrefix) {
+			continue
+		}
+
+		var value string
+		if property.Value != nil {
+			value = fmt.Sprintf("%v", property.Value)
+		}
+
+		switch name {
+		case linkColorProperty:
+			l.Color = value
+		case linkStyleProperty:
+			style, _ := strconv.Atoi(value)
+			l.Style = LinkStyle(style)
+		case linkThicknessProperty:
+			thickness, _ := strconv.Atoi(value)
+			l.Thickness = LineThickness(thickness)
+		case linkLabelProperty:
+			l.Label = value
+		case linkShowLabelProperty:
+			show, _ := strconv.Atoi(value)
+			l.ShowLabel = LinkShowLabel(show)
+		case linkDirectionProperty:
+			l.Direction = LinkDirection(value)
+		default:
+			property.Name = strings.TrimPrefix(name, linkPropertyPrefix)
+			l.AddField(property)
+		}
+	}
+}
+
 // LinkStyle - The appearance style of a link to between two Entities.
 type LinkStyle int
 
@@ -95,6 +221,16 @@ const (
 	Bidirectional     LinkDirection = "bidirectional"
 )
 
+// Special properties - The names of the Entity properties in which
+// the Maltego client passes the notes and bookmark of an Entity.
+const (
+	notesProperty    = "notes#"
+	bookmarkProperty = "bookmark#"
+
+	// legacyBookmarkProperty - The name once used for the bookmark, still read.
+	legacyBookmarkProperty = "#bookmark"
+)
+
 // BookmarkColor - The color of an Entity bookmark
 type BookmarkColor string
 
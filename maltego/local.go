@@ -0,0 +1,229 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
+)
+
+// Exit codes of a Transform run as a local Transform (see RunLocal()).
+const (
+	LocalExitSuccess = 0 // The Transform ran successfully, its output is on stdout.
+	LocalExitFailure = 1 // The Transform failed, its exceptions are on stdout and stderr.
+	LocalExitUsage   = 2 // The command was invoked with invalid arguments, explained on stderr.
+)
+
+// SetLocal - Declare the Transform as a local one, run by the Maltego client as a command
+// on the analyst machine instead of being queried over HTTP: the command and its parameters
+// are written in the distribution, which declares the Transform with the local adapter. The
+// client appends the input Entity value and its properties to the parameters when running it.
+func (t *Transform) SetLocal(command string, args ...string) {
+	t.CmdLineTransformSetting(command, args...)
+}
+
+// SetLocal - Declare all Transforms registered to the server as local Transforms, run by the
+// same command (generally the Go binary serving them, eg. os.Executable()), with parameters
+// made of args followed by the Transform path: the command is expected to pass its parameters
+// to RunLocal(). Transforms registered afterwards are not affected.
+//
+//	// Invoked by Maltego as: transforms local /DNSToIP example.com "key=value#..."
+//	if len(os.Args) > 1 && os.Args[1] == "local" {
+//		os.Exit(server.RunLocal(os.Args[2:], os.Stdout, os.Stderr))
+//	}
+func (ts *TransformServer) SetLocal(command string, args ...string) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	for path, t := range ts.Transforms {
+		t.SetLocal(command, append(append([]string{}, args...), path)...)
+		ts.Distribution.RegisterTransform(*t)
+	}
+}
+
+// RunLocal - Run a Transform as a Maltego local Transform, writing its output message to
+// stdout and any error to stderr, and returning the exit code of the command. The arguments
+// are the path (or name) of the Transform, followed by those passed by the Maltego client:
+// the input Entity value, and its properties as name=value pairs separated by '#'.
+// The input Entity has the type declared by the Transform input, if any.
+func (ts *TransformServer) RunLocal(args []string, stdout, stderr io.Writer) (code int) {
+	if len(args) < 2 {
+		fmt.Fprintln(stderr, "Usage: <transform> <entity value> [name=value#name=value...]")
+		return LocalExitUsage
+	}
+
+	path := args[0]
+	transform := ts.GetTransform(path)
+	if transform == nil {
+		path = "/" + strings.TrimPrefix(path, "/")
+		if transform = ts.GetTransform(path); transform == nil {
+			fmt.Fprintf(stderr, "No Transform registered at path %s\n", args[0])
+			return LocalExitUsage
+		}
+	}
+
+	// The client does not send the Entity type, but the Transform knows it.
+	fqType := ""
+	transform.mutex.RLock()
+	if transform.input != nil {
+		fqType = entityTypeName(transform.input.AsEntity())
+	}
+	transform.mutex.RUnlock()
+
+	input := NewForeignEntity(fqType, args[1])
+	if len(args) > 2 {
+		for name, value := range parseLocalFields(args[2]) {
+			input.AddProperty(Field{Name: name, Value: value})
+		}
+	}
+	request := Message{
+		Value:  input.Value,
+		Type:   fqType,
+		Entity: input,
+	}
+
+	instance, runErr, err := ts.runRequest(context.Background(), path, "", nil, request)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return LocalExitUsage
+	}
+
+	format := configuration.XMLCompact
+	if ts.PrettyXML {
+		format = configuration.XMLPretty
+	}
+	output, err := instance.marshalOutput(runErr, format)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error marshalling Transform output: %s\n", err)
+		return LocalExitFailure
+	}
+	stdout.Write(output)
+
+	if runErr != nil {
+		for _, exception := range instance.Exceptions() {
+			fmt.Fprintln(stderr, exception)
+		}
+		return LocalExitFailure
+	}
+	return LocalExitSuccess
+}
+
+// parseLocalFields - Parse the Entity properties passed to a local Transform, as
+// name=value pairs separated by '#', in which '#', '=' and '\' are escaped with '\'.
+func parseLocalFields(arg string) map[string]string {
+	fields := map[string]string{}
+	var pair []string
+	var current strings.Builder
+	escaped := false
+
+	flush := func() {
+		pair = append(pair, current.String())
+		current.Reset()
+		if len(pair) == 2 && pair[0] != "" {
+			fields[pair[0]] = pair[1]
+		}
+		pair = nil
+	}
+
+	for _, r := range arg {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '=' && len(pair) == 0:
+			pair = append(pair, current.String())
+			current.Reset()
+		case r == '#':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return fields
+}
+
+// isLocal - Whether the Transform is a local one (see SetLocal()).
+func (t *Transform) isLocal() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for _, setting := range t.Settings.settings {
+		if setting.Name == configuration.LocalCommand {
+			return true
+		}
+	}
+	return false
+}
+
+// toConfig - The Transform wraps itself into its configuration equivalent,
+// using the given adapter, for inclusion in a distribution.
+func (t *Transform) toConfig(adapter configuration.TransformAdapter) configuration.Transform {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	config := configuration.Transform{
+		TransformInfo:    t.TransformInfo,
+		Visibility:       configuration.VisibilityTypePublic,
+		TransformAdapter: adapter,
+		Authenticator:    t.authenticator,
+		Sets:             append([]string{}, t.sets...),
+		Settings:         t.Settings.toConfig(),
+	}
+	if config.DisplayName == "" {
+		config.DisplayName = getDisplayName(t.Name)
+	}
+	if t.Debug {
+		config.Settings.Settings = withDebugProperty(config.Settings.Settings)
+	}
+	if t.input != nil {
+		config.Input = append(config.Input, configuration.IOConstraint{
+			Type: entityTypeName(t.input.AsEntity()),
+			Min:  1,
+			Max:  1,
+		})
+	}
+	for _, output := range t.output {
+		config.Output = append(config.Output, configuration.IOConstraint{
+			Type: entityTypeName(output.AsEntity()),
+			Min:  0,
+			Max:  1,
+		})
+	}
+
+	return config
+}
+
+// withDebugProperty - Returns the properties of a Transform in Debug mode: the property
+// showing the client debug window is added, or enabled by default if it already exists.
+func withDebugProperty(properties []configuration.TransformProperty) []configuration.TransformProperty {
+	debug := debugSetting(true)
+	for i, property := range properties {
+		if property.Name == configuration.LocalDebug {
+			properties[i].DefaultValue = fmt.Sprintf("%v", debug.Default)
+			return properties
+		}
+	}
+	return append(properties, debug.toTransformProperty())
+}
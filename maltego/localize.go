@@ -0,0 +1,197 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+//
+// Localization - Display Names & Descriptions per Locale ----------------------------------------
+//
+// Entities and Transforms can have their display name and description translated for analyst
+// groups not working in English. Distributions write all translations as one resource bundle
+// per locale (eg. Localization/Bundle_fr.properties), with keys of the form:
+//
+//	entity.acme.Vessel.displayName=Navire
+//	transform.DNSToIP.description=Résout un nom de domaine en adresses IP
+//
+// Locales are language tags, with an optional region (eg. "fr", "fr_CA" or "pt-BR").
+
+// Localized - The display name and description of an Entity or Transform, in a given locale.
+type Localized struct {
+	DisplayName string `json:"display,omitempty" yaml:"display,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// Localizations - Localized display names and descriptions, by locale.
+type Localizations map[string]Localized
+
+// Localize - Set the display name and description of the Entity type in a locale (eg. "fr").
+func (e *Entity) Localize(locale string, l Localized) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.locales == nil {
+		e.locales = Localizations{}
+	}
+	e.locales[normalizeLocale(locale)] = l
+}
+
+// Localized - Returns the display name and description of the Entity type in a locale,
+// falling back on its language (eg. "fr" for "fr_CA"), and then on the default ones.
+func (e *Entity) Localized(locale string) Localized {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.locales.lookup(locale, Localized{DisplayName: e.DisplayName, Description: e.Description})
+}
+
+// Localize - Set the display name and description of the Transform in a locale (eg. "fr").
+func (t *Transform) Localize(locale string, l Localized) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.locales == nil {
+		t.locales = Localizations{}
+	}
+	t.locales[normalizeLocale(locale)] = l
+}
+
+// Localized - Returns the display name and description of the Transform in a locale,
+// falling back on its language (eg. "fr" for "fr_CA"), and then on the default ones.
+func (t *Transform) Localized(locale string) Localized {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.locales.lookup(locale, Localized{DisplayName: t.DisplayName, Description: t.Description})
+}
+
+// lookup - Returns the localization for a locale or its language, completed with the defaults.
+func (l Localizations) lookup(locale string, defaults Localized) Localized {
+	locale = normalizeLocale(locale)
+	localized, found := l[locale]
+	if !found {
+		localized = l[strings.SplitN(locale, "_", 2)[0]]
+	}
+	if localized.DisplayName == "" {
+		localized.DisplayName = defaults.DisplayName
+	}
+	if localized.Description == "" {
+		localized.Description = defaults.Description
+	}
+	return localized
+}
+
+// clone - Returns a copy of the localizations, not sharing their map.
+func (l Localizations) clone() Localizations {
+	if l == nil {
+		return nil
+	}
+	c := make(Localizations, len(l))
+	for locale, localized := range l {
+		c[locale] = localized
+	}
+	return c
+}
+
+// normalizeLocale - Canonicalize a locale (eg. "pt-br" gives "pt_BR").
+func normalizeLocale(locale string) string {
+	parts := strings.SplitN(strings.ReplaceAll(locale, "-", "_"), "_", 2)
+	parts[0] = strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		parts[1] = strings.ToUpper(parts[1])
+	}
+	return strings.Join(parts, "_")
+}
+
+// writeLocalizations - Write the resource bundles of all locales in which
+// Entities or Transforms of the distribution are localized.
+func (d *Distribution) writeLocalizations(dir string) error {
+	bundles := map[string]map[string]string{}
+	add := func(kind, id string, locales Localizations) {
+		for locale, localized := range locales {
+			if bundles[locale] == nil {
+				bundles[locale] = map[string]string{}
+			}
+			key := strings.Join([]string{kind, id}, ".")
+			if localized.DisplayName != "" {
+				bundles[locale][key+".displayName"] = localized.DisplayName
+			}
+			if localized.Description != "" {
+				bundles[locale][key+".description"] = localized.Description
+			}
+		}
+	}
+	for id, entity := range d.entities {
+		add("entity", id, entity.locales)
+	}
+	for name, locales := range d.locales {
+		add("transform", name, locales)
+	}
+	if len(bundles) == 0 {
+		return nil
+	}
+
+	bundleDir := filepath.Join(dir, "Localization")
+	if err := os.MkdirAll(bundleDir, 0o755); err != nil {
+		return fmt.Errorf("Error getting output dir: %s", err)
+	}
+	for locale, bundle := range bundles {
+		keys := make([]string, 0, len(bundle))
+		for key := range bundle {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var contents strings.Builder
+		for _, key := range keys {
+			fmt.Fprintf(&contents, "%s=%s\n", escapeProperty(key), escapeProperty(bundle[key]))
+		}
+		path := filepath.Join(bundleDir, "Bundle_"+locale+".properties")
+		if err := os.WriteFile(path, []byte(contents.String()), 0o644); err != nil {
+			return fmt.Errorf("Error writing %s localization: %s", locale, err)
+		}
+	}
+
+	return nil
+}
+
+// escapeProperty - Escape a key or value for a Java properties file, which is
+// encoded in ISO-8859-1: all other characters are written as \uXXXX escapes.
+func escapeProperty(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '=' || r == ':' || r == '#' || r == '!':
+			escaped.WriteString(`\` + string(r))
+		case r == '\n':
+			escaped.WriteString(`\n`)
+		case r > 0xffff:
+			r1, r2 := utf16.EncodeRune(r)
+			fmt.Fprintf(&escaped, `\u%04x\u%04x`, r1, r2)
+		case r < 0x20 || r > 0x7e:
+			fmt.Fprintf(&escaped, `\u%04x`, r)
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,133 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader - The HTTP header identifying a request across systems. When a request
+// has none, the server generates an identifier, and always sends it back in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// Logger - A server-side logger, to which all UI messages and exceptions of Transforms
+// are mirrored (see TransformServer.Logger). The standard *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// RequestID - Returns the identifier of the request run by the Transform, either sent by
+// the client in the RequestIDHeader, or generated by the server. All runs of a request
+// with several input Entities share it. Messages mirrored to the server logger include it.
+func (t *Transform) RequestID() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.requestID
+}
+
+// requestIDKey - The context key of the identifier of an HTTP request.
+type requestIDKey struct{}
+
+// withRequestID - Returns a context carrying the identifier of an HTTP request, taken from
+// its RequestIDHeader or generated, and send the identifier back in the response header.
+func withRequestID(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID - Returns the request identifier carried by a context, or a new one.
+func requestID(ctx context.Context) string {
+	if ctx != nil {
+		if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+			return id
+		}
+	}
+	return newRequestID()
+}
+
+// newRequestID - Generate a random request identifier.
+func newRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// logf - Mirror a UI message or an exception of the Transform to the server logger, if any.
+func (t *Transform) logf(level, msg string) {
+	t.mutex.RLock()
+	server, name, id := t.server, t.Name, t.requestID
+	t.mutex.RUnlock()
+	if server == nil || server.Logger == nil {
+		return
+	}
+	server.Logger.Printf("[%s] %s (request %s): %s", level, name, id, msg)
+}
+
+// tracef - Log a verbose execution message of a Transform in Debug mode (see TransformInfo):
+// it is shown as a debug message in the Maltego transform window, and written to the logger.
+func (t *Transform) tracef(format string, args ...interface{}) {
+	if t.Debug {
+		t.Debugf(format, args...)
+	}
+}
+
+// traceStart - Log the inputs, settings and limits of a Transform run in Debug mode.
+// Only the names of the settings are logged, as their values may be secrets.
+func (t *Transform) traceStart(processors int) {
+	if !t.Debug {
+		return
+	}
+	names := make([]string, 0, len(t.request.Settings))
+	for _, setting := range t.request.Settings {
+		names = append(names, setting.Name)
+	}
+	t.tracef("Running %s (request %s) on %d input Entities, with settings [%s]",
+		t.Name, t.requestID, len(t.Inputs()), strings.Join(names, ", "))
+	for _, input := range t.Inputs() {
+		t.tracef("Input: %s %q", entityTypeName(*input), input.Value)
+	}
+	if deadline, ok := t.Deadline(); ok {
+		t.tracef("Deadline: %s left", time.Until(deadline).Round(time.Millisecond))
+	}
+	t.tracef("Slider: %d, output processors: %d", t.request.Slider, processors)
+}
+
+// traceEnd - Log the outcome of a Transform run in Debug mode.
+func (t *Transform) traceEnd(err error, duration time.Duration) {
+	if !t.Debug {
+		return
+	}
+	t.mutex.RLock()
+	entities, dropped := len(t.entities), t.dropped
+	t.mutex.RUnlock()
+	if err != nil {
+		t.tracef("Failed after %s: %s", duration.Round(time.Millisecond), err)
+		return
+	}
+	t.tracef("Done in %s: %d output Entities, %d dropped", duration.Round(time.Millisecond), entities, dropped)
+}
@@ -0,0 +1,254 @@
+// Package maltegotest provides a harness for unit-testing Transforms: it builds synthetic
+// Maltego requests from Go Entities (value, properties, slider, settings), runs a Transform
+// on them and exposes assertions over its output Entities, UI messages and exceptions,
+// without any HTTP server or Maltego client involved.
+//
+//	func TestToIPAddress(t *testing.T) {
+//		request := maltegotest.NewRequest(maltego.NewForeignEntity("maltego.Domain", "example.com")).Slider(5)
+//		result := maltegotest.Run(t, &transform, request)
+//		result.AssertSuccess().AssertEntityCount(1)
+//		result.AssertEntity("maltego.IPv4Address", "93.184.216.34")
+//	}
+package maltegotest
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// DefaultSlider - The number of results requested by default, high enough
+// for the slider not to drop any output Entity in most tests.
+const DefaultSlider = 10000
+
+// Request - A synthetic Maltego request, built from one or more input Entities.
+// All its methods return the request itself, so that they can be chained.
+type Request struct {
+	inputs   []maltego.Entity
+	slider   int
+	settings []maltego.TransformSetting
+}
+
+// NewRequest - Create a request for the given input Entities, with the first one as the main
+// input Entity: a request with several of them is like a Transform run on a selection.
+func NewRequest(inputs ...maltego.ValidEntity) *Request {
+	r := &Request{slider: DefaultSlider}
+	for _, input := range inputs {
+		r.inputs = append(r.inputs, input.AsEntity())
+	}
+	if len(r.inputs) == 0 {
+		r.inputs = append(r.inputs, maltego.Entity{Properties: map[string]maltego.Field{}})
+	}
+	return r
+}
+
+// Value - Set the value of the main input Entity.
+func (r *Request) Value(value string) *Request {
+	r.inputs[0] = r.inputs[0].WithValue(value)
+	return r
+}
+
+// Property - Set a property of the main input Entity, as if edited in the Maltego client.
+func (r *Request) Property(name string, value interface{}) *Request {
+	r.inputs[0] = r.inputs[0].WithField(maltego.Field{Name: name, Value: value})
+	return r
+}
+
+// Weight - Set the weight of the main input Entity.
+func (r *Request) Weight(weight int) *Request {
+	r.inputs[0] = r.inputs[0].WithWeight(weight)
+	return r
+}
+
+// Slider - Set the maximum number of results requested (see DefaultSlider).
+func (r *Request) Slider(slider int) *Request {
+	r.slider = slider
+	return r
+}
+
+// Setting - Set a Transform setting sent along the request, as the client or TDS would.
+func (r *Request) Setting(name string, value interface{}) *Request {
+	r.settings = append(r.settings, maltego.TransformSetting{Name: name, Default: value})
+	return r
+}
+
+// Message - Returns the request as a Maltego message, as unmarshalled by a server.
+func (r *Request) Message() maltego.Message {
+	input := r.inputs[0]
+	message := maltego.Message{
+		Value:    input.Value,
+		Type:     entityTypeName(input),
+		Weight:   input.Weight,
+		Slider:   r.slider,
+		Entity:   input,
+		Settings: append([]maltego.TransformSetting{}, r.settings...),
+	}
+	if len(r.inputs) > 1 {
+		message.Entities = append([]maltego.Entity{}, r.inputs...)
+	}
+	return message
+}
+
+// Result - The outcome of a Transform run, with assertions over it. Failed assertions
+// are reported to the test, which stops: all assertions return the result itself (or
+// the Entity they looked for), so that they can be chained.
+type Result struct {
+	Entities   []maltego.Entity    // All output Entities
+	Messages   []maltego.MessageUI // All UI messages
+	Exceptions []maltego.Exception // All exceptions, if the run failed
+	Err        error               // The error with which the run failed, if it did
+	Transform  *maltego.Transform  // The Transform instance that has run
+	tb         testing.TB
+}
+
+// Run - Run a Transform on a request, on a throwaway server holding this Transform only.
+// The test fails if the Transform cannot be run at all.
+func Run(tb testing.TB, t *maltego.Transform, r *Request) *Result {
+	tb.Helper()
+	server := maltego.NewTransformServer(nil)
+	server.RegisterTransform(t)
+	return RunServer(tb, server, t.Path(), r)
+}
+
+// RunServer - Run the Transform registered at path on an existing server, so that its
+// middleware, processors, sessions and settings apply. The test fails if no Transform
+// is registered at this path.
+func RunServer(tb testing.TB, server *maltego.TransformServer, path string, r *Request) *Result {
+	tb.Helper()
+	instance, err := server.Run(path, r.Message())
+	if err != nil {
+		tb.Fatalf("Cannot run Transform at %s: %s", path, err)
+		return nil
+	}
+	return &Result{
+		Entities:   instance.Entities(),
+		Messages:   instance.Messages(),
+		Exceptions: instance.Exceptions(),
+		Err:        instance.Err(),
+		Transform:  instance,
+		tb:         tb,
+	}
+}
+
+// AssertSuccess - The Transform run has not failed.
+func (r *Result) AssertSuccess() *Result {
+	r.tb.Helper()
+	if r.Err != nil {
+		r.tb.Fatalf("Transform failed: %s (exceptions: %v)", r.Err, r.Exceptions)
+	}
+	return r
+}
+
+// AssertFailure - The Transform run has failed, with an error containing text.
+func (r *Result) AssertFailure(text string) *Result {
+	r.tb.Helper()
+	if r.Err == nil {
+		r.tb.Fatalf("Transform succeeded, expected it to fail with %q", text)
+	} else if !strings.Contains(r.Err.Error(), text) {
+		r.tb.Fatalf("Transform failed with %q, expected %q", r.Err, text)
+	}
+	return r
+}
+
+// AssertEntityCount - The Transform has returned exactly count Entities.
+func (r *Result) AssertEntityCount(count int) *Result {
+	r.tb.Helper()
+	if len(r.Entities) != count {
+		r.tb.Fatalf("Transform returned %d Entities, expected %d: %v", len(r.Entities), count, r.values())
+	}
+	return r
+}
+
+// AssertEntity - The Transform has returned an Entity of this type with this value, which
+// is returned for further checks. The type is either fully qualified (eg. maltego.Domain)
+// or not (eg. Domain), and an empty type matches all Entities.
+func (r *Result) AssertEntity(entityType, value string) maltego.Entity {
+	r.tb.Helper()
+	for _, entity := range r.Entities {
+		if entity.Value != value {
+			continue
+		}
+		if entityType == "" || entityType == entity.Type || entityType == entityTypeName(entity) {
+			return entity
+		}
+	}
+	r.tb.Fatalf("Transform returned no %s Entity with value %q: %v", entityType, value, r.values())
+	return maltego.Entity{}
+}
+
+// AssertNoEntity - The Transform has not returned any Entity with this value.
+func (r *Result) AssertNoEntity(value string) *Result {
+	r.tb.Helper()
+	for _, entity := range r.Entities {
+		if entity.Value == value {
+			r.tb.Fatalf("Transform returned an unexpected %s Entity with value %q", entityTypeName(entity), value)
+		}
+	}
+	return r
+}
+
+// AssertMessage - The Transform has logged a UI message containing text.
+func (r *Result) AssertMessage(text string) *Result {
+	r.tb.Helper()
+	for _, message := range r.Messages {
+		if strings.Contains(message.Text, text) {
+			return r
+		}
+	}
+	r.tb.Fatalf("Transform logged no message containing %q: %v", text, r.Messages)
+	return r
+}
+
+// AssertException - The Transform has raised an exception containing text.
+func (r *Result) AssertException(text string) *Result {
+	r.tb.Helper()
+	for _, exception := range r.Exceptions {
+		if strings.Contains(string(exception), text) {
+			return r
+		}
+	}
+	r.tb.Fatalf("Transform raised no exception containing %q: %v", text, r.Exceptions)
+	return r
+}
+
+// AssertNoExceptions - The Transform has not raised any exception.
+func (r *Result) AssertNoExceptions() *Result {
+	r.tb.Helper()
+	if len(r.Exceptions) > 0 {
+		r.tb.Fatalf("Transform raised exceptions: %v", r.Exceptions)
+	}
+	return r
+}
+
+// values - The type and value of all output Entities, for failure messages.
+func (r *Result) values() []string {
+	values := make([]string, 0, len(r.Entities))
+	for _, entity := range r.Entities {
+		values = append(values, entityTypeName(entity)+"="+entity.Value)
+	}
+	return values
+}
+
+// entityTypeName - The fully qualified Maltego type of an Entity.
+func entityTypeName(e maltego.Entity) string {
+	return strings.Trim(strings.Join([]string{e.Namespace, e.Type}, "."), ".")
+}
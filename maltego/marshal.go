@@ -19,8 +19,19 @@ package maltego
 */
 
 import (
+	"encoding"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
 )
 
 //
@@ -32,10 +43,21 @@ import (
 
 // GetGoProperties - This function uses reflection to package all valid fields in the struct
 // (as interface) stored by the Entity, as properties. We overwrite them directly each time.
+// Once all properties are set, overlays are checked, and colour overlays computed: any
+// invalid overlay is removed from the Entity and reported in the returned error.
 func (e *Entity) GetGoProperties() (err error) {
-	if e.data == nil {
+	if err = e.marshalGoProperties(); err != nil {
 		return
 	}
+	return e.resolveOverlays()
+}
+
+// marshalGoProperties - Package all valid fields of the native Go type of the
+// Entity (if any) as properties, without resolving nor checking its overlays.
+func (e *Entity) marshalGoProperties() (err error) {
+	if e.data == nil {
+		return nil
+	}
 
 	// Get the reflect value here. The type is only
 	// needed in recursive calls, with entityValue.TypeOf()
@@ -49,22 +71,30 @@ func (e *Entity) GetGoProperties() (err error) {
 	default:
 		// Simply add the field with fmt.Sprintf representation of the data.
 		// This might be big, so people better know what they are passing.
+		var value interface{}
+		if value, err = marshalValue(entityValue); err != nil {
+			return fmt.Errorf("Go Type %s: %s", entityValue.Type(), err)
+		}
 		e.AddProperty(Field{
 			Name:         "Go Type: " + entityType.String(),
 			MatchingRule: MatchLoose,
-			Value:        e.data,
+			Value:        value,
 		})
 
 	// But we send structs in a recursive loop, for any embedded structs.
 	case reflect.Ptr, reflect.Struct:
-		e.marshalStruct("", entityValue, nil)
+		return e.marshalStruct("", entityValue, nil)
 	}
 
 	return
 }
 
+// goTypeSeparator - The value of the properties separating the
+// fields of each (nested) struct of an Entity in its properties.
+const goTypeSeparator = "Go type"
+
 // marshalStruct - Marshal a struct with an arbitrary level of nesting, and package its content as Properties.
-func (e *Entity) marshalStruct(namespace string, entityValue reflect.Value, field *reflect.StructField) {
+func (e *Entity) marshalStruct(namespace string, entityValue reflect.Value, field *reflect.StructField) (err error) {
 
 	// Process any base Entities first, for preserving properties order.
 	// This also sets all the Entity's inherited fields, like icons, labels, etc.
@@ -75,7 +105,7 @@ func (e *Entity) marshalStruct(namespace string, entityValue reflect.Value, fiel
 		Name:         getNamespace(namespace, entityValue.Type().Name()),
 		Display:      entityValue.String(),
 		MatchingRule: MatchLoose,
-		Value:        "Go type",
+		Value:        goTypeSeparator,
 	})
 
 	// Compute the current namespace for this struct
@@ -85,9 +115,7 @@ func (e *Entity) marshalStruct(namespace string, entityValue reflect.Value, fiel
 
 	// Then, process the property fields that are specific to this Entity, but
 	// which might include any level of struct/type/whatever nesting.
-	e.marshalProperties(namespace, entityValue, field)
-
-	return
+	return e.marshalProperties(namespace, entityValue, field)
 }
 
 // marshalBaseEntities - Get all the base Entities first, process their
@@ -106,8 +134,8 @@ func (e *Entity) marshalBaseEntities(entityValue reflect.Value, field *reflect.S
 		fieldValue := entityValue.Field(fieldCount) // Can be nil
 		fieldType := entityValue.Type().Field(fieldCount)
 
-		// We can't read unexported fields, nor
-		if !fieldType.IsExported() {
+		// We can't read unexported fields, nor those excluded by their tag.
+		if !isMarshalled(fieldType) {
 			continue
 		}
 
@@ -120,11 +148,6 @@ func (e *Entity) marshalBaseEntities(entityValue reflect.Value, field *reflect.S
 			realValue = fieldValue
 		}
 
-		// We can't read unexported fields, nor
-		if !fieldType.IsExported() {
-			continue
-		}
-
 		// If the type is marked as a Base entity, check and process it.
 		if _, isBaseEntity := fieldType.Tag.Lookup("base"); isBaseEntity {
 			e.marshalBaseEntity(realValue, &fieldType)
@@ -153,7 +176,7 @@ func (e *Entity) marshalBaseEntity(entityValue reflect.Value, field *reflect.Str
 }
 
 // marshalProperties - Wrap all fields specific to this Entity into valid Properties, based on reflection.
-func (e *Entity) marshalProperties(namespace string, entityValue reflect.Value, field *reflect.StructField) {
+func (e *Entity) marshalProperties(namespace string, entityValue reflect.Value, field *reflect.StructField) (err error) {
 
 	numFields := entityValue.Type().NumField()
 	for fieldCount := 0; fieldCount < numFields; fieldCount++ {
@@ -167,8 +190,8 @@ func (e *Entity) marshalProperties(namespace string, entityValue reflect.Value,
 		fieldVal := entityValue.Field(fieldCount) // Can be nil
 		fieldType := entityValue.Type().Field(fieldCount)
 
-		// We can't read unexported fields, nor
-		if !fieldType.IsExported() {
+		// We can't read unexported fields, nor those excluded by their tag.
+		if !isMarshalled(fieldType) {
 			continue
 		}
 
@@ -181,36 +204,86 @@ func (e *Entity) marshalProperties(namespace string, entityValue reflect.Value,
 			realValue = fieldVal
 		}
 
-		// If the field is itself a struct, create a new
-		// namespace level and call this func recursively.
-		if realValue.Kind() == reflect.Struct {
-			e.marshalStruct(namespace, realValue, &fieldType)
+		// If the field is itself a struct, create a new namespace level and call
+		// this func recursively, unless it's a type marshalled as a single value.
+		if realValue.Kind() == reflect.Struct && !isPropertyType(realValue.Type()) {
+			if err = e.marshalStruct(namespace, realValue, &fieldType); err != nil {
+				return
+			}
+			continue
+		}
+
+		// Slices and maps of structs have each of their elements marshalled
+		// in its own indexed namespace (eg. hosts.0.ip, or ports.https.number).
+		if isStructCollection(realValue.Type()) {
+			if err = e.marshalCollection(getNamespace(namespace, fieldType.Name), realValue); err != nil {
+				return
+			}
 			continue
 		}
 
 		// The only required is display:"", not nil
-		if _, ok := fieldType.Tag.Lookup("display"); !ok {
+		display, ok := fieldType.Tag.Lookup("display")
+		if !ok {
 			continue
 		}
+		if display == "" {
+			display = fieldType.Name
+		}
 
-		// Process MatchRules and Aliases
+		// Process MatchRules and Aliases: fields tagged strict:"yes"
+		// (or match:"strict") use the strict matching rule.
 		var match = MatchLoose
-		value, ok := fieldType.Tag.Lookup("match")
-		if ok && value != "" {
+		if strict, ok := fieldType.Tag.Lookup("strict"); ok && strict != "" {
+			match = MatchStrict
+		} else if MatchingRule(fieldType.Tag.Get("match")) == MatchStrict {
 			match = MatchStrict
 		}
 		aliasTag, ok := fieldType.Tag.Lookup("alias")
 		if !ok || aliasTag == "" {
-			aliasTag = strings.ToLower(fieldType.Name)
+			aliasTag = getNamespace(namespace, fieldType.Name)
+		}
+
+		// Unsigned values are sent as Maltego long properties, which are signed.
+		switch realValue.Kind() {
+		case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			if realValue.Uint() > math.MaxInt64 {
+				return fmt.Errorf("Field %s: value %d overflows a Maltego long property", fieldType.Name, realValue.Uint())
+			}
+		}
+
+		var value interface{}
+		if value, err = marshalValue(realValue); err != nil {
+			return fmt.Errorf("Field %s: %s", fieldType.Name, err)
 		}
 
 		// Else, pick the tags and populate field
 		f := Field{
 			Name:         getNamespace(namespace, fieldType.Name),
-			Value:        entityValue,
-			Display:      fieldType.Type.Name(),
+			Value:        value,
+			Display:      display,
 			MatchingRule: match,
 			Alias:        aliasTag,
+			Type:         propertyType(realValue.Type()),
+		}
+		if sample, ok := fieldType.Tag.Lookup("sample"); ok {
+			f.SampleValue = sample
+		}
+		if defaultValue, ok := fieldType.Tag.Lookup("default"); ok {
+			f.DefaultValue = defaultValue
+		}
+		if group, ok := fieldType.Tag.Lookup("group"); ok && group != "" {
+			f.Group = group
+		} else if field != nil {
+			f.Group = field.Tag.Get("group")
+		}
+		f.Hidden = isFlagTag(fieldType, field, "hidden")
+		f.ReadOnly = isFlagTag(fieldType, field, "readonly")
+		if pattern, ok := fieldType.Tag.Lookup("validate"); ok && pattern != "" {
+			if _, err = regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("Field %s: invalid validate tag: %s", fieldType.Name, err)
+			}
+			f.Validate = pattern
 		}
 		e.AddProperty(f)
 
@@ -219,8 +292,257 @@ func (e *Entity) marshalProperties(namespace string, entityValue reflect.Value,
 		if !yes {
 			continue
 		}
-		e.addFieldAsOverlay(f, overlayTag)
+		if err = e.addFieldAsOverlay(f, overlayTag); err != nil {
+			return fmt.Errorf("Field %s: %s", fieldType.Name, err)
+		}
+	}
+
+	return
+}
+
+// marshalCollection - Marshal the elements of a slice, array or map of structs as properties,
+// namespaced with their index or key. Map keys should not contain dots, which separate namespaces.
+func (e *Entity) marshalCollection(namespace string, collection reflect.Value) (err error) {
+	marshalElement := func(key string, elem reflect.Value) error {
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				return nil
+			}
+			elem = elem.Elem()
+		}
+		return e.marshalProperties(namespace+"."+key, elem, nil)
+	}
+
+	switch collection.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < collection.Len(); i++ {
+			if err = marshalElement(strconv.Itoa(i), collection.Index(i)); err != nil {
+				return
+			}
+		}
+	case reflect.Map:
+		keys := collection.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			if err = marshalElement(fmt.Sprint(key.Interface()), collection.MapIndex(key)); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// isStructCollection - Whether a type is a slice, array or map of structs (or of pointers to
+// structs), which elements are marshalled as indexed properties instead of a single value.
+func isStructCollection(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		elem := t.Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		return elem.Kind() == reflect.Struct && !isPropertyType(elem)
+	}
+	return false
+}
+
+// Maltego date formats - The formats in which time.Time
+// values are passed to and parsed from Maltego properties.
+const (
+	MaltegoDateFormat     = "2006-01-02"
+	MaltegoDateTimeFormat = "2006-01-02 15:04:05.000"
+)
+
+// Go types that are natively supported as property values, although
+// they are structs or slices that we would otherwise process as such.
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	ipType    = reflect.TypeOf(net.IP{})
+	ipNetType = reflect.TypeOf(net.IPNet{})
+	urlType   = reflect.TypeOf(url.URL{})
+
+	// Durations are written with their String() method, as parsed by time.ParseDuration.
+	durationType = reflect.TypeOf(time.Duration(0))
+
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isMarshalled - Whether a struct field is marshalled into (and unmarshalled from)
+// properties: unexported fields and those tagged maltego:"-" never are.
+func isMarshalled(field reflect.StructField) bool {
+	return field.IsExported() && field.Tag.Get("maltego") != "-"
+}
+
+// isFlagTag - Whether a boolean tag (eg. hidden:"yes") is set on a field, or
+// on the struct field holding it, if any. Any non-empty value sets the flag.
+func isFlagTag(field reflect.StructField, parent *reflect.StructField, tag string) bool {
+	if value, ok := field.Tag.Lookup(tag); ok {
+		return value != ""
+	}
+	return parent != nil && parent.Tag.Get(tag) != ""
+}
+
+// isPropertyType - Whether a type is marshalled as a single property value,
+// while it would otherwise be processed as a struct with its own fields.
+func isPropertyType(t reflect.Type) bool {
+	switch t {
+	case timeType, ipType, ipNetType, urlType:
+		return true
+	}
+	return isTextType(t)
+}
+
+// isTextType - Whether a type converts itself to and from text (encoding.TextMarshaler
+// and encoding.TextUnmarshaler, possibly on its pointer): such types (ULIDs, enums, etc)
+// are marshalled as a single property value, with their own implementations.
+func isTextType(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	return t.Implements(textMarshalerType) || t.Implements(textUnmarshalerType)
+}
+
+// marshalValue - Returns the value of a field to be used as a property value.
+// Natively supported types (time.Time, time.Duration, net.IP, net.IPNet, url.URL)
+// are converted to their Maltego string representation, which is parsed back when
+// unmarshalling. Errors of types converting themselves to text are returned as is.
+func marshalValue(value reflect.Value) (interface{}, error) {
+	switch value.Type() {
+	case timeType:
+		t := value.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(MaltegoDateTimeFormat), nil
+	case durationType:
+		return value.Interface().(time.Duration).String(), nil
+	case ipType:
+		ip := value.Interface().(net.IP)
+		if ip == nil {
+			return "", nil
+		}
+		return ip.String(), nil
+	case ipNetType:
+		ipNet := value.Interface().(net.IPNet)
+		if ipNet.IP == nil {
+			return "", nil
+		}
+		return ipNet.String(), nil
+	case urlType:
+		u := value.Interface().(url.URL)
+		return u.String(), nil
+	}
+
+	// Types converting themselves to text, either as values or pointers.
+	marshaler, ok := value.Interface().(encoding.TextMarshaler)
+	if ok && value.Kind() == reflect.Ptr && value.IsNil() {
+		return "", nil
+	}
+	if !ok && value.CanAddr() {
+		marshaler, ok = value.Addr().Interface().(encoding.TextMarshaler)
 	}
+	if ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(text), nil
+	}
+
+	// Lists are sent as comma-separated values, the format of Maltego string[]
+	// and int[] properties, maps as key:value pairs, and bytes as a string:
+	// the XML encoder writes nothing for values of any other composite kind.
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return "", nil
+		}
+		return marshalValue(value.Elem())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			return string(value.Bytes()), nil
+		}
+		items := make([]string, value.Len())
+		for i := range items {
+			item, err := marshalValue(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = fmt.Sprintf("%v", item)
+		}
+		return strings.Join(items, ","), nil
+	case reflect.Map:
+		items := make([]string, 0, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			key, err := marshalValue(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			item, err := marshalValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, fmt.Sprintf("%v:%v", key, item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ","), nil
+	}
+
+	return value.Interface(), nil
+}
+
+// propertyType - Returns the Maltego property type corresponding to a Go type,
+// so that the Maltego client can sort and filter on numeric/date properties.
+// All types that have no Maltego equivalent are strings.
+func propertyType(t reflect.Type) configuration.PropertyType {
+	if t == nil {
+		return configuration.PropertyTypeString
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return configuration.PropertyTypeDateTime
+	case ipType, ipNetType, urlType:
+		return configuration.PropertyTypeString
+	}
+	if isTextType(t) {
+		return configuration.PropertyTypeString
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return configuration.PropertyTypeBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint8, reflect.Uint16:
+		return configuration.PropertyTypeInteger
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		if t == durationType {
+			return configuration.PropertyTypeString
+		}
+		return configuration.PropertyTypeLong
+	case reflect.Float32, reflect.Float64:
+		return configuration.PropertyTypeFloat
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return configuration.PropertyTypeString // []byte
+		}
+		switch propertyType(t.Elem()) {
+		case configuration.PropertyTypeInteger:
+			return configuration.PropertyTypeIntArray
+		case configuration.PropertyTypeString:
+			return configuration.PropertyTypeStringArray
+		}
+	}
+
+	return configuration.PropertyTypeString
 }
 
 // getNamespace - Compute the namespace for a field (or a series of them)
@@ -231,33 +553,27 @@ func getNamespace(namespace, name string) string {
 
 // addFieldAsOverlay - A struct field has been tagged as overlay,
 // so validate it, create it and register it to the entity.
-func (e *Entity) addFieldAsOverlay(f Field, tag string) {
+// The tag notation is <Position>[,<type>], the type defaulting to text.
+func (e *Entity) addFieldAsOverlay(f Field, tag string) error {
 	infos := strings.Split(tag, ",")
 	if len(infos) == 1 && infos[0] == "" {
-		return
+		return nil
+	}
+	if len(infos) > 2 {
+		return fmt.Errorf("Invalid overlay tag %q: notation is <Position>,<type>", tag)
 	}
 
 	// If we have only the position, we're fine,
 	// we default the type as text.
-	if len(infos) == 1 && isOverlayPosition(infos[0]) {
-		e.AddOverlay(f.Name, OverlayPosition(infos[0]), OverlayText)
-		return
-	}
+	position := OverlayPosition(strings.TrimSpace(infos[0]))
+	oType := OverlayText
 
-	// If we have two items, we will be fine in one case, not in the other
 	if len(infos) == 2 {
-		// If none is good, return
-		if !isOverlayPosition(infos[0]) && !isOverlayType(infos[1]) {
-			return
-		}
-		// Type is invalid, use text as default
-		if isOverlayPosition(infos[0]) && !isOverlayType(infos[1]) {
-			e.AddOverlay(f.Name, OverlayPosition(infos[0]), OverlayText)
-			return
-		}
-		// Both types are valid, populate both
-		if isOverlayPosition(infos[0]) && isOverlayType(infos[1]) {
-			e.AddOverlay(f.Name, OverlayPosition(infos[0]), OverlayType(infos[1]))
+		oType = OverlayType(strings.TrimSpace(infos[1]))
+		if oType == "color" {
+			oType = OverlayColour
 		}
 	}
+
+	return e.AddOverlay(f.Name, position, oType)
 }
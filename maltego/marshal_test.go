@@ -0,0 +1,193 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
+)
+
+// testAccount - A native Go Entity type with list, map and unsigned fields.
+type testAccount struct {
+	_       struct{}          `namespace:"gondor.test"`
+	Name    string            `display:"Name"`
+	Aliases []string          `display:"Aliases"`
+	Ports   []int             `display:"Ports"`
+	Tags    map[string]string `display:"Tags"`
+	Key     []byte            `display:"Key"`
+	Quota   uint64            `display:"Quota"`
+}
+
+func (a *testAccount) AsEntity() Entity {
+	e := NewEntity(a)
+	e.Value = a.Name
+	return e
+}
+
+func TestMarshalCompositeProperties(t *testing.T) {
+	account := &testAccount{
+		Name:    "alice",
+		Aliases: []string{"al", "ali"},
+		Ports:   []int{22, 443},
+		Tags:    map[string]string{"team": "red", "role": "admin"},
+		Key:     []byte("secret"),
+		Quota:   1 << 40,
+	}
+	transform := NewTransform("Accounts", func(t *Transform) error {
+		if err := t.AddEntity(account); err != nil {
+			return err
+		}
+		domain := NewForeignEntity("maltego.Domain", "example.com")
+		domain.AddProperty(Field{Name: "servers", Value: []string{"ns1", "ns2"}})
+		return t.AddEntity(domain)
+	})
+
+	response := serveTransform(t, transform, 12)
+	if len(response.Entities) != 2 {
+		t.Fatalf("Expected 2 output Entities, got %d", len(response.Entities))
+	}
+	if servers, _ := response.Entities[1].field("servers"); servers != "ns1,ns2" {
+		t.Errorf("Expected the list of servers set by the Transform, got %q", servers)
+	}
+	for name, want := range map[string]string{
+		"aliases": "al,ali",
+		"ports":   "22,443",
+		"tags":    "role:admin,team:red",
+		"key":     "secret",
+		"quota":   "1099511627776",
+	} {
+		if value, found := response.Entities[0].field(name); !found || value != want {
+			t.Errorf("Property %s: got %q (found: %t), want %q", name, value, found, want)
+		}
+	}
+
+	entity := account.AsEntity()
+	if err := entity.GetGoProperties(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]configuration.PropertyType{
+		"aliases": configuration.PropertyTypeStringArray,
+		"ports":   configuration.PropertyTypeIntArray,
+		"key":     configuration.PropertyTypeString,
+		"quota":   configuration.PropertyTypeLong,
+	} {
+		if got := entity.Properties[name].Type; got != want {
+			t.Errorf("Property %s: declared as %s, want %s", name, got, want)
+		}
+	}
+
+	decoded := &testAccount{}
+	entity.Unmarshal(decoded)
+	if !reflect.DeepEqual(decoded.Aliases, account.Aliases) || !reflect.DeepEqual(decoded.Ports, account.Ports) ||
+		!reflect.DeepEqual(decoded.Tags, account.Tags) || string(decoded.Key) != "secret" || decoded.Quota != account.Quota {
+		t.Errorf("Properties not unmarshalled back: %+v", decoded)
+	}
+}
+
+func TestMarshalUnsignedOverflow(t *testing.T) {
+	var err error
+	transform := NewTransform("Accounts", func(t *Transform) error {
+		err = t.AddEntity(&testAccount{Name: "bob", Quota: math.MaxUint64})
+		return nil
+	})
+
+	response := serveTransform(t, transform, 12)
+	if err == nil || !strings.Contains(err.Error(), "overflows a Maltego long property") {
+		t.Errorf("Expected an overflow error, got %v", err)
+	}
+	if len(response.Entities) != 0 {
+		t.Errorf("The Entity with an overflowing value should not be sent")
+	}
+}
+
+// testStatus - A type converting itself to text, which fails for unknown statuses.
+type testStatus int
+
+func (s testStatus) MarshalText() ([]byte, error) {
+	switch s {
+	case 0:
+		return []byte("pending"), nil
+	case 1:
+		return []byte("done"), nil
+	}
+	return nil, errors.New("unknown status")
+}
+
+// testJob - A native Go Entity type with a duration and a text field.
+type testJob struct {
+	_       struct{}      `namespace:"gondor.test"`
+	Name    string        `display:"Name"`
+	Timeout time.Duration `display:"Timeout"`
+	Status  testStatus    `display:"Status"`
+}
+
+func (j *testJob) AsEntity() Entity {
+	e := NewEntity(j)
+	e.Value = j.Name
+	return e
+}
+
+func TestMarshalDuration(t *testing.T) {
+	job := &testJob{Name: "scan", Timeout: 90 * time.Second}
+	entity := job.AsEntity()
+	if err := entity.GetGoProperties(); err != nil {
+		t.Fatal(err)
+	}
+	if value := entity.Properties["timeout"].Value; value != "1m30s" {
+		t.Errorf("Expected the duration as a string, got %v", value)
+	}
+	if got := entity.Properties["timeout"].Type; got != configuration.PropertyTypeString {
+		t.Errorf("Duration declared as %s, want %s", got, configuration.PropertyTypeString)
+	}
+
+	decoded := &testJob{}
+	if err := entity.Unmarshal(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Timeout != job.Timeout {
+		t.Errorf("Duration not unmarshalled back: got %s, want %s", decoded.Timeout, job.Timeout)
+	}
+}
+
+func TestMarshalTextErrors(t *testing.T) {
+	var err error
+	transform := NewTransform("Jobs", func(t *Transform) error {
+		err = t.AddEntity(&testJob{Name: "scan", Status: 42})
+		return nil
+	})
+
+	response := serveTransform(t, transform, 12)
+	if err == nil || !strings.Contains(err.Error(), "unknown status") {
+		t.Errorf("Expected the error of the Status field, got %v", err)
+	}
+	if len(response.Entities) != 0 {
+		t.Errorf("The Entity with an invalid value should not be sent")
+	}
+
+	field := Field{Name: "status", Value: testStatus(42)}
+	if _, err := field.ValueString(); err == nil {
+		t.Errorf("Expected an error for the value of an invalid property")
+	}
+}
@@ -0,0 +1,173 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergeFrom - Merge another Entity into this one, for transforms aggregating results for
+// the same value from several data sources before emitting a single Entity. Both Entities
+// must have the same type and value, once normalized (see RegisterNormalizer()). The
+// matching rule gives the semantics of the merge:
+//
+// MatchStrict - All properties existing in both Entities must have the same value.
+// MatchLoose - Properties existing in both Entities keep the value of this Entity, unless
+// their own matching rule is strict, in which case they must be equal.
+//
+// In both cases, the properties, labels and overlays of the other Entity that this one does
+// not have are added to it, the highest weight is kept, and the notes of both are joined.
+// If the Entities cannot be merged, an error describes all conflicts and nothing is merged.
+func (e *Entity) MergeFrom(other Entity, rule MatchingRule) error {
+	e.ensureInitialized()
+	other.ensureInitialized()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	thisType := strings.Join([]string{e.Namespace, e.Type}, ".")
+	otherType := strings.Join([]string{other.Namespace, other.Type}, ".")
+	if thisType != otherType {
+		return fmt.Errorf("Cannot merge Entity of type %s into Entity of type %s", otherType, thisType)
+	}
+	if normalizedValue(thisType, e.Value) != normalizedValue(otherType, other.Value) {
+		return fmt.Errorf("Cannot merge %s Entities with different values (%q and %q)", e.Type, e.Value, other.Value)
+	}
+
+	// Check all conflicts first, so that we merge all or nothing.
+	names := make([]string, 0, len(other.Properties))
+	for name := range other.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var conflicts []string
+	for _, name := range names {
+		theirs := other.Properties[name]
+		ours, found := e.Properties[name]
+		if !found || name == notesProperty || strings.Contains(name, "#") {
+			continue
+		}
+		strict := rule == MatchStrict || ours.MatchingRule == MatchStrict || theirs.MatchingRule == MatchStrict
+		if strict && fmt.Sprintf("%v", ours.Value) != fmt.Sprintf("%v", theirs.Value) {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%v and %v)", name, ours.Value, theirs.Value))
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("Cannot merge %s %s: conflicting strict properties: %s",
+			e.Type, e.Value, strings.Join(conflicts, ", "))
+	}
+
+	// Properties
+	for _, name := range names {
+		if _, found := e.Properties[name]; !found {
+			e.Properties[name] = other.Properties[name].clone()
+		}
+	}
+
+	// Notes of both Entities are kept.
+	if theirs, found := other.Properties[notesProperty]; found && theirs.Value != nil {
+		ours := e.Properties[notesProperty]
+		ourNotes, theirNotes := fmt.Sprintf("%v", ours.Value), fmt.Sprintf("%v", theirs.Value)
+		switch {
+		case ours.Value == nil || ourNotes == "":
+			e.Properties[notesProperty] = theirs.clone()
+		case theirNotes != "" && !strings.Contains(ourNotes, theirNotes):
+			ours.Value = ourNotes + "\n" + theirNotes
+			e.Properties[notesProperty] = ours
+		}
+	}
+
+	// Labels
+	for _, label := range other.Labels {
+		var found bool
+		for _, ours := range e.Labels {
+			if ours.Name == label.Name && ours.Content == label.Content {
+				found = true
+				break
+			}
+		}
+		if !found {
+			e.Labels = append(e.Labels, label)
+		}
+	}
+
+	// Overlays
+	for pos, overlay := range other.Overlays {
+		if _, found := e.Overlays[pos]; found {
+			continue
+		}
+		e.Overlays[pos] = overlay
+		if color, found := other.colors[pos]; found {
+			if e.colors == nil {
+				e.colors = map[OverlayPosition]overlayColor{}
+			}
+			e.colors[pos] = color
+		}
+	}
+
+	// Weight, bookmark and confidence
+	if other.Weight > e.Weight {
+		e.Weight = other.Weight
+	}
+	e.weightSet = e.weightSet || other.weightSet
+	if e.Bookmark == "" || e.Bookmark == BOOKMARK_COLOR_NONE {
+		e.Bookmark = other.Bookmark
+	}
+	if other.confidenceSet && (!e.confidenceSet || other.confidence > e.confidence) {
+		e.confidence, e.confidenceSet = other.confidence, true
+	}
+
+	return nil
+}
+
+// SetDeduplicate - Collapse the output Entities with the same type and value (once normalized,
+// see RegisterNormalizer()) into a single one, merging their properties, labels and overlays
+// as MergeFrom() does with the MatchLoose rule. Entities whose strict properties differ are
+// not merged, and are all returned. Streamed Entities (see SetStreaming()) are not merged.
+func (t *Transform) SetDeduplicate(dedup bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.dedup = dedup
+}
+
+// dedupEntities - Returns the Entities, with those having the same type and value merged into
+// the first one that they can be merged with. The Entities passed are not modified.
+func dedupEntities(entities []Entity) []Entity {
+	merged := make([]Entity, 0, len(entities))
+	byKey := map[string][]int{}
+	for i := range entities {
+		fqType := entityTypeName(entities[i])
+		key := fqType + "\x00" + normalizedValue(fqType, entities[i].Value)
+
+		var done bool
+		for _, index := range byKey[key] {
+			if merged[index].MergeFrom(entities[i], MatchLoose) == nil {
+				done = true
+				break
+			}
+		}
+		if !done {
+			byKey[key] = append(byKey[key], len(merged))
+			merged = append(merged, entities[i].Clone())
+		}
+	}
+	return merged
+}
@@ -0,0 +1,73 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"testing"
+)
+
+// testDevice - A native Go Entity type with a strict field.
+type testDevice struct {
+	_      struct{} `namespace:"gondor.test"`
+	Name   string   `display:"Name"`
+	Serial string   `display:"Serial Number" strict:"yes"`
+	Vendor string   `display:"Vendor"`
+}
+
+func (d *testDevice) AsEntity() Entity {
+	e := NewEntity(d)
+	e.Value = d.Name
+	return e
+}
+
+func TestStrictTag(t *testing.T) {
+	entity := (&testDevice{Name: "router", Serial: "A1"}).AsEntity()
+	if err := entity.GetGoProperties(); err != nil {
+		t.Fatal(err)
+	}
+	if rule := entity.Properties["serial"].MatchingRule; rule != MatchStrict {
+		t.Errorf("Field tagged strict should use the strict matching rule, got %q", rule)
+	}
+	if rule := entity.Properties["vendor"].MatchingRule; rule != MatchLoose {
+		t.Errorf("Untagged field should use the loose matching rule, got %q", rule)
+	}
+}
+
+func TestDeduplicateStrictFields(t *testing.T) {
+	transform := NewTransform("Devices", func(t *Transform) error {
+		t.SetDeduplicate(true)
+		t.AddEntity(&testDevice{Name: "router", Serial: "A1", Vendor: "Acme"})
+		t.AddEntity(&testDevice{Name: "router", Serial: "A1"})
+		return t.AddEntity(&testDevice{Name: "router", Serial: "B2", Vendor: "Acme"})
+	})
+
+	response := serveTransform(t, transform, 12)
+	if len(response.Entities) != 2 {
+		t.Fatalf("Expected the devices with distinct serial numbers apart, got %d Entities", len(response.Entities))
+	}
+	for i, serial := range []string{"A1", "B2"} {
+		entity := response.Entities[i]
+		if value, _ := entity.field("serial"); value != serial {
+			t.Errorf("Entity %d: expected serial %s, got %q", i, serial, value)
+		}
+		if vendor, _ := entity.field("vendor"); vendor != "Acme" {
+			t.Errorf("Entity %d: expected the vendor of the merged devices, got %q", i, vendor)
+		}
+	}
+}
@@ -20,64 +20,167 @@ package maltego
 
 import (
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Message - A type containing all the output elements of a Transform.
 type Message struct {
-	x xml.Name // Modify the xml tag name for this type ("MaltegoMessage")
+	XMLName xml.Name `xml:"MaltegoMessage"`
 
 	// Request
-	Value      string             `xml:"-"`               // Fetched with custom UnmarshalXML
-	Type       string             `xml:"-"`               // Fetched from the Entity
-	Weight     int                `xml:"Weight"`          // Weight of Input Entity
-	Slider     int                `xml:"-"`               // Transform limits, fetched with custom UnmarshalXML
-	Geneaology []Geneaology       `xml:"Geneaology"`      // All the parent transforms and entities tree
-	Entity     Entity             `xml:"-"`               // A unique input Entity
-	Settings   []TransformSetting `xml:"TransformFields"` // Settings for Transform (global/local, and their properties)
+	Value      string             `xml:"-"`                // Fetched with custom UnmarshalXML
+	Type       string             `xml:"-"`                // Fetched from the Entity
+	Weight     int                `xml:"Weight,omitempty"` // Weight of Input Entity
+	Slider     int                `xml:"-"`                // Transform limits, fetched with custom UnmarshalXML
+	Geneaology []Geneaology       `xml:"Geneaology"`       // All the parent transforms and entities tree
+	Entity     Entity             `xml:"-"`                // The input Entity (the first one, if several)
+	Entities   []Entity           `xml:"-"`                // All input Entities, when the request has several
+	Settings   []TransformSetting `xml:"TransformFields"`  // Settings for Transform (global/local, and their properties)
 
 	// Response
-	Response  TransformResponseMessage  `xml:"MaltegoTransformResponseMessage,omitempty"`
-	Exception TransformExceptionMessage `xml:"MaltegoTransformExceptionMessage,omitempty"`
+	Response  *TransformResponseMessage  `xml:"MaltegoTransformResponseMessage,omitempty"`
+	Exception *TransformExceptionMessage `xml:"MaltegoTransformExceptionMessage,omitempty"`
 }
 
-// UnmarshalXML - The Message type needs to do a bit of custom
-// XML unmarshalling because of unwished lists to process.
-func (m Message) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
+// UnmarshalXML - The Message type needs to do a bit of custom XML unmarshalling,
+// because the Maltego request wraps its content (input Entities, limits, transform
+// fields) in several levels of XML elements that we don't want to expose to users.
+func (m *Message) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
 
 	// Temporary types/structs for deserialing fields that cannot be
 	// directly unmarshaled into the message, because they are lists.
-	type slider = struct {
-		SoftLimit int `xml:"SoftLimit,attr"`
+	type field struct {
+		Name         string `xml:"Name,attr"`
+		DisplayName  string `xml:"DisplayName,attr"`
+		MatchingRule string `xml:"MatchingRule,attr"`
+		Value        string `xml:",chardata"`
+	}
+	type entity struct {
+		Type   string  `xml:"Type,attr"`
+		Value  string  `xml:"Value"`
+		Weight int     `xml:"Weight"`
+		Fields []field `xml:"AdditionalFields>Field"`
+		Labels []Label `xml:"DisplayInformation>Label"`
 	}
 	temp := struct {
-		// Input
-		Values   []string `xml:"Value"`
-		Entities []Entity `xml:"Entity"`
-		// Transform settings
-		Slider slider `xml:"Limits"`
+		Request struct {
+			Entities []entity `xml:"Entities>Entity"`
+			Limits   struct {
+				SoftLimit int `xml:"SoftLimit,attr"`
+				HardLimit int `xml:"HardLimit,attr"`
+			} `xml:"Limits"`
+			Fields     []field      `xml:"TransformFields>Field"`
+			Geneaology []Geneaology `xml:"Genealogy>Type"`
+		} `xml:"MaltegoTransformRequestMessage"`
 	}{}
-	if err = d.Decode(&temp); err != nil {
+	if err = d.DecodeElement(&temp, &start); err != nil {
 		return
 	}
+	request := temp.Request
 
-	// Then we can decode the whole Message type.
-	if err = d.Decode(&m); err != nil {
-		return
+	if len(request.Entities) == 0 {
+		return errors.New("No input Entity in Maltego request")
 	}
 
-	// And finally write the temp struct contents to the Message
-	m.Entity = temp.Entities[0] // Hard-coded in Maltego Python/Go libs
-	m.Type = m.Entity.Type
-	m.Value = temp.Values[0]         // Same hard-coding
-	m.Slider = temp.Slider.SoftLimit // And finally, the limit of output entities
+	// And finally write the temp struct contents to the Message. Clients send
+	// one input Entity, but batch requests (eg. from a TDS) might hold several.
+	for _, input := range request.Entities {
+		entity := NewForeignEntity(input.Type, input.Value)
+		entity.Weight = input.Weight
+		entity.Labels = input.Labels
+		for _, f := range input.Fields {
+			entity.AddProperty(Field{
+				Name:         f.Name,
+				Display:      f.DisplayName,
+				MatchingRule: MatchingRule(f.MatchingRule),
+				Value:        f.Value,
+			})
+		}
+		m.Entities = append(m.Entities, entity)
+	}
+	input := request.Entities[0]
+	m.Entity = m.Entities[0]
+	if len(m.Entities) == 1 {
+		m.Entities = nil
+	}
+
+	m.Type = input.Type
+	m.Value = input.Value
+	m.Weight = input.Weight
+	m.Slider = request.Limits.SoftLimit // And finally, the limit of output entities
+	m.Geneaology = request.Geneaology
+
+	for _, f := range request.Fields {
+		m.Settings = append(m.Settings, TransformSetting{
+			Name:    f.Name,
+			Default: f.Value,
+		})
+	}
 
 	return
 }
 
+// timeout - Returns the timeout hint passed by the client in the TimeoutSetting
+// transform field, either as a number of seconds or as a Go duration ("1m30s").
+func (m *Message) timeout() time.Duration {
+	for _, setting := range m.Settings {
+		if setting.Name != TimeoutSetting || setting.Default == nil {
+			continue
+		}
+		value := strings.TrimSpace(fmt.Sprintf("%v", setting.Default))
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+			return duration
+		}
+	}
+	return 0
+}
+
 // TransformResponseMessage - A type containing all the output elements of a Transform.
 type TransformResponseMessage struct {
-	Entities []Entity    `xml:"Entities"`   // All entities to be returned as the Transform output.
-	Messages []MessageUI `xml:"UIMessages"` // Transform log messages
+	Entities []Entity    `xml:"Entities>Entity"`      // All entities to be returned as the Transform output.
+	Messages []MessageUI `xml:"UIMessages>UIMessage"` // Transform log messages
+}
+
+// MarshalXML - An Entity implements the xml.Marshaller interface, so that it is written
+// with the layout expected by the Maltego client in Transform responses: its fully qualified
+// type as attribute, then its value, weight, labels, properties, icon and overlays.
+func (e Entity) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if e.mutex != nil {
+		e.mutex.RLock()
+		defer e.mutex.RUnlock()
+	}
+
+	type display struct {
+		Labels []Label `xml:"Label"`
+	}
+	entity := struct {
+		Type       string     `xml:"Type,attr"`
+		Value      string     `xml:"Value"`
+		Weight     int        `xml:"Weight"`
+		Display    *display   `xml:"DisplayInformation,omitempty"`
+		Properties Properties `xml:"AdditionalFields"`
+		IconURL    string     `xml:"IconURL,omitempty"`
+		Overlays   Overlays   `xml:"Overlays"`
+	}{
+		Type:       entityTypeName(e),
+		Value:      e.Value,
+		Weight:     e.Weight,
+		Properties: e.Properties,
+		IconURL:    e.IconURL,
+		Overlays:   e.Overlays,
+	}
+	if len(e.Labels) > 0 {
+		entity.Display = &display{Labels: e.Labels}
+	}
+
+	return enc.EncodeElement(entity, start)
 }
 
 // TransformExceptionMessage - A type containing all the exceptions (errors) that
@@ -85,7 +188,7 @@ type TransformResponseMessage struct {
 // any point in your code, thereby terminating execution, you can also simply log
 // them with Transform.AddError(), and they will be passed along any other output.
 type TransformExceptionMessage struct {
-	Exceptions []Exception
+	Exceptions []Exception `xml:"Exceptions>Exception"`
 }
 
 // Exception - Term for an error in a Transform. Can be terminating, or not.
@@ -94,14 +197,14 @@ type Exception string
 // MessageUI - A log message passed along a Transform
 // output for display in the Maltego transform window.
 type MessageUI struct {
-	Text string `xml:"text"`
-	Type string `xml:"type"`
+	Text string `xml:",chardata"`
+	Type string `xml:"MessageType,attr"`
 }
 
 // Geneaology - A geneaologic node, member of a Geneaology
 // (list of nodes) transmitted in a Maltego Transform Request.
 type Geneaology struct {
-	Name    string
-	OldName string
-	Type    string
+	Name    string `xml:"Name,attr"`
+	OldName string `xml:"OldName,attr"`
+	Type    string `xml:"Type,attr"`
 }
@@ -0,0 +1,247 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Metrics - Transform Execution Instrumentation -------------------------------------------------
+//
+// The server reports each Transform run to its Metrics, if any: the builtin MetricsRegistry
+// keeps counters and histograms labeled by Transform name, in the Prometheus text format.
+// To use another metrics library (eg. the Prometheus Go client), implement Metrics instead,
+// or wrap a function with MetricsFunc. With ServeMetrics, the server also serves them at
+// MetricsPath, for Prometheus to scrape alongside the Transforms.
+
+// MetricsPath - The URL path at which the server Metrics are served in the Prometheus text
+// format, when the server has ServeMetrics set and its Metrics implement PrometheusMetrics.
+// If the server has a MetricsToken, scrapers must bear it as an "Authorization: Bearer" header.
+const MetricsPath = "/metrics"
+
+// TransformMetrics - The measures of a single Transform run.
+type TransformMetrics struct {
+	Transform string        // The name of the Transform
+	Duration  time.Duration // How long the run took
+	Entities  int           // The number of output Entities
+	Failed    bool          // The run returned an error
+	Rejected  bool          // The Transform did not run (disabled, rate limited, etc)
+}
+
+// Metrics - A pluggable sink for the measures of all Transform runs of a server.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	ObserveTransform(m TransformMetrics)
+}
+
+// MetricsFunc - A function implementing the Metrics interface.
+type MetricsFunc func(m TransformMetrics)
+
+// ObserveTransform - Call the function with the measures of a run.
+func (f MetricsFunc) ObserveTransform(m TransformMetrics) {
+	f(m)
+}
+
+// PrometheusMetrics - Metrics that can be exported in the Prometheus text format, like the
+// builtin MetricsRegistry, and which the server can thus serve at MetricsPath.
+type PrometheusMetrics interface {
+	Metrics
+	WritePrometheus(w io.Writer) error
+}
+
+// DefaultDurationBuckets - The upper bounds (in seconds) of the run duration histogram buckets.
+var DefaultDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// DefaultEntityBuckets - The upper bounds of the output Entities histogram buckets.
+var DefaultEntityBuckets = []float64{0, 1, 5, 10, 25, 50, 100, 250, 1000, 10000}
+
+// MetricsRegistry - The builtin Metrics, counting runs, failures and rejections, and keeping
+// histograms of the run durations and output Entity counts, all labeled by Transform name.
+type MetricsRegistry struct {
+	transforms map[string]*transformMetrics
+	durations  []float64
+	entities   []float64
+	mutex      *sync.RWMutex
+}
+
+// transformMetrics - The metrics of a single Transform.
+type transformMetrics struct {
+	runs       uint64
+	failures   uint64
+	rejections uint64
+	durations  histogram
+	entities   histogram
+}
+
+// histogram - Cumulative counts of observations below bucket bounds, with their sum.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewMetricsRegistry - Create an empty registry, with the default histogram buckets.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		transforms: map[string]*transformMetrics{},
+		durations:  DefaultDurationBuckets,
+		entities:   DefaultEntityBuckets,
+		mutex:      &sync.RWMutex{},
+	}
+}
+
+// ObserveTransform - Record the measures of a Transform run.
+func (r *MetricsRegistry) ObserveTransform(m TransformMetrics) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tm, found := r.transforms[m.Transform]
+	if !found {
+		tm = &transformMetrics{
+			durations: histogram{counts: make([]uint64, len(r.durations))},
+			entities:  histogram{counts: make([]uint64, len(r.entities))},
+		}
+		r.transforms[m.Transform] = tm
+	}
+
+	if m.Rejected {
+		tm.rejections++
+		return
+	}
+	tm.runs++
+	if m.Failed {
+		tm.failures++
+	}
+	tm.durations.observe(r.durations, m.Duration.Seconds())
+	tm.entities.observe(r.entities, float64(m.Entities))
+}
+
+// observe - Add an observation to the histogram.
+func (h *histogram) observe(buckets []float64, value float64) {
+	for i, bound := range buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// WritePrometheus - Write all metrics in the Prometheus text exposition format.
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.transforms))
+	for name := range r.transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	counter := func(metric, help string, value func(tm *transformMetrics) uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", metric, help, metric)
+		for _, name := range names {
+			fmt.Fprintf(&b, "%s{transform=%s} %d\n", metric, promLabel(name), value(r.transforms[name]))
+		}
+	}
+	hist := func(metric, help string, buckets []float64, value func(tm *transformMetrics) histogram) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", metric, help, metric)
+		for _, name := range names {
+			h, label := value(r.transforms[name]), promLabel(name)
+			for i, bound := range buckets {
+				fmt.Fprintf(&b, "%s_bucket{transform=%s,le=\"%s\"} %d\n", metric, label, promFloat(bound), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket{transform=%s,le=\"+Inf\"} %d\n", metric, label, h.count)
+			fmt.Fprintf(&b, "%s_sum{transform=%s} %s\n", metric, label, promFloat(h.sum))
+			fmt.Fprintf(&b, "%s_count{transform=%s} %d\n", metric, label, h.count)
+		}
+	}
+
+	counter("gondor_transform_executions_total", "Number of Transform runs.",
+		func(tm *transformMetrics) uint64 { return tm.runs })
+	counter("gondor_transform_errors_total", "Number of Transform runs that returned an error.",
+		func(tm *transformMetrics) uint64 { return tm.failures })
+	counter("gondor_transform_rejections_total", "Number of Transform requests not run (disabled, rate limited, etc).",
+		func(tm *transformMetrics) uint64 { return tm.rejections })
+	hist("gondor_transform_duration_seconds", "Duration of Transform runs.", r.durations,
+		func(tm *transformMetrics) histogram { return tm.durations })
+	hist("gondor_transform_output_entities", "Number of output Entities of Transform runs.", r.entities,
+		func(tm *transformMetrics) histogram { return tm.entities })
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// promLabel - Quote and escape a Prometheus label value.
+func promLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// promFloat - Format a float for the Prometheus text format.
+func promFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricsHandler - Serve the server Metrics in the Prometheus text format, if enabled with
+// ServeMetrics, to the requests bearing the server MetricsToken, if it has one.
+func (ts *TransformServer) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics, exported := ts.Metrics.(PrometheusMetrics)
+	if !ts.ServeMetrics || !exported {
+		http.NotFound(w, r)
+		return
+	}
+	if ts.MetricsToken != "" && !bearerAllowed(w, r, ts.MetricsToken) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.WritePrometheus(w); err != nil && ts.Logger != nil {
+		ts.Logger.Printf("Failed to write metrics: %s", err)
+	}
+}
+
+// observeMetrics - Report a Transform run (or rejection) to the server statistics,
+// and to the server metrics, if any.
+func (ts *TransformServer) observeMetrics(instance *Transform, runErr error, rejected bool, duration time.Duration) {
+	entities := len(instance.Entities())
+	ts.stats.observe(instance.Name, entities, runErr, rejected, duration)
+	if ts.Metrics == nil {
+		return
+	}
+	ts.Metrics.ObserveTransform(TransformMetrics{
+		Transform: instance.Name,
+		Duration:  duration,
+		Entities:  entities,
+		Failed:    runErr != nil,
+		Rejected:  rejected,
+	})
+}
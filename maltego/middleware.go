@@ -0,0 +1,62 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// TransformMiddleware - A layer wrapping the implementation of Transforms: it receives the
+// Transform instance before the run, can decide not to call the next layer (eg. to answer from
+// a cache, or to reject unauthorized principals), and can inspect the output after the run
+// (eg. for logging or metrics). Middleware compose, instead of being repeated in all Transforms:
+//
+//	func Logging(next maltego.TransformFunc) maltego.TransformFunc {
+//		return func(t *maltego.Transform) error {
+//			start := time.Now()
+//			err := next(t)
+//			log.Printf("%s on %s: %d entities in %s", t.Name, t.Input().Value, len(t.Entities()), time.Since(start))
+//			return err
+//		}
+//	}
+type TransformMiddleware func(next TransformFunc) TransformFunc
+
+// Use - Add middleware wrapping all Transforms of the server. Server middleware wrap those
+// of the Transforms, and run in the order they are added: the first one is the outermost.
+func (ts *TransformServer) Use(mw ...TransformMiddleware) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.middleware = append(ts.middleware, mw...)
+}
+
+// Use - Add middleware wrapping the implementation of this Transform only. They run in the
+// order they are added (the first one is the outermost), within those of the server.
+func (t *Transform) Use(mw ...TransformMiddleware) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.middleware = append(t.middleware, mw...)
+}
+
+// chainMiddleware - Wrap a Transform implementation with middleware, the first one outermost.
+func chainMiddleware(run TransformFunc, middleware ...[]TransformMiddleware) TransformFunc {
+	var all []TransformMiddleware
+	for _, layer := range middleware {
+		all = append(all, layer...)
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		run = all[i](run)
+	}
+	return run
+}
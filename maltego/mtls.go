@@ -0,0 +1,138 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//
+// Mutual TLS - Client Certificates Authentication & Authorization ------------------------------
+//
+// Transform hosts are commonly protected with client certificates: when the server has
+// ClientCAs, ListenAndServeTLS() requires all clients to present a certificate signed by
+// one of them. The identity of the certificate is the Principal of the requests, and the
+// server ClientRules, if any, restrict the Transforms that each identity may run.
+
+// ClaimSAN - The claim of mTLS principals holding the Subject Alternative Names of their
+// certificate (DNS names, email addresses, URIs and IP addresses), separated by commas.
+const ClaimSAN = "san"
+
+// ClientRule - Grants the clients authenticated with a TLS certificate access to some
+// Transforms. A certificate matches the rule when its Common Name or one of its Subject
+// Alternative Names (DNS name, email address, URI or IP address) is the rule Identity.
+type ClientRule struct {
+	Identity   string   // The CN or SAN of the client certificates, or "*" for all of them.
+	Transforms []string // The names of the Transforms they may run, all of them if empty.
+}
+
+// LoadClientCAs - Add the PEM-encoded certificates found in the given files to the
+// ClientCAs of the server, which then requires client certificates signed by them.
+func (ts *TransformServer) LoadClientCAs(files ...string) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if ts.ClientCAs == nil {
+		ts.ClientCAs = x509.NewCertPool()
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("Failed to read client CAs: %s", err)
+		}
+		if !ts.ClientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("No PEM certificate found in %s", file)
+		}
+	}
+	return nil
+}
+
+// clientAllowed - Whether the principal of a request may run the named Transform, according
+// to the ClientRules of the server. The rules apply to the client certificate of the request,
+// whatever the authentication method of the principal (eg. Basic credentials over mTLS), and
+// all clients are allowed when the server has no rules, or the request had no certificate.
+func (ts *TransformServer) clientAllowed(principal *Principal, name string) bool {
+	if principal == nil || len(ts.ClientRules) == 0 {
+		return true
+	}
+	identities := principal.certificate
+	if identities == nil && principal.Method == PrincipalMTLS {
+		identities = append([]string{principal.ID}, strings.Split(principal.Claim(ClaimSAN), ",")...)
+	}
+	if identities == nil {
+		return true
+	}
+	for _, rule := range ts.ClientRules {
+		if !rule.matches(identities) {
+			continue
+		}
+		if len(rule.Transforms) == 0 {
+			return true
+		}
+		for _, transform := range rule.Transforms {
+			if transform == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches - Whether one of the identities of a certificate is the one of the rule.
+func (r ClientRule) matches(identities []string) bool {
+	for _, identity := range identities {
+		if r.Identity == "*" || (identity != "" && identity == r.Identity) {
+			return true
+		}
+	}
+	return false
+}
+
+// withClientAuth - Returns a copy of the TLS configuration requiring and verifying client
+// certificates against the ClientCAs of the server, or the configuration itself if it has none.
+func (ts *TransformServer) withClientAuth(config *tls.Config) *tls.Config {
+	if ts.ClientCAs == nil {
+		return config
+	}
+	config = config.Clone()
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.ClientCAs = ts.ClientCAs
+	return config
+}
+
+// certificateIdentities - Returns the identities of a certificate matched by ClientRules:
+// its Common Name, followed by its Subject Alternative Names.
+func certificateIdentities(cert *x509.Certificate) []string {
+	return append([]string{cert.Subject.CommonName}, certificateNames(cert)...)
+}
+
+// certificateNames - Returns the Subject Alternative Names of a certificate.
+func certificateNames(cert *x509.Certificate) []string {
+	names := append(append([]string{}, cert.DNSNames...), cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
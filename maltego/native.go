@@ -0,0 +1,122 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+// ValidTransform - A native Go type implementing a Transform with its Do method, which
+// works exactly like a TransformFunc. Such types are registered with RegisterNative(),
+// which derives the Transform information from the type and the optional interfaces
+// below, or with Register() for structs declaring it in their tags.
+type ValidTransform interface {
+	Do(t *Transform) (err error)
+}
+
+// TransformNamer - An optional interface for native Go Transform types,
+// overriding the name derived from the type name by RegisterNative().
+type TransformNamer interface {
+	TransformName() string
+}
+
+// TransformDescriber - An optional interface for native Go Transform types, overriding
+// the description derived from the type doc comment by RegisterNative().
+type TransformDescriber interface {
+	TransformDescription() string
+}
+
+// TransformInputTyper - An optional interface for native Go Transform types, declaring
+// the type of their input Entity. Types that are also a ValidEntity are their own input.
+type TransformInputTyper interface {
+	TransformInput() ValidEntity
+}
+
+// RegisterNative - Declare and register a Transform implemented by a native Go type. Its
+// name is the type name, its description the doc comment of the type, and its input type
+// is the type itself if it is also a ValidEntity, unless the type implements TransformNamer,
+// TransformDescriber or TransformInputTyper. Pointers to structs can also declare their
+// information, settings and input in their tags (see Register()), and are copied for each
+// run. Other types are shared by all runs, and must thus be safe for concurrent use.
+func (ts *TransformServer) RegisterNative(v ValidTransform) (*Transform, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return nil, fmt.Errorf("Cannot register %T: nil Transform", v)
+	}
+	isStruct := value.Kind() == reflect.Ptr && value.Elem().Kind() == reflect.Struct
+
+	run := func(t *Transform) error { return v.Do(t) }
+	if isStruct {
+		run = registeredRun(value)
+	}
+	t := NewTransform(reflect.Indirect(value).Type().Name(), run)
+
+	if namer, ok := v.(TransformNamer); ok && namer.TransformName() != "" {
+		t.Name = namer.TransformName()
+	}
+	if describer, ok := v.(TransformDescriber); ok {
+		t.Description = describer.TransformDescription()
+	} else {
+		t.Description = typeDescription(v)
+	}
+	if typer, ok := v.(TransformInputTyper); ok {
+		t.input = typer.TransformInput()
+	} else if entity, ok := v.(ValidEntity); ok {
+		t.input = entity
+	}
+
+	if isStruct {
+		if err := declareRegistered(&t, value.Elem()); err != nil {
+			return nil, fmt.Errorf("Cannot register %T: %s", v, err)
+		}
+	} else if t.DisplayName == "" {
+		t.DisplayName = getDisplayName(t.Name)
+	}
+	ts.RegisterTransform(&t)
+
+	return &t, nil
+}
+
+// typeDescription - Returns the doc comment of the type of a native Go Transform, if it
+// is declared in the file of its Do method (or in the package registering it), and the
+// source code is available.
+func typeDescription(v ValidTransform) string {
+	method, found := reflect.TypeOf(v).MethodByName("Do")
+	if !found {
+		return ""
+	}
+	fileName, _ := runtime.FuncForPC(method.Func.Pointer()).FileLine(method.Func.Pointer())
+	pkg := sourceDoc(fileName)
+	if pkg == nil {
+		pkg = sourceDoc(callerDir())
+	}
+	if pkg == nil {
+		return ""
+	}
+
+	name := reflect.Indirect(reflect.ValueOf(v)).Type().Name()
+	for _, declared := range pkg.Types {
+		if declared.Name == name {
+			return declared.Doc
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Normalizer - An optional interface for native Go Entity types, canonicalizing their
+// values (lowercasing domains, stripping whitespace, etc) so that graphs don't fragment
+// on formatting differences. Normalize() is called on the type when an input Entity is
+// unmarshalled into it, and before it is added to a Transform output.
+type Normalizer interface {
+	Normalize()
+}
+
+// ValueNormalizer - A function canonicalizing the value of Entities of a given Maltego type.
+type ValueNormalizer func(value string) string
+
+// valueNormalizers - The value normalizers of all Maltego types, including builtin ones.
+var valueNormalizers = struct {
+	funcs map[string]ValueNormalizer
+	mutex *sync.RWMutex
+}{
+	funcs: map[string]ValueNormalizer{
+		"maltego.Domain":       NormalizeHostname,
+		"maltego.DNSName":      NormalizeHostname,
+		"maltego.MXRecord":     NormalizeHostname,
+		"maltego.NSRecord":     NormalizeHostname,
+		"maltego.Website":      ChainNormalizers(StripScheme, NormalizeHostname),
+		"maltego.URL":          NormalizeURL,
+		"maltego.IPv4Address":  NormalizeIP,
+		"maltego.IPv6Address":  NormalizeIP,
+		"maltego.EmailAddress": strings.ToLower,
+	},
+	mutex: &sync.RWMutex{},
+}
+
+// RegisterNormalizer - Set the function normalizing the value of all Entities
+// of a fully qualified Maltego type (eg. "maltego.Domain"), be they Transform
+// inputs or outputs. This replaces any builtin normalizer for the type.
+// The values of all Entities have their surrounding whitespace stripped anyway.
+func RegisterNormalizer(fqType string, normalize ValueNormalizer) {
+	valueNormalizers.mutex.Lock()
+	defer valueNormalizers.mutex.Unlock()
+	valueNormalizers.funcs[fqType] = normalize
+}
+
+// ChainNormalizers - Returns a normalizer applying all normalizers in order,
+// so that custom types can reuse the builtin ones (eg. StripScheme, NormalizeHostname).
+func ChainNormalizers(normalizers ...ValueNormalizer) ValueNormalizer {
+	return func(value string) string {
+		for _, normalize := range normalizers {
+			value = normalize(value)
+		}
+		return value
+	}
+}
+
+// normalizeValue - Normalize the value of the Entity, with the normalizer of its type.
+func (e *Entity) normalizeValue() {
+	e.Value = normalizedValue(strings.Join([]string{e.Namespace, e.Type}, "."), e.Value)
+}
+
+// normalizedValue - Returns a value normalized with the normalizer of a Maltego type.
+func normalizedValue(fqType, value string) string {
+	value = strings.TrimSpace(value)
+
+	valueNormalizers.mutex.RLock()
+	normalize := valueNormalizers.funcs[fqType]
+	valueNormalizers.mutex.RUnlock()
+
+	if normalize != nil && value != "" {
+		return normalize(value)
+	}
+	return value
+}
+
+// NormalizeHostname - Lowercase a hostname, without its trailing dot.
+func NormalizeHostname(value string) string {
+	return strings.TrimSuffix(strings.ToLower(value), ".")
+}
+
+// NormalizeIP - Canonicalize an IP address (eg. compressed IPv6 zeros).
+func NormalizeIP(value string) string {
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String()
+	}
+	return value
+}
+
+// StripScheme - Strip the scheme of a URL (eg. "https://"), and its path
+// if it is only a slash, leaving the host and any other path as is.
+func StripScheme(value string) string {
+	if parts := strings.SplitN(value, "://", 2); len(parts) == 2 && !strings.ContainsAny(parts[0], "/.") {
+		value = parts[1]
+	}
+	return strings.TrimSuffix(value, "/")
+}
+
+// NormalizeURL - Lowercase the scheme and host of a URL, leaving its path, query and fragment
+// as is, since they are case-sensitive. Values that are not absolute URLs are left unchanged.
+func NormalizeURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return value
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
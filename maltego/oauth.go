@@ -0,0 +1,194 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//
+// OAuth - Maltego OAuth Authenticators Pass-Through ---------------------------------------------
+//
+// Transforms calling third-party APIs on behalf of the analyst declare the OAuth authenticator
+// configured on the Maltego server (iTDS/TDS) for the API: the Maltego client then runs the
+// OAuth flow, and sends the access token of the analyst in a hidden Transform setting of each
+// request. Tokens are encrypted with the public key of the Transform server, if it has one:
+// the server decrypts them with its OAuthKey, as "aesToken$rsaKey" secrets (an AES key
+// encrypted with RSA PKCS#1 v1.5, and the token encrypted with this key in ECB mode), or
+// as a single token encrypted with RSA. Without an OAuthKey, tokens are passed as is.
+
+// DefaultOAuthSetting - The name of the setting holding the OAuth token of the analyst,
+// when SetOAuth() is not given one. It must match the "Access Token Input" of the
+// authenticator on the Maltego server.
+const DefaultOAuthSetting = "token"
+
+// ErrNoOAuthToken - Returned by Transform.OAuthToken() when the request has no OAuth token,
+// generally because the analyst has not logged in with the authenticator of the Transform.
+var ErrNoOAuthToken = errors.New("No OAuth token in the request: log in with the Transform authenticator first")
+
+// SetOAuth - Declare the OAuth authenticator (configured on the Maltego server) that the
+// client uses to obtain the access token of the analyst, passed in the setting with the
+// given name (DefaultOAuthSetting if empty), and available with OAuthToken() when running.
+// The authenticator is written in the configuration of local Transforms (see SetLocal()):
+// for served Transforms, select it in their configuration on the iTDS/TDS instead.
+// Since their output depends on the analyst token, the responses of such Transforms are
+// never stored in the server result cache, even if SetCache() was called.
+func (t *Transform) SetOAuth(authenticator, setting string) {
+	if setting == "" {
+		setting = DefaultOAuthSetting
+	}
+	t.setSetting(TransformSetting{
+		Name:        setting,
+		Display:     authenticator + " access token",
+		Description: "The OAuth access token obtained with the " + authenticator + " authenticator",
+		Auth:        true,
+		Optional:    true,
+	})
+	t.mutex.Lock()
+	t.authenticator = authenticator
+	t.mutex.Unlock()
+}
+
+// OAuthToken - Returns the OAuth access token of the analyst, sent along the request by the
+// Maltego client (see SetOAuth()), and decrypted with the server OAuthKey if it has one.
+// Use it to call third-party APIs on behalf of the analyst.
+func (t *Transform) OAuthToken() (string, error) {
+	setting := t.oauthSetting()
+	if setting == "" {
+		return "", fmt.Errorf("Transform %s has no OAuth authenticator (see SetOAuth())", t.Name)
+	}
+
+	secrets := strings.TrimSpace(t.Setting(setting))
+	if secrets == "" {
+		return "", ErrNoOAuthToken
+	}
+	if t.server == nil || t.server.OAuthKey == nil {
+		return secrets, nil
+	}
+	token, err := decryptOAuthSecrets(t.server.OAuthKey, secrets)
+	if err != nil {
+		return "", fmt.Errorf("Failed to decrypt the OAuth token: %s", err)
+	}
+	return token, nil
+}
+
+// oauthSetting - Returns the name of the setting holding the OAuth token
+// of the analyst, or an empty string if the Transform has no authenticator.
+func (t *Transform) oauthSetting() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for _, declared := range t.Settings.settings {
+		if declared.Auth {
+			return declared.Name
+		}
+	}
+	return ""
+}
+
+// LoadOAuthKey - Set the OAuthKey of the server from a PEM file holding an RSA private key,
+// in PKCS#1 or PKCS#8 form. Its public key is the one given to the Maltego server.
+func (ts *TransformServer) LoadOAuthKey(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("Failed to read OAuth key: %s", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("No PEM key found in %s", file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		ts.OAuthKey = key
+		return nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("Invalid OAuth key in %s: %s", file, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("Invalid OAuth key in %s: not an RSA key", file)
+	}
+	ts.OAuthKey = rsaKey
+	return nil
+}
+
+// decryptOAuthSecrets - Decrypt the OAuth token sent by a Maltego client: either a token
+// encrypted with RSA, or "aesToken$rsaKey", all encoded in base64.
+func decryptOAuthSecrets(key *rsa.PrivateKey, secrets string) (string, error) {
+	fields := strings.Split(secrets, "$")
+	if len(fields) == 1 {
+		token, err := decryptRSA(key, fields[0])
+		return string(token), err
+	}
+	aesKey, err := decryptRSA(key, fields[1])
+	if err != nil {
+		return "", err
+	}
+	token, err := decryptAES(aesKey, fields[0])
+	return string(token), err
+}
+
+// decryptRSA - Decrypt a base64 ciphertext with RSA PKCS#1 v1.5.
+func decryptRSA(key *rsa.PrivateKey, encoded string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptPKCS1v15(rand.Reader, key, ciphertext)
+}
+
+// decryptAES - Decrypt a base64 ciphertext with AES in ECB mode, and remove its PKCS#7 padding.
+func decryptAES(key []byte, encoded string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	size := block.BlockSize()
+	if len(ciphertext) == 0 || len(ciphertext)%size != 0 {
+		return nil, errors.New("Invalid AES ciphertext length")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	for i := 0; i < len(ciphertext); i += size {
+		block.Decrypt(plaintext[i:i+size], ciphertext[i:i+size])
+	}
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > size {
+		return nil, errors.New("Invalid AES padding")
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("Invalid AES padding")
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
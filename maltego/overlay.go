@@ -18,7 +18,12 @@ package maltego
    along with this program.  If not, see <https://www.gnu.org/licenses/>.
 */
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+)
 
 // Overlay - An overlay is a piece of information that is displayed
 // at some position relative (close) to the Entity. An overlay can
@@ -105,11 +110,107 @@ func isOverlayPosition(a string) bool {
 	return false
 }
 
-// Label - Used to convey extra information associated with an Entity in the Maltego
-// client GUI. Unlike entity fields, labels are only transmitted in response messages
-// and cannot be passed from transform to transform as a source of input.
-type Label struct {
-	Name    string `xml:"Name,attr"` // The name (key) for the label
-	Content string `xml:",cdata"`    // The content, displayed in Maltego
-	Type    string `xml:"Type,attr"` // The type of content (if empty, defaults to "text/html")
+// OverlayColorFunc - A function computing the color of a colour overlay, given the
+// current value of the Entity property it is bound to. It must return a valid RGB
+// code (eg. #45e06f).
+type OverlayColorFunc func(value string) string
+
+// overlayColor - A colour overlay computed from an Entity property value.
+type overlayColor struct {
+	property string
+	color    OverlayColorFunc
+}
+
+// overlayColorProperty - The name of the (hidden) property holding
+// the color computed for a colour overlay at a given position.
+func overlayColorProperty(pos OverlayPosition) string {
+	return "overlay#colour." + strings.ToLower(string(pos))
+}
+
+// rgbColor - A valid RGB color code
+var rgbColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// isRGBColor - Verify that a color is a valid RGB code (eg. #45e06f)
+func isRGBColor(color string) bool {
+	return rgbColor.MatchString(color)
+}
+
+// colorCode - Returns the RGB code of a color given by name (see ParseColor()),
+// or the color unchanged if it is invalid, for validation to report it.
+func colorCode(color string) string {
+	if code, err := ParseColor(color); err == nil {
+		return code
+	}
+	return color
+}
+
+// validateOverlay - Check that an overlay has a valid position and type, that the
+// property it references exists (for text/colour overlays), and that the value of
+// a colour overlay property is a valid RGB code. Image overlays may either reference
+// a property, or directly hold the URL to their image.
+func (e *Entity) validateOverlay(o Overlay) error {
+	if !isOverlayPosition(string(o.Position)) {
+		return fmt.Errorf("Invalid overlay position %q (valid: N, S, W, NW, SW, C)", o.Position)
+	}
+	if !isOverlayType(string(o.Type)) {
+		return fmt.Errorf("Invalid overlay type %q for %s overlay (valid: text, image, colour)", o.Type, o.Position)
+	}
+
+	property, found := e.Properties[o.PropertyName]
+
+	switch o.Type {
+	case OverlayText:
+		if !found {
+			return fmt.Errorf("Text overlay %s references a non-existing property %q", o.Position, o.PropertyName)
+		}
+	case OverlayColour:
+		if !found {
+			return fmt.Errorf("Colour overlay %s references a non-existing property %q", o.Position, o.PropertyName)
+		}
+		if _, err := ParseColor(fmt.Sprintf("%v", property.Value)); err != nil {
+			return fmt.Errorf("Colour overlay %s: property %q: %s", o.Position, o.PropertyName, err)
+		}
+	case OverlayImage:
+		if !found && !strings.Contains(o.PropertyName, "://") && !strings.HasPrefix(o.PropertyName, "data:") {
+			return fmt.Errorf("Image overlay %s references neither a property nor an image URL: %q",
+				o.Position, o.PropertyName)
+		}
+	}
+
+	return nil
+}
+
+// resolveOverlays - Compute the color of all dynamic colour overlays and
+// store them as hidden properties, then check that all overlays are valid.
+// All invalid overlays are removed from the Entity, and reported at once.
+func (e *Entity) resolveOverlays() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for pos, dynamic := range e.colors {
+		var value string
+		if property, found := e.Properties[dynamic.property]; found && property.Value != nil {
+			value = fmt.Sprintf("%v", property.Value)
+		}
+		e.Properties[overlayColorProperty(pos)] = Field{
+			Name:         overlayColorProperty(pos),
+			Display:      "Overlay Colour (" + string(pos) + ")",
+			MatchingRule: MatchLoose,
+			Hidden:       true,
+			Value:        colorCode(dynamic.color(value)),
+		}
+	}
+
+	var invalid []string
+	for pos, overlay := range e.Overlays {
+		if err := e.validateOverlay(overlay); err != nil {
+			invalid = append(invalid, err.Error())
+			delete(e.Overlays, pos)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("Invalid overlays for %s entity: %s", e.Type, strings.Join(invalid, "; "))
+	}
+
+	return nil
 }
@@ -0,0 +1,102 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// DefaultPathTemplate - The template of the URL paths of Transforms, unless the server
+// has its own PathTemplate: the name of the Transform, followed by its major version
+// if it has a semantic version (eg. /DNSToIP/v2).
+const DefaultPathTemplate = "/{{.Name}}{{with .Major}}/{{.}}{{end}}"
+
+// TransformPath - The values available to the path templates of a server (see
+// TransformServer.PathTemplate), when registering a Transform with RegisterTransform():
+//
+//	server.PathTemplate = "/{{.Namespace}}/{{.Name}}"  // eg. /maltego/DNSToIP
+type TransformPath struct {
+	Name      string // The name of the Transform.
+	Version   string // The semantic version of the Transform, if any (eg. 2.1.0).
+	Major     string // The major version of the Transform, if any (eg. v2).
+	Namespace string // The namespace of the declared input Entity type, if any (eg. maltego).
+}
+
+// RegisterTransformAt - Register a Transform at a given URL path, instead of the one derived
+// from its properties with the server PathTemplate. Unlike RegisterTransform(), the Transform
+// is not served at an unversioned path. Registering a Transform at the path of another one
+// replaces the latter.
+func (ts *TransformServer) RegisterTransformAt(path string, t *Transform) {
+	ts.registerTransform(cleanPath(path), "", t)
+}
+
+// transformPath - Returns the path at which a Transform is registered, derived from its
+// properties with the server PathTemplate, and the unversioned one pointing to its latest
+// version. Paths of invalid templates are derived from the default one, and logged.
+func (ts *TransformServer) transformPath(t *Transform) (path, base string) {
+	values := t.pathValues()
+	tmpl, err := template.New("path").Parse(ts.PathTemplate)
+	if ts.PathTemplate == "" || err != nil {
+		if err != nil && ts.Logger != nil {
+			ts.Logger.Printf("Invalid path template %q: %s", ts.PathTemplate, err)
+		}
+		tmpl = template.Must(template.New("path").Parse(DefaultPathTemplate))
+	}
+
+	execute := func(values TransformPath) string {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, values); err != nil {
+			if ts.Logger != nil {
+				ts.Logger.Printf("Invalid path template %q: %s", ts.PathTemplate, err)
+			}
+			t.mutex.RLock()
+			defer t.mutex.RUnlock()
+			return t.defaultPath()
+		}
+		return cleanPath(buf.String())
+	}
+
+	path = execute(values)
+	values.Version, values.Major = "", ""
+	return path, execute(values)
+}
+
+// pathValues - Returns the values available to path templates for the Transform.
+func (t *Transform) pathValues() TransformPath {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	values := TransformPath{Name: t.Name}
+	if v, err := parseVersion(t.Version); err == nil {
+		values.Version = v.String()
+		values.Major = fmt.Sprintf("v%d", v.major)
+	}
+	if t.input != nil {
+		values.Namespace = t.input.AsEntity().Namespace
+	}
+	return values
+}
+
+// cleanPath - Returns an absolute URL path, without empty or trailing elements.
+func cleanPath(p string) string {
+	return path.Clean("/" + strings.TrimSpace(p))
+}
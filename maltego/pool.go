@@ -0,0 +1,102 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimit - Caps the number of concurrent runs of a Transform, across all requests
+// (and all input Entities of requests with several of them). This protects the host from
+// Transforms shelling out to heavy tools (nmap, headless browsers, etc) when an analyst
+// runs them on hundreds of Entities at once: runs over the limit wait for a free slot.
+type ConcurrencyLimit struct {
+	Max     int           // Maximum number of concurrent runs (0 means no limit).
+	Queue   int           // Maximum number of runs waiting for a slot, others are rejected (0 means no limit, -1 no waiting).
+	Timeout time.Duration // Maximum time waiting for a slot (0 means until the request deadline, if any).
+}
+
+// SetConcurrency - Cap the number of concurrent runs of the Transform (see ConcurrencyLimit).
+// Runs that cannot get a slot fail with an exception asking the analyst to retry later.
+func (t *Transform) SetConcurrency(limit ConcurrencyLimit) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if limit.Max <= 0 {
+		t.pool = nil
+		return
+	}
+	t.pool = &workerPool{
+		limit: limit,
+		slots: make(chan struct{}, limit.Max),
+		mutex: &sync.Mutex{},
+	}
+}
+
+// workerPool - The slots of the concurrent runs of a Transform, shared by all its instances.
+type workerPool struct {
+	limit   ConcurrencyLimit
+	slots   chan struct{}
+	waiting int // The number of runs waiting for a slot
+	mutex   *sync.Mutex
+}
+
+// acquire - Wait for a free slot, according to the limit overflow settings and to the
+// context, and return the function releasing it once the run is over.
+func (p *workerPool) acquire(ctx context.Context) (release func(), err error) {
+	release = func() { <-p.slots }
+
+	// Free slot
+	select {
+	case p.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	// Or queue, if there is room in the queue.
+	p.mutex.Lock()
+	if p.limit.Queue < 0 || (p.limit.Queue > 0 && p.waiting >= p.limit.Queue) {
+		p.mutex.Unlock()
+		return nil, fmt.Errorf("%d runs in progress", p.limit.Max)
+	}
+	p.waiting++
+	p.mutex.Unlock()
+	defer func() {
+		p.mutex.Lock()
+		p.waiting--
+		p.mutex.Unlock()
+	}()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p.limit.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.limit.Timeout)
+		defer cancel()
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no free slot after waiting for %d runs in progress", p.limit.Max)
+	}
+}
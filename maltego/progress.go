@@ -0,0 +1,47 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import "time"
+
+// ProgressInterval - The minimum time between two progress messages of a
+// Transform (see Transform.Progress()). Zero disables the throttling.
+var ProgressInterval = time.Second
+
+// Progress - Report the progress of a long Transform in the Maltego output window, as
+// in "Progress: 250/1000 (25%)", with a total of zero or less when it is unknown. Messages
+// are throttled to one per ProgressInterval, so it is safe to call this for each item the
+// Transform processes: those called in between are dropped, except the final one.
+func (t *Transform) Progress(current, total int) {
+	now := time.Now()
+	t.mutex.Lock()
+	done := total > 0 && current >= total
+	if !done && !t.progressAt.IsZero() && now.Sub(t.progressAt) < ProgressInterval {
+		t.mutex.Unlock()
+		return
+	}
+	t.progressAt = now
+	t.mutex.Unlock()
+
+	if total <= 0 {
+		t.Infof("Progress: %d", current)
+		return
+	}
+	t.Infof("Progress: %d/%d (%d%%)", current, total, current*100/total)
+}
@@ -0,0 +1,129 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//
+// Reverse Proxies - Public Server Address -------------------------------------------------------
+//
+// When the server runs behind a reverse proxy (or a load balancer), the address it is bound
+// to is not the one of the Maltego clients: all the URLs it generates (help pages, attachments,
+// etc) must use the public one instead. It is either fixed with the ExternalURL of the server,
+// or derived per request from the X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix
+// headers, only trusted when the request comes from one of the TrustedProxies.
+//
+// The path of the public URL (eg. /maltego in https://osint.acme.com/maltego) is stripped
+// from the request paths, for proxies forwarding them as is.
+
+// PublicURL - Returns the base URL at which clients reach the server:
+// its ExternalURL if set, or its URL otherwise (empty if not known yet).
+func (ts *TransformServer) PublicURL() string {
+	if ts.ExternalURL != "" {
+		return strings.TrimSuffix(ts.ExternalURL, "/")
+	}
+	return strings.TrimSuffix(ts.URL, "/")
+}
+
+// requestURL - Returns the base URL at which the client of a request reaches the server:
+// derived from the forwarding headers if the request comes from a trusted proxy, or
+// the public URL of the server otherwise.
+func (ts *TransformServer) requestURL(r *http.Request) string {
+	if ts.ExternalURL != "" || !ts.isTrustedProxy(r.RemoteAddr) {
+		return ts.PublicURL()
+	}
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		return ts.PublicURL()
+	}
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		proto = "https"
+	}
+	// Headers might hold several comma-separated values, when going through several proxies.
+	first := func(value string) string { return strings.TrimSpace(strings.SplitN(value, ",", 2)[0]) }
+	prefix := strings.TrimSuffix(first(r.Header.Get("X-Forwarded-Prefix")), "/")
+
+	return first(proto) + "://" + first(host) + prefix
+}
+
+// isTrustedProxy - Whether a remote address (host:port) is one of the trusted proxies,
+// given as IP addresses or CIDR ranges.
+func (ts *TransformServer) isTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range ts.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyHandler - Wrap the server routes, stripping the path prefix of the public
+// URL from request paths, and passing the public URL of the request to Transforms.
+func (ts *TransformServer) proxyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := ts.requestURL(r)
+
+		prefix := ""
+		if u, err := url.Parse(base); err == nil {
+			prefix = strings.TrimSuffix(u.Path, "/")
+		}
+		if prefix != "" && strings.HasPrefix(r.URL.Path, prefix+"/") {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+			r2.URL.RawPath = ""
+			r = r2
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), publicURLKey{}, base)))
+	})
+}
+
+// publicURLKey - The context key of the public URL of a request.
+type publicURLKey struct{}
+
+// publicURL - Returns the base URL at which the client of the
+// Transform reaches the server, or an empty string if unknown.
+func (t *Transform) publicURL() string {
+	if base, ok := t.Context().Value(publicURLKey{}).(string); ok && base != "" {
+		return base
+	}
+	if t.server == nil {
+		return ""
+	}
+	return t.server.PublicURL()
+}
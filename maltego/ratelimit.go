@@ -0,0 +1,194 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited - The error of runs rejected because their client went over its rate limit.
+var ErrRateLimited = errors.New("Rate limited")
+
+// RateLimit - The maximum rate at which each client (identified by the API key of its tenant,
+// or by its IP address) can run Transforms. Clients going over it are answered with an
+// exception telling them when to retry, instead of the Transform output.
+type RateLimit struct {
+	Rate  float64 // Maximum number of requests per second (0 means no limit).
+	Burst int     // Maximum number of requests at once, defaults to the rate.
+}
+
+// SetRateLimit - Limit the rate at which each client can run this Transform, in addition
+// to the limit of the server for all Transforms (see TransformServer.ClientRateLimit).
+// Only requests received over HTTP are limited.
+func (t *Transform) SetRateLimit(limit RateLimit) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.rateLimit = limit
+}
+
+// clientKey - The context key of the client of an HTTP request.
+type clientKey struct{}
+
+// requestClient - The identifiers of the client of an HTTP request.
+type requestClient struct {
+	ip  string // The IP address of the client
+	key string // The API key sent in the TenantKeyHeader, not validated
+}
+
+// withClient - Returns a context carrying the client of a request, for rate limiting: its
+// IP address, and its API key if it has one. Requests from trusted proxies are identified
+// with their X-Forwarded-For header.
+func (ts *TransformServer) withClient(ctx context.Context, r *http.Request) context.Context {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && ts.isTrustedProxy(r.RemoteAddr) {
+		host = strings.TrimSpace(strings.SplitN(forwarded, ",", 2)[0])
+	}
+	return context.WithValue(ctx, clientKey{}, requestClient{ip: host, key: r.Header.Get(TenantKeyHeader)})
+}
+
+// rateLimitedClient - Returns the identifier of the client of a run for rate limiting: a hash
+// of its API key when the key identifies the tenant of the run, and its IP address otherwise,
+// so that clients cannot get a new bucket for each request by sending random keys.
+func rateLimitedClient(client requestClient, t *Transform) string {
+	key := requestKey(client.key, t.request)
+	if key == "" || t.tenant == nil || !t.tenant.hasKey(key) {
+		return "ip:" + client.ip
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:8])
+}
+
+// rateLimited - Consume a request from the buckets of the client of a request, the one of the
+// server and the one of the Transform, and if any of them is empty, raise an exception telling
+// the client when to retry and return true. Rejected requests consume from none of them.
+func (ts *TransformServer) rateLimited(ctx context.Context, t *Transform) bool {
+	client, found := ctx.Value(clientKey{}).(requestClient)
+	if !found {
+		return false
+	}
+	t.mutex.RLock()
+	limit := t.rateLimit
+	t.mutex.RUnlock()
+
+	id := rateLimitedClient(client, t)
+	retry := ts.limiter.wait(
+		bucketLimit{key: id, limit: ts.ClientRateLimit},
+		bucketLimit{key: id + "\x00" + t.Name, limit: limit},
+	)
+	if retry == 0 {
+		return false
+	}
+	t.Errorf("Rate limited, retry in %ds", int(math.Ceil(retry.Seconds())))
+	return true
+}
+
+// clientLimiter - The rate limiting buckets of all clients, by client (and Transform).
+type clientLimiter struct {
+	buckets map[string]*tokenBucket
+	swept   time.Time // The last time idle buckets were removed
+	mutex   *sync.Mutex
+}
+
+// tokenBucket - The requests a client can still make at once, refilled over time.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketLimit - A bucket of a client limiter, and the rate limit refilling it.
+type bucketLimit struct {
+	key   string
+	limit RateLimit
+}
+
+// newClientLimiter - Create a limiter with no buckets.
+func newClientLimiter() *clientLimiter {
+	return &clientLimiter{
+		buckets: map[string]*tokenBucket{},
+		swept:   time.Now(),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// wait - Consume a token from each of the buckets if all of them have one, and return zero,
+// or how long to wait until they all have one otherwise, in which case no token is consumed.
+// Buckets without a rate do not limit anything.
+func (l *clientLimiter) wait(buckets ...bucketLimit) (retry time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	var refilled []*tokenBucket
+	for _, b := range buckets {
+		if b.limit.Rate <= 0 {
+			continue
+		}
+		burst := float64(b.limit.Burst)
+		if burst <= 0 {
+			burst = math.Max(1, math.Ceil(b.limit.Rate))
+		}
+		bucket, found := l.buckets[b.key]
+		if !found {
+			bucket = &tokenBucket{tokens: burst, last: now}
+			l.buckets[b.key] = bucket
+		}
+		bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*b.limit.Rate)
+		bucket.last = now
+		if bucket.tokens < 1 {
+			if wait := time.Duration((1 - bucket.tokens) / b.limit.Rate * float64(time.Second)); wait > retry {
+				retry = wait
+			}
+		}
+		refilled = append(refilled, bucket)
+	}
+	if retry > 0 {
+		return retry
+	}
+	for _, bucket := range refilled {
+		bucket.tokens--
+	}
+	return 0
+}
+
+// sweep - Remove the buckets of clients idle for more than an hour,
+// at most once per minute: they would be full again anyway.
+func (l *clientLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > time.Hour {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
@@ -0,0 +1,84 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"testing"
+)
+
+// rateLimitedRun - Whether a request to the Transform at path was rate limited.
+func rateLimitedRun(ts *TransformServer, path string, headers map[string]string) bool {
+	_, response := serveAuthenticated(ts, path, "", headers)
+	return len(response.Exceptions) == 1
+}
+
+func TestRateLimitUnvalidatedKeys(t *testing.T) {
+	ts := newAuthServer(func(ts *TransformServer) {
+		ts.ClientRateLimit = RateLimit{Rate: 0.001, Burst: 1}
+	})
+
+	if rateLimitedRun(ts, "/Lookup", map[string]string{TenantKeyHeader: "random-1"}) {
+		t.Fatalf("First request should not be rate limited")
+	}
+	if !rateLimitedRun(ts, "/Lookup", map[string]string{TenantKeyHeader: "random-2"}) {
+		t.Errorf("API keys matching no tenant should not give a new bucket to the client")
+	}
+}
+
+func TestRateLimitTenantKeys(t *testing.T) {
+	ts := newAuthServer(func(ts *TransformServer) {
+		ts.ClientRateLimit = RateLimit{Rate: 0.001, Burst: 1}
+		ts.AddTenant(&Tenant{Name: "acme", APIKeys: []string{"acme-1", "acme-2"}})
+	})
+
+	for _, key := range []string{"acme-1", "acme-2"} {
+		if rateLimitedRun(ts, "/Lookup", map[string]string{TenantKeyHeader: key}) {
+			t.Errorf("Each tenant API key should have its own bucket")
+		}
+	}
+	if !rateLimitedRun(ts, "/Lookup", map[string]string{TenantKeyHeader: "acme-1"}) {
+		t.Errorf("Second request with the same API key should be rate limited")
+	}
+}
+
+func TestRateLimitRejectedConsumeNothing(t *testing.T) {
+	ts := newAuthServer(func(ts *TransformServer) {
+		ts.ClientRateLimit = RateLimit{Rate: 0.001, Burst: 2}
+		for _, transform := range ts.Transforms {
+			if transform.Name == "Export" {
+				transform.SetRateLimit(RateLimit{Rate: 0.001, Burst: 1})
+			}
+		}
+	})
+
+	runs := []struct {
+		path    string
+		limited bool
+	}{
+		{"/Export", false},
+		{"/Export", true}, // The Transform bucket is empty, the server one is not.
+		{"/Lookup", false},
+		{"/Lookup", true},
+	}
+	for i, run := range runs {
+		if limited := rateLimitedRun(ts, run.path, nil); limited != run.limited {
+			t.Errorf("Run %d of %s: rate limited %t, want %t", i, run.path, limited, run.limited)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Register - Declare and register a Transform from a tagged struct having a Do method
+// satisfying the TransformFunc signature, instead of calling NewTransform(), AddToSet()
+// and AddSetting(). The Transform metadata is declared in the tags of a blank field:
+//
+//	type DNSToIP struct {
+//		_        struct{} `transform:"DNSToIP" display:"DNS To IP" sets:"DNS,Infrastructure"`
+//		Domain   *Domain  `input:""`
+//		Resolver string   `setting:"dns.resolver" description:"DNS server" default:"8.8.8.8"`
+//		APIKey   string   `setting:"api.key" description:"Your API key" popup:"yes"`
+//		Results  int      `setting:"results" display:"Number of results" default:"10" popup:"yes"`
+//	}
+//
+//	func (d *DNSToIP) Do(t *maltego.Transform) error { ... }
+//
+// Blank field tags:
+//
+// transform:"DNSToIP"          - The name of the Transform, defaults to the type name.
+// display:"DNS To IP"          - The display name, defaults to the name split on its words.
+// description:"Resolve..."     - The Transform description.
+// sets:"DNS,Infrastructure"    - The Transform sets the Transform belongs to.
+// input:"maltego.Domain"       - The fully qualified Maltego type of the input Entity.
+// outputs:"maltego.Website"    - The fully qualified Maltego types of the output Entities.
+// author:"..." owner:"..." version:"..." - The Transform information, as in TransformInfo.
+//
+// Fields tagged setting:"name" declare a Transform setting (with the display, description,
+// default, optional:"yes" and popup:"yes" tags, its type following the one of the field),
+// and a field tagged input:"" holding a ValidEntity declares the input type: before each run,
+// both are populated from the request on a copy of the struct, on which Do is called.
+// Thus concurrent runs never share their state.
+func (ts *TransformServer) Register(v interface{}) (*Transform, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Cannot register %T: must be a pointer to a struct", v)
+	}
+	structType := value.Elem().Type()
+
+	if _, ok := v.(ValidTransform); !ok {
+		return nil, fmt.Errorf("Cannot register %T: no Do(*maltego.Transform) error method", v)
+	}
+
+	t := NewTransform(structType.Name(), registeredRun(value))
+	if err := declareRegistered(&t, value.Elem()); err != nil {
+		return nil, fmt.Errorf("Cannot register %T: %s", v, err)
+	}
+	ts.RegisterTransform(&t)
+
+	return &t, nil
+}
+
+// registeredRun - The implementation of a Transform registered from a struct: the struct
+// is copied for each run, which populates the copy from the request and calls its Do method.
+func registeredRun(value reflect.Value) TransformFunc {
+	structType := value.Elem().Type()
+	template := reflect.New(structType).Elem()
+	template.Set(value.Elem())
+	return func(t *Transform) error {
+		instance := reflect.New(structType)
+		instance.Elem().Set(template)
+		if err := populateRegistered(t, instance.Elem()); err != nil {
+			return err
+		}
+		return instance.Interface().(ValidTransform).Do(t)
+	}
+}
+
+// declareRegistered - Set the Transform information, sets, settings
+// and input type from the tags of a struct passed to Register().
+func declareRegistered(t *Transform, value reflect.Value) error {
+	structType := value.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		// The blank field holds the Transform information.
+		if field.Name == "_" {
+			tags := map[string]*string{
+				"transform":   &t.Name,
+				"display":     &t.DisplayName,
+				"description": &t.Description,
+				"author":      &t.Author,
+				"owner":       &t.Owner,
+				"version":     &t.Version,
+			}
+			for tag, info := range tags {
+				if tagValue, ok := field.Tag.Lookup(tag); ok && tagValue != "" {
+					*info = tagValue
+				}
+			}
+			if sets, ok := field.Tag.Lookup("sets"); ok {
+				for _, set := range strings.Split(sets, ",") {
+					if set = strings.TrimSpace(set); set != "" {
+						t.AddToSet(set)
+					}
+				}
+			}
+			if outputs, ok := field.Tag.Lookup("outputs"); ok {
+				for _, output := range strings.Split(outputs, ",") {
+					if output = strings.TrimSpace(output); output != "" {
+						entity := NewForeignEntity(output, "")
+						t.AddOutputType(&entity)
+					}
+				}
+			}
+			if input, ok := field.Tag.Lookup("input"); ok && input != "" {
+				entity := NewForeignEntity(input, "")
+				t.input = &entity
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		// A typed input Entity
+		if _, ok := field.Tag.Lookup("input"); ok {
+			validEntity := reflect.TypeOf((*ValidEntity)(nil)).Elem()
+			if field.Type.Kind() != reflect.Ptr || !field.Type.Implements(validEntity) {
+				return fmt.Errorf("input field %s must be a pointer to a maltego.ValidEntity type", field.Name)
+			}
+			t.input = reflect.New(field.Type.Elem()).Interface().(ValidEntity)
+			continue
+		}
+
+		// A Transform setting
+		name, ok := field.Tag.Lookup("setting")
+		if !ok {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		setting := TransformSetting{
+			Name:        name,
+			Display:     field.Tag.Get("display"),
+			Description: field.Tag.Get("description"),
+			Type:        propertyType(field.Type),
+			Optional:    field.Tag.Get("optional") != "",
+			Popup:       field.Tag.Get("popup") != "",
+		}
+		if defaultValue, ok := field.Tag.Lookup("default"); ok {
+			setting.Default = defaultValue
+		} else if fieldValue := value.Field(i); !fieldValue.IsZero() {
+			setting.Default = fieldValue.Interface()
+		}
+		t.AddSetting(setting)
+	}
+
+	if t.DisplayName == "" {
+		t.DisplayName = getDisplayName(t.Name)
+	}
+
+	return nil
+}
+
+// populateRegistered - Populate the setting and input fields of a copy of a
+// struct passed to Register(), with the values and input Entity of the request.
+func populateRegistered(t *Transform, value reflect.Value) error {
+	structType := value.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.Name == "_" || !field.IsExported() {
+			continue
+		}
+
+		if _, ok := field.Tag.Lookup("input"); ok {
+			input := reflect.New(field.Type.Elem())
+			if err := t.Input().Unmarshal(input.Interface().(ValidEntity)); err != nil {
+				return fmt.Errorf("Error unmarshalling input Entity: %s", err)
+			}
+			value.Field(i).Set(input)
+			continue
+		}
+
+		name, ok := field.Tag.Lookup("setting")
+		if !ok {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if setting := t.settingValue(name); setting != "" {
+			if err := convert(setting, value.Field(i)); err != nil {
+				return fmt.Errorf("Invalid value for setting %s: %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
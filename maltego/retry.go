@@ -0,0 +1,126 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy - Controls how many times, and how often, Transform.Retry() calls a
+// function that failed. The wait between two attempts starts at Initial, is multiplied
+// by Multiplier after each failure (up to Max), and is randomized by Jitter, so that
+// concurrent transforms don't hammer a struggling data source at the same time.
+type RetryPolicy struct {
+	Attempts   int           // Maximum number of calls, including the first one (at least 1).
+	Initial    time.Duration // Wait time after the first failure.
+	Max        time.Duration // Maximum wait time between two attempts (0 means no limit).
+	Multiplier float64       // Growth factor of the wait time (defaults to 2).
+	Jitter     float64       // Random fraction (0 to 1) of the wait time added or removed.
+}
+
+// DefaultRetryPolicy - A sensible policy for most third-party APIs: up
+// to 4 attempts, waiting roughly 0.5s, 1s and 2s between them.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   4,
+	Initial:    500 * time.Millisecond,
+	Max:        5 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Retry - Call fn until it succeeds or the policy gives up, and return its last error.
+// Each retried failure is shown as a warning in the Maltego transform window, and the
+// last one as a debug message. Retries are abandoned early when the next attempt would
+// start after the request Deadline(), or as soon as the request Context() is canceled,
+// in which case the context error is returned. Errors that retrying cannot fix (user
+// input and configuration errors, see UserError and ConfigError) are returned at once.
+func (t *Transform) Retry(policy RetryPolicy, fn func() error) (err error) {
+	ctx := t.Context()
+	wait := policy.Initial
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !retryable(err) {
+			return
+		}
+		if attempt >= policy.Attempts {
+			t.Debugf("Attempt %d/%d failed: %s (giving up)", attempt, policy.Attempts, err)
+			return
+		}
+
+		delay := policy.jitter(wait)
+		if deadline, ok := t.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			t.Debugf("Attempt %d/%d failed: %s (no time left for retrying)", attempt, policy.Attempts, err)
+			return
+		}
+		t.Warnf("Attempt %d/%d failed: %s (retrying in %s)", attempt, policy.Attempts, err, delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		wait = policy.next(wait)
+	}
+}
+
+// RetryN - Call fn up to n times until it succeeds, waiting backoff after the first failure,
+// and twice as long after each of the next ones (see Retry() and DefaultRetryPolicy).
+func (t *Transform) RetryN(n int, backoff time.Duration, fn func() error) error {
+	policy := DefaultRetryPolicy
+	policy.Attempts = n
+	policy.Initial = backoff
+	if policy.Max < backoff {
+		policy.Max = 0
+	}
+	return t.Retry(policy, fn)
+}
+
+// retryable - Whether a failed call is worth retrying: errors of the analyst
+// input or of the server configuration will fail again, the others might not.
+func retryable(err error) bool {
+	var user *UserError
+	var config *ConfigError
+	return !errors.As(err, &user) && !errors.As(err, &config)
+}
+
+// next - Returns the wait time following the current one.
+func (p RetryPolicy) next(wait time.Duration) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	wait = time.Duration(float64(wait) * multiplier)
+	if p.Max > 0 && wait > p.Max {
+		wait = p.Max
+	}
+	return wait
+}
+
+// jitter - Randomize the wait time by up to +/- Jitter of its value.
+func (p RetryPolicy) jitter(wait time.Duration) time.Duration {
+	if p.Jitter <= 0 || wait <= 0 {
+		return wait
+	}
+	delta := (rand.Float64()*2 - 1) * p.Jitter * float64(wait)
+	return wait + time.Duration(delta)
+}
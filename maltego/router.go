@@ -0,0 +1,119 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TransformRouter - A Transform dispatching requests to different implementations depending
+// on the type of their input Entity, since a Maltego Transform can accept several input
+// types while the Go code handling them is often quite different:
+//
+//	transform := maltego.NewRouterTransform("To Location").
+//		On(&Domain{}, domainToLocation).
+//		On(&IPv4{}, ipToLocation).
+//		OnType("maltego.Phrase", phraseToLocation).
+//		Transform()
+//
+// Input types are matched exactly first, and then against the base types of the input
+// Entity (the genealogy sent by Maltego), so that a handler for maltego.Domain also runs
+// on Entities inheriting from it. Unmatched inputs go to the Default() handler, if any.
+type TransformRouter struct {
+	name     string
+	settings []TransformSetting
+	routes   map[string]TransformFunc
+	types    []string // Routed types, in registration order
+	fallback TransformFunc
+	mutex    *sync.RWMutex
+}
+
+// NewRouterTransform - Create a new Transform dispatching to handlers by input Entity type.
+// Settings are passed to the resulting Transform, exactly as with NewTransform().
+func NewRouterTransform(name string, settings ...TransformSetting) *TransformRouter {
+	return &TransformRouter{
+		name:     name,
+		settings: settings,
+		routes:   map[string]TransformFunc{},
+		mutex:    &sync.RWMutex{},
+	}
+}
+
+// On - Run the handler when the input Entity is of the same type as input.
+func (r *TransformRouter) On(input ValidEntity, run TransformFunc) *TransformRouter {
+	e := input.AsEntity()
+	return r.OnType(strings.Join([]string{e.Namespace, e.Type}, "."), run)
+}
+
+// OnType - Run the handler when the input Entity is of this fully qualified
+// Maltego type (eg. "maltego.Domain"), for types without a native Go type.
+func (r *TransformRouter) OnType(fqType string, run TransformFunc) *TransformRouter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.routes[fqType]; !exists {
+		r.types = append(r.types, fqType)
+	}
+	r.routes[fqType] = run
+	return r
+}
+
+// Default - Run the handler when the input Entity type matches no other handler.
+// Without it, such requests fail with an exception listing the supported types.
+func (r *TransformRouter) Default(run TransformFunc) *TransformRouter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.fallback = run
+	return r
+}
+
+// Transform - Returns the Transform to register to a server.
+func (r *TransformRouter) Transform() Transform {
+	return NewTransform(r.name, r.run, r.settings...)
+}
+
+// run - The TransformFunc of the router, dispatching to the handler of the input type.
+func (r *TransformRouter) run(t *Transform) error {
+	input := t.Input()
+	inputType := strings.Trim(strings.Join([]string{input.Namespace, input.Type}, "."), ".")
+
+	r.mutex.RLock()
+	run := r.route(inputType, t.request.Geneaology)
+	supported := strings.Join(r.types, ", ")
+	r.mutex.RUnlock()
+
+	if run == nil {
+		return fmt.Errorf("Input Entity type %s is not supported (supported: %s)", inputType, supported)
+	}
+	return run(t)
+}
+
+// route - Returns the handler for the input type, or for the closest of its base types.
+func (r *TransformRouter) route(inputType string, genealogy []Geneaology) TransformFunc {
+	if run, found := r.routes[inputType]; found {
+		return run
+	}
+	for _, node := range genealogy {
+		if run, found := r.routes[node.Name]; found {
+			return run
+		}
+	}
+	return r.fallback
+}
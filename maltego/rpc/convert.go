@@ -0,0 +1,186 @@
+package rpc
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// EntityToProto - Convert a maltego.Entity into its Protobuf equivalent.
+// An error is returned if the value of one of its properties cannot be marshalled.
+func EntityToProto(e maltego.Entity) (*Entity, error) {
+	link, err := LinkToProto(e.Link)
+	if err != nil {
+		return nil, err
+	}
+	pe := &Entity{
+		Namespace:   e.Namespace,
+		Type:        e.Type,
+		DisplayName: e.DisplayName,
+		Value:       e.Value,
+		Weight:      int32(e.Weight),
+		IconUrl:     e.IconURL,
+		Bookmark:    string(e.Bookmark),
+		Link:        link,
+	}
+
+	for _, overlay := range e.Overlays {
+		pe.Overlays = append(pe.Overlays, &Overlay{
+			PropertyName: overlay.PropertyName,
+			Position:     string(overlay.Position),
+			Type:         string(overlay.Type),
+		})
+	}
+	sort.Slice(pe.Overlays, func(i, j int) bool {
+		return pe.Overlays[i].Position < pe.Overlays[j].Position
+	})
+
+	for _, label := range e.Labels {
+		pe.Labels = append(pe.Labels, &Label{
+			Name:    label.Name,
+			Content: label.Content,
+			Type:    label.Type,
+		})
+	}
+
+	for _, field := range e.Properties {
+		pf, err := FieldToProto(field)
+		if err != nil {
+			return nil, err
+		}
+		pe.Properties = append(pe.Properties, pf)
+	}
+	sort.Slice(pe.Properties, func(i, j int) bool {
+		return pe.Properties[i].Name < pe.Properties[j].Name
+	})
+
+	return pe, nil
+}
+
+// EntityFromProto - Convert a Protobuf Entity into a maltego.Entity.
+// The returned Entity is never backed by any native Go type: use its
+// Unmarshal() method if you want to populate one from its properties.
+func EntityFromProto(pe *Entity) maltego.Entity {
+	fqType := strings.Trim(strings.Join([]string{pe.GetNamespace(), pe.GetType()}, "."), ".")
+	e := maltego.NewForeignEntity(fqType, pe.GetValue())
+
+	if pe.GetDisplayName() != "" {
+		e.DisplayName = pe.GetDisplayName()
+	}
+	e.Weight = int(pe.GetWeight())
+	e.IconURL = pe.GetIconUrl()
+	e.Bookmark = maltego.BookmarkColor(pe.GetBookmark())
+	e.Link = LinkFromProto(pe.GetLink())
+
+	for _, field := range pe.GetProperties() {
+		e.AddProperty(FieldFromProto(field))
+	}
+	for _, label := range pe.GetLabels() {
+		e.Labels = append(e.Labels, maltego.Label{
+			Name:    label.GetName(),
+			Content: label.GetContent(),
+			Type:    label.GetType(),
+		})
+	}
+
+	// Overlays are set as is: they are validated when the Entity is marshalled.
+	for _, overlay := range pe.GetOverlays() {
+		e.Overlays[maltego.OverlayPosition(overlay.GetPosition())] = maltego.Overlay{
+			PropertyName: overlay.GetPropertyName(),
+			Position:     maltego.OverlayPosition(overlay.GetPosition()),
+			Type:         maltego.OverlayType(overlay.GetType()),
+		}
+	}
+
+	return e
+}
+
+// LinkToProto - Convert a maltego.Link into its Protobuf equivalent.
+func LinkToProto(l maltego.Link) (*Link, error) {
+	pl := &Link{
+		Label:     l.Label,
+		Style:     int32(l.Style),
+		Thickness: int32(l.Thickness),
+		ShowLabel: int32(l.ShowLabel),
+		Color:     l.Color,
+		Direction: string(l.Direction),
+	}
+	for _, field := range l.Fields() {
+		pf, err := FieldToProto(field)
+		if err != nil {
+			return nil, err
+		}
+		pl.Properties = append(pl.Properties, pf)
+	}
+
+	return pl, nil
+}
+
+// LinkFromProto - Convert a Protobuf Link into a maltego.Link.
+func LinkFromProto(pl *Link) maltego.Link {
+	l := maltego.Link{
+		Label:     pl.GetLabel(),
+		Style:     maltego.LinkStyle(pl.GetStyle()),
+		Thickness: maltego.LineThickness(pl.GetThickness()),
+		ShowLabel: maltego.LinkShowLabel(pl.GetShowLabel()),
+		Color:     pl.GetColor(),
+		Direction: maltego.LinkDirection(pl.GetDirection()),
+	}
+	for _, field := range pl.GetProperties() {
+		l.AddField(FieldFromProto(field))
+	}
+
+	return l
+}
+
+// FieldToProto - Convert a maltego.Field into its Protobuf equivalent. The value of
+// the field is converted to its string representation in Transform responses.
+func FieldToProto(f maltego.Field) (*Field, error) {
+	pf := &Field{
+		Name:         f.Name,
+		Display:      f.Display,
+		MatchingRule: string(f.MatchingRule),
+		Alias:        f.Alias,
+		Hidden:       f.Hidden,
+		ReadOnly:     f.ReadOnly,
+	}
+	value, err := f.ValueString()
+	if err != nil {
+		return nil, err
+	}
+	pf.Value = value
+
+	return pf, nil
+}
+
+// FieldFromProto - Convert a Protobuf Field into a maltego.Field.
+func FieldFromProto(pf *Field) maltego.Field {
+	return maltego.Field{
+		Name:         pf.GetName(),
+		Display:      pf.GetDisplay(),
+		MatchingRule: maltego.MatchingRule(pf.GetMatchingRule()),
+		Alias:        pf.GetAlias(),
+		Hidden:       pf.GetHidden(),
+		ReadOnly:     pf.GetReadOnly(),
+		Value:        pf.GetValue(),
+	}
+}
@@ -0,0 +1,141 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: gondor.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// TransformServiceClient is the client API for TransformService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TransformServiceClient interface {
+	ListTransforms(ctx context.Context, in *ListTransformsRequest, opts ...grpc.CallOption) (*ListTransformsResponse, error)
+	RunTransform(ctx context.Context, in *RunTransformRequest, opts ...grpc.CallOption) (*RunTransformResponse, error)
+}
+
+type transformServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTransformServiceClient(cc grpc.ClientConnInterface) TransformServiceClient {
+	return &transformServiceClient{cc}
+}
+
+func (c *transformServiceClient) ListTransforms(ctx context.Context, in *ListTransformsRequest, opts ...grpc.CallOption) (*ListTransformsResponse, error) {
+	out := new(ListTransformsResponse)
+	err := c.cc.Invoke(ctx, "/gondor.v1.TransformService/ListTransforms", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transformServiceClient) RunTransform(ctx context.Context, in *RunTransformRequest, opts ...grpc.CallOption) (*RunTransformResponse, error) {
+	out := new(RunTransformResponse)
+	err := c.cc.Invoke(ctx, "/gondor.v1.TransformService/RunTransform", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TransformServiceServer is the server API for TransformService service.
+// All implementations must embed UnimplementedTransformServiceServer
+// for forward compatibility
+type TransformServiceServer interface {
+	ListTransforms(context.Context, *ListTransformsRequest) (*ListTransformsResponse, error)
+	RunTransform(context.Context, *RunTransformRequest) (*RunTransformResponse, error)
+	mustEmbedUnimplementedTransformServiceServer()
+}
+
+// UnimplementedTransformServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedTransformServiceServer struct {
+}
+
+func (UnimplementedTransformServiceServer) ListTransforms(context.Context, *ListTransformsRequest) (*ListTransformsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransforms not implemented")
+}
+func (UnimplementedTransformServiceServer) RunTransform(context.Context, *RunTransformRequest) (*RunTransformResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunTransform not implemented")
+}
+func (UnimplementedTransformServiceServer) mustEmbedUnimplementedTransformServiceServer() {}
+
+// UnsafeTransformServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TransformServiceServer will
+// result in compilation errors.
+type UnsafeTransformServiceServer interface {
+	mustEmbedUnimplementedTransformServiceServer()
+}
+
+func RegisterTransformServiceServer(s grpc.ServiceRegistrar, srv TransformServiceServer) {
+	s.RegisterService(&TransformService_ServiceDesc, srv)
+}
+
+func _TransformService_ListTransforms_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransformsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransformServiceServer).ListTransforms(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gondor.v1.TransformService/ListTransforms",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransformServiceServer).ListTransforms(ctx, req.(*ListTransformsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransformService_RunTransform_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunTransformRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransformServiceServer).RunTransform(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gondor.v1.TransformService/RunTransform",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransformServiceServer).RunTransform(ctx, req.(*RunTransformRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TransformService_ServiceDesc is the grpc.ServiceDesc for TransformService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TransformService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gondor.v1.TransformService",
+	HandlerType: (*TransformServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTransforms",
+			Handler:    _TransformService_ListTransforms_Handler,
+		},
+		{
+			MethodName: "RunTransform",
+			Handler:    _TransformService_RunTransform_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "gondor.proto",
+}
@@ -0,0 +1,159 @@
+package rpc
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// Service - Implements the gRPC TransformService on top of a maltego.TransformServer,
+// so that internal services that are not Maltego clients can reuse the very same
+// Transform implementations programmatically.
+type Service struct {
+	UnimplementedTransformServiceServer
+	server *maltego.TransformServer
+}
+
+// NewService - Create a new gRPC TransformService serving
+// all the Transforms registered on the Transform server.
+func NewService(server *maltego.TransformServer) *Service {
+	return &Service{server: server}
+}
+
+// Register - Create a TransformService for the Transform
+// server and register it onto the gRPC server.
+func Register(gs *grpc.Server, server *maltego.TransformServer) {
+	RegisterTransformServiceServer(gs, NewService(server))
+}
+
+// ListTransforms - Returns the information of all Transforms registered on the server.
+func (s *Service) ListTransforms(ctx context.Context, req *ListTransformsRequest) (*ListTransformsResponse, error) {
+	res := &ListTransformsResponse{}
+
+	for path, t := range s.server.RegisteredTransforms() {
+		res.Transforms = append(res.Transforms, &TransformInfo{
+			Path:        path,
+			Name:        t.Name,
+			DisplayName: t.DisplayName,
+			Description: t.Description,
+			Author:      t.Author,
+			Version:     t.Version,
+		})
+	}
+
+	// Map iteration is random, give a stable output.
+	sort.Slice(res.Transforms, func(i, j int) bool {
+		return res.Transforms[i].Path < res.Transforms[j].Path
+	})
+
+	return res, nil
+}
+
+// RunTransform - Run a Transform registered on the server, with the input Entity and settings of the request.
+func (s *Service) RunTransform(ctx context.Context, req *RunTransformRequest) (*RunTransformResponse, error) {
+	if req.GetEntity() == nil {
+		return nil, status.Error(codes.InvalidArgument, "No input Entity in request")
+	}
+
+	// Build the equivalent of a Maltego request
+	input := EntityFromProto(req.GetEntity())
+	request := maltego.Message{
+		Value:  input.Value,
+		Type:   strings.Trim(strings.Join([]string{input.Namespace, input.Type}, "."), "."),
+		Weight: input.Weight,
+		Slider: int(req.GetSlider()),
+		Entity: input,
+	}
+	for name, value := range req.GetSettings() {
+		request.Settings = append(request.Settings, maltego.TransformSetting{
+			Name:    name,
+			Default: value,
+		})
+	}
+
+	// The Transform is canceled along with the call (client cancel or deadline).
+	instance, err := s.server.RunContext(ctx, req.GetPath(), request)
+	switch {
+	case errors.Is(err, maltego.ErrUnknownTenant):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, maltego.ErrServerClosing):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, maltego.ErrTransformNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if runErr := instance.Err(); runErr != nil {
+		return nil, status.Error(runErrorCode(runErr), runErr.Error())
+	}
+
+	// And package all the output
+	res := &RunTransformResponse{}
+	for _, entity := range instance.Entities() {
+		pe, err := EntityToProto(entity)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		res.Entities = append(res.Entities, pe)
+	}
+	for _, msg := range instance.Messages() {
+		res.Messages = append(res.Messages, &UIMessage{Type: msg.Type, Text: msg.Text})
+	}
+	for _, exception := range instance.Exceptions() {
+		res.Exceptions = append(res.Exceptions, string(exception))
+	}
+
+	return res, nil
+}
+
+// runErrorCode - Returns the gRPC code of the error of a rejected or failed run.
+func runErrorCode(err error) codes.Code {
+	var user *maltego.UserError
+	var config *maltego.ConfigError
+	var upstream *maltego.UpstreamError
+	switch {
+	case errors.Is(err, maltego.ErrRateLimited):
+		return codes.ResourceExhausted
+	case errors.Is(err, maltego.ErrNotAllowed):
+		return codes.PermissionDenied
+	case errors.Is(err, maltego.ErrTransformDisabled):
+		return codes.Unavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.As(err, &user):
+		return codes.InvalidArgument
+	case errors.As(err, &config):
+		return codes.FailedPrecondition
+	case errors.As(err, &upstream):
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
@@ -0,0 +1,97 @@
+package rpc
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/maxlandon/gondor/maltego"
+)
+
+// newTestService - Returns a service for a server with a tenant limited to one
+// request per hour, and Transforms succeeding, failing and disabled.
+func newTestService() *Service {
+	server := maltego.NewTransformServer(nil)
+	transforms := map[string]maltego.TransformFunc{
+		"Resolve": func(t *maltego.Transform) error {
+			entity := maltego.NewForeignEntity("maltego.IPv4Address", "192.0.2.1")
+			entity.AddProperty(maltego.Field{Name: "names", Value: []string{"a.example.com", "b.example.com"}})
+			return t.AddEntity(entity)
+		},
+		"Invalid":  func(t *maltego.Transform) error { return maltego.UserErrorf("Not a domain") },
+		"Disabled": func(t *maltego.Transform) error { return nil },
+		"Private":  func(t *maltego.Transform) error { return nil },
+	}
+	for name, run := range transforms {
+		transform := maltego.NewTransform(name, run)
+		server.RegisterTransform(&transform)
+	}
+	server.DisableTransform("Disabled")
+	server.AddTenant(&maltego.Tenant{
+		Name:       "acme",
+		APIKeys:    []string{"acme-key"},
+		Transforms: []string{"Resolve", "Invalid", "Disabled"},
+		RateLimit:  1.0 / 3600,
+		Burst:      3,
+	})
+	return NewService(server)
+}
+
+func TestRunTransformCodes(t *testing.T) {
+	service := newTestService()
+	run := func(path, key string) (*RunTransformResponse, error) {
+		return service.RunTransform(context.Background(), &RunTransformRequest{
+			Path:     path,
+			Entity:   &Entity{Namespace: "maltego", Type: "Domain", Value: "example.com"},
+			Settings: map[string]string{maltego.TenantKeySetting: key},
+		})
+	}
+
+	tests := []struct {
+		path, key string
+		code      codes.Code
+	}{
+		{"/Resolve", "other-key", codes.Unauthenticated},
+		{"/Unknown", "acme-key", codes.NotFound},
+		{"/Private", "acme-key", codes.PermissionDenied},
+		{"/Invalid", "acme-key", codes.InvalidArgument},
+		{"/Disabled", "acme-key", codes.Unavailable},
+		{"/Resolve", "acme-key", codes.OK},
+		{"/Resolve", "acme-key", codes.ResourceExhausted}, // The burst of 3 requests is consumed.
+	}
+	for _, test := range tests {
+		res, err := run(test.path, test.key)
+		if code := status.Code(err); code != test.code {
+			t.Errorf("%s with key %s: got code %s, want %s (%v)", test.path, test.key, code, test.code, err)
+		}
+		if err != nil {
+			continue
+		}
+		if len(res.Entities) != 1 || len(res.Entities[0].Properties) != 1 {
+			t.Fatalf("Unexpected response %v", res)
+		}
+		if value := res.Entities[0].Properties[0].Value; value != "a.example.com,b.example.com" {
+			t.Errorf("List property sent as %q", value)
+		}
+	}
+}
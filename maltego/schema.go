@@ -0,0 +1,211 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
+)
+
+//
+// Entity Schemas - Runtime Entity Definitions ---------------------------------------------------
+//
+// Entity types can be defined at runtime from schema files, instead of Go structs: this is
+// needed for plugins, or for generating Entities from external data dictionaries. Schemas are
+// JSON documents holding either one Entity schema or a list of them:
+//
+//	[{
+//	    "name": "Vessel", "namespace": "acme.maritime", "icon": "Ship", "base": "maltego.Phrase",
+//	    "fields": [
+//	        {"name": "imo", "display": "IMO Number", "type": "int", "strict": true, "group": "Registry"},
+//	        {"name": "flag", "display": "Flag State", "sample": "Panama"}
+//	    ]
+//	}]
+//
+// YAML schemas are supported by passing the Unmarshal function of any YAML package (eg.
+// gopkg.in/yaml.v3) to ParseEntitySchemas(), since schemas have yaml tags as well.
+
+// EntitySchema - The definition of an Entity type, without any Go struct.
+type EntitySchema struct {
+	Name        string        `json:"name" yaml:"name"`                                   // The type name, required (eg. "Vessel")
+	Namespace   string        `json:"namespace" yaml:"namespace"`                         // The namespace, required (eg. "acme.maritime")
+	DisplayName string        `json:"display,omitempty" yaml:"display,omitempty"`         // Defaults to the name split on its words
+	Description string        `json:"description,omitempty" yaml:"description,omitempty"` // A description of the Entity type
+	Category    string        `json:"category,omitempty" yaml:"category,omitempty"`       // The category of the Entity in the palette
+	Alias       string        `json:"alias,omitempty" yaml:"alias,omitempty"`             // Derived if empty (see Entity.Alias)
+	Icon        string        `json:"icon,omitempty" yaml:"icon,omitempty"`               // A built-in icon name, or an image URL
+	Base        string        `json:"base,omitempty" yaml:"base,omitempty"`               // A fully qualified base type (eg. "maltego.Phrase")
+	Fields      []FieldSchema `json:"fields,omitempty" yaml:"fields,omitempty"`           // The properties of the Entity
+	Locales     Localizations `json:"locales,omitempty" yaml:"locales,omitempty"`         // Translated names, by locale (eg. "fr")
+}
+
+// FieldSchema - The definition of a property of an EntitySchema.
+type FieldSchema struct {
+	Name        string `json:"name" yaml:"name"`                                   // The property name, required
+	Display     string `json:"display,omitempty" yaml:"display,omitempty"`         // Defaults to the name
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"`               // A Maltego property type, defaults to "string"
+	Description string `json:"description,omitempty" yaml:"description,omitempty"` // A description of the property
+	Default     string `json:"default,omitempty" yaml:"default,omitempty"`         // The default value
+	Sample      string `json:"sample,omitempty" yaml:"sample,omitempty"`           // The sample value
+	Strict      bool   `json:"strict,omitempty" yaml:"strict,omitempty"`           // Use the strict matching rule
+	Hidden      bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`           // Hide the property in the Properties window
+	ReadOnly    bool   `json:"readonly,omitempty" yaml:"readonly,omitempty"`       // The user cannot edit the property
+	Validate    string `json:"validate,omitempty" yaml:"validate,omitempty"`       // A regular expression for values
+	Group       string `json:"group,omitempty" yaml:"group,omitempty"`             // The section in the Properties window
+}
+
+// ParseEntitySchemas - Decode one Entity schema, or a list of them, from a schema document.
+// The unmarshal function decodes the document (json.Unmarshal if nil, yaml.Unmarshal, etc).
+func ParseEntitySchemas(data []byte, unmarshal func([]byte, interface{}) error) ([]EntitySchema, error) {
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+
+	var schemas []EntitySchema
+	if err := unmarshal(data, &schemas); err != nil {
+		var schema EntitySchema
+		if errSingle := unmarshal(data, &schema); errSingle != nil || bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			return nil, fmt.Errorf("Error decoding Entity schemas: %s", err)
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, nil
+}
+
+// LoadEntitySchemas - Read and decode the Entity schemas of a file (see ParseEntitySchemas()).
+func LoadEntitySchemas(path string, unmarshal func([]byte, interface{}) error) ([]EntitySchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEntitySchemas(data, unmarshal)
+}
+
+// Entity - Check the schema and return an (empty) Entity of the type it defines,
+// which can be registered to a Distribution, or used as a Transform output.
+func (s EntitySchema) Entity() (e Entity, err error) {
+	if s.Name == "" || s.Namespace == "" {
+		return e, fmt.Errorf("Invalid Entity schema %q: a name and a namespace are required", s.Name)
+	}
+
+	e = NewForeignEntity(strings.Join([]string{s.Namespace, s.Name}, "."), "")
+	e.DisplayName = s.DisplayName
+	if e.DisplayName == "" {
+		e.DisplayName = getDisplayName(s.Name)
+	}
+	e.Description = s.Description
+	e.Category = s.Category
+	e.Alias = s.Alias
+	e.IconURL = s.Icon
+	if s.Base != "" {
+		base := NewForeignEntity(s.Base, "")
+		e.SetBase(base)
+	}
+
+	for _, fs := range s.Fields {
+		field, err := fs.field()
+		if err != nil {
+			return e, fmt.Errorf("Invalid Entity schema %s: %s", s.Name, err)
+		}
+		e.AddProperty(field)
+	}
+
+	for locale, localized := range s.Locales {
+		e.Localize(locale, localized)
+	}
+
+	return e, e.checkAliases()
+}
+
+// field - Check the property schema and return the corresponding Field.
+func (fs FieldSchema) field() (f Field, err error) {
+	if fs.Name == "" {
+		return f, fmt.Errorf("property without a name")
+	}
+
+	f = Field{
+		Name:         fs.Name,
+		Display:      fs.Display,
+		MatchingRule: MatchLoose,
+		Hidden:       fs.Hidden,
+		ReadOnly:     fs.ReadOnly,
+		Description:  fs.Description,
+		Type:         configuration.PropertyType(fs.Type),
+		Validate:     fs.Validate,
+		Group:        fs.Group,
+		Value:        fs.Default,
+	}
+	if f.Display == "" {
+		f.Display = fs.Name
+	}
+	if fs.Strict {
+		f.MatchingRule = MatchStrict
+	}
+	if fs.Default != "" {
+		f.DefaultValue = fs.Default
+	}
+	if fs.Sample != "" {
+		f.SampleValue = fs.Sample
+	}
+
+	switch f.Type {
+	case "":
+		f.Type = configuration.PropertyTypeString
+	case configuration.PropertyTypeString, configuration.PropertyTypeBoolean, configuration.PropertyTypeInteger,
+		configuration.PropertyTypeLong, configuration.PropertyTypeFloat, configuration.PropertyTypeDate,
+		configuration.PropertyTypeDateTime, configuration.PropertyTypeStringArray, configuration.PropertyTypeIntArray:
+	default:
+		return f, fmt.Errorf("property %s: invalid type %q", fs.Name, fs.Type)
+	}
+	if fs.Validate != "" {
+		if _, err = regexp.Compile(fs.Validate); err != nil {
+			return f, fmt.Errorf("property %s: invalid validate pattern: %s", fs.Name, err)
+		}
+	}
+
+	return f, nil
+}
+
+// RegisterSchemas - Define Entity types from their schemas, and register them to the
+// distribution (see RegisterEntity()). Schemas are all checked before any is registered.
+func (d *Distribution) RegisterSchemas(schemas ...EntitySchema) error {
+	entities := make([]Entity, 0, len(schemas))
+	for _, schema := range schemas {
+		entity, err := schema.Entity()
+		if err != nil {
+			return err
+		}
+		entities = append(entities, entity)
+	}
+
+	for _, entity := range entities {
+		if err := d.RegisterEntity(entity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
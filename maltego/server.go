@@ -19,29 +19,82 @@ package maltego
 */
 
 import (
+	"context"
+	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// DefaultPort - The port on which Transform servers listen, when not configured otherwise.
+const DefaultPort = 8080
+
 // TransformServer - A server holding all its registered Transforms,
 // serving them, either through HTTP or through local invocation.
 type TransformServer struct {
 	// Information
-	Name           string             // Generally you don't need to set the name
-	Description    string             // You can set a description for your Transform Server
-	URL            string             // Set at runtime when the HTTP server starts, or when config output.
-	LastSync       string             // Last time the server whas registered, you don't need to set this.
-	Protocol       string             // You don't need to set the protocol yourself
-	Authentication AuthenticationType // The default authentication is None
-	Enabled        bool               // The transform server is always enabled by default
-	Transforms     Transforms         // All user-registered transforms
-	Distribution                      // The distribution for this server
+	Name            string             // Generally you don't need to set the name
+	Description     string             // You can set a description for your Transform Server
+	URL             string             // Set at runtime when the HTTP server starts, or when config output.
+	ExternalURL     string             // The public URL of the server behind a reverse proxy, if any (see PublicURL()).
+	TrustedProxies  []string           // The IPs or CIDR ranges of proxies whose X-Forwarded-* headers are trusted.
+	LastSync        string             // Last time the server whas registered, you don't need to set this.
+	Protocol        string             // You don't need to set the protocol yourself
+	Authentication  AuthenticationType // The default authentication is None
+	Enabled         bool               // The transform server is always enabled by default
+	Transforms      Transforms         // All user-registered transforms
+	Timeout         time.Duration      // Maximum run duration of a transform, zero meaning no limit.
+	Sessions        SessionStore       // An optional store for the state of investigations (see Transform.Session())
+	Disabled        []string           // Names of the Transforms not to run, can be set from a configuration.
+	PrettyXML       bool               // Indent the XML responses (for debugging), which are compact by default.
+	Weights         *WeightPolicy      // The weight policy of all Transforms not having their own, if any.
+	History         HistoryStore       // An optional store recording all Transform runs (see QueryHistory())
+	Fixtures        string             // If set, the directory of canned responses returned by flagged Transforms.
+	Concurrency     int                // Maximum concurrent runs for requests with several input Entities (default 4).
+	Metrics         Metrics            // An optional sink for the measures of all runs (see NewMetricsRegistry())
+	ServeMetrics    bool               // Serve the Metrics at MetricsPath, for Prometheus to scrape (see PrometheusMetrics).
+	MetricsToken    string             // If set, the bearer token required to scrape the Metrics at MetricsPath.
+	Cache           ResultCache        // An optional cache for the responses of Transforms (see Transform.SetCache())
+	ClientRateLimit RateLimit          // The rate at which each client can run Transforms (see Transform.SetRateLimit())
+	Logger          Logger             // An optional logger, to which all Transform messages are mirrored
+	TrackOrigins    bool               // Record the Transforms producing Entities in them (see Transform.Origins())
+	PathTemplate    string             // The template of the URL paths of Transforms (see TransformPath), if not the default one.
+	StatsToken      string             // If set, the bearer token giving access to the statistics of Transforms at StatsPath.
+	Address         string             // The host or IP address on which the server listens (all interfaces if empty).
+	Port            int                // The port on which the server listens (DefaultPort if zero).
+	Listener        net.Listener       // An optional pre-bound listener, used instead of the Address and Port.
+	TLSConfig       *tls.Config        // The TLS configuration of ListenAndServeTLS(), when it is passed none.
+	ClientCAs       *x509.CertPool     // If set, TLS clients must present a certificate signed by these CAs (see ClientRule).
+	ClientRules     []ClientRule       // If any, the Transforms that TLS clients may run, by certificate identity.
+	AutoTLS         *AutoTLS           // If set, obtain the certificates of ListenAndServeTLS() automatically.
+	OAuthKey        *rsa.PrivateKey    // The key decrypting the OAuth tokens sent by Maltego clients, if encrypted (see SetOAuth()).
+	DrainTimeout    time.Duration      // The maximum time given to running Transforms to finish on Shutdown(), if any.
+	Distribution                       // The distribution for this server
 
 	// Runtime HTTP
-	hs    http.Server
-	mux   *http.ServeMux
-	mutex *sync.RWMutex // Concurrency
+	hs          http.Server
+	mux         *http.ServeMux
+	tenants     []*Tenant             // Customer teams sharing the server, if any
+	processors  []OutputProcessor     // Functions reshaping the output of all transforms
+	middleware  []TransformMiddleware // Layers wrapping the implementation of all transforms
+	settings    []TransformSetting    // Settings inherited by all transforms (see AddSetting())
+	aliases     map[string]string     // Former URL paths of Transforms, mapped to their current one
+	versions    map[string]string     // Unversioned URL paths of Transforms, mapped to their latest version
+	routes      map[string]bool       // URL paths already routed to the Transform handler
+	limiter     *clientLimiter        // The rate limiting buckets of clients
+	attachments *attachmentStore      // Files attached to output Entities, too large to be embedded
+	jobs        *jobStore             // The background runs of asynchronous Transforms, and their results
+	stats       *statsStore           // The runtime statistics of all Transforms
+	challenges  *http.Server          // Answers the HTTP challenges of the AutoTLS certificate authority, if any
+	auth        *httpAuth             // The HTTP credentials required to run Transforms, if any
+	drain       *drainer              // The running Transforms, waited for on Shutdown()
+	mutex       *sync.RWMutex         // Concurrency
 }
 
 // NewTransformServer - Create a new Transform Server instance,
@@ -52,13 +105,37 @@ func NewTransformServer(config interface{}) *TransformServer {
 		Name:        "Local",
 		Description: "Go Local Transforms, hosted on this machine.",
 
-		Transforms: Transforms{},
+		Transforms:   Transforms{},
+		Distribution: NewDistribution(),
 		// config: config,
-		hs:    http.Server{},
-		mux:   http.NewServeMux(),
-		mutex: &sync.RWMutex{},
+		hs:          http.Server{},
+		mux:         http.NewServeMux(),
+		attachments: newAttachmentStore(),
+		jobs:        newJobStore(),
+		stats:       newStatsStore(),
+		drain:       newDrainer(),
+		aliases:     map[string]string{},
+		versions:    map[string]string{},
+		routes:      map[string]bool{},
+		limiter:     newClientLimiter(),
+		mutex:       &sync.RWMutex{},
 	}
 
+	// Serve files attached to output Entities
+	ts.mux.HandleFunc(AttachmentsPath, ts.attachmentHandler)
+
+	// Serve the help pages of all Transforms
+	ts.mux.HandleFunc(HelpPath, ts.helpHandler)
+
+	// Serve the status and results of asynchronous Transforms
+	ts.mux.HandleFunc(JobsPath, ts.jobHandler)
+
+	// Serve the statistics of all Transforms, if enabled
+	ts.mux.HandleFunc(StatsPath, ts.statsHandler)
+
+	// Serve the metrics of all Transforms to Prometheus, if enabled
+	ts.mux.HandleFunc(MetricsPath, ts.metricsHandler)
+
 	// Make a default Maltego Distribution holding us
 	// as its unique Maltego Server.
 
@@ -68,51 +145,344 @@ func NewTransformServer(config interface{}) *TransformServer {
 // RegisterTransform - Once you have declared/instantiated a Transform
 // in your code, you must register it to a Server with this function.
 // The path at which the Transform is available is automatically set
-// from its properties, and this should match any exported Config.
+// from its properties and the server PathTemplate (see Transform.Path()),
+// and this should match any exported Config. Registering a Transform at
+// the path of another one replaces the latter.
 func (ts *TransformServer) RegisterTransform(t *Transform) {
-	ts.mutex.RLock()
-	defer ts.mutex.RUnlock()
+	path, base := ts.transformPath(t)
+	ts.registerTransform(path, base, t)
+}
 
-	// Map the transform to the server
-	ts.Transforms["transform.Namespace"] = t
+// registerTransform - Register a Transform at a path, and point the unversioned
+// base path (if any) to the highest version of the Transform.
+func (ts *TransformServer) registerTransform(path, base string, t *Transform) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
 
-	// And to the HTTP server
-	ts.mux.HandleFunc("transform.Namespace", ts.transformHandler)
+	t.mutex.Lock()
+	t.path = path
+	t.mutex.Unlock()
 
-	return
+	// Map the transform to the server, and to the HTTP server
+	ts.Transforms[path] = t
+	ts.route(path)
+
+	// Keep serving it at its unversioned and former paths
+	ts.registerVersion(path, base, t)
+	ts.registerAliases(path, t)
+
+	// And to the distribution, with the settings it inherits from us.
+	registered := *t
+	registered.Settings = inheritSettings(t.Settings, ts.settings)
+	ts.Distribution.RegisterTransform(registered)
+
+	// Asynchronous Transforms need another one to fetch their results.
+	if t.async {
+		ts.registerJobResults()
+	}
+}
+
+// route - Route a Transform URL path to the Transform handler, once.
+func (ts *TransformServer) route(path string) {
+	if !ts.routes[path] {
+		ts.mux.HandleFunc(path, ts.transformHandler)
+		ts.routes[path] = true
+	}
 }
 
 // ListenAndServe - The Transform Server starts serving its content, pulling from the current
-// state of its configuration: target address, TLS configuration, transforms settings, etc.
+// state of its configuration: listener or bind address and port, transforms settings, etc.
+// It blocks until the server fails or is shut down (see Shutdown()), and always returns a
+// non-nil error: http.ErrServerClosed after Shutdown(), or the error that stopped it.
 func (ts *TransformServer) ListenAndServe() (err error) {
-
-	// Bind the mux handler to the server
-	ts.hs.Handler = ts.mux
-
-	return
+	listener, err := ts.listen("")
+	if err != nil {
+		return err
+	}
+	return ts.serve(listener, "http", nil)
 }
 
 // ListenAndServeTLS - The Transform Server starts serving its content, with an optional TLS
-// configuration passed as argument. If nil, will default on its present configuration state.
+// configuration passed as argument. If nil, will default on its present configuration state
+// (the TLSConfig field), which must hold the server certificates, or on its AutoTLS, which
+// obtains them automatically. If the server has ClientCAs, clients must present a certificate
+// signed by one of them (mutual TLS). The server listens on addr ("host:port") if not empty,
+// or as ListenAndServe() does otherwise, and blocks likewise.
 func (ts *TransformServer) ListenAndServeTLS(addr string, tlsConfig *tls.Config) (err error) {
+	if tlsConfig == nil {
+		tlsConfig = ts.TLSConfig
+	}
+	if tlsConfig == nil && ts.AutoTLS != nil {
+		if tlsConfig, err = ts.autoTLSConfig(); err != nil {
+			return err
+		}
+	}
+	if tlsConfig == nil || (len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil && tlsConfig.GetConfigForClient == nil) {
+		return errors.New("No TLS certificates configured for the Transform server")
+	}
+	listener, err := ts.listen(addr)
+	if err != nil {
+		return err
+	}
+	return ts.serve(listener, "https", ts.withClientAuth(tlsConfig))
+}
+
+// listen - Returns the pre-bound Listener of the server, if any, or a new listener
+// on addr, if not empty, or on the server Address and Port otherwise.
+func (ts *TransformServer) listen(addr string) (net.Listener, error) {
+	if ts.Listener != nil && addr == "" {
+		return ts.Listener, nil
+	}
+	if addr == "" {
+		port := ts.Port
+		if port == 0 {
+			port = DefaultPort
+		}
+		addr = net.JoinHostPort(ts.Address, strconv.Itoa(port))
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on %s: %s", addr, err)
+	}
+	return listener, nil
+}
+
+// serve - Serve the Transforms on a listener, over TLS if a configuration is given.
+// The URL and protocol of the server are set from the listener, if not known yet.
+func (ts *TransformServer) serve(listener net.Listener, scheme string, tlsConfig *tls.Config) error {
+	ts.mutex.Lock()
+	ts.Protocol = scheme
+	if ts.URL == "" {
+		ts.URL = listenerURL(listener, scheme)
+	}
+	ts.mutex.Unlock()
 
-	// Bind the mux handler to the server
-	ts.hs.Handler = ts.mux
+	// Bind the mux handler to the server, behind any reverse proxy.
+	ts.hs.Handler = ts.proxyHandler(ts.mux)
 
+	// Transforms without a HelpURL point to their generated help page.
+	ts.setHelpURLs()
+
+	if tlsConfig != nil {
+		ts.hs.TLSConfig = tlsConfig
+		return ts.hs.ServeTLS(listener, "", "")
+	}
+	return ts.hs.Serve(listener)
+}
+
+// listenerURL - Returns the base URL of a server listening on a listener: servers
+// listening on all interfaces are reached on localhost, for local clients.
+func listenerURL(listener net.Listener, scheme string) string {
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return scheme + "://" + listener.Addr().String()
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// Run - Run the Transform registered at path with a request built outside of any HTTP
+// context (eg. from an RPC service or a local invocation). The returned instance gives
+// access to the output Entities, UI messages and exceptions produced by the run: the
+// error is only non-nil when no Transform is registered at this path, or when the
+// server has tenants and that the request does not belong to any of them.
+func (ts *TransformServer) Run(path string, request Message) (instance *Transform, err error) {
+	instance, _, err = ts.runRequest(context.Background(), path, "", nil, request)
 	return
 }
 
-// GetTransform - Find the Transform corresponding to an HTTP URL path.
-func (ts *TransformServer) GetTransform(path string) *Transform {
+// RunContext - Works exactly like Run(), but the Transform runs with a context
+// derived from the given one (see Transform.Context()), for cancellation.
+func (ts *TransformServer) RunContext(ctx context.Context, path string, request Message) (instance *Transform, err error) {
+	instance, _, err = ts.runRequest(ctx, path, "", nil, request)
+	return
+}
+
+// RunAs - Works exactly like Run(), but on behalf of a principal authenticated
+// by the caller (eg. an RPC service), which the Transform can access.
+func (ts *TransformServer) RunAs(path string, principal *Principal, request Message) (instance *Transform, err error) {
+	instance, _, err = ts.runRequest(context.Background(), path, "", principal, request)
+	return
+}
+
+// AddProcessor - Register a function reshaping the output Entities of all the Transforms
+// of the server, after they have run successfully (see OutputProcessor). Processors run
+// in the order they have been added, after those registered on the Transform itself.
+func (ts *TransformServer) AddProcessor(p OutputProcessor) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.processors = append(ts.processors, p)
+}
+
+// DisableTransform - Stop running the Transform registered with this name, without
+// unregistering it: until it is enabled again, all requests for this Transform are
+// answered with an exception explaining that it is temporarily disabled. This is useful
+// to shed load, or to pull a misbehaving Transform out of service without redeploying.
+// Transforms can also be disabled from the start, by listing them in the Disabled field.
+func (ts *TransformServer) DisableTransform(name string) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	var found bool
+	for _, transform := range ts.Transforms {
+		if transform.Name == name {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("No Transform registered with name %s", name)
+	}
+	for _, disabled := range ts.Disabled {
+		if disabled == name {
+			return nil
+		}
+	}
+	ts.Disabled = append(ts.Disabled, name)
+
+	return nil
+}
+
+// EnableTransform - Run again a Transform previously disabled with DisableTransform().
+func (ts *TransformServer) EnableTransform(name string) {
 	ts.mutex.Lock()
 	defer ts.mutex.Unlock()
-	return ts.Transforms[path]
+
+	var enabled []string
+	for _, disabled := range ts.Disabled {
+		if disabled != name {
+			enabled = append(enabled, disabled)
+		}
+	}
+	ts.Disabled = enabled
+}
+
+// IsTransformDisabled - Whether the Transform registered with this name is disabled.
+func (ts *TransformServer) IsTransformDisabled(name string) bool {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	for _, disabled := range ts.Disabled {
+		if disabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTransform - Find the Transform corresponding to an HTTP URL path, or to one of its aliases.
+func (ts *TransformServer) GetTransform(path string) *Transform {
+	t, _ := ts.resolveTransform(path)
+	return t
+}
+
+// RegisteredTransforms - Returns a copy of the Transforms registered on the server, by URL
+// path, which can be iterated safely while other Transforms are being registered.
+func (ts *TransformServer) RegisteredTransforms() Transforms {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	transforms := make(Transforms, len(ts.Transforms))
+	for path, t := range ts.Transforms {
+		transforms[path] = t
+	}
+	return transforms
 }
 
 //
 // Maltego Transform Server - Internal Implementation ------------------------------------------
 //
 
+// runRequest - Find the tenant (if any) and the Transform of a request, create a new instance
+// of the latter and run it, unless it is disabled or that the tenant cannot run it (anymore).
+// The error is only non-nil when no tenant or Transform matches: the outcome of the run is
+// returned as runErr, to be passed to the instance when marshalling its output.
+// The principal, if any, is the identity established by the request authentication,
+// and the context is the one of the request, from which the one of the run derives.
+func (ts *TransformServer) runRequest(ctx context.Context, path, key string, principal *Principal, request Message) (instance *Transform, runErr, err error) {
+	ctx, done, ok := ts.drain.start(ctx)
+	if !ok {
+		return nil, nil, ErrServerClosing
+	}
+	defer done()
+
+	tenant, path, err := ts.findTenant(path, key, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	transform, aliased := ts.resolveTransform(path)
+	if transform == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrTransformNotFound, path)
+	}
+
+	// Create a new Transform instance based on the model.
+	instance = transform.newInstanceFromRequest(request, ts)
+	instance.tenant = tenant
+	instance.principal = tenantPrincipal(principal, tenant)
+	instance.requestID = requestID(ctx)
+	instance.warnDeprecated(path, aliased)
+	inputErr := instance.checkInputs()
+
+	switch {
+	case tenant != nil && !tenant.CanRun(transform.Name):
+		runErr = instance.reject(ErrNotAllowed, "Transform %s is not available to tenant %s", transform.Name, tenant.Name)
+	case !ts.clientAllowed(instance.principal, transform.Name):
+		runErr = instance.reject(ErrNotAllowed, "Transform %s is not available to client %s", transform.Name, instance.principal.ID)
+	case tenant != nil && !tenant.allow():
+		runErr = instance.reject(ErrRateLimited, "Rate limit exceeded for tenant %s, please retry later", tenant.Name)
+	case ts.IsTransformDisabled(transform.Name):
+		runErr = instance.disabled()
+	case inputErr != nil:
+		runErr = instance.reject(&UserError{Err: inputErr}, "%s", inputErr)
+	case ts.rateLimited(ctx, instance):
+		runErr = ErrRateLimited
+	// Responses found in the cache are sent as is, without running the Transform.
+	case instance.setCached(ts.cachedResponse(ctx, instance)):
+		return instance, nil, nil
+	// Asynchronous Transforms answer with a Job Entity, and run in the background.
+	case instance.async:
+		runErr = ts.startJob(transform, instance, request)
+		instance.setErr(runErr)
+		return instance, runErr, nil
+	default:
+		runErr = ts.runInstance(ctx, transform, instance)
+		return instance, runErr, nil
+	}
+
+	if tenant != nil {
+		tenant.account(transform.Name, instance, true, false, 0)
+	}
+	ts.observeMetrics(instance, runErr, true, 0)
+	instance.setErr(runErr)
+	return instance, runErr, nil
+}
+
+// runInstance - Run an instance of a Transform, process its output Entities,
+// and account for the run (tenant quotas, metrics and history).
+func (ts *TransformServer) runInstance(ctx context.Context, transform, instance *Transform) (runErr error) {
+	var cancel context.CancelFunc
+	instance.ctx, cancel = instance.newContext(ctx)
+	defer cancel()
+	ts.mutex.RLock()
+	processors := append(append([]OutputProcessor{}, instance.processors...), ts.processors...)
+	ts.mutex.RUnlock()
+	instance.attachStream(ctx, processors)
+	instance.traceStart(len(processors))
+	start := time.Now()
+	if runErr = instance.executeInputs(transform, ts); runErr == nil {
+		instance.process(processors)
+		instance.validateOutput()
+		instance.warnDropped()
+	}
+	instance.traceEnd(runErr, time.Since(start))
+	if instance.tenant != nil {
+		instance.tenant.account(transform.Name, instance, false, runErr != nil, time.Since(start))
+	}
+	ts.observeMetrics(instance, runErr, false, time.Since(start))
+	ts.recordHistory(instance, start, runErr)
+	instance.setErr(runErr)
+	return runErr
+}
+
 // TransformServer - A transform server outputs a complete Maltego
 // configuration file (.mtz) with transforms, sets, entities, settings, etc...
 func (ts *TransformServer) marshalConfig() (data []byte, err error) {
@@ -0,0 +1,214 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SessionSetting - The name of the transform field through which a Maltego client
+// identifies the graph/investigation a request belongs to. When present and when the
+// server has a SessionStore, transforms can keep state across invocations with t.Session().
+const SessionSetting = "gondor.session"
+
+// ErrNoSession - Returned by all Session methods when the request
+// has no session identifier, or when the server has no SessionStore.
+var ErrNoSession = errors.New("No session for this Transform request")
+
+// SessionStore - A backend storing the state of investigations, as raw values keyed by
+// session (graph) and by name. Implementations must be safe for concurrent use, since
+// several transforms of the same graph generally run at the same time. The package
+// provides an in-memory store and a directory-based one, but any database can be used.
+type SessionStore interface {
+	Get(session, key string) (value []byte, found bool, err error)
+	Set(session, key string, value []byte) error
+	Delete(session, key string) error
+}
+
+// Session - The state of an investigation, shared by all transforms run on the same
+// Maltego graph: pagination cursors, sets of entities already returned, etc. Values
+// are stored as JSON, so any Go type that can be (un)marshalled to it can be used.
+type Session struct {
+	ID    string // The identifier of the session, as sent by the client.
+	store SessionStore
+}
+
+// Get - Unmarshal the value stored under key into value (a pointer),
+// and return whether the key was found in the session.
+func (s *Session) Get(key string, value interface{}) (found bool, err error) {
+	if s == nil {
+		return false, ErrNoSession
+	}
+	data, found, err := s.store.Get(s.ID, key)
+	if err != nil || !found {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// Set - Store the value under key, replacing any previous value.
+func (s *Session) Set(key string, value interface{}) error {
+	if s == nil {
+		return ErrNoSession
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(s.ID, key, data)
+}
+
+// Delete - Remove a key from the session, if it exists.
+func (s *Session) Delete(key string) error {
+	if s == nil {
+		return ErrNoSession
+	}
+	return s.store.Delete(s.ID, key)
+}
+
+// newSession - Returns the session of a request, or nil if the request
+// has no session identifier or that there is no store for sessions.
+func newSession(store SessionStore, request Message) *Session {
+	if store == nil {
+		return nil
+	}
+	for _, setting := range request.Settings {
+		if setting.Name == SessionSetting && setting.Default != nil {
+			if id, ok := setting.Default.(string); ok && id != "" {
+				return &Session{ID: id, store: store}
+			}
+		}
+	}
+	return nil
+}
+
+//
+// Session Stores - Builtin Backends ---------------------------------------------------------
+//
+
+// MemorySessionStore - A SessionStore keeping all sessions in memory.
+// All sessions are lost when the server stops.
+type MemorySessionStore struct {
+	sessions map[string]map[string][]byte
+	mutex    *sync.RWMutex
+}
+
+// NewMemorySessionStore - Create a new, empty in-memory SessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: map[string]map[string][]byte{},
+		mutex:    &sync.RWMutex{},
+	}
+}
+
+// Get - Implements SessionStore.
+func (m *MemorySessionStore) Get(session, key string) (value []byte, found bool, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	value, found = m.sessions[session][key]
+	return
+}
+
+// Set - Implements SessionStore.
+func (m *MemorySessionStore) Set(session, key string, value []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.sessions[session] == nil {
+		m.sessions[session] = map[string][]byte{}
+	}
+	m.sessions[session][key] = value
+	return nil
+}
+
+// Delete - Implements SessionStore.
+func (m *MemorySessionStore) Delete(session, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sessions[session], key)
+	if len(m.sessions[session]) == 0 {
+		delete(m.sessions, session)
+	}
+	return nil
+}
+
+// DirSessionStore - A SessionStore persisting sessions on disk, so that they survive
+// server restarts: each session is a directory, in which each key is a file.
+type DirSessionStore struct {
+	Path  string // The root directory of all sessions.
+	mutex *sync.RWMutex
+}
+
+// NewDirSessionStore - Create a SessionStore writing its sessions in path.
+func NewDirSessionStore(path string) (*DirSessionStore, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, err
+	}
+	return &DirSessionStore{Path: path, mutex: &sync.RWMutex{}}, nil
+}
+
+// Get - Implements SessionStore.
+func (d *DirSessionStore) Get(session, key string) (value []byte, found bool, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	value, err = os.ReadFile(d.file(session, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	return value, err == nil, err
+}
+
+// Set - Implements SessionStore.
+func (d *DirSessionStore) Set(session, key string, value []byte) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(d.file(session, key)), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(d.file(session, key), value, 0o600)
+}
+
+// Delete - Implements SessionStore.
+func (d *DirSessionStore) Delete(session, key string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	err := os.Remove(d.file(session, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// file - Returns the path of a key file. Session identifiers and keys
+// are escaped, so that they can never point outside of the store.
+func (d *DirSessionStore) file(session, key string) string {
+	escape := func(name string) string {
+		name = url.PathEscape(name)
+		if strings.HasPrefix(name, ".") {
+			name = "%2E" + name[1:]
+		}
+		return name
+	}
+	return filepath.Join(d.Path, escape(session), escape(key))
+}
@@ -0,0 +1,211 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
+)
+
+// SetSeparator - Separates the names of nested Transform sets, from the outermost one
+// (eg. "Recon / DNS"). Slashes in set names are always read as separators, with or
+// without spaces around them: "Recon/DNS" and "Recon / DNS" are the same set.
+const SetSeparator = " / "
+
+// TransformSet - A set of Transforms, grouping them in the menus of the Maltego client.
+// Transforms join sets with their AddToSet() method, and sets are described by registering
+// them to a server or a distribution, before or after their Transforms: all sets used by
+// the registered Transforms are written in the distribution, described or not.
+//
+// Sets can be nested, by separating their names with slashes (see SetPath()): the Maltego
+// client only knows flat sets, so each parent set is also written in the distribution, with
+// all the Transforms of its nested sets. Sorted by name, the sets of a tree are thus shown
+// next to each other in the client menus: "Recon", "Recon / Certificates", "Recon / DNS".
+type TransformSet struct {
+	Name        string // The name of the set, as passed to Transform.AddToSet()
+	Description string // The description of the set, shown in the Maltego client
+}
+
+// Sets - Returns the names of all the sets to which the Transform belongs.
+func (t *Transform) Sets() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return append([]string{}, t.sets...)
+}
+
+// RegisterTransformSet - Describe a set of Transforms to this distribution. Registering
+// a set with the name of an existing one updates its description, and keeps its Transforms.
+func (d *Distribution) RegisterTransformSet(set TransformSet) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.sets == nil {
+		d.sets = map[string]configuration.TransformSet{}
+	}
+	set.Name = cleanSetName(set.Name)
+	config := d.sets[set.Name]
+	config.Name = set.Name
+	config.Description = set.Description
+	d.sets[set.Name] = config
+}
+
+// RegisterTransformSet - Describe a set of Transforms to the server distribution.
+func (ts *TransformServer) RegisterTransformSet(set TransformSet) {
+	ts.Distribution.RegisterTransformSet(set)
+}
+
+// addToSets - Add a Transform to all its sets, registering the sets not known yet.
+// Must be called with the distribution lock held.
+func (d *Distribution) addToSets(t *Transform) {
+	if d.sets == nil {
+		d.sets = map[string]configuration.TransformSet{}
+	}
+	for _, name := range t.sets {
+		name = cleanSetName(name)
+		config := d.sets[name]
+		config.Name = name
+		if !hasSetMember(config, t.Name) {
+			config.Transforms = append(config.Transforms, configuration.TransformSetMember{Name: t.Name})
+		}
+		d.sets[name] = config
+	}
+}
+
+// hasSetMember - Whether a Transform is already listed in a set.
+func hasSetMember(set configuration.TransformSet, name string) bool {
+	for _, member := range set.Transforms {
+		if member.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPath - Returns the name of a nested Transform set, from the names
+// of its ancestors and its own: SetPath("Recon", "DNS") is "Recon / DNS".
+func SetPath(names ...string) string {
+	return cleanSetName(strings.Join(names, SetSeparator))
+}
+
+// TransformSetNode - A Transform set in the tree of nested sets (see TransformSetTree()).
+type TransformSetNode struct {
+	Name        string              // The full name of the set (eg. "Recon / DNS")
+	Label       string              // The name of the set in its parent (eg. "DNS")
+	Description string              // The description of the set, if it is registered
+	Transforms  []string            // The names of the Transforms directly in this set
+	Children    []*TransformSetNode // The sets nested in this one, sorted by name
+}
+
+// TransformSetTree - Returns the tree of the Transform sets of the distribution: the sets
+// that are not nested in another one, sorted by name. Parent sets that are neither registered
+// nor used by a Transform (eg. "Recon" for "Recon / DNS") are still in the tree.
+func (d *Distribution) TransformSetTree() []*TransformSetNode {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	nodes := map[string]*TransformSetNode{}
+	var node func(name string) *TransformSetNode
+	node = func(name string) *TransformSetNode {
+		if found, ok := nodes[name]; ok {
+			return found
+		}
+		n := &TransformSetNode{Name: name, Label: name}
+		nodes[name] = n
+		if parent, label, nested := splitSetName(name); nested {
+			n.Label = label
+			p := node(parent)
+			p.Children = append(p.Children, n)
+		}
+		return n
+	}
+	for name, set := range d.sets {
+		n := node(name)
+		n.Description = set.Description
+		for _, member := range set.Transforms {
+			n.Transforms = append(n.Transforms, member.Name)
+		}
+	}
+
+	var roots []*TransformSetNode
+	for _, n := range nodes {
+		sort.Strings(n.Transforms)
+		sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+		if !strings.Contains(n.Name, SetSeparator) {
+			roots = append(roots, n)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Name < roots[j].Name })
+	return roots
+}
+
+// nestedSets - Returns the sets to write in the distribution: all sets, including the parents
+// of nested ones, holding their own Transforms followed by those of their nested sets.
+// Must be called with the distribution lock held.
+func (d *Distribution) nestedSets() map[string]configuration.TransformSet {
+	names := make([]string, 0, len(d.sets))
+	for name := range d.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sets := make(map[string]configuration.TransformSet, len(d.sets))
+	for _, name := range names {
+		set := d.sets[name]
+		set.Transforms = append([]configuration.TransformSetMember{}, set.Transforms...)
+		sets[name] = set
+
+		// Add the Transforms of the set to all its ancestors, which sort before it.
+		for parent, _, nested := splitSetName(name); nested; parent, _, nested = splitSetName(parent) {
+			ancestor, found := sets[parent]
+			if !found {
+				ancestor = configuration.TransformSet{Name: parent}
+			}
+			for _, member := range d.sets[name].Transforms {
+				if !hasSetMember(ancestor, member.Name) {
+					ancestor.Transforms = append(ancestor.Transforms, member)
+				}
+			}
+			sets[parent] = ancestor
+		}
+	}
+	return sets
+}
+
+// cleanSetName - Returns the name of a set with a single SetSeparator between the names of
+// nested sets, and without empty names: " Recon/ /DNS " is "Recon / DNS".
+func cleanSetName(name string) string {
+	var names []string
+	for _, part := range strings.Split(name, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			names = append(names, part)
+		}
+	}
+	return strings.Join(names, SetSeparator)
+}
+
+// splitSetName - Returns the name of the parent of a nested set, and the name of the set
+// in its parent. nested is false if the set is not nested in another one.
+func splitSetName(name string) (parent, label string, nested bool) {
+	i := strings.LastIndex(name, SetSeparator)
+	if i < 0 {
+		return "", name, false
+	}
+	return name[:i], name[i+len(SetSeparator):], true
+}
@@ -20,55 +20,254 @@ package maltego
 
 import (
 	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/maxlandon/gondor/maltego/configuration"
 )
 
+// TimeoutSetting - The name of the transform field through which a Maltego client can
+// hint at how long it will wait for the transform response, either as a number of
+// seconds or as a Go duration string ("1m30s"). See Transform.Deadline().
+const TimeoutSetting = "gondor.timeout"
+
 // TransformSetting - An individual Transform Setting, which can be customized
 // by a user in control of a Transform type (through its .Settings field).
+//
+// Popup settings are prompted for by the Maltego client each time the Transform is run
+// (eg. "Number of results"), showing their display name and prefilled with their default
+// value: the value entered by the analyst is read with Setting(), SettingInt(), etc.
 type TransformSetting struct {
 	Name        string
+	Display     string // The name shown to the user (eg. in popups), derived from Name if empty.
 	Description string
-	Default     interface{} // The default value CAN ONLY BE a string, boolean or int
+	Default     interface{}                // The default value CAN ONLY BE a string, boolean or int
+	Type        configuration.PropertyType // The Maltego type of the value, inferred from Default if empty.
 	Optional    bool
 	Popup       bool
+	Auth        bool // Filled by the Maltego client with the OAuth token of the analyst (see SetOAuth()).
+}
+
+// NewPopupSetting - Declare a setting that the Maltego client prompts for when the
+// Transform is run, with the given display name and default value (a string, boolean
+// or int). Add it to a Transform with AddSetting(), or pass it to NewTransform().
+func NewPopupSetting(name, display string, defaultValue interface{}) TransformSetting {
+	return TransformSetting{
+		Name:    name,
+		Display: display,
+		Default: defaultValue,
+		Popup:   true,
+	}
+}
+
+// Setting - Returns the value of a Transform setting (eg. "api.key"), as sent by the client or
+// the TDS along the request. If the request doesn't have it, the tenant value (if any) or the
+// default value of the setting declared with AddSetting() is returned, or an empty string.
+func (t *Transform) Setting(name string) string {
+	return t.settingValue(name)
+}
+
+// SettingBool - Returns the value of a Transform setting as a boolean (see Setting()):
+// "true", "yes", "on" and "1" are true, regardless of their case. Other values are false.
+func (t *Transform) SettingBool(name string) bool {
+	switch strings.ToLower(strings.TrimSpace(t.settingValue(name))) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
+// SettingInt - Returns the value of a Transform setting as an integer (see Setting()).
+// If the value is not a valid integer, the default value of the declared setting is
+// returned instead, if it is one, or zero otherwise.
+func (t *Transform) SettingInt(name string) int {
+	if value, err := strconv.Atoi(strings.TrimSpace(t.settingValue(name))); err == nil {
+		return value
+	}
+	for _, setting := range t.Settings.settings {
+		if setting.Name != name || setting.Default == nil {
+			continue
+		}
+		if value, err := strconv.Atoi(fmt.Sprintf("%v", setting.Default)); err == nil {
+			return value
+		}
+	}
+	return 0
+}
+
+// AddSetting - Declare a setting for all the Transforms of the server: they inherit it as if
+// they had declared it themselves, and it is written in the configuration of the local ones.
+// The settings of a Transform take precedence over those of the server with the same name,
+// and a setting added with the name of an existing one replaces it. The value of a setting
+// is, in order of precedence: the one sent along the request, the tenant default value, the
+// default value declared by the Transform, and the default value declared by the server.
+// Add settings before registering Transforms, so that their configuration includes them.
+func (ts *TransformServer) AddSetting(s TransformSetting) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	for i, setting := range ts.settings {
+		if setting.Name == s.Name {
+			ts.settings[i] = s
+			return
+		}
+	}
+	ts.settings = append(ts.settings, s)
+}
+
+// EffectiveSettings - Returns the settings of the Transform registered at path, merged with
+// those it inherits from the server (see AddSetting()), or nil if there is no such Transform.
+func (ts *TransformServer) EffectiveSettings(path string) []TransformSetting {
+	transform, _ := ts.resolveTransform(path)
+	if transform == nil {
+		return nil
+	}
+	transform.mutex.RLock()
+	settings := transform.Settings
+	transform.mutex.RUnlock()
+
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	return inheritSettings(settings, ts.settings).settings
+}
+
+// EffectiveSettings - Returns all the settings of the running Transform: its own, followed
+// by those it inherits from the server. On a Transform not running, only its own settings
+// are returned: use TransformServer.EffectiveSettings() to include the inherited ones.
+func (t *Transform) EffectiveSettings() []TransformSetting {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return append([]TransformSetting{}, t.Settings.settings...)
+}
+
+// inheritSettings - Returns the settings of a Transform, followed by the server ones that
+// it does not declare itself. The settings of the Transform are copied, not modified.
+func inheritSettings(local TransformSettings, global []TransformSetting) TransformSettings {
+	declared := make(map[string]bool, len(local.settings))
+	settings := append([]TransformSetting{}, local.settings...)
+	for _, setting := range local.settings {
+		declared[setting.Name] = true
+	}
+	for _, setting := range global {
+		if !declared[setting.Name] {
+			settings = append(settings, setting)
+		}
+	}
+	local.settings = settings
+	return local
 }
 
 // CmdLineTransformSetting - Create a new special Transform property
-// for local execution, if the transform is ran locally.
-func (t *Transform) CmdLineTransformSetting(command string, args ...[]string) {
+// for local execution, if the transform is ran locally: the command
+// run by the Maltego client, and its parameters (see SetLocal()).
+func (t *Transform) CmdLineTransformSetting(command string, args ...string) {
 
 	// Add one property for the command
-	// "transform.local.command"
+	t.setSetting(TransformSetting{
+		Name:        configuration.LocalCommand,
+		Display:     "Command line",
+		Description: "The command to execute for this transform",
+		Default:     command,
+	})
 
 	// And another property for the args
-	// "transform.local.parameters"
+	t.setSetting(TransformSetting{
+		Name:        configuration.LocalParameters,
+		Display:     "Command parameters",
+		Description: "The parameters to pass to the transform command",
+		Default:     strings.Join(args, " "),
+		Optional:    true,
+	})
 }
 
 // CmdWorkDirTransformSetting - Specify the working
 // directory to be used when executing the transform locally.
 func (t *Transform) CmdWorkDirTransformSetting(path string) {
+	t.setSetting(TransformSetting{
+		Name:        configuration.LocalWorkDir,
+		Display:     "Working directory",
+		Description: "The working directory used when invoking the executable",
+		Default:     path,
+		Optional:    true,
+	})
 }
 
 // CmdDebugTransformSetting - Add a property for controlling whether the
 // transform is to be ran locally in Debug mode, and the default value.
 func (t *Transform) CmdDebugTransformSetting(isDefault bool) {
+	t.setSetting(debugSetting(isDefault))
+}
 
+// debugSetting - The property controlling whether the Maltego client
+// shows a debug window when running a local Transform.
+func debugSetting(isDefault bool) TransformSetting {
+	return TransformSetting{
+		Name:        configuration.LocalDebug,
+		Display:     "Show debug info",
+		Description: "When this is set, the transform's text output will be printed to the output window",
+		Default:     isDefault,
+	}
+}
+
+// setSetting - Add a setting to the Transform, replacing any setting with the same name.
+func (t *Transform) setSetting(s TransformSetting) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i, setting := range t.Settings.settings {
+		if setting.Name == s.Name {
+			t.Settings.settings[i] = s
+			return
+		}
+	}
+	t.Settings.settings = append(t.Settings.settings, s)
 }
 
 // toTransformProperty - The setting wraps itself into a Transform property,
 // the latter being in charge of XML marshalling/unmarshalling for the config.
 func (t *TransformSetting) toTransformProperty() (tp configuration.TransformProperty) {
+	tp = configuration.TransformProperty{
+		Name:        t.Name,
+		DisplayName: t.Display,
+		Description: t.Description,
+		Nullable:    t.Optional,
+		Popup:       t.Popup,
+		Auth:        t.Auth,
+		Hidden:      t.Auth,
+		Type:        string(t.Type),
+		Visibility:  "public",
+	}
+	if tp.DisplayName == "" {
+		tp.DisplayName = getDisplayName(t.Name)
+	}
 
-	// Don't forget, we don't have a Type field, so we must
-	// use the config.PropertyType string version of the interface
-	// after checking its a good one (string/int/bool)
+	// Without an explicit type, use the config.PropertyType
+	// string version of the default value type (string/int/bool)
+	if tp.Type == "" {
+		switch t.Default.(type) {
+		case bool:
+			tp.Type = string(configuration.PropertyTypeBoolean)
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			tp.Type = string(configuration.PropertyTypeInteger)
+		default:
+			tp.Type = string(configuration.PropertyTypeString)
+		}
+	}
+	if t.Default != nil {
+		tp.DefaultValue = fmt.Sprintf("%v", t.Default)
+		// The popup is prefilled with the sample value.
+		if t.Popup {
+			tp.SampleValue = tp.DefaultValue
+		}
+	}
 
 	return
 }
 
 // TransformSettings - Holds all settings for
 // a Transform, and their local configurations.
+// Transforms are enabled and run with all others by default, see
+// the Transform SetEnabled(), SetRunWithAll() and SetFavorite() methods:
+// like the rest of the configuration, they are only exported for local Transforms.
 type TransformSettings struct {
 	Enabled    bool
 	RunWithAll bool
@@ -81,19 +280,13 @@ type TransformSettings struct {
 // MarshalXML - The Transform Settings implement the xml.Marshaller interface in order to
 // marshal a few of its elements that are not accessible to Transform writers, like Properties.
 func (ts *TransformSettings) MarshalXML(e *xml.Encoder, start xml.StartElement) (err error) {
-	if err = e.EncodeToken(start); err != nil {
-		return
-	}
-
-	// Create a new temporary struct similar to us
-	template := struct {
-		Enabled    bool
-		RunWithAll bool
-		Favorite   bool
-		Accepted   bool `xml:"disclaimerAccepted,attr"`
-		ShowHelp   bool `xml:"showHelp,attr"`
-		Properties []configuration.TransformProperty
-	}{
+	config := ts.toConfig()
+	return config.MarshalXML(e, start)
+}
+
+// toConfig - The settings wrap themselves into their configuration equivalent.
+func (ts *TransformSettings) toConfig() configuration.TransformSettings {
+	config := configuration.TransformSettings{
 		Enabled:    ts.Enabled,
 		RunWithAll: ts.RunWithAll,
 		Favorite:   ts.Favorite,
@@ -103,14 +296,8 @@ func (ts *TransformSettings) MarshalXML(e *xml.Encoder, start xml.StartElement)
 
 	// Add the actual settings as properties
 	for _, setting := range ts.settings {
-		property := setting.toTransformProperty()
-		template.Properties = append(template.Properties, property)
-	}
-
-	// And encore it to XML
-	if err = e.Encode(template); err != nil {
-		return
+		config.Settings = append(config.Settings, setting.toTransformProperty())
 	}
 
-	return e.EncodeToken(start.End())
+	return config
 }
@@ -0,0 +1,159 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrServerClosing - Returned for the requests received once the server is shutting down.
+var ErrServerClosing = errors.New("The Transform server is shutting down")
+
+// Shutdown - Stop the server gracefully, for deployments to roll without dropping the requests
+// of analysts: the server stops accepting requests and closes its listeners, then waits for
+// all running Transforms to finish, including asynchronous ones and those run outside of HTTP.
+// Draining lasts until the context is done, or for the server DrainTimeout if it is shorter:
+// the Transforms still running are then canceled (see Transform.Context()), and the context
+// error is returned. Requests received meanwhile are rejected with ErrServerClosing.
+func (ts *TransformServer) Shutdown(ctx context.Context) error {
+	if ts.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ts.DrainTimeout)
+		defer cancel()
+	}
+	ts.drain.close()
+
+	ts.mutex.RLock()
+	challenges := ts.challenges
+	ts.mutex.RUnlock()
+	if challenges != nil {
+		challenges.Close()
+	}
+
+	if err := ts.hs.Shutdown(ctx); err != nil {
+		ts.drain.cancelAll()
+		return err
+	}
+	return ts.drain.wait(ctx)
+}
+
+// drainer - Keeps track of the running Transforms of a server, for it to wait for them
+// when shutting down, and to cancel them if they do not finish in time.
+type drainer struct {
+	closing bool                       // The server is shutting down, and rejects new runs.
+	runs    map[int]context.CancelFunc // The cancel functions of all running requests.
+	next    int                        // The identifier of the next run.
+	idle    chan struct{}              // Closed when the last run finishes while closing.
+	mutex   *sync.Mutex
+}
+
+// newDrainer - Create a drainer, for a server not running any Transform yet.
+func newDrainer() *drainer {
+	return &drainer{
+		runs:  map[int]context.CancelFunc{},
+		idle:  make(chan struct{}),
+		mutex: &sync.Mutex{},
+	}
+}
+
+// start - Account for a new run, with a context that is canceled if the server stops draining
+// before it finishes. The run must call done once finished. ok is false when closing.
+func (d *drainer) start(ctx context.Context) (runCtx context.Context, done func(), ok bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closing {
+		return ctx, func() {}, false
+	}
+	return d.add(ctx), d.doneFunc(d.next - 1), true
+}
+
+// join - Account for a run started by another one (eg. an asynchronous Transform run in the
+// background), which is accepted even when closing, since the server is still draining.
+func (d *drainer) join(ctx context.Context) (runCtx context.Context, done func()) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.add(ctx), d.doneFunc(d.next - 1)
+}
+
+// add - Register a run, and returns its cancelable context. Must be called with the lock held.
+func (d *drainer) add(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	d.runs[d.next] = cancel
+	d.next++
+	return ctx
+}
+
+// doneFunc - Returns the function unregistering a run, once.
+func (d *drainer) doneFunc(id int) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mutex.Lock()
+			defer d.mutex.Unlock()
+			if cancel, found := d.runs[id]; found {
+				cancel()
+				delete(d.runs, id)
+			}
+			if d.closing && len(d.runs) == 0 {
+				d.closeIdle()
+			}
+		})
+	}
+}
+
+// close - Stop accepting new runs.
+func (d *drainer) close() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.closing = true
+	if len(d.runs) == 0 {
+		d.closeIdle()
+	}
+}
+
+// closeIdle - Signal that no run is left. Must be called with the lock held.
+func (d *drainer) closeIdle() {
+	select {
+	case <-d.idle:
+	default:
+		close(d.idle)
+	}
+}
+
+// wait - Wait for all runs to finish, or cancel them when the context is done.
+func (d *drainer) wait(ctx context.Context) error {
+	select {
+	case <-d.idle:
+		return nil
+	case <-ctx.Done():
+		d.cancelAll()
+		return ctx.Err()
+	}
+}
+
+// cancelAll - Cancel the context of all running Transforms.
+func (d *drainer) cancelAll() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, cancel := range d.runs {
+		cancel()
+	}
+}
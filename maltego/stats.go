@@ -0,0 +1,186 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsPath - The URL path at which the statistics of all Transforms are served as JSON,
+// when the server has a StatsToken. Requests must bear it as an "Authorization: Bearer"
+// header: the statistics are meant for the maintainers of the server, not for analysts.
+const StatsPath = "/admin/stats"
+
+// TransformStats - The runtime statistics of a Transform since the server started, for
+// finding the slow or broken Transforms of a server in production (see Stats()).
+type TransformStats struct {
+	Runs          int           // Runs of the Transform, failed or not.
+	Failures      int           // Runs that returned an error.
+	Rejections    int           // Requests not run (disabled, rate limited, invalid input, etc).
+	Entities      int           // Total number of output Entities.
+	TotalDuration time.Duration // Total duration of all runs.
+	MaxDuration   time.Duration // Duration of the slowest run.
+	LastRun       time.Time     // Time at which the last run ended, if any.
+	LastError     string        // The error of the last failed run, if any.
+	LastFailure   time.Time     // Time at which the last failed run ended, if any.
+}
+
+// AverageDuration - Returns the average duration of the runs of the Transform.
+func (s TransformStats) AverageDuration() time.Duration {
+	if s.Runs == 0 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(s.Runs)
+}
+
+// FailureRate - Returns the fraction (0 to 1) of the runs of the Transform that failed.
+func (s TransformStats) FailureRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Runs)
+}
+
+// Stats - Returns the runtime statistics of all Transforms that were requested since
+// the server started, by Transform name. They are always kept, unlike the Metrics.
+func (ts *TransformServer) Stats() map[string]TransformStats {
+	return ts.stats.snapshot()
+}
+
+// statsStore - The runtime statistics of the Transforms of a server, by name.
+type statsStore struct {
+	transforms map[string]TransformStats
+	mutex      *sync.RWMutex
+}
+
+// newStatsStore - Create an empty statistics store.
+func newStatsStore() *statsStore {
+	return &statsStore{
+		transforms: map[string]TransformStats{},
+		mutex:      &sync.RWMutex{},
+	}
+}
+
+// observe - Account for a Transform run, or rejection.
+func (s *statsStore) observe(name string, entities int, runErr error, rejected bool, duration time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.transforms[name]
+	switch {
+	case rejected:
+		stats.Rejections++
+	default:
+		now := time.Now()
+		stats.Runs++
+		stats.Entities += entities
+		stats.TotalDuration += duration
+		if duration > stats.MaxDuration {
+			stats.MaxDuration = duration
+		}
+		stats.LastRun = now
+		if runErr != nil {
+			stats.Failures++
+			stats.LastError = runErr.Error()
+			stats.LastFailure = now
+		}
+	}
+	s.transforms[name] = stats
+}
+
+// snapshot - Returns a copy of the statistics of all Transforms.
+func (s *statsStore) snapshot() map[string]TransformStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	stats := make(map[string]TransformStats, len(s.transforms))
+	for name, transform := range s.transforms {
+		stats[name] = transform
+	}
+	return stats
+}
+
+// statsHandler - Serve the statistics of all Transforms as a JSON array sorted
+// by name, to the requests bearing the server StatsToken, if it has one.
+func (ts *TransformServer) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if ts.StatsToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !bearerAllowed(w, r, ts.StatsToken) {
+		return
+	}
+
+	stats := ts.Stats()
+	documents := make([]transformStatsDocument, 0, len(stats))
+	for name, transform := range stats {
+		document := transformStatsDocument{
+			Transform:  name,
+			Runs:       transform.Runs,
+			Failures:   transform.Failures,
+			Rejections: transform.Rejections,
+			Entities:   transform.Entities,
+			Average:    transform.AverageDuration().Seconds(),
+			Max:        transform.MaxDuration.Seconds(),
+			LastError:  transform.LastError,
+		}
+		if !transform.LastRun.IsZero() {
+			document.LastRun = &transform.LastRun
+		}
+		if !transform.LastFailure.IsZero() {
+			document.LastFailure = &transform.LastFailure
+		}
+		documents = append(documents, document)
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].Transform < documents[j].Transform })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(documents)
+}
+
+// transformStatsDocument - The JSON document describing the statistics of a Transform.
+type transformStatsDocument struct {
+	Transform   string     `json:"transform"`
+	Runs        int        `json:"runs"`
+	Failures    int        `json:"failures"`
+	Rejections  int        `json:"rejections"`
+	Entities    int        `json:"entities"`
+	Average     float64    `json:"average_seconds"`
+	Max         float64    `json:"max_seconds"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+}
+
+// bearerAllowed - Returns true if the request bears the token as an "Authorization: Bearer"
+// header, or replies with an authentication challenge and returns false.
+func bearerAllowed(w http.ResponseWriter, r *http.Request, token string) bool {
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
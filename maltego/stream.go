@@ -0,0 +1,208 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
+)
+
+// SetStreaming - Stream the output Entities of the Transform to the Maltego client as they are
+// added, by batches of the given size, instead of sending all of them once the run is over: for
+// long Transforms, analysts get the first results quickly. The response is sent with a chunked
+// encoding, flushed after each batch. A batch size of 0 (the default) disables streaming.
+//
+// Output processors and validation apply to each batch when it is sent, rather than to the
+// whole output. If the Transform fails after a batch was sent, its exceptions are sent as
+// error UI messages of the response, which cannot be an exception message anymore. Requests
+// with several input Entities, and runs outside of HTTP (RPC, batches), are not streamed.
+func (t *Transform) SetStreaming(batch int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if batch < 0 {
+		batch = 0
+	}
+	t.streamBatch = batch
+}
+
+// responseStream - Writes the response of a streaming Transform to an HTTP client,
+// one batch of Entities at a time, once the first of them is ready.
+type responseStream struct {
+	w          io.Writer
+	flusher    http.Flusher
+	encoder    *xml.Encoder
+	processors []OutputProcessor // Processors applied to each batch before writing it
+	started    bool              // The response message is open
+	err        error             // The first write error, after which nothing is written
+	mutex      *sync.Mutex
+}
+
+// streamKey - The context key of the response stream of an HTTP request.
+type streamKey struct{}
+
+// withResponseStream - Returns a context carrying a stream writing to w, if the
+// latter can be flushed: Transforms set to stream their output will use it.
+func withResponseStream(ctx context.Context, w http.ResponseWriter, format configuration.XMLFormat) context.Context {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return ctx
+	}
+	stream := &responseStream{
+		w:       w,
+		flusher: flusher,
+		encoder: xml.NewEncoder(w),
+		mutex:   &sync.Mutex{},
+	}
+	if format == configuration.XMLPretty {
+		stream.encoder.Indent("", "  ")
+	}
+	return context.WithValue(ctx, streamKey{}, stream)
+}
+
+// attachStream - Stream the output of the Transform instance to the response stream of
+// the request context, if it has one and that the Transform streams its output.
+func (t *Transform) attachStream(ctx context.Context, processors []OutputProcessor) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.streamBatch == 0 || len(t.request.Entities) > 1 || ctx == nil {
+		return
+	}
+	if stream, ok := ctx.Value(streamKey{}).(*responseStream); ok {
+		stream.processors = processors
+		t.stream = stream
+	}
+}
+
+// streaming - Whether the response message of the Transform is already being streamed.
+func (t *Transform) streaming() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if t.stream == nil {
+		return false
+	}
+	t.stream.mutex.Lock()
+	defer t.stream.mutex.Unlock()
+	return t.stream.started
+}
+
+// flushStream - Process, validate and send the Entities added since the last batch, once
+// there are enough of them. Must be called with the Transform lock held.
+func (t *Transform) flushStream() {
+	if t.stream == nil || len(t.entities)-t.streamed < t.streamBatch {
+		return
+	}
+	batch := append([]Entity{}, t.entities[t.streamed:]...)
+	for _, process := range t.stream.processors {
+		batch = process(batch)
+	}
+	var problems []string
+	batch, problems = sanitizeEntities(batch)
+	for _, problem := range problems {
+		t.messages = append(t.messages, MessageUI{Text: problem, Type: "Partial"})
+	}
+	t.entities = append(t.entities[:t.streamed], batch...)
+	t.streamed = len(t.entities)
+	t.stream.write(batch)
+}
+
+// closeStream - Send the last Entities of the Transform (already processed) and
+// its UI messages, with its exceptions as error messages if it failed.
+func (t *Transform) closeStream(runErr error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	messages := append([]MessageUI{}, t.messages...)
+	if runErr != nil {
+		for _, exception := range t.exceptions {
+			messages = append(messages, MessageUI{Text: string(exception), Type: "PartialError"})
+		}
+	} else {
+		t.stream.write(t.entities[t.streamed:])
+		t.streamed = len(t.entities)
+	}
+	t.stream.close(messages)
+}
+
+// write - Write Entities to the response, opening it first if needed.
+func (s *responseStream) write(entities []Entity) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.started {
+		s.start(xml.StartElement{Name: xml.Name{Local: "MaltegoMessage"}})
+		s.start(xml.StartElement{Name: xml.Name{Local: "MaltegoTransformResponseMessage"}})
+		s.start(xml.StartElement{Name: xml.Name{Local: "Entities"}})
+		s.started = true
+	}
+	for _, entity := range entities {
+		s.encode(entity, "Entity")
+	}
+	s.flush()
+}
+
+// close - Close the Entities of the response, write the UI messages and close the response.
+func (s *responseStream) close(messages []MessageUI) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.end("Entities")
+	if len(messages) > 0 {
+		s.start(xml.StartElement{Name: xml.Name{Local: "UIMessages"}})
+		for _, message := range messages {
+			s.encode(message, "UIMessage")
+		}
+		s.end("UIMessages")
+	}
+	s.end("MaltegoTransformResponseMessage")
+	s.end("MaltegoMessage")
+	s.flush()
+}
+
+// start - Open an element of the response.
+func (s *responseStream) start(element xml.StartElement) {
+	if s.err == nil {
+		s.err = s.encoder.EncodeToken(element)
+	}
+}
+
+// end - Close an element of the response.
+func (s *responseStream) end(name string) {
+	if s.err == nil {
+		s.err = s.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+	}
+}
+
+// encode - Write a value as an element of the response.
+func (s *responseStream) encode(v interface{}, name string) {
+	if s.err == nil {
+		s.err = s.encoder.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}})
+	}
+}
+
+// flush - Send all that was written so far to the client.
+func (s *responseStream) flush() {
+	if s.err == nil {
+		s.err = s.encoder.Flush()
+	}
+	if s.err == nil {
+		s.flusher.Flush()
+	}
+}
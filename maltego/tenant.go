@@ -0,0 +1,254 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantKeyHeader - The HTTP header through which a client passes its tenant API key.
+const TenantKeyHeader = "X-API-Key"
+
+// TenantKeySetting - The name of the transform field through which a Maltego client
+// passes its tenant API key, since the Maltego client cannot set HTTP headers itself.
+const TenantKeySetting = "gondor.apikey"
+
+// ErrUnknownTenant - Returned when a server has tenants, but that
+// a request matches none of them, either by API key or by path prefix.
+var ErrUnknownTenant = errors.New("Request does not match any tenant")
+
+// Tenant - A customer team served by a shared TransformServer. Requests are attributed to
+// a tenant either by API key (see TenantKeyHeader and TenantKeySetting), or by the prefix of
+// their URL path (eg. /acme/transform/path). Each tenant has its own view of the Transforms,
+// its own settings defaults and rate limit, and the server accounts for its usage.
+//
+// When a server has no tenants, all requests are accepted and nothing is accounted for.
+type Tenant struct {
+	Name       string            // The name of the tenant, required and unique.
+	APIKeys    []string          // The API keys identifying the tenant.
+	PathPrefix string            // A URL path prefix identifying the tenant (eg. "/acme").
+	Transforms []string          // The names of the Transforms the tenant can run (all if empty).
+	Settings   map[string]string // Default values of Transform settings, overriding the Transforms' ones.
+	RateLimit  float64           // Maximum number of requests per second (0 means no limit).
+	Burst      int               // Maximum number of requests at once, defaults to the rate limit.
+
+	// Operating
+	usage  map[string]TenantUsage // Usage, per Transform name
+	tokens float64                // Token bucket for rate limiting
+	last   time.Time              // Last time the bucket was refilled
+	mutex  *sync.Mutex
+}
+
+// TenantUsage - The usage of a Transform by a Tenant.
+type TenantUsage struct {
+	Requests int           // All requests, including rejected ones.
+	Rejected int           // Requests rejected because of the rate limit or visibility.
+	Failures int           // Runs that returned an exception.
+	Entities int           // Total number of Entities returned.
+	Duration time.Duration // Total run time.
+	LastRun  time.Time     // Time of the last request.
+}
+
+// AddTenant - Register a tenant to the server. Once a server has tenants, all requests
+// must be attributable to one of them: other ones are rejected with ErrUnknownTenant.
+func (ts *TransformServer) AddTenant(tenant *Tenant) error {
+	if tenant.Name == "" {
+		return errors.New("Tenant has no name")
+	}
+	if len(tenant.APIKeys) == 0 && tenant.PathPrefix == "" {
+		return fmt.Errorf("Tenant %s has neither API keys nor path prefix", tenant.Name)
+	}
+	if tenant.PathPrefix != "" {
+		tenant.PathPrefix = "/" + strings.Trim(tenant.PathPrefix, "/")
+	}
+
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	for _, other := range ts.tenants {
+		if other.Name == tenant.Name {
+			return fmt.Errorf("Tenant %s already registered", tenant.Name)
+		}
+		if tenant.PathPrefix != "" && other.PathPrefix == tenant.PathPrefix {
+			return fmt.Errorf("Tenant %s already uses path prefix %s", other.Name, tenant.PathPrefix)
+		}
+	}
+
+	tenant.usage = map[string]TenantUsage{}
+	tenant.tokens = float64(tenant.burst())
+	tenant.last = time.Now()
+	tenant.mutex = &sync.Mutex{}
+	ts.tenants = append(ts.tenants, tenant)
+
+	// All Transforms and Jobs are reachable under the tenant prefix.
+	if tenant.PathPrefix != "" {
+		ts.mux.HandleFunc(tenant.PathPrefix+"/", ts.transformHandler)
+		ts.mux.HandleFunc(tenant.PathPrefix+JobsPath, ts.jobHandler)
+	}
+
+	return nil
+}
+
+// GetTenant - Returns the tenant registered with this name, or nil if not found.
+func (ts *TransformServer) GetTenant(name string) *Tenant {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	for _, tenant := range ts.tenants {
+		if tenant.Name == name {
+			return tenant
+		}
+	}
+	return nil
+}
+
+// CanRun - Whether the tenant can see and run the Transform with this name.
+func (t *Tenant) CanRun(name string) bool {
+	if len(t.Transforms) == 0 {
+		return true
+	}
+	for _, transform := range t.Transforms {
+		if transform == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage - Returns the usage of the tenant so far, per Transform name.
+func (t *Tenant) Usage() map[string]TenantUsage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	usage := make(map[string]TenantUsage, len(t.usage))
+	for name, u := range t.usage {
+		usage[name] = u
+	}
+	return usage
+}
+
+//
+// Tenants - Internal Implementation -----------------------------------------------------------
+//
+
+// findTenant - Returns the tenant to which a request belongs, and the request path without
+// the tenant prefix. The API key is either the one of the HTTP request, or the one passed
+// in the TenantKeySetting field. Without tenants on the server, the tenant is nil.
+func (ts *TransformServer) findTenant(path, key string, request Message) (tenant *Tenant, trimmed string, err error) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	if len(ts.tenants) == 0 {
+		return nil, path, nil
+	}
+	key = requestKey(key, request)
+
+	for _, tenant := range ts.tenants {
+		if tenant.PathPrefix != "" && strings.HasPrefix(path, tenant.PathPrefix+"/") {
+			return tenant, strings.TrimPrefix(path, tenant.PathPrefix), nil
+		}
+		if key != "" && tenant.hasKey(key) {
+			return tenant, path, nil
+		}
+	}
+
+	return nil, path, ErrUnknownTenant
+}
+
+// requestKey - Returns the API key of a request: the one of the HTTP request,
+// if any, or the one passed in the TenantKeySetting field otherwise.
+func requestKey(key string, request Message) string {
+	if key != "" {
+		return key
+	}
+	for _, setting := range request.Settings {
+		if setting.Name == TenantKeySetting && setting.Default != nil {
+			key = fmt.Sprintf("%v", setting.Default)
+		}
+	}
+	return key
+}
+
+// hasKey - Whether the API key belongs to the tenant (compared in constant time).
+func (t *Tenant) hasKey(key string) bool {
+	for _, k := range t.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// burst - The size of the rate limiting bucket.
+func (t *Tenant) burst() int {
+	if t.Burst > 0 {
+		return t.Burst
+	}
+	return int(math.Max(1, math.Ceil(t.RateLimit)))
+}
+
+// allow - Consume a token from the tenant rate limiting bucket, if available.
+func (t *Tenant) allow() bool {
+	if t.RateLimit <= 0 {
+		return true
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.tokens = math.Min(float64(t.burst()), t.tokens+now.Sub(t.last).Seconds()*t.RateLimit)
+	t.last = now
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+// account - Record the outcome of a request for a Transform.
+func (t *Tenant) account(name string, instance *Transform, rejected, failed bool, duration time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	usage := t.usage[name]
+	usage.Requests++
+	usage.LastRun = time.Now()
+	switch {
+	case rejected:
+		usage.Rejected++
+	case failed:
+		usage.Failures++
+	}
+	usage.Entities += len(instance.Entities())
+	usage.Duration += duration
+	t.usage[name] = usage
+}
+
+// setting - Returns the tenant default value for a Transform setting, if any.
+func (t *Tenant) setting(name string) (value string, found bool) {
+	if t == nil {
+		return "", false
+	}
+	value, found = t.Settings[name]
+	return
+}
@@ -23,11 +23,13 @@ package maltego
 //
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/maxlandon/gondor/maltego/configuration"
 )
@@ -43,25 +45,70 @@ import (
 // You can return an error at any time within your Tranform function implementation.
 type TransformFunc func(t *Transform) (err error)
 
+// TransformContextFunc - An alternative Transform implementation, receiving the context of
+// the request: it is canceled when the client goes away, and carries the Transform deadline
+// (see Transform.Deadline()). Pass it to your API calls and DB queries, so that they stop
+// as soon as their results are not needed anymore. Declare it with NewTransformContext().
+type TransformContextFunc func(ctx context.Context, t *Transform) (err error)
+
+// OutputProcessor - A function reshaping the output Entities of a Transform once it has
+// run successfully, for cross-cutting concerns: tagging all outputs with a classification
+// label, stripping internal-only properties, enforcing naming conventions, etc. Processors
+// can be registered on a Transform (AddProcessor()) or on a server, for all its Transforms.
+type OutputProcessor func(entities []Entity) []Entity
+
 // Transform - The base Go implementation of a Maltego transform.
 // This type holds all the information necessary to the correct registration
 // and functioning of an equivalent Maltego Client Transform, and exactly as
 // in the Python code, is NOT restricted to any type of output Entity.
 type Transform struct {
 	// Base Information
-	configuration.TransformInfo                   // The user can set this to his wish.
-	sets                        []string          // The transform sets to which the transform belongs
-	input                       ValidEntity       // The transform is passed a maltego.ValidEntity and populates this with info
-	output                      []ValidEntity     // Output entities for this transform
-	Settings                    TransformSettings // All settings for this transform, and their local configuration.
+	configuration.TransformInfo                       // The user can set this to his wish.
+	sets                        []string              // The transform sets to which the transform belongs
+	input                       ValidEntity           // The transform is passed a maltego.ValidEntity and populates this with info
+	output                      []ValidEntity         // Output entities for this transform
+	Settings                    TransformSettings     // All settings for this transform, and their local configuration.
+	processors                  []OutputProcessor     // Functions reshaping the output entities, in order.
+	middleware                  []TransformMiddleware // Layers wrapping the implementation, outermost first.
+	weights                     *WeightPolicy         // How output weights derive from the input one, if set.
+	fixture                     string                // The file of canned responses used in fixture mode, if any.
+	locales                     Localizations         // Localized display names and descriptions, by locale.
+	streamBatch                 int                   // The number of output Entities streamed at once, if streaming.
+	cacheTTL                    time.Duration         // How long successful responses are cached, if they are.
+	cacheSettings               []string              // The settings whose values are part of the cache key.
+	rateLimit                   RateLimit             // The rate at which each client can run the Transform, if limited.
+	pool                        *workerPool           // The slots of concurrent runs, shared by all instances, if limited.
+	isolation                   *Isolation            // How to run the Transform in a subprocess, if isolated.
+	async                       bool                  // The Transform runs in the background, answering with a Job.
+	asyncTimeout                time.Duration         // The maximum duration of background runs, if any.
+	dedup                       bool                  // Merge the output entities with the same type and value.
+	deprecation                 string                // Why the Transform is deprecated and what to use instead, if it is.
+	aliases                     []string              // Former URL paths at which the Transform is still served.
+	path                        string                // The URL path at which the Transform is registered, if it is.
+	authenticator               string                // The OAuth authenticator of the Transform, if any.
 
 	// Operating Parameters
-	Request    Message       // The incoming Transform request, input Entity, and all transform settings.
-	run        TransformFunc // The transform function implementation, declared and passed by the user
-	entities   []Entity      // All entities to be returned as the Transform output.
-	messages   []MessageUI   // Transform log messages
-	exceptions []Exception   // All errors throwed during execution.
-	mutex      *sync.RWMutex // Concurrency
+	request    Message          // The incoming Transform request, input Entity, and all transform settings.
+	deadline   time.Time        // The time at which the client/server will give up on this request.
+	session    *Session         // The state of the investigation, if the request belongs to one.
+	tenant     *Tenant          // The tenant running the Transform, if the server has some.
+	principal  *Principal       // The authenticated identity running the Transform, if any.
+	server     *TransformServer // The server running the Transform, for serving attachments.
+	ctx        context.Context  // The context of the request, canceled when the run is over.
+	run        TransformFunc    // The transform function implementation, declared and passed by the user
+	entities   []Entity         // All entities to be returned as the Transform output.
+	messages   []MessageUI      // Transform log messages
+	exceptions []Exception      // All errors throwed during execution.
+	dropped    int              // The number of Entities dropped because of the request slider.
+	err        error            // The error with which the run failed, if it did.
+	stream     *responseStream  // The HTTP response to which output Entities are streamed, if any.
+	streamed   int              // The number of output Entities already streamed.
+	cacheKey   string           // The key under which to cache the response, if any.
+	cached     []byte           // The cached response of the request, if found.
+	requestID  string           // The identifier of the request, for server logs.
+	callers    []string         // The Transforms running this one in-process, if any (see RunTransform()).
+	progressAt time.Time        // The time of the last progress message, if any.
+	mutex      *sync.RWMutex    // Concurrency
 }
 
 // NewTransform - Instantiate a new Transform by passing a valid Transform function
@@ -70,7 +117,7 @@ type Transform struct {
 //
 // The function allows you to pass an optional list of transform settings that you want to
 // apply to this transform AND ONLY THIS ONE. If you want global settings (applying to all
-// transforms served by an HTTP server), pass this settings to the server itself.
+// transforms served by an HTTP server), pass this settings to the server AddSetting() method.
 // You can also add settings to the Transform later, through its AddSetting() method. In all
 // cases, you should always register them BEFORE serving the Transforms to their client.
 func NewTransform(name string, run TransformFunc, settings ...TransformSetting) Transform {
@@ -80,11 +127,26 @@ func NewTransform(name string, run TransformFunc, settings ...TransformSetting)
 		run:           run,
 		mutex:         &sync.RWMutex{},
 	}
+	t.Name = name
 	t.Description = getTransformDescription(run)
+	t.Settings.Enabled = true
+	t.Settings.RunWithAll = true
+	t.Settings.settings = append(t.Settings.settings, settings...)
 
 	return t
 }
 
+// NewTransformContext - Works exactly like NewTransform(), but for an implementation receiving
+// the context of the request (see TransformContextFunc). The context is also available from
+// any Transform, with its Context() method.
+func NewTransformContext(name string, run TransformContextFunc, settings ...TransformSetting) Transform {
+	t := NewTransform(name, func(t *Transform) error {
+		return run(t.Context(), t)
+	}, settings...)
+	t.Description = getTransformDescription(run)
+	return t
+}
+
 // NewTransformWith - Declare a new Transform, with a Run implementation, an Input entity
 // type and any number of OutputEntities. The input/output entities are merely used to check
 // that we will be able to unmarshal Maltego entities into them, by verifying both types match.
@@ -99,6 +161,8 @@ func NewTransformWith(run TransformFunc, input ValidEntity, output ...ValidEntit
 		mutex:         &sync.RWMutex{},
 	}
 	t.Description = getTransformDescription(run)
+	t.Settings.Enabled = true
+	t.Settings.RunWithAll = true
 }
 
 //
@@ -108,9 +172,17 @@ func NewTransformWith(run TransformFunc, input ValidEntity, output ...ValidEntit
 // AddToSet - Include your transform in a specific set of Transforms,
 // for classification in the Maltego client. You can add your transform
 // to multiple sets, thus you can call this function multiple times.
+// Sets are described by registering them to the server (see TransformSet),
+// and can be nested by separating their names with slashes ("Recon / DNS").
 func (t *Transform) AddToSet(set string) {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
+	set = cleanSetName(set)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, existing := range t.sets {
+		if existing == set {
+			return
+		}
+	}
 	t.sets = append(t.sets, set)
 }
 
@@ -122,116 +194,655 @@ func (t *Transform) AddSetting(s TransformSetting) {
 	t.Settings.settings = append(t.Settings.settings, s)
 }
 
+// SetEnabled - Whether the Transform is enabled in the Maltego client once the configuration
+// is imported, for local Transforms (see SetLocal()). Transforms are enabled by default:
+// disable the ones that users should explicitly opt in, like those querying paid APIs.
+func (t *Transform) SetEnabled(enabled bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.Settings.Enabled = enabled
+}
+
+// SetRunWithAll - Whether the local Transform runs when the user selects "All Transforms"
+// (or a whole Transform set) in the Maltego client. This is the default: opt out for
+// Transforms that are slow, noisy or costly.
+func (t *Transform) SetRunWithAll(runWithAll bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.Settings.RunWithAll = runWithAll
+}
+
+// SetFavorite - Whether the local Transform appears in the Favorites of the Maltego client
+// context menu. Transforms are not favorites by default.
+func (t *Transform) SetFavorite(favorite bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.Settings.Favorite = favorite
+}
+
+// SetDescription - Set the description of the Transform, shown in the Maltego client.
+// By default, it is the doc comment of the Transform implementation (function or
+// method), which is only available when the program runs along its source code:
+// set it explicitly for binaries deployed without it.
+func (t *Transform) SetDescription(description string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.Description = description
+}
+
+// AddProcessor - Register a function reshaping the output Entities of the Transform,
+// after it has run successfully. Processors run in the order they have been added,
+// and before those registered on the server with TransformServer.AddProcessor().
+func (t *Transform) AddProcessor(p OutputProcessor) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.processors = append(t.processors, p)
+}
+
+// AddOutputType - Declare the types of Entities returned by the Transform, as in
+// t.AddOutputType(&Target{}, &Credential{}). They are written as the OutputEntities
+// of the configuration of local Transforms (see SetLocal()), which the Maltego client
+// uses to discover which Transforms can be run from the context menu of the Entities
+// on the graph: declare those of served Transforms on the iTDS/TDS instead.
+// Declaring a type does not prevent the Transform from returning other types.
+func (t *Transform) AddOutputType(types ...ValidEntity) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, output := range types {
+		if !t.hasOutputType(entityTypeName(output.AsEntity())) {
+			t.output = append(t.output, output)
+		}
+	}
+}
+
+// OutputTypes - Returns the fully qualified types of the Entities
+// declared as returned by the Transform (see AddOutputType()).
+func (t *Transform) OutputTypes() (types []string) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for _, output := range t.output {
+		types = append(types, entityTypeName(output.AsEntity()))
+	}
+	return
+}
+
+// hasOutputType - Returns true if the Entity type is declared as an output type.
+func (t *Transform) hasOutputType(fqType string) bool {
+	for _, output := range t.output {
+		if entityTypeName(output.AsEntity()) == fqType {
+			return true
+		}
+	}
+	return false
+}
+
 // AddEntity - Add an Entity to the list of entities to be sent in the Transform response.
 // Generally, you want to call it with either yourGoType.AsEntity() function, or directly
 // passing a maltego.Entity type when you can't/don't want to use a native Go type in the Transform.
+//
+// The Entity properties are validated first (see Entity.Validate()): if one of them is invalid,
+// the Entity is not added and the returned error is also logged as a Transform exception.
+// Before that, the fields of native Go types are marshalled into properties (see GetGoProperties()),
+// as are the link and bookmark of the Entity, and its colour overlays are computed: invalid
+// overlays are removed with a warning. The Entity and its value are also normalized (see
+// Normalizer and RegisterNormalizer()).
+//
+// Once the output holds as many Entities as the request slider (the soft limit chosen by the
+// analyst), other Entities are dropped without error, and the analyst is told to raise the
+// slider to get them. Use Full() to stop fetching results that would be dropped anyway.
 func (t *Transform) AddEntity(e ValidEntity) (err error) {
-	// Do not append the entity if the we topped
-	// the maximum allowed number of output entities.
-	if t.Request.Slider == len(t.entities) {
+	return t.addEntity(e, nil)
+}
+
+// AddEntityWithLink - Works exactly like AddEntity(), but the link between the input and
+// this output Entity is set to the given one (label, style, direction, custom fields...),
+// replacing the Link of the Entity returned by AsEntity().
+func (t *Transform) AddEntityWithLink(e ValidEntity, link Link) error {
+	return t.addEntity(e, &link)
+}
+
+// addEntity - Add an output Entity, with its link to the input if not nil.
+func (t *Transform) addEntity(e ValidEntity, link *Link) (err error) {
+	if t.Full() {
+		t.mutex.Lock()
+		t.dropped++
+		t.mutex.Unlock()
+		return
+	}
+	if normalizer, ok := e.(Normalizer); ok {
+		normalizer.Normalize()
+	}
+	entity := e.AsEntity()
+	entity.ensureInitialized()
+	if err = entity.marshalGoProperties(); err != nil {
+		return t.Errorf("Invalid %s Entity: %s", entity.Type, err)
+	}
+	if link != nil {
+		entity.Link = link.clone()
+	}
+	entity.getDisplayProperties()
+	if invalid := entity.resolveOverlays(); invalid != nil {
+		t.Warnf("%s (removed)", invalid)
+	}
+	entity.normalizeValue()
+	t.applyWeight(&entity)
+	t.trackOrigin(&entity)
+	if err = entity.Validate(); err != nil {
+		return t.Errorf("Invalid %s Entity: %s", entity.Type, err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.request.Slider > 0 && len(t.entities) >= t.request.Slider {
+		t.dropped++
 		return
 	}
+	t.entities = append(t.entities, entity)
+	t.flushStream()
+	return
+}
+
+// Full - Returns true when the output holds as many Entities as the request slider:
+// any other Entity added would be dropped. Requests without a slider are never full.
+func (t *Transform) Full() bool {
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
-	t.entities = append(t.entities)
-	return
+	return t.request.Slider > 0 && len(t.entities) >= t.request.Slider
 }
 
 // Debugf - Log an debug-level message in the Maltego transform window.
+// All these messages are also written to the server Logger, if it has one.
 func (t *Transform) Debugf(format string, args ...interface{}) {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
 	msg := fmt.Sprintf(format, args...)
+	t.mutex.Lock()
 	t.messages = append(t.messages, MessageUI{Text: msg, Type: "Debug"})
+	t.mutex.Unlock()
+	t.logf("DEBUG", msg)
 }
 
 // Infof - Log an info-level message in the Maltego transform window.
 func (t *Transform) Infof(format string, args ...interface{}) {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
 	msg := fmt.Sprintf(format, args...)
+	t.mutex.Lock()
 	t.messages = append(t.messages, MessageUI{Text: msg, Type: "Inform"})
+	t.mutex.Unlock()
+	t.logf("INFO", msg)
 }
 
 // Warnf - Log an warning-level message in the Maltego transform window.
 func (t *Transform) Warnf(format string, args ...interface{}) {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
 	msg := fmt.Sprintf(format, args...)
+	t.mutex.Lock()
 	t.messages = append(t.messages, MessageUI{Text: msg, Type: "Partial"})
+	t.mutex.Unlock()
+	t.logf("WARN", msg)
 }
 
 // Errorf - Log an error-level message in the Maltego transform window.
 // This function returns the error, so that if you want to terminate the
 // transform because of it, you can "return err" from anywhere.
 func (t *Transform) Errorf(format string, args ...interface{}) error {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
 	msg := fmt.Sprintf(format, args...)
+	t.mutex.Lock()
 	t.exceptions = append(t.exceptions, Exception(msg))
+	t.mutex.Unlock()
+	t.logf("ERROR", msg)
 	return errors.New(msg)
 }
 
+// Input - Returns the input Entity of the Transform request. This is the canonical
+// way of accessing the input Entity: query its properties, or unmarshal it into your
+// native Go type with t.Input().Unmarshal(&yourType). The Entity Value, Weight and
+// notes are accessible from it as well (t.Input().Value, t.Input().Notes(), etc).
+//
+// When a request holds several input Entities, the Transform runs once per input,
+// each run having its own input Entity here (see Inputs() and TransformServer.Concurrency).
+func (t *Transform) Input() *Entity {
+	return &t.request.Entity
+}
+
+// Inputs - Returns all the input Entities of the Transform request: clients send a single
+// one, but batch requests (eg. from a TDS) might hold several. Transforms do not need to
+// handle them themselves, since the server runs them once per input Entity.
+func (t *Transform) Inputs() []*Entity {
+	if len(t.request.Entities) == 0 {
+		return []*Entity{&t.request.Entity}
+	}
+	inputs := make([]*Entity, len(t.request.Entities))
+	for i := range t.request.Entities {
+		inputs[i] = &t.request.Entities[i]
+	}
+	return inputs
+}
+
+// InputValue - Returns the value of the input Entity of the Transform request.
+// This is a shorthand for t.Input().Value.
+func (t *Transform) InputValue() string {
+	return t.request.Entity.Value
+}
+
+// InputWeight - Returns the weight of the input Entity of the Transform request.
+func (t *Transform) InputWeight() int {
+	return t.request.Entity.Weight
+}
+
+// InputType - Returns the fully qualified type of the input Entity of the Transform
+// request (eg. maltego.Domain), as sent by the client. See also InputInherits().
+func (t *Transform) InputType() string {
+	if fqType := entityTypeName(t.request.Entity); fqType != "" {
+		return fqType
+	}
+	return t.request.Type
+}
+
+// Deadline - Returns the time by which the Transform should have returned its output,
+// derived from the client timeout hint (the TimeoutSetting field) and the server Timeout,
+// whichever comes first. Use it to budget your calls to external APIs. As with the
+// context.Context method of the same name, ok is false when no deadline is set.
+func (t *Transform) Deadline() (deadline time.Time, ok bool) {
+	return t.deadline, !t.deadline.IsZero()
+}
+
+// Context - Returns the context of the request: it is canceled when the client goes away
+// or when the run is over, and has the deadline of the Transform, if any. Pass it to your
+// API calls and DB queries so that they are canceled along with the request.
+func (t *Transform) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// Session - Returns the state of the investigation (Maltego graph) to which the request
+// belongs, for keeping data across invocations, like pagination cursors or the entities
+// already returned. The session is nil when the client did not send a SessionSetting field
+// or when the server has no SessionStore: all its methods then return ErrNoSession.
+func (t *Transform) Session() *Session {
+	return t.session
+}
+
+// Principal - Returns the authenticated identity on behalf of which the Transform runs,
+// for per-user decisions (filtering results, audit attribution, etc). It is set by
+// authentication middleware (see WithPrincipal()), from a verified TLS client certificate,
+// or from the tenant API key. The principal is nil for unauthenticated requests.
+func (t *Transform) Principal() *Principal {
+	return t.principal
+}
+
+// Tenant - Returns the tenant on behalf of which the Transform runs,
+// or nil if the server is not shared between tenants.
+func (t *Transform) Tenant() *Tenant {
+	return t.tenant
+}
+
+// Entities - Returns the Entities added so far to the Transform output.
+func (t *Transform) Entities() []Entity {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.entities
+}
+
+// Messages - Returns all UI messages logged so far by the Transform.
+func (t *Transform) Messages() []MessageUI {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.messages
+}
+
+// Exceptions - Returns all exceptions raised so far by the Transform.
+func (t *Transform) Exceptions() []Exception {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.exceptions
+}
+
+// Err - Returns the error with which the run of the Transform failed, or nil if
+// it succeeded (or did not run yet). Its output is then made of its exceptions.
+func (t *Transform) Err() error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.err
+}
+
 //
 // Transform Internal Implementation -----------------------------------------------
 //
 
+// execute - Run the user-provided implementation on this instance. If the
+// implementation returned an error without logging it with Errorf(), we add
+// it to the exceptions so that it is always passed along to the client.
+// Classified errors (UserError, ConfigError, UpstreamError) are reported
+// with their class, or as a simple message when they are not fatal.
+// If the concurrency of the Transform is limited, it first waits for a slot.
+func (t *Transform) execute() (err error) {
+	if t.pool != nil {
+		release, err := t.pool.acquire(t.Context())
+		if err != nil {
+			return t.Errorf("Transform %s is busy (%s), please retry later", t.Name, err)
+		}
+		defer release()
+	}
+	run := t.run
+	if t.isolation != nil {
+		run = (*Transform).runIsolated
+	}
+	if err = run(t); err == nil {
+		return
+	}
+	return t.raiseError(err)
+}
+
+// setErr - Record the error with which the run failed, if any (see Err()).
+func (t *Transform) setErr(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.err = err
+}
+
+// defaultConcurrency - The maximum number of concurrent runs for requests with
+// several input Entities, when the server does not set its own.
+const defaultConcurrency = 4
+
+// executeInputs - Run the implementation once per input Entity of the request, with at most
+// the server Concurrency runs at once, and gather all outputs on this instance, in the order
+// of the inputs and up to the request slider. Runs that failed are reported as warnings,
+// unless all of them failed. Requests with a single input Entity are simply executed.
+func (t *Transform) executeInputs(model *Transform, ts *TransformServer) error {
+	inputs := t.request.Entities
+	if len(inputs) <= 1 {
+		return t.execute()
+	}
+	limit := ts.Concurrency
+	if limit <= 0 {
+		limit = defaultConcurrency
+	}
+
+	runs := make([]*Transform, len(inputs))
+	errs := make([]error, len(inputs))
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+
+	for i, input := range inputs {
+		request := t.request
+		request.Entity = input
+		request.Entities = nil
+		request.Type = strings.Trim(strings.Join([]string{input.Namespace, input.Type}, "."), ".")
+		request.Weight = input.Weight
+
+		run := model.newInstanceFromRequest(request, ts)
+		run.tenant = t.tenant
+		run.principal = t.principal
+		run.ctx = t.ctx
+		run.requestID = t.requestID
+		runs[i] = run
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = runs[i].execute()
+		}(i)
+	}
+	wg.Wait()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	failed := 0
+	for i, run := range runs {
+		t.messages = append(t.messages, run.messages...)
+		if errs[i] != nil {
+			failed++
+			t.exceptions = append(t.exceptions, run.exceptions...)
+			t.messages = append(t.messages, MessageUI{
+				Text: fmt.Sprintf("Transform failed on %s: %s", inputs[i].Value, errs[i]),
+				Type: "Partial",
+			})
+			continue
+		}
+		t.dropped += run.dropped
+		for _, entity := range run.entities {
+			if t.request.Slider > 0 && len(t.entities) >= t.request.Slider {
+				t.dropped++
+				continue
+			}
+			t.entities = append(t.entities, entity)
+		}
+	}
+
+	if failed == len(runs) {
+		return fmt.Errorf("Transform failed on all %d input Entities", len(runs))
+	}
+	return nil
+}
+
+// newContext - Returns the context of a run, derived from the one of the request and
+// bounded by the Transform deadline, if any. The context must be canceled after the run.
+func (t *Transform) newContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	if deadline, ok := t.Deadline(); ok {
+		return context.WithDeadline(parent, deadline)
+	}
+	return context.WithCancel(parent)
+}
+
+// warnDropped - Tell the analyst how many Entities were dropped because
+// of the request slider, and that raising it would return them as well.
+func (t *Transform) warnDropped() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.dropped == 0 {
+		return
+	}
+	t.messages = append(t.messages, MessageUI{
+		Text: fmt.Sprintf("%d more Entities were found but not returned: raise the number of results (slider) above %d to get them",
+			t.dropped, t.request.Slider),
+		Type: "Partial",
+	})
+}
+
+// process - Pass the output Entities through all the given processors, in order.
+// Entities already streamed to the client (see SetStreaming()) have been processed already.
+func (t *Transform) process(processors []OutputProcessor) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	entities := append([]Entity{}, t.entities[t.streamed:]...)
+	for _, process := range processors {
+		entities = process(entities)
+	}
+	t.entities = append(t.entities[:t.streamed], entities...)
+}
+
+// disabled - Do not run the implementation, and answer the request with
+// an exception explaining that the Transform is temporarily disabled.
+func (t *Transform) disabled() error {
+	return t.reject(ErrTransformDisabled, "Transform %s is temporarily disabled on this server, please retry later", t.Name)
+}
+
 // newInstanceFromRequest - Instantiate a new transform instance, copying a
 // few of the fields from us (the model), and populating with a new Request.
-func (t *Transform) newInstanceFromRequest(request Message) (nt *Transform) {
+// The server provides the timeout to combine with any client hint, and the session store.
+func (t *Transform) newInstanceFromRequest(request Message, ts *TransformServer) (nt *Transform) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
+
+	// The input Entity link reflects how the previous Transform linked it.
+	request.Entity.ensureInitialized()
+	request.Entity.normalizeValue()
+	request.Value = request.Entity.Value
+	request.Entity.Link.fromProperties(request.Entity.Properties)
+	request.Entity.Bookmark = request.Entity.BookmarkColor()
+	if len(request.Entities) > 0 {
+		inputs := make([]Entity, len(request.Entities))
+		for i, input := range request.Entities {
+			input.ensureInitialized()
+			input.normalizeValue()
+			input.Link.fromProperties(input.Properties)
+			input.Bookmark = input.BookmarkColor()
+			inputs[i] = input
+		}
+		request.Entities = inputs
+	}
+
+	// The shortest of the client and server timeouts gives the deadline.
+	timeout := ts.Timeout
+	if hint := request.timeout(); hint > 0 && (timeout == 0 || hint < timeout) {
+		timeout = hint
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	// Transforms without their own weight policy use the server one.
+	weights := t.weights
+	if weights == nil {
+		weights = ts.Weights
+	}
+
+	// In fixture mode, flagged Transforms answer with their canned responses.
+	run := t.run
+	if ts.Fixtures != "" && t.fixture != "" {
+		run = fixtureRun(ts.Fixtures, t.fixture)
+	}
+
+	// Server middleware wrap those of the Transform, which inherits the server settings.
+	ts.mutex.RLock()
+	run = chainMiddleware(run, ts.middleware, t.middleware)
+	settings := inheritSettings(t.Settings, ts.settings)
+	ts.mutex.RUnlock()
+
 	return &Transform{
 		TransformInfo: t.TransformInfo,
-		Request:       request,
-		run:           t.run,
+		input:         t.input,
+		Settings:      settings,
+		processors:    t.processors,
+		weights:       weights,
+		deprecation:   t.deprecation,
+		path:          t.path,
+		streamBatch:   t.streamBatch,
+		cacheTTL:      t.cacheTTL,
+		cacheSettings: t.cacheSettings,
+		rateLimit:     t.rateLimit,
+		pool:          t.pool,
+		isolation:     t.isolation,
+		async:         t.async,
+		asyncTimeout:  t.asyncTimeout,
+		dedup:         t.dedup,
+		authenticator: t.authenticator,
+		request:       request,
+		deadline:      deadline,
+		session:       newSession(ts.Sessions, request),
+		server:        ts,
+		run:           run,
 		mutex:         &sync.RWMutex{},
 	}
 }
 
+// settingValue - Returns the string value of a setting sent along the request, or the
+// default value of the tenant or of the corresponding declared setting, if any.
+// Popup settings left empty by the analyst have their default value.
+func (t *Transform) settingValue(name string) string {
+	for _, setting := range t.request.Settings {
+		if setting.Name != name || setting.Default == nil {
+			continue
+		}
+		if value := fmt.Sprintf("%v", setting.Default); value != "" || !t.isPopupSetting(name) {
+			return value
+		}
+	}
+	if value, found := t.tenant.setting(name); found {
+		return value
+	}
+	for _, setting := range t.Settings.settings {
+		if setting.Name == name && setting.Default != nil {
+			return fmt.Sprintf("%v", setting.Default)
+		}
+	}
+	return ""
+}
+
+// isPopupSetting - Whether the Transform declares a popup setting with this name.
+func (t *Transform) isPopupSetting(name string) bool {
+	for _, setting := range t.Settings.settings {
+		if setting.Name == name {
+			return setting.Popup
+		}
+	}
+	return false
+}
+
 // marshalOutput - The transform packages the output Entities within an XML string.
-func (t *Transform) marshalOutput(runErr error) (out []byte, err error) {
+func (t *Transform) marshalOutput(runErr error, format configuration.XMLFormat) (out []byte, err error) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
 	// Message container
-	message := Message{
-		x: xml.Name{Local: "MaltegoMessage"},
-	}
+	message := Message{}
 
 	// We have either failed (and the error is already stored)
 	if runErr != nil {
-		message.Exception = TransformExceptionMessage{
+		message.Exception = &TransformExceptionMessage{
 			Exceptions: t.exceptions,
 		}
 	}
 
 	// Or succeeded, with output entities and UI messages
 	if runErr == nil {
-		message.Response = TransformResponseMessage{
-			Entities: t.entities,
+		entities := t.entities
+		if t.dedup {
+			entities = dedupEntities(entities)
+		}
+		message.Response = &TransformResponseMessage{
+			Entities: entities,
 			Messages: t.messages,
 		}
 	}
 
 	// Marshal the overall message and its content.
-	return xml.Marshal(message)
+	return configuration.Marshal(message, format)
+}
+
+// checkInputs - Verify the type of all the input Entities of the request (see checkInputEntity()).
+func (t *Transform) checkInputs() error {
+	for _, input := range t.Inputs() {
+		if err := t.checkInputEntity(*input); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Check that the Transform Input Entity native type (if any)
-// is the same type as the request Entity one.
+// checkInputEntity - Verify that an input Entity is of the type declared as the Transform
+// input (if any), or of a type inheriting from it: according to the genealogy sent by the
+// client, or to the base Entities of the Entities registered on the server. Otherwise, the
+// Transform would run with an input whose properties cannot be unmarshalled.
 func (t *Transform) checkInputEntity(input Entity) (err error) {
+	if t.input == nil {
+		return nil
+	}
 	tInput := t.input.AsEntity()
 
 	// Always check the string values of our Entities, must be enough
-	inputFQN := strings.Join([]string{input.Namespace, input.Type}, ".")
-	wantedFQN := strings.Join([]string{tInput.Namespace, tInput.Type}, ".")
-	if inputFQN != wantedFQN {
-		return fmt.Errorf("Mismatch native Go entity types: wanted %s, got %s",
-			wantedFQN, inputFQN)
+	inputFQN := entityTypeName(input)
+	wantedFQN := entityTypeName(tInput)
+	if inputFQN == "" || inputFQN == wantedFQN || inputFQN == tInput.alias() {
+		return nil
+	}
+	for _, node := range t.request.Geneaology {
+		if node.Name == wantedFQN || node.OldName == wantedFQN {
+			return nil
+		}
+	}
+	if t.server != nil && t.server.Distribution.inherits(inputFQN, wantedFQN) {
+		return nil
 	}
 
-	return nil
+	return fmt.Errorf("Transform %s expects a %s Entity as input, got a %s Entity",
+		t.Name, wantedFQN, inputFQN)
 }
 
 // marshalConfig - The transform packages itself into an XML string,
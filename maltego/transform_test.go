@@ -0,0 +1,195 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testResponse - A Transform response, decoded as the Maltego client reads it.
+type testResponse struct {
+	XMLName    xml.Name      `xml:"MaltegoMessage"`
+	Entities   []testEntity  `xml:"MaltegoTransformResponseMessage>Entities>Entity"`
+	Messages   []testMessage `xml:"MaltegoTransformResponseMessage>UIMessages>UIMessage"`
+	Exceptions []string      `xml:"MaltegoTransformExceptionMessage>Exceptions>Exception"`
+}
+
+type testEntity struct {
+	Type     string        `xml:"Type,attr"`
+	Value    string        `xml:"Value"`
+	Fields   []testField   `xml:"AdditionalFields>Field"`
+	Overlays []testOverlay `xml:"Overlays>Overlay"`
+}
+
+type testField struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type testOverlay struct {
+	Property string `xml:"property_name,attr"`
+	Position string `xml:"position,attr"`
+	Type     string `xml:"type,attr"`
+}
+
+type testMessage struct {
+	Type string `xml:"MessageType,attr"`
+	Text string `xml:",chardata"`
+}
+
+// field - Returns the value of a property of the Entity, and whether it has it.
+func (e testEntity) field(name string) (string, bool) {
+	for _, f := range e.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// newTransformRequest - Returns an HTTP request to the Transform at path,
+// with a maltego.Domain input Entity and the given slider.
+func newTransformRequest(path string, slider int) *http.Request {
+	request := fmt.Sprintf(`<MaltegoMessage><MaltegoTransformRequestMessage>`+
+		`<Entities><Entity Type="maltego.Domain"><Value>example.com</Value><Weight>100</Weight></Entity></Entities>`+
+		`<Limits SoftLimit="%d" HardLimit="%d"/></MaltegoTransformRequestMessage></MaltegoMessage>`, slider, slider)
+
+	return httptest.NewRequest("POST", path, strings.NewReader(request))
+}
+
+// serveTransform - Run a Transform through the HTTP handler of a new server, with a
+// maltego.Domain input and the given slider, and decode the response it writes.
+func serveTransform(t *testing.T, transform Transform, slider int) testResponse {
+	t.Helper()
+
+	ts := NewTransformServer(nil)
+	ts.RegisterTransform(&transform)
+
+	w := httptest.NewRecorder()
+	ts.mux.ServeHTTP(w, newTransformRequest("/"+transform.Name, slider))
+
+	var response testResponse
+	if err := xml.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response %q: %s", w.Body.String(), err)
+	}
+	return response
+}
+
+func TestAddEntityWithLink(t *testing.T) {
+	transform := NewTransform("Resolve", func(t *Transform) error {
+		link := Link{Label: "resolves to", Thickness: LineThick}
+		link.AddField(Field{Name: "record", Display: "Record", Value: "A"})
+		return t.AddEntityWithLink(NewForeignEntity("maltego.IPv4Address", "192.0.2.1"), link)
+	})
+
+	response := serveTransform(t, transform, 12)
+	if len(response.Entities) != 1 {
+		t.Fatalf("Expected 1 output Entity, got %d", len(response.Entities))
+	}
+	entity := response.Entities[0]
+	if entity.Type != "maltego.IPv4Address" || entity.Value != "192.0.2.1" {
+		t.Errorf("Unexpected output Entity %s %q", entity.Type, entity.Value)
+	}
+
+	for name, want := range map[string]string{
+		linkLabelProperty:     "resolves to",
+		linkThicknessProperty: "3",
+		"link#record":         "A",
+	} {
+		if value, found := entity.field(name); !found || value != want {
+			t.Errorf("Link property %s: got %q (found: %t), want %q", name, value, found, want)
+		}
+	}
+	if _, found := entity.field(linkColorProperty); found {
+		t.Errorf("Link property %s should not be sent when not set", linkColorProperty)
+	}
+}
+
+// addDomains - Returns a Transform adding n Domain Entities to its output,
+// and recording whether its output was full before adding each of them.
+func addDomains(n int, full *[]bool) Transform {
+	return NewTransform("Domains", func(t *Transform) error {
+		for i := 0; i < n; i++ {
+			*full = append(*full, t.Full())
+			if err := t.AddEntity(NewForeignEntity("maltego.Domain", fmt.Sprintf("%d.example.com", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestAddEntityBelowSlider(t *testing.T) {
+	var full []bool
+	response := serveTransform(t, addDomains(3, &full), 5)
+
+	if len(response.Entities) != 3 {
+		t.Fatalf("Expected 3 output Entities, got %d", len(response.Entities))
+	}
+	for i, entity := range response.Entities {
+		if want := fmt.Sprintf("%d.example.com", i); entity.Value != want {
+			t.Errorf("Output Entity %d: got %q, want %q", i, entity.Value, want)
+		}
+	}
+	for i, isFull := range full {
+		if isFull {
+			t.Errorf("Output should not be full before adding Entity %d", i)
+		}
+	}
+	if len(response.Messages) != 0 {
+		t.Errorf("Unexpected UI messages %+v", response.Messages)
+	}
+}
+
+func TestAddEntityAtSlider(t *testing.T) {
+	var full []bool
+	response := serveTransform(t, addDomains(5, &full), 2)
+
+	if len(response.Entities) != 2 {
+		t.Fatalf("Expected 2 output Entities, got %d", len(response.Entities))
+	}
+	if response.Entities[0].Value != "0.example.com" || response.Entities[1].Value != "1.example.com" {
+		t.Errorf("The first Entities should be kept, got %+v", response.Entities)
+	}
+	if want := []bool{false, false, true, true, true}; fmt.Sprint(full) != fmt.Sprint(want) {
+		t.Errorf("Full() before each Entity: got %v, want %v", full, want)
+	}
+}
+
+func TestDroppedEntitiesMessage(t *testing.T) {
+	var full []bool
+	response := serveTransform(t, addDomains(5, &full), 2)
+
+	if len(response.Messages) != 1 {
+		t.Fatalf("Expected 1 UI message, got %+v", response.Messages)
+	}
+	message := response.Messages[0]
+	if message.Type != "Partial" {
+		t.Errorf("Dropped Entities should be reported as a warning, got a %s message", message.Type)
+	}
+	if !strings.HasPrefix(message.Text, "3 more Entities were found but not returned") ||
+		!strings.Contains(message.Text, "above 2") {
+		t.Errorf("Unexpected message %q", message.Text)
+	}
+}
@@ -0,0 +1,103 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// nativeTypes - The native Go types registered for Maltego types, by fully qualified name.
+var nativeTypes = struct {
+	types map[string]reflect.Type
+	mutex *sync.RWMutex
+}{
+	types: map[string]reflect.Type{},
+	mutex: &sync.RWMutex{},
+}
+
+// RegisterType - Map a fully qualified Maltego type (eg. "maltego.Domain") to a native Go
+// type, passed as a pointer to one of its values (eg. &Domain{}). Input Entities of this type,
+// even when declared by other Maltego packages, can then be instantiated as the Go type with
+// Entity.Native() or Transform.NativeInput(), instead of querying their properties as strings.
+// Registering a Maltego type again replaces its previous Go type.
+func RegisterType(fqType string, entity ValidEntity) error {
+	goType := reflect.TypeOf(entity)
+	if goType == nil || goType.Kind() != reflect.Ptr || goType.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Invalid Go type for %s: must be a pointer to a struct, got %v", fqType, goType)
+	}
+
+	nativeTypes.mutex.Lock()
+	defer nativeTypes.mutex.Unlock()
+	nativeTypes.types[fqType] = goType.Elem()
+
+	return nil
+}
+
+// NewRegisteredType - Returns a new, zero value of the native Go type registered
+// for a fully qualified Maltego type, or false if no type is registered for it.
+func NewRegisteredType(fqType string) (entity ValidEntity, found bool) {
+	nativeTypes.mutex.RLock()
+	goType, found := nativeTypes.types[fqType]
+	nativeTypes.mutex.RUnlock()
+
+	if !found {
+		return nil, false
+	}
+	return reflect.New(goType).Interface().(ValidEntity), true
+}
+
+// Native - Instantiate the native Go type registered for the Maltego type of the
+// Entity (see RegisterType()) and unmarshal the Entity into it. If you know the
+// Go type in advance, use Entity.Unmarshal() instead, which is checked at compile-time.
+func (e *Entity) Native() (entity ValidEntity, err error) {
+	fqType := strings.Join([]string{e.Namespace, e.Type}, ".")
+
+	entity, found := NewRegisteredType(fqType)
+	if !found {
+		return nil, fmt.Errorf("No Go type registered for Maltego type %s", fqType)
+	}
+	err = e.Unmarshal(entity)
+
+	return
+}
+
+// NativeInput - Returns the input Entity unmarshalled into the native Go type registered
+// for its Maltego type or, if there is none, for the closest of its base types that has one.
+// You can then use a type switch on the result, instead of accessing string properties.
+func (t *Transform) NativeInput() (entity ValidEntity, err error) {
+	input := t.Input()
+	fqType := strings.Join([]string{input.Namespace, input.Type}, ".")
+
+	entity, found := NewRegisteredType(fqType)
+	for _, node := range t.request.Geneaology {
+		if found {
+			break
+		}
+		entity, found = NewRegisteredType(node.Name)
+	}
+	if !found {
+		return nil, fmt.Errorf("No Go type registered for Maltego type %s or its base types", fqType)
+	}
+	err = input.Unmarshal(entity)
+
+	return
+}
@@ -19,6 +19,10 @@ package maltego
 */
 
 import (
+	"encoding"
+	"fmt"
+	"net"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -54,30 +58,31 @@ func (e *Entity) unmarshalProperties(namespace string, realval reflect.Value) {
 	numFields := realval.Type().NumField()
 	for fieldCount := 0; fieldCount < numFields; fieldCount++ {
 		field := realval.Type().Field(fieldCount)
-		fieldKind := field.Type.Kind()
 		fieldVal := realval.Field(fieldCount) // Can be nil
 
-		// We can't read unexported fields, nor
-		if !field.IsExported() {
+		// We can't read unexported fields, nor those excluded by their tag.
+		if !isMarshalled(field) {
 			continue
 		}
 
-		// The base might be a ValidEntity VALUE, not a pointer to it.
-		// If that's the case, get the pointer to check implementation.
-		if fieldKind != reflect.Ptr {
-			realval = reflect.New(reflect.TypeOf(realval.Interface()))
+		// If the field is itself a struct (or a pointer to one), create
+		// a new namespace level and call this func recursively, unless
+		// it's a type that is marshalled as a single property value.
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
 		}
-
-		// Also, check that we have a working instance, because we will
-		// need to call its method, fetch attributes, etc.
-		if realval.IsNil() {
-			realval = reflect.New(realval.Type().Elem())
+		if fieldType.Kind() == reflect.Struct && !isPropertyType(fieldType) {
+			if fieldVal.Kind() == reflect.Ptr && fieldVal.IsNil() {
+				fieldVal.Set(reflect.New(fieldType))
+			}
+			e.unmarshalStruct(namespace, reflect.Indirect(fieldVal), &field)
+			continue
 		}
 
-		// If the field is itself a struct, create a new
-		// namespace level and call this func recursively.
-		if field.Type.Kind() == reflect.Struct {
-			e.unmarshalStruct(namespace, fieldVal, &field)
+		// Slices and maps of structs are rebuilt from their indexed properties.
+		if isStructCollection(field.Type) {
+			e.unmarshalCollection(getNamespace(namespace, field.Name), fieldVal)
 			continue
 		}
 
@@ -89,11 +94,115 @@ func (e *Entity) unmarshalProperties(namespace string, realval reflect.Value) {
 
 		// Else we need to find the corresponding property
 		// The value passed by maltego is given as a string here
-		fqn := strings.Join([]string{namespace, field.Name}, ".")
-		prop := e.Property(fqn)
+		prop, found := e.Properties[getNamespace(namespace, field.Name)]
+		if !found || prop.Value == nil {
+			continue
+		}
 
 		// Unmarshal the string value into the field native type.
-		convert(prop, realval)
+		convert(fmt.Sprintf("%v", prop.Value), fieldVal)
+	}
+}
+
+// unmarshalCollection - Rebuild a slice, array or map of structs from the properties
+// namespaced with the indexes or keys of its elements (eg. hosts.0.ip, hosts.1.ip).
+func (e *Entity) unmarshalCollection(namespace string, collection reflect.Value) {
+
+	// Find the indexes/keys of all elements having at least one property.
+	var keys []string
+	seen := map[string]bool{}
+	for name := range e.Properties {
+		if !strings.HasPrefix(name, namespace+".") {
+			continue
+		}
+		key := strings.SplitN(strings.TrimPrefix(name, namespace+"."), ".", 2)[0]
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	// newElement - Unmarshal the properties of an element into a new value of the element type.
+	elemType := collection.Type().Elem()
+	newElement := func(key string) reflect.Value {
+		elem := reflect.New(elemType).Elem()
+		if elemType.Kind() == reflect.Ptr {
+			elem.Set(reflect.New(elemType.Elem()))
+		}
+		e.unmarshalProperties(namespace+"."+key, reflect.Indirect(elem))
+		return elem
+	}
+
+	switch collection.Kind() {
+	case reflect.Slice, reflect.Array:
+		elements := map[int]reflect.Value{}
+		length := 0
+		for _, key := range keys {
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 {
+				continue
+			}
+			if collection.Kind() == reflect.Array && index >= collection.Len() {
+				continue
+			}
+			elements[index] = newElement(key)
+			if index >= length {
+				length = index + 1
+			}
+		}
+		if collection.Kind() == reflect.Slice {
+			collection.Set(reflect.MakeSlice(collection.Type(), length, length))
+		}
+		for index, elem := range elements {
+			collection.Index(index).Set(elem)
+		}
+
+	case reflect.Map:
+		if collection.IsNil() {
+			collection.Set(reflect.MakeMap(collection.Type()))
+		}
+		for _, key := range keys {
+			keyVal := reflect.New(collection.Type().Key()).Elem()
+			if err := convert(key, keyVal); err != nil {
+				continue
+			}
+			collection.SetMapIndex(keyVal, newElement(key))
+		}
+	}
+}
+
+// setDefaultValues - Populate all fields tagged with default:"value" and still holding
+// the zero value of their type with this value, recursively for all nested structs.
+func setDefaultValues(value reflect.Value) {
+	value = reflect.Indirect(value)
+	if value.Kind() != reflect.Struct {
+		return
+	}
+
+	numFields := value.NumField()
+	for fieldCount := 0; fieldCount < numFields; fieldCount++ {
+		field := value.Type().Field(fieldCount)
+		fieldVal := value.Field(fieldCount)
+
+		// We can't write unexported fields, nor those excluded by their tag.
+		if !isMarshalled(field) {
+			continue
+		}
+
+		// Nested structs have their own defaults, unless marshalled as a single value.
+		if indirect := reflect.Indirect(fieldVal); indirect.Kind() == reflect.Struct && !isPropertyType(indirect.Type()) {
+			setDefaultValues(fieldVal)
+			continue
+		}
+
+		defaultValue, ok := field.Tag.Lookup("default")
+		if !ok || !fieldVal.IsZero() {
+			continue
+		}
+		convert(defaultValue, fieldVal)
 	}
 }
 
@@ -107,6 +216,54 @@ func convert(val string, retval reflect.Value) error {
 
 	tp := retval.Type()
 
+	// Support for types natively marshalled as single property values.
+	switch tp {
+	case timeType:
+		if val == "" {
+			return nil
+		}
+		parsed, err := parseTime(val)
+		if err != nil {
+			return err
+		}
+		retval.Set(reflect.ValueOf(parsed))
+		return nil
+	case ipType:
+		if val == "" {
+			return nil
+		}
+		ip := net.ParseIP(val)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address: %q", val)
+		}
+		retval.Set(reflect.ValueOf(ip))
+		return nil
+	case ipNetType:
+		if val == "" {
+			return nil
+		}
+		_, ipNet, err := net.ParseCIDR(val)
+		if err != nil {
+			return err
+		}
+		retval.Set(reflect.ValueOf(*ipNet))
+		return nil
+	case urlType:
+		parsed, err := url.Parse(val)
+		if err != nil {
+			return err
+		}
+		retval.Set(reflect.ValueOf(*parsed))
+		return nil
+	}
+
+	// Types parsing themselves from text, generally through their pointer.
+	if retval.CanAddr() {
+		if unmarshaler, ok := retval.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return unmarshaler.UnmarshalText([]byte(val))
+		}
+	}
+
 	// Support for time.Duration
 	if tp == reflect.TypeOf((*time.Duration)(nil)).Elem() {
 		parsed, err := time.ParseDuration(val)
@@ -161,43 +318,60 @@ func convert(val string, retval reflect.Value) error {
 	case reflect.Slice:
 		elemtp := tp.Elem()
 
-		elemvalptr := reflect.New(elemtp)
-		elemval := reflect.Indirect(elemvalptr)
-
-		if err := convert(val, elemval); err != nil {
-			return err
+		// Bytes are sent as a string, and lists as comma-separated values.
+		if elemtp.Kind() == reflect.Uint8 {
+			retval.SetBytes([]byte(val))
+			return nil
+		}
+		if val == "" {
+			return nil
 		}
 
-		retval.Set(reflect.Append(retval, elemval))
-	case reflect.Map:
-		parts := strings.SplitN(val, ":", 2)
+		for _, item := range strings.Split(val, ",") {
+			elemvalptr := reflect.New(elemtp)
+			elemval := reflect.Indirect(elemvalptr)
 
-		key := parts[0]
-		var value string
+			if err := convert(item, elemval); err != nil {
+				return err
+			}
 
-		if len(parts) == 2 {
-			value = parts[1]
+			retval.Set(reflect.Append(retval, elemval))
+		}
+	case reflect.Map:
+		if val == "" {
+			return nil
+		}
+		if retval.IsNil() {
+			retval.Set(reflect.MakeMap(tp))
 		}
 
-		keytp := tp.Key()
-		keyval := reflect.New(keytp)
+		// Maps are sent as comma-separated key:value pairs.
+		for _, pair := range strings.Split(val, ",") {
+			parts := strings.SplitN(pair, ":", 2)
 
-		if err := convert(key, keyval); err != nil {
-			return err
-		}
+			key := parts[0]
+			var value string
 
-		valuetp := tp.Elem()
-		valueval := reflect.New(valuetp)
+			if len(parts) == 2 {
+				value = parts[1]
+			}
 
-		if err := convert(value, valueval); err != nil {
-			return err
-		}
+			keytp := tp.Key()
+			keyval := reflect.New(keytp)
 
-		if retval.IsNil() {
-			retval.Set(reflect.MakeMap(tp))
-		}
+			if err := convert(key, keyval); err != nil {
+				return err
+			}
+
+			valuetp := tp.Elem()
+			valueval := reflect.New(valuetp)
+
+			if err := convert(value, valueval); err != nil {
+				return err
+			}
 
-		retval.SetMapIndex(reflect.Indirect(keyval), reflect.Indirect(valueval))
+			retval.SetMapIndex(reflect.Indirect(keyval), reflect.Indirect(valueval))
+		}
 	case reflect.Ptr:
 		if retval.IsNil() {
 			retval.Set(reflect.New(retval.Type().Elem()))
@@ -212,3 +386,21 @@ func convert(val string, retval reflect.Value) error {
 
 	return nil
 }
+
+// parseTime - Parse a time value passed by Maltego, trying the
+// Maltego date/time formats first, and then a few standard ones.
+func parseTime(val string) (t time.Time, err error) {
+	formats := []string{
+		MaltegoDateTimeFormat,
+		"2006-01-02 15:04:05",
+		MaltegoDateFormat,
+		time.RFC3339Nano,
+		time.RFC1123Z,
+	}
+	for _, format := range formats {
+		if t, err = time.Parse(format, val); err == nil {
+			return
+		}
+	}
+	return t, fmt.Errorf("invalid date/time: %q", val)
+}
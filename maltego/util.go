@@ -23,53 +23,234 @@ import (
 	"go/doc"
 	"go/parser"
 	"go/token"
-	"log"
+	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"strings"
+	"unicode"
 )
 
 // getTransformDescription - Get a default description for a Transform,
-// based on the comment of the user-provided TransformRun function.
+// based on the comment of the user-provided TransformRun function: either a
+// top-level function, or a method (eg. Type.Do). Binaries deployed without
+// their source code have no default description (see Transform.SetDescription()).
 func getTransformDescription(f interface{}) string {
 	if f == nil {
 		return ""
 	}
-	fileName, _ := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).FileLine(0)
-	funcName := funcName(f)
-	fset := token.NewFileSet()
+	pc := reflect.ValueOf(f).Pointer()
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ""
+	}
+	receiver, name := splitFuncName(fn.Name())
+	fileName, _ := fn.FileLine(pc)
+
+	// Method values (eg. myType.Do) are wrapped in autogenerated functions:
+	// look for the method in the package of the caller, generally the one
+	// declaring the type.
+	pkg := sourceDoc(fileName)
+	if pkg == nil && receiver != "" {
+		pkg = sourceDoc(callerDir())
+	}
+	if pkg == nil {
+		return ""
+	}
 
-	// Parse src
-	parsedAst, err := parser.ParseFile(fset, fileName, nil, parser.ParseComments)
-	if err != nil {
-		log.Fatal(err)
+	if receiver == "" {
+		for _, theFunc := range pkg.Funcs {
+			if theFunc.Name == name {
+				return theFunc.Doc
+			}
+		}
 		return ""
 	}
+	for _, theType := range pkg.Types {
+		if theType.Name != receiver {
+			continue
+		}
+		for _, method := range theType.Methods {
+			if method.Name == name {
+				return method.Doc
+			}
+		}
+	}
+	return ""
+}
+
+// splitFuncName - Returns the receiver type (if any) and the name of a function, from
+// its runtime name (eg. "github.com/user/pkg.(*Type).Do-fm" gives "Type" and "Do").
+func splitFuncName(fullName string) (receiver, name string) {
+	fullName = strings.TrimSuffix(fullName, "-fm")
+	if i := strings.LastIndex(fullName, "/"); i != -1 {
+		fullName = fullName[i+1:]
+	}
+	parts := strings.Split(fullName, ".")
+	name = parts[len(parts)-1]
+	if len(parts) > 2 {
+		receiver = strings.Trim(parts[len(parts)-2], "(*)")
+	}
+	return receiver, name
+}
+
+// sourceDoc - Parse the documentation of a Go source file, or of all
+// the (non-test) files of a directory. Returns nil if there are none.
+func sourceDoc(path string) *doc.Package {
+	fset := token.NewFileSet()
+	files := map[string]*ast.File{}
+
+	if strings.HasSuffix(path, ".go") {
+		parsed, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil
+		}
+		files[path] = parsed
+	} else if path != "" {
+		notTest := func(info os.FileInfo) bool {
+			return !strings.HasSuffix(info.Name(), "_test.go")
+		}
+		pkgs, err := parser.ParseDir(fset, path, notTest, parser.ParseComments)
+		if err != nil {
+			return nil
+		}
+		for _, pkg := range pkgs {
+			for name, file := range pkg.Files {
+				files[name] = file
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
 
 	pkg := &ast.Package{
 		Name:  "Any",
-		Files: make(map[string]*ast.File),
+		Files: files,
 	}
-	pkg.Files[fileName] = parsedAst
-
 	importPath, _ := filepath.Abs("/")
-	myDoc := doc.New(pkg, importPath, doc.AllDecls)
-	for _, theFunc := range myDoc.Funcs {
-		if theFunc.Name == funcName {
-			return theFunc.Doc
+	return doc.New(pkg, importPath, doc.AllDecls)
+}
+
+// callerDir - Returns the directory of the first caller outside of this package.
+func callerDir() string {
+	self := reflect.TypeOf(Transform{}).PkgPath() + "."
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, self) {
+			return filepath.Dir(frame.File)
+		}
+		if !more {
+			return ""
 		}
 	}
-	return ""
 }
 
-// Get the name and path of a func
-func funcPathAndName(f interface{}) string {
-	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+// getNamePlural - Returns the (English) plural of
+// an Entity display name, for Entity configurations.
+func getNamePlural(name string) string {
+	if name == "" {
+		return name
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsAny(lower[len(lower)-2:len(lower)-1], "aeiou"):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+// getDisplayName - Returns the display name of an Entity type, with its camelCase name
+// split into words: "DNSToIP" gives "DNS To IP". A new word starts at an uppercase letter
+// following a lowercase letter or a digit ("ToIP"), or ending an acronym when followed by
+// a lowercase letter ("DNSTo"), except for versions like in "IPv4".
+func getDisplayName(typeName string) string {
+	runes := []rune(strings.ReplaceAll(typeName, "_", " "))
+	var name []rune
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			switch {
+			case unicode.IsLower(prev), unicode.IsDigit(prev):
+				name = append(name, ' ')
+			case unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+				if i+2 >= len(runes) || !unicode.IsDigit(runes[i+2]) {
+					name = append(name, ' ')
+				}
+			}
+		}
+		name = append(name, r)
+	}
+
+	return strings.Join(strings.Fields(string(name)), " ")
+}
+
+// typeDisplayName - Returns the display name declared by a native Go Entity type,
+// either through the EntityDisplayNamer interface, or with a display:"" tag on a
+// blank field. Returns an empty string if the type doesn't declare any.
+func typeDisplayName(data interface{}) string {
+	if namer, ok := data.(EntityDisplayNamer); ok {
+		if name := namer.EntityDisplayName(); name != "" {
+			return name
+		}
+	}
+	return typeTag(data, "display")
+}
+
+// typeNamespace - Returns the namespace declared by a native Go Entity type, either through
+// the EntityNamespacer interface or with a namespace:"" tag on a blank field, or registered
+// for its package. Otherwise, the namespace is derived from the Go module and package paths.
+func typeNamespace(data interface{}) string {
+	if namer, ok := data.(EntityNamespacer); ok {
+		if namespace := namer.EntityNamespace(); namespace != "" {
+			return namespace
+		}
+	}
+	if namespace := typeTag(data, "namespace"); namespace != "" {
+		return namespace
+	}
+
+	pkgPath := reflect.TypeOf(data).Elem().PkgPath()
+
+	packageNamespaces.mutex.RLock()
+	namespace, found := packageNamespaces.names[pkgPath]
+	packageNamespaces.mutex.RUnlock()
+	if found {
+		return namespace
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		return strings.Join([]string{bi.Main.Path, pkgPath}, "/")
+	}
+	return pkgPath
 }
 
-// Get the name of a func (with package path)
-func funcName(f interface{}) string {
-	splitFuncName := strings.Split(funcPathAndName(f), ".")
-	return splitFuncName[len(splitFuncName)-1]
+// typeTag - Returns the value of a tag on a blank field of a native Go Entity
+// type, or an empty string if the type doesn't have any such tagged field.
+func typeTag(data interface{}, tag string) string {
+	dataType := reflect.TypeOf(data)
+	for dataType != nil && dataType.Kind() == reflect.Ptr {
+		dataType = dataType.Elem()
+	}
+	if dataType == nil || dataType.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < dataType.NumField(); i++ {
+		field := dataType.Field(i)
+		if field.Name != "_" {
+			continue
+		}
+		if value, ok := field.Tag.Lookup(tag); ok && value != "" {
+			return value
+		}
+	}
+
+	return ""
 }
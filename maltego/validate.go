@@ -0,0 +1,115 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Valid characters of Entity namespaces and types. Namespaces
+// of native Go types include their package path, thus slashes.
+var (
+	entityNamespace = regexp.MustCompile(`^[A-Za-z0-9_.\-/]*$`)
+	entityType      = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+)
+
+// validateOutput - Check all output Entities before they are sent, since the Maltego
+// client silently rejects the responses it cannot parse. Invalid display settings
+// (link colors, overlays) are removed, while Entities without a value or with an
+// invalid type are not sent at all. All problems are reported as UI warnings.
+func (t *Transform) validateOutput() {
+	t.mutex.Lock()
+	valid, problems := sanitizeEntities(t.entities[t.streamed:])
+	t.entities = append(t.entities[:t.streamed], valid...)
+	t.mutex.Unlock()
+
+	for _, problem := range problems {
+		t.Warnf("%s", problem)
+	}
+}
+
+// sanitizeEntities - Sanitize Entities (see Entity.sanitize()), in place,
+// returning those that can be sent and all problems found.
+func sanitizeEntities(entities []Entity) (valid []Entity, problems []string) {
+	valid = entities[:0]
+	for _, entity := range entities {
+		entityProblems, ok := entity.sanitize()
+		problems = append(problems, entityProblems...)
+		if ok {
+			valid = append(valid, entity)
+		}
+	}
+	return valid, problems
+}
+
+// sanitize - Check that the Entity will be accepted by Maltego, removing the invalid
+// settings that can be. Returns all problems found, and false if the Entity cannot
+// be sent at all.
+func (e *Entity) sanitize() (problems []string, ok bool) {
+	e.ensureInitialized()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	name := strings.Trim(strings.Join([]string{e.Namespace, e.Type}, "."), ".")
+	if name == "" {
+		name = "(no type)"
+	}
+	ok = true
+
+	// Errors Maltego cannot recover from
+	if strings.TrimSpace(e.Value) == "" {
+		problems = append(problems, fmt.Sprintf("%s Entity not sent: empty value", name))
+		ok = false
+	}
+	if !entityNamespace.MatchString(e.Namespace) {
+		problems = append(problems, fmt.Sprintf("%s Entity not sent: invalid characters in namespace %q", name, e.Namespace))
+		ok = false
+	}
+	if !entityType.MatchString(e.Type) {
+		problems = append(problems, fmt.Sprintf("%s Entity not sent: invalid type %q", name, e.Type))
+		ok = false
+	}
+	if !ok {
+		return
+	}
+
+	// Display settings, which we can drop.
+	if e.Link.Color != "" && !isRGBColor(e.Link.Color) {
+		problems = append(problems, fmt.Sprintf("%s %s: invalid link color %q removed", name, e.Value, e.Link.Color))
+		e.Link.Color = ""
+		delete(e.Properties, linkColorProperty)
+	}
+	if property, found := e.Properties[linkColorProperty]; found {
+		color := fmt.Sprintf("%v", property.Value)
+		if color != "" && property.Value != nil && !isRGBColor(color) {
+			problems = append(problems, fmt.Sprintf("%s %s: invalid link color %q removed", name, e.Value, color))
+			delete(e.Properties, linkColorProperty)
+		}
+	}
+	for pos, overlay := range e.Overlays {
+		if err := e.validateOverlay(overlay); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %s: overlay removed: %s", name, e.Value, err))
+			delete(e.Overlays, pos)
+		}
+	}
+
+	return problems, ok
+}
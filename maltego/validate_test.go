@@ -0,0 +1,113 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"strings"
+	"testing"
+)
+
+// testHost - A native Go Entity type, whose value is its name.
+type testHost struct {
+	_      struct{} `namespace:"gondor.test"`
+	Name   string   `display:"Name"`
+	Status string   `display:"Status" overlay:"NW,colour"`
+}
+
+func (h *testHost) AsEntity() Entity {
+	e := NewEntity(h)
+	e.Value = h.Name
+	return e
+}
+
+func TestOutputValidation(t *testing.T) {
+	transform := NewTransform("Hosts", func(t *Transform) error {
+		t.AddEntity(&testHost{Status: "green"})
+		t.AddEntity(&testHost{Name: "srv1", Status: "red"})
+		return t.AddEntityWithLink(NewForeignEntity("maltego.Domain", "example.org"), Link{Color: "blue-ish"})
+	})
+
+	response := serveTransform(t, transform, 12)
+	if len(response.Entities) != 2 {
+		t.Fatalf("Expected 2 output Entities, got %d", len(response.Entities))
+	}
+
+	host := response.Entities[0]
+	if host.Type != "gondor.test.testHost" || host.Value != "srv1" {
+		t.Errorf("Unexpected output Entity %s %q", host.Type, host.Value)
+	}
+	if status, _ := host.field("status"); status != "#e53935" {
+		t.Errorf("Colour overlay property should hold an RGB code, got %q", status)
+	}
+	if len(host.Overlays) != 1 || host.Overlays[0].Property != "status" || host.Overlays[0].Position != "NW" {
+		t.Errorf("Unexpected overlays %+v", host.Overlays)
+	}
+
+	domain := response.Entities[1]
+	if _, found := domain.field(linkColorProperty); found {
+		t.Errorf("Invalid link color should have been removed")
+	}
+
+	var warnings []string
+	for _, message := range response.Messages {
+		if message.Type == "Partial" {
+			warnings = append(warnings, message.Text)
+		}
+	}
+	if len(warnings) != 2 ||
+		!strings.Contains(warnings[0], "gondor.test.testHost Entity not sent: empty value") ||
+		!strings.Contains(warnings[1], `invalid link color "blue-ish" removed`) {
+		t.Errorf("Unexpected warnings %q", warnings)
+	}
+}
+
+// testService - A native Go Entity type with a validated field.
+type testService struct {
+	_    struct{} `namespace:"gondor.test"`
+	Port string   `display:"Port" validate:"^[0-9]+$"`
+}
+
+func (s *testService) AsEntity() Entity {
+	e := NewEntity(s)
+	e.Value = "service/" + s.Port
+	return e
+}
+
+func TestValidateTag(t *testing.T) {
+	var invalid, valid error
+	transform := NewTransform("Services", func(t *Transform) error {
+		invalid = t.AddEntity(&testService{Port: "https"})
+		valid = t.AddEntity(&testService{Port: "443"})
+		return nil
+	})
+
+	response := serveTransform(t, transform, 12)
+	if invalid == nil || !strings.Contains(invalid.Error(), `value "https" does not match`) {
+		t.Errorf("Expected a validation error for the https port, got %v", invalid)
+	}
+	if valid != nil {
+		t.Errorf("Unexpected validation error: %s", valid)
+	}
+	if len(response.Entities) != 1 {
+		t.Fatalf("Expected 1 output Entity, got %d", len(response.Entities))
+	}
+	if port, _ := response.Entities[0].field("port"); port != "443" {
+		t.Errorf("Expected the 443 port in the output, got %q", port)
+	}
+}
@@ -0,0 +1,134 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetVersion - Set the semantic version of the Transform (eg. "2.1.0", "v2.1" or "2"),
+// written in its exported configuration. Its major version is part of the path at which
+// the Transform is registered (eg. /DNSToIP/v2), so that two major versions of the same
+// Transform can be served side by side during a migration, the unversioned path (eg.
+// /DNSToIP) always pointing to the highest version registered.
+func (t *Transform) SetVersion(version string) error {
+	v, err := parseVersion(version)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.Version = v.String()
+	return nil
+}
+
+// Path - Returns the URL path at which the Transform is served once registered (see
+// TransformServer.PathTemplate and RegisterTransformAt()), or would be by default: its
+// name, followed by its major version if it has a semantic version (eg. /DNSToIP/v2).
+func (t *Transform) Path() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if t.path != "" {
+		return t.path
+	}
+	return t.defaultPath()
+}
+
+// defaultPath - Returns the path of the Transform with the DefaultPathTemplate.
+// The Transform must be locked by the caller.
+func (t *Transform) defaultPath() string {
+	path := "/" + t.Name
+	if v, err := parseVersion(t.Version); err == nil {
+		path += fmt.Sprintf("/v%d", v.major)
+	}
+	return path
+}
+
+// registerVersion - Point the unversioned path of a Transform registered at a versioned
+// one to the highest version of this Transform, unless a Transform is registered there.
+func (ts *TransformServer) registerVersion(path, base string, t *Transform) {
+	if base == "" || base == path {
+		return
+	}
+	if latest, found := ts.versions[base]; found {
+		if current := ts.Transforms[latest]; current != nil && compareVersions(current.Version, t.Version) > 0 {
+			return
+		}
+	}
+	ts.route(base)
+	ts.versions[base] = path
+}
+
+// version - A semantic version (major.minor.patch).
+type version struct {
+	major, minor, patch int
+}
+
+// parseVersion - Parse a semantic version, with an optional "v" prefix and
+// optional minor and patch numbers. Pre-release and build metadata are ignored.
+func parseVersion(s string) (v version, err error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if s == "" || len(parts) > 3 {
+		return v, fmt.Errorf("Invalid semantic version %q", s)
+	}
+	numbers := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("Invalid semantic version %q", s)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// String - The version formatted as major.minor.patch.
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// compareVersions - Returns -1, 0 or 1 if the version a is lower, equal or higher than b.
+// Invalid versions are lower than any valid one.
+func compareVersions(a, b string) int {
+	va, errA := parseVersion(a)
+	vb, errB := parseVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	for _, diff := range []int{va.major - vb.major, va.minor - vb.minor, va.patch - vb.patch} {
+		if diff < 0 {
+			return -1
+		}
+		if diff > 0 {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,113 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/maxlandon/gondor/maltego/configuration"
+)
+
+// Viewlet - A small Maltego canvas widget scoring Entities on one of their properties,
+// and coloring/sizing them accordingly: eg. coloring domains by reputation score. The
+// rules are evaluated in the order they are added, and the first matching one applies.
+// Register viewlets to a Distribution, so that they are included in its configuration.
+//
+//	viewlet := maltego.NewViewlet("Reputation", "score", "maltego.Domain", "maltego.IPv4Address")
+//	viewlet.ColorRange(0, 30, "#d32f2f")
+//	viewlet.ColorRange(30, 70, "#f57c00")
+//	viewlet.ColorMatch("^unknown$", "#616161")
+type Viewlet struct {
+	Name        string   // The unique name of the viewlet.
+	DisplayName string   // Defaults to the name.
+	Description string   // A description, shown in the Maltego client.
+	Property    string   // The name of the Entity property scored by the viewlet.
+	Types       []string // The fully qualified types of Entities to score (all if empty).
+	rules       []configuration.ViewletRule
+}
+
+// NewViewlet - Declare a new Viewlet scoring the property of Entities of the given types.
+func NewViewlet(name, property string, types ...string) Viewlet {
+	return Viewlet{
+		Name:        name,
+		DisplayName: name,
+		Property:    property,
+		Types:       types,
+	}
+}
+
+// ColorRange - Color the Entities whose property value is a number within [min, max].
+func (v *Viewlet) ColorRange(min, max float64, color string) error {
+	if min > max {
+		return fmt.Errorf("Invalid viewlet range: %v > %v", min, max)
+	}
+	if !isRGBColor(color) {
+		return fmt.Errorf("Invalid viewlet color %q (eg. #45e06f)", color)
+	}
+	v.rules = append(v.rules, configuration.ViewletRule{Min: &min, Max: &max, Color: color})
+	return nil
+}
+
+// ColorMatch - Color the Entities whose property value matches a regular expression.
+func (v *Viewlet) ColorMatch(pattern, color string) error {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("Invalid viewlet pattern: %s", err)
+	}
+	if !isRGBColor(color) {
+		return fmt.Errorf("Invalid viewlet color %q (eg. #45e06f)", color)
+	}
+	v.rules = append(v.rules, configuration.ViewletRule{Match: pattern, Color: color})
+	return nil
+}
+
+// SizeRange - Size the Entities whose property value is a number within [min, max].
+// The size is relative to the default size of Entities on the graph (100).
+func (v *Viewlet) SizeRange(min, max float64, size int) error {
+	if min > max {
+		return fmt.Errorf("Invalid viewlet range: %v > %v", min, max)
+	}
+	if size <= 0 {
+		return fmt.Errorf("Invalid viewlet size %d", size)
+	}
+	v.rules = append(v.rules, configuration.ViewletRule{Min: &min, Max: &max, Size: size})
+	return nil
+}
+
+// writeConfig - The Viewlet creates a file in path/Viewlets/ViewletName.viewlet,
+// and writes itself as an XML message into it.
+func (v Viewlet) writeConfig(path string) (err error) {
+	if v.Name == "" || v.Property == "" {
+		return errors.New("Viewlet must have a name and a property")
+	}
+	cv := configuration.Viewlet{
+		Name:        v.Name,
+		DisplayName: v.DisplayName,
+		Description: v.Description,
+		Property:    v.Property,
+		EntityTypes: v.Types,
+		Rules:       v.rules,
+	}
+	if cv.DisplayName == "" {
+		cv.DisplayName = v.Name
+	}
+
+	return cv.WriteConfig(path)
+}
@@ -0,0 +1,127 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import "math"
+
+// Maltego Entity weights range from MinWeight to MaxWeight.
+const (
+	MinWeight = 0
+	MaxWeight = 100
+)
+
+// WeightPolicy - How a Transform computes the weight of its output Entities from the
+// weight of its input one: the input weight is multiplied by Factor (a decay if lower
+// than 1, a boost if greater), then Offset is added. The result is kept within the
+// [MinWeight, MaxWeight] range. Entities whose weight has been set explicitly (either
+// with Entity.SetWeight() or a non-zero Weight) are not affected by the policy.
+//
+// With Confidence set, Entities having a confidence (see Entity.SetConfidence()) are
+// weighted proportionally to it instead, from MinWeight to MaxWeight: this gives
+// consistent weights to graphs produced by many Transforms.
+//
+// A TransformServer can set a default policy, for all Transforms not having their own.
+type WeightPolicy struct {
+	Factor     float64 // Multiplies the input weight
+	Offset     int     // Added to the result
+	Confidence bool    // Weight Entities by their confidence, when they have one
+}
+
+// WeightDecay - A policy giving output Entities a fraction of the input weight.
+func WeightDecay(factor float64) WeightPolicy {
+	return WeightPolicy{Factor: factor}
+}
+
+// WeightBoost - A policy giving output Entities the input weight plus a constant.
+func WeightBoost(offset int) WeightPolicy {
+	return WeightPolicy{Factor: 1, Offset: offset}
+}
+
+// WeightByConfidence - A policy weighting output Entities proportionally to their
+// confidence, and giving the others the input weight.
+func WeightByConfidence() WeightPolicy {
+	return WeightPolicy{Factor: 1, Confidence: true}
+}
+
+// Weight - Returns the weight of an output Entity, given the weight of the input one.
+func (p WeightPolicy) Weight(input int) int {
+	return clampWeight(int(math.Round(float64(input)*p.Factor)) + p.Offset)
+}
+
+// SetWeight - Set the weight of the Entity on the graph, kept within [MinWeight, MaxWeight].
+// Unlike setting the Weight field, this marks the weight as explicit even if it is zero, so
+// that it is never overridden by the weight policy of the Transform returning the Entity.
+func (e *Entity) SetWeight(weight int) {
+	e.Weight = clampWeight(weight)
+	e.weightSet = true
+}
+
+// SetConfidence - Set how confident the Transform is in the Entity, from 0 (a guess) to 1
+// (a certainty). Weight policies with Confidence set derive the Entity weight from it.
+func (e *Entity) SetConfidence(confidence float64) {
+	e.confidence = math.Max(0, math.Min(1, confidence))
+	e.confidenceSet = true
+}
+
+// Confidence - Returns the confidence of the Entity, if one has been set with SetConfidence().
+func (e *Entity) Confidence() (confidence float64, ok bool) {
+	return e.confidence, e.confidenceSet
+}
+
+// SetWeightPolicy - Compute the weight of all output Entities of the Transform from the
+// weight of its input Entity, unless they have an explicit weight (see WeightPolicy).
+func (t *Transform) SetWeightPolicy(p WeightPolicy) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.weights = &p
+}
+
+// OutputWeight - Returns the weight that the Transform weight policy gives to output
+// Entities, or the input weight if the Transform has no policy.
+func (t *Transform) OutputWeight() int {
+	input := t.Input().Weight
+	if t.weights == nil {
+		return input
+	}
+	return t.weights.Weight(input)
+}
+
+// applyWeight - Give an output Entity the weight of the Transform policy (or of
+// its confidence, if the policy says so), unless it has an explicit one.
+func (t *Transform) applyWeight(e *Entity) {
+	if t.weights == nil || e.weightSet || e.Weight != 0 {
+		return
+	}
+	if confidence, ok := e.Confidence(); ok && t.weights.Confidence {
+		e.Weight = clampWeight(MinWeight + int(math.Round(confidence*float64(MaxWeight-MinWeight))))
+		return
+	}
+	e.Weight = t.OutputWeight()
+}
+
+// clampWeight - Keep a weight within the valid range.
+func clampWeight(weight int) int {
+	if weight < MinWeight {
+		return MinWeight
+	}
+	if weight > MaxWeight {
+		return MaxWeight
+	}
+	return weight
+}
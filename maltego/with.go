@@ -0,0 +1,126 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+//
+// Immutable Entity Construction -----------------------------------------------------------------
+//
+// The With* methods of Entities and Links never modify their receiver: they return a modified
+// deep copy of it instead (see Entity.Clone()), taken under the read lock of the Entity, while
+// its mutators (AddProperty(), AddLabel(), AddOverlay(), etc) hold its write lock. Transforms
+// emitting several variants of the same base Entity, possibly from concurrent goroutines, can
+// thus safely share that base, as long as they do not reassign its fields (eg. Value) meanwhile:
+//
+//	base := maltego.NewForeignEntity("maltego.IPv4Address", ip)
+//	for _, port := range ports {
+//		link := maltego.Link{}.WithLabel(port.Proto).WithColor(maltego.ColorRed)
+//		t.AddEntity(base.WithLink(link).WithLabel("Port", port.Banner))
+//	}
+
+// WithLink - Returns a copy of the Entity, linked to the input one with the given Link.
+func (e Entity) WithLink(link Link) Entity {
+	c := e.Clone()
+	c.Link = link.clone()
+	return c
+}
+
+// WithOverlay - Returns a copy of the Entity, with the given overlay (see AddOverlay()).
+// Invalid overlays are not added: call AddOverlay() on a clone if you need the error.
+func (e Entity) WithOverlay(value string, pos OverlayPosition, oType OverlayType) Entity {
+	c := e.Clone()
+	c.AddOverlay(value, pos, oType)
+	return c
+}
+
+// WithField - Returns a copy of the Entity, with the given property (see AddField()).
+func (e Entity) WithField(f Field) Entity {
+	c := e.Clone()
+	c.AddField(f)
+	return c
+}
+
+// WithLabel - Returns a copy of the Entity, with an additional display label (see AddLabel()).
+func (e Entity) WithLabel(title, content string) Entity {
+	c := e.Clone()
+	c.AddLabel(title, content)
+	return c
+}
+
+// WithValue - Returns a copy of the Entity, with the given value.
+func (e Entity) WithValue(value string) Entity {
+	c := e.Clone()
+	c.Value = value
+	return c
+}
+
+// WithWeight - Returns a copy of the Entity, with the given weight.
+func (e Entity) WithWeight(weight int) Entity {
+	c := e.Clone()
+	c.Weight = weight
+	return c
+}
+
+// WithLabel - Returns a copy of the Link, with the given label.
+func (l Link) WithLabel(label string) Link {
+	l = l.clone()
+	l.Label = label
+	return l
+}
+
+// WithStyle - Returns a copy of the Link, with the given line style.
+func (l Link) WithStyle(style LinkStyle) Link {
+	l = l.clone()
+	l.Style = style
+	return l
+}
+
+// WithThickness - Returns a copy of the Link, with the given line thickness.
+func (l Link) WithThickness(thickness LineThickness) Link {
+	l = l.clone()
+	l.Thickness = thickness
+	return l
+}
+
+// WithShowLabel - Returns a copy of the Link, with the given label display setting.
+func (l Link) WithShowLabel(show LinkShowLabel) Link {
+	l = l.clone()
+	l.ShowLabel = show
+	return l
+}
+
+// WithColor - Returns a copy of the Link, with the given color.
+func (l Link) WithColor(color string) Link {
+	l = l.clone()
+	l.Color = color
+	return l
+}
+
+// WithDirection - Returns a copy of the Link, with the given direction.
+func (l Link) WithDirection(direction LinkDirection) Link {
+	l = l.clone()
+	l.Direction = direction
+	return l
+}
+
+// WithField - Returns a copy of the Link, with the given custom field (see AddField()).
+func (l Link) WithField(f Field) Link {
+	l = l.clone()
+	l.AddField(f)
+	return l
+}
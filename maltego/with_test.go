@@ -0,0 +1,77 @@
+package maltego
+
+/*
+   Gondor - Go Maltego Transform Framework
+   Copyright (C) 2021 Maxime Landon
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU General Public License for more details.
+
+   You should have received a copy of the GNU General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestWithConcurrentVariants(t *testing.T) {
+	base := NewForeignEntity("maltego.IPv4Address", "192.0.2.1")
+	base.AddProperty(Field{Name: "asn", Value: "64496"})
+
+	variants := make([]Entity, 16)
+	var wg sync.WaitGroup
+	for i := range variants {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			port := fmt.Sprintf("%d", 8000+i)
+			variants[i] = base.WithLink(Link{}.WithLabel(port)).
+				WithField(Field{Name: "port", Value: port}).
+				WithLabel("Port", port).
+				WithOverlay(port, OverlayNorthWest, OverlayText)
+			variants[i].SetNote("scanned")
+		}(i)
+	}
+	wg.Wait()
+
+	if len(base.Properties) != 1 || len(base.Labels) != 0 || len(base.Overlays) != 0 {
+		t.Errorf("The base Entity was modified: %+v", base)
+	}
+	for i, variant := range variants {
+		port := fmt.Sprintf("%d", 8000+i)
+		if variant.Property("port") != port || variant.Link.Label != port || variant.Notes() != "scanned" ||
+			variant.Property("asn") != "64496" || len(variant.GetLabels()) != 1 {
+			t.Errorf("Unexpected variant %d: %+v", i, variant)
+		}
+	}
+}
+
+func TestConcurrentMutators(t *testing.T) {
+	entity := NewForeignEntity("maltego.Domain", "example.com")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entity.AddProperty(Field{Name: fmt.Sprintf("record%d", i), Value: "A"})
+			entity.AddLabel("Record", fmt.Sprintf("%d", i))
+			entity.SetNote("resolved")
+		}(i)
+	}
+	wg.Wait()
+
+	if len(entity.Properties) != 17 || len(entity.GetLabels()) != 16 {
+		t.Errorf("Expected 16 records and a note, and 16 labels: %+v", entity)
+	}
+}